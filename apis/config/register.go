@@ -34,6 +34,7 @@ var (
 // addKnownTypes registers known types to the given scheme
 func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
+		&CapacitySchedulingArgs{},
 		&CoschedulingArgs{},
 		&NodeResourcesAllocatableArgs{},
 		&TargetLoadPackingArgs{},
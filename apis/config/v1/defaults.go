@@ -27,6 +27,8 @@ import (
 )
 
 var (
+	defaultFairSharing = false
+
 	defaultPermitWaitingTimeSeconds int64 = 60
 	defaultPodGroupBackoffSeconds   int64 = 0
 
@@ -104,6 +106,13 @@ var (
 	DefaultSySchedProfileName = "all-syscalls"
 )
 
+// SetDefaults_CapacitySchedulingArgs sets the default parameters for CapacityScheduling plugin.
+func SetDefaults_CapacitySchedulingArgs(obj *CapacitySchedulingArgs) {
+	if obj.FairSharing == nil {
+		obj.FairSharing = &defaultFairSharing
+	}
+}
+
 // SetDefaults_CoschedulingArgs sets the default parameters for Coscheduling plugin.
 func SetDefaults_CoschedulingArgs(obj *CoschedulingArgs) {
 	if obj.PermitWaitingTimeSeconds == nil {
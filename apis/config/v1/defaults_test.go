@@ -35,6 +35,22 @@ func TestSchedulingDefaults(t *testing.T) {
 		config runtime.Object
 		expect runtime.Object
 	}{
+		{
+			name:   "empty config CapacitySchedulingArgs",
+			config: &CapacitySchedulingArgs{},
+			expect: &CapacitySchedulingArgs{
+				FairSharing: pointer.Bool(false),
+			},
+		},
+		{
+			name: "set non default CapacitySchedulingArgs",
+			config: &CapacitySchedulingArgs{
+				FairSharing: pointer.Bool(true),
+			},
+			expect: &CapacitySchedulingArgs{
+				FairSharing: pointer.Bool(true),
+			},
+		},
 		{
 			name:   "empty config CoschedulingArgs",
 			config: &CoschedulingArgs{},
@@ -24,6 +24,16 @@ import (
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
+// CapacitySchedulingArgs defines the scheduling parameters for CapacityScheduling plugin.
+type CapacitySchedulingArgs struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// FairSharing enables the dominant-resource fair sharing of the capacity borrowed by the ElasticQuotas.
+	FairSharing *bool `json:"fairSharing,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
 // CoschedulingArgs defines the scheduling parameters for Coscheduling plugin.
 type CoschedulingArgs struct {
 	metav1.TypeMeta `json:",inline"`
@@ -40,6 +40,16 @@ func init() {
 // RegisterConversions adds conversion functions to the given scheme.
 // Public to allow building arbitrary schemes.
 func RegisterConversions(s *runtime.Scheme) error {
+	if err := s.AddGeneratedConversionFunc((*CapacitySchedulingArgs)(nil), (*config.CapacitySchedulingArgs)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1beta3_CapacitySchedulingArgs_To_config_CapacitySchedulingArgs(a.(*CapacitySchedulingArgs), b.(*config.CapacitySchedulingArgs), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*config.CapacitySchedulingArgs)(nil), (*CapacitySchedulingArgs)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_config_CapacitySchedulingArgs_To_v1beta3_CapacitySchedulingArgs(a.(*config.CapacitySchedulingArgs), b.(*CapacitySchedulingArgs), scope)
+	}); err != nil {
+		return err
+	}
 	if err := s.AddGeneratedConversionFunc((*CoschedulingArgs)(nil), (*config.CoschedulingArgs)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1beta3_CoschedulingArgs_To_config_CoschedulingArgs(a.(*CoschedulingArgs), b.(*config.CoschedulingArgs), scope)
 	}); err != nil {
@@ -183,6 +193,30 @@ func RegisterConversions(s *runtime.Scheme) error {
 	return nil
 }
 
+func autoConvert_v1beta3_CapacitySchedulingArgs_To_config_CapacitySchedulingArgs(in *CapacitySchedulingArgs, out *config.CapacitySchedulingArgs, s conversion.Scope) error {
+	if err := v1.Convert_Pointer_bool_To_bool(&in.FairSharing, &out.FairSharing, s); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Convert_v1beta3_CapacitySchedulingArgs_To_config_CapacitySchedulingArgs is an autogenerated conversion function.
+func Convert_v1beta3_CapacitySchedulingArgs_To_config_CapacitySchedulingArgs(in *CapacitySchedulingArgs, out *config.CapacitySchedulingArgs, s conversion.Scope) error {
+	return autoConvert_v1beta3_CapacitySchedulingArgs_To_config_CapacitySchedulingArgs(in, out, s)
+}
+
+func autoConvert_config_CapacitySchedulingArgs_To_v1beta3_CapacitySchedulingArgs(in *config.CapacitySchedulingArgs, out *CapacitySchedulingArgs, s conversion.Scope) error {
+	if err := v1.Convert_bool_To_Pointer_bool(&in.FairSharing, &out.FairSharing, s); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Convert_config_CapacitySchedulingArgs_To_v1beta3_CapacitySchedulingArgs is an autogenerated conversion function.
+func Convert_config_CapacitySchedulingArgs_To_v1beta3_CapacitySchedulingArgs(in *config.CapacitySchedulingArgs, out *CapacitySchedulingArgs, s conversion.Scope) error {
+	return autoConvert_config_CapacitySchedulingArgs_To_v1beta3_CapacitySchedulingArgs(in, out, s)
+}
+
 func autoConvert_v1beta3_CoschedulingArgs_To_config_CoschedulingArgs(in *CoschedulingArgs, out *config.CoschedulingArgs, s conversion.Scope) error {
 	if err := v1.Convert_Pointer_int64_To_int64(&in.PermitWaitingTimeSeconds, &out.PermitWaitingTimeSeconds, s); err != nil {
 		return err
@@ -55,13 +55,183 @@ type ElasticQuotaSpec struct {
 	// successfully scheduled pods.
 	// +optional
 	Max v1.ResourceList `json:"max,omitempty" protobuf:"bytes,2,rep,name=max, casttype=ResourceList,castkey=ResourceName"`
+
+	// Parent refers to the parent ElasticQuota of the quota in a quota tree, e.g. the quota of a department
+	// for the quota of one of its teams. The Min and Max of the parent bound the resources used by the parent
+	// and all its descendants, and the unused Min of the parent is lent to its descendants first.
+	// If not specified, the quota is the root of its tree.
+	// +optional
+	Parent *ElasticQuotaReference `json:"parent,omitempty" protobuf:"bytes,3,opt,name=parent"`
+
+	// PodSelector selects the pods of the namespace that are subject to the quota, so that a namespace can
+	// have several quotas, e.g. one for its training pods and one for its inference pods. A pod is subject to
+	// exactly one quota. The quotas with a PodSelector take precedence over the quota without, which applies
+	// to all the other pods of the namespace, and the quota with the smallest name takes precedence among the
+	// quotas selecting the same pod. Such overlapping quotas are reported as invalid.
+	// If not specified, the quota applies to all the pods of the namespace not selected by another quota.
+	// +optional
+	PodSelector *metav1.LabelSelector `json:"podSelector,omitempty" protobuf:"bytes,4,opt,name=podSelector"`
+
+	// NamespaceSelector selects the namespaces the quota applies to instead of its own namespace, so that
+	// a single quota pools the usage of all the namespaces of a team. The quotas of the namespace of a pod
+	// take precedence over the quotas selecting its namespace, and the quota with the smallest namespace
+	// and name takes precedence among the quotas selecting the same pod. An empty selector selects all
+	// the namespaces.
+	// If not specified, the quota applies to its own namespace.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty" protobuf:"bytes,5,opt,name=namespaceSelector"`
+
+	// BorrowingLimit is the most of each named resource the quota and its descendants may use above the Min
+	// of the quota, borrowing from the unused Min of the other quotas. The resources not listed can be borrowed
+	// up to Max.
+	// +optional
+	BorrowingLimit v1.ResourceList `json:"borrowingLimit,omitempty" protobuf:"bytes,6,rep,name=borrowingLimit,casttype=ResourceList,castkey=ResourceName"`
+
+	// LendingLimit is the most of the unused Min of each named resource of the quota that the quotas outside
+	// its subtree may borrow, so that the rest of its Min is kept available for the quota scaling back up.
+	// The unused Min of the resources not listed can be lent entirely.
+	// +optional
+	LendingLimit v1.ResourceList `json:"lendingLimit,omitempty" protobuf:"bytes,7,rep,name=lendingLimit,casttype=ResourceList,castkey=ResourceName"`
+
+	// FairSharingWeight is the weight of the quota when the capacity borrowed by the quotas is shared fairly,
+	// see the fairSharing argument of the CapacityScheduling plugin. The dominant share of the quota in the
+	// borrowed capacity is divided by its weight, so that a quota of weight 2 may borrow twice as much as a
+	// quota of weight 1. Defaults to 1.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	FairSharingWeight *int32 `json:"fairSharingWeight,omitempty" protobuf:"varint,8,opt,name=fairSharingWeight"`
+
+	// Windows are recurring time windows overriding the Min and Max of the quota while they are active, e.g.
+	// to hand the resources of a team over to another one overnight. The first active window of the list is
+	// in effect. When the Max in effect drops below the usage of the quota, the least important pods of the
+	// quota and its descendants are preempted until the usage fits again.
+	// +optional
+	Windows []ElasticQuotaWindow `json:"windows,omitempty" protobuf:"bytes,9,rep,name=windows"`
+
+	// Flavors bound the resources the pods subject to the quota use on the nodes of some flavors, e.g. the
+	// nodes of a GPU model, in addition to the Min and Max of the quota. A pod is charged to the first
+	// flavor of the list selecting its node, if any. The flavors don't apply to the pods of the descendants
+	// of the quota.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Flavors []ElasticQuotaFlavor `json:"flavors,omitempty" protobuf:"bytes,10,rep,name=flavors"`
+}
+
+// ElasticQuotaFlavor is a flavor of the nodes of an ElasticQuota.
+type ElasticQuotaFlavor struct {
+	// Name of the flavor. The quotas are expected to give the same name to the flavors selecting the same nodes.
+	Name string `json:"name" protobuf:"bytes,1,opt,name=name"`
+
+	// NodeSelector selects the nodes of the flavor.
+	NodeSelector *metav1.LabelSelector `json:"nodeSelector" protobuf:"bytes,2,opt,name=nodeSelector"`
+
+	// Min is the guaranteed part of the flavor for each named resource. The quota may use more than its
+	// Min of the flavor only while the quotas with a flavor of the same name, together, use no more than
+	// the sum of their Min of the flavor.
+	// +optional
+	Min v1.ResourceList `json:"min,omitempty" protobuf:"bytes,3,rep,name=min,casttype=ResourceList,castkey=ResourceName"`
+
+	// Max is the upper bound of the flavor for each named resource. The resources not listed are unbounded.
+	// +optional
+	Max v1.ResourceList `json:"max,omitempty" protobuf:"bytes,4,rep,name=max,casttype=ResourceList,castkey=ResourceName"`
+}
+
+// Weekday is a day of the week.
+// +kubebuilder:validation:Enum=Sunday;Monday;Tuesday;Wednesday;Thursday;Friday;Saturday
+type Weekday string
+
+// ElasticQuotaWindow is a recurring time window of an ElasticQuota.
+type ElasticQuotaWindow struct {
+	// Name of the window, reported in the status of the quota while the window is active.
+	Name string `json:"name" protobuf:"bytes,1,opt,name=name"`
+
+	// Days are the days of the week the window starts on.
+	// If not specified, the window starts every day.
+	// +optional
+	Days []Weekday `json:"days,omitempty" protobuf:"bytes,2,rep,name=days,casttype=Weekday"`
+
+	// Start is the time of the day the window starts at, as HH:MM.
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+	Start string `json:"start" protobuf:"bytes,3,opt,name=start"`
+
+	// End is the time of the day the window ends at, as HH:MM. A window ending at or before its start
+	// ends on the next day.
+	// +kubebuilder:validation:Pattern=`^([01][0-9]|2[0-3]):[0-5][0-9]$`
+	End string `json:"end" protobuf:"bytes,4,opt,name=end"`
+
+	// TimeZone is the name of the time zone of Start and End in the IANA database, e.g. Europe/Paris.
+	// If not specified, the times are in UTC.
+	// +optional
+	TimeZone string `json:"timeZone,omitempty" protobuf:"bytes,5,opt,name=timeZone"`
+
+	// Min overrides the Min of the quota for each named resource while the window is active.
+	// +optional
+	Min v1.ResourceList `json:"min,omitempty" protobuf:"bytes,6,rep,name=min,casttype=ResourceList,castkey=ResourceName"`
+
+	// Max overrides the Max of the quota for each named resource while the window is active.
+	// +optional
+	Max v1.ResourceList `json:"max,omitempty" protobuf:"bytes,7,rep,name=max,casttype=ResourceList,castkey=ResourceName"`
+}
+
+// ElasticQuotaReference refers to an ElasticQuota.
+type ElasticQuotaReference struct {
+	// Namespace of the ElasticQuota.
+	Namespace string `json:"namespace" protobuf:"bytes,1,opt,name=namespace"`
+
+	// Name of the ElasticQuota.
+	Name string `json:"name" protobuf:"bytes,2,opt,name=name"`
 }
 
 // ElasticQuotaStatus defines the observed use.
 type ElasticQuotaStatus struct {
-	// Used is the current observed total usage of the resource in the namespace.
+	// Used is the current observed total usage of the resource by the pods subject to the quota.
 	// +optional
 	Used v1.ResourceList `json:"used,omitempty" protobuf:"bytes,1,rep,name=used,casttype=ResourceList,castkey=ResourceName"`
+
+	// AggregatedUsed is the current observed total usage of the resource by the quota and all its descendants.
+	// +optional
+	AggregatedUsed v1.ResourceList `json:"aggregatedUsed,omitempty" protobuf:"bytes,2,rep,name=aggregatedUsed,casttype=ResourceList,castkey=ResourceName"`
+
+	// Borrowed is the current observed usage of the resource by the quota and all its descendants above the
+	// Min of the quota.
+	// +optional
+	Borrowed v1.ResourceList `json:"borrowed,omitempty" protobuf:"bytes,3,rep,name=borrowed,casttype=ResourceList,castkey=ResourceName"`
+
+	// Lent is the current observed part of the unused Min of the resource of the quota borrowed by its
+	// siblings, i.e. the quotas with the same parent, or the other roots for a root quota. The resources
+	// borrowed by the siblings are lent by the quotas in proportion to what they can lend.
+	// +optional
+	Lent v1.ResourceList `json:"lent,omitempty" protobuf:"bytes,4,rep,name=lent,casttype=ResourceList,castkey=ResourceName"`
+
+	// Pending is the part of Used by the pods assigned to a node which don't run yet, e.g. because they
+	// are still pulling their images.
+	// +optional
+	Pending v1.ResourceList `json:"pending,omitempty" protobuf:"bytes,5,rep,name=pending,casttype=ResourceList,castkey=ResourceName"`
+
+	// Terminating is the part of Used by the pods being deleted, which hold their resources until they terminate.
+	// +optional
+	Terminating v1.ResourceList `json:"terminating,omitempty" protobuf:"bytes,6,rep,name=terminating,casttype=ResourceList,castkey=ResourceName"`
+
+	// ActiveWindow is the name of the window of the quota in effect, if any.
+	// +optional
+	ActiveWindow string `json:"activeWindow,omitempty" protobuf:"bytes,7,opt,name=activeWindow"`
+
+	// Flavors is the part of Used on the nodes of each flavor of the quota.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Flavors []ElasticQuotaFlavorStatus `json:"flavors,omitempty" protobuf:"bytes,8,rep,name=flavors"`
+}
+
+// ElasticQuotaFlavorStatus is the observed use of a flavor of an ElasticQuota.
+type ElasticQuotaFlavorStatus struct {
+	// Name of the flavor.
+	Name string `json:"name" protobuf:"bytes,1,opt,name=name"`
+
+	// Used is the current observed usage of the resource by the pods subject to the quota on the nodes of the flavor.
+	// +optional
+	Used v1.ResourceList `json:"used,omitempty" protobuf:"bytes,2,rep,name=used,casttype=ResourceList,castkey=ResourceName"`
 }
 
 // +kubebuilder:object:root=true
@@ -107,6 +277,60 @@ const (
 
 	// PodGroupLabel is the default label of coscheduling
 	PodGroupLabel = scheduling.GroupName + "/pod-group"
+
+	// PodGroupRoleLabel is the label of the role of a pod in its pod group
+	PodGroupRoleLabel = scheduling.GroupName + "/role"
+)
+
+// These are the annotations of the workloads, e.g. Jobs, the controller creates pod groups for.
+const (
+	// PodGroupCreateAnnotation opts a workload in the automatic creation of its pod group when set to "true".
+	PodGroupCreateAnnotation = scheduling.GroupName + "/create-pod-group"
+
+	// PodGroupMinMemberAnnotation overrides the minMember of the pod group created for a workload.
+	PodGroupMinMemberAnnotation = scheduling.GroupName + "/min-member"
+)
+
+// PodGroupSchedulable is the type of the condition written by the scheduler to tell
+// whether the pod group can be scheduled, and why not.
+const PodGroupSchedulable = "Schedulable"
+
+// These are the reasons of the PodGroupSchedulable condition.
+const (
+	// PodGroupReasonScheduled means the quorum of the pod group has been scheduled.
+	PodGroupReasonScheduled = "Scheduled"
+
+	// PodGroupReasonNotEnoughMembers means the pod group has less pods than its `spec.minMember`,
+	// or than the minMember of one of its roles.
+	PodGroupReasonNotEnoughMembers = "NotEnoughMembers"
+
+	// PodGroupReasonInsufficientResources means the cluster, or its topology domains, cannot
+	// accommodate the pod group.
+	PodGroupReasonInsufficientResources = "InsufficientResources"
+
+	// PodGroupReasonUnschedulable means a member of the pod group cannot be placed on any node.
+	PodGroupReasonUnschedulable = "Unschedulable"
+
+	// PodGroupReasonBackedOff means the pod group failed to be scheduled recently and is backed off.
+	PodGroupReasonBackedOff = "BackedOff"
+
+	// PodGroupReasonPermitTimeout means the members of the pod group timed out waiting for their
+	// siblings in Permit.
+	PodGroupReasonPermitTimeout = "PermitTimeout"
+)
+
+// PodGroupFailedCondition is the type of the condition written by the controller to tell
+// why the pod group reached the Failed phase.
+const PodGroupFailedCondition = "Failed"
+
+// These are the reasons of the PodGroupFailedCondition condition.
+const (
+	// PodGroupReasonMemberFailed means a member of the pod group failed.
+	PodGroupReasonMemberFailed = "MemberFailed"
+
+	// PodGroupReasonScheduleTimeout means no member of the pod group was bound within the schedule timeout
+	// of the controller.
+	PodGroupReasonScheduleTimeout = "ScheduleTimeout"
 )
 
 // PodGroup is a collection of Pod; used for batch workload.
@@ -139,6 +363,12 @@ type PodGroupSpec struct {
 	// will not start anyone.
 	MinMember int32 `json:"minMember,omitempty"`
 
+	// MaxMember defines the maximal number of members/tasks of the pod group. Once MinMember
+	// members are scheduled, the extra members are scheduled individually up to MaxMember.
+	// If not specified, the number of members is not limited.
+	// +optional
+	MaxMember *int32 `json:"maxMember,omitempty"`
+
 	// MinResources defines the minimal resource of members/tasks to run the pod group;
 	// if there's not enough resources to start all tasks, the scheduler
 	// will not start anyone.
@@ -146,6 +376,105 @@ type PodGroupSpec struct {
 
 	// ScheduleTimeoutSeconds defines the maximal time of members/tasks to wait before run the pod group;
 	ScheduleTimeoutSeconds *int32 `json:"scheduleTimeoutSeconds,omitempty"`
+
+	// TTLSecondsAfterFinished limits the lifetime of a pod group that has finished or failed.
+	// The controller deletes the pod group TTLSecondsAfterFinished seconds after it completed.
+	// If not specified, the default of the controller applies, which keeps the pod group by default.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+
+	// TopologyConstraint defines the topology domain (e.g. zone, rack) all members of the pod group
+	// should be placed in. If not specified, members can be placed anywhere in the cluster.
+	// +optional
+	TopologyConstraint *TopologyConstraint `json:"topologyConstraint,omitempty"`
+
+	// Roles defines the minimal members of the roles inside the pod group, e.g. 1 launcher and 8 workers.
+	// The role of a pod is the value of its `scheduling.x-k8s.io/role` label. The pod group
+	// is only scheduled once the minMember of every role is met, in addition to MinMember.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Roles []PodGroupRole `json:"roles,omitempty"`
+
+	// FailurePolicy defines what the controller does once a member of the pod group fails.
+	// If not specified, the pod group is only marked as Failed.
+	// +optional
+	FailurePolicy *FailurePolicy `json:"failurePolicy,omitempty"`
+}
+
+// PodGroupRole defines the minimal members of a role inside a pod group.
+type PodGroupRole struct {
+	// Name of the role, matched against the `scheduling.x-k8s.io/role` label of the pods.
+	Name string `json:"name"`
+
+	// MinMember defines the minimal number of pods of the role to run the pod group.
+	MinMember int32 `json:"minMember"`
+
+	// MinResources defines the minimal resource of the pods of the role to run the pod group.
+	// +optional
+	MinResources v1.ResourceList `json:"minResources,omitempty"`
+}
+
+// TopologyConstraintMode is the mode a TopologyConstraint is enforced with.
+// +kubebuilder:validation:Enum=Required;Preferred
+type TopologyConstraintMode string
+
+const (
+	// TopologyConstraintRequired means the members of the pod group are only placed in a single
+	// topology domain; the pod group stays pending if no domain can accommodate it.
+	TopologyConstraintRequired TopologyConstraintMode = "Required"
+
+	// TopologyConstraintPreferred means the members of the pod group are placed in a single
+	// topology domain if one can accommodate it; otherwise they can be placed anywhere.
+	TopologyConstraintPreferred TopologyConstraintMode = "Preferred"
+)
+
+// TopologyConstraint defines the topology domain all members of a pod group should be placed in.
+type TopologyConstraint struct {
+	// TopologyKey is the key of node labels. Nodes that have a label with this key
+	// and identical values are considered to be in the same topology domain.
+	TopologyKey string `json:"topologyKey"`
+
+	// Mode is either Required or Preferred. Defaults to Required.
+	// +optional
+	// +kubebuilder:default=Required
+	Mode TopologyConstraintMode `json:"mode,omitempty"`
+}
+
+// FailurePolicyAction is the action taken once a member of a pod group fails.
+// +kubebuilder:validation:Enum=None;RestartGroup;FailGroup
+type FailurePolicyAction string
+
+const (
+	// FailurePolicyNone means the pod group is marked as Failed, its members are left untouched.
+	FailurePolicyNone FailurePolicyAction = "None"
+
+	// FailurePolicyRestartGroup means all the members of the pod group are deleted, so that their
+	// owners recreate them, and the pod group gets scheduled again. Once the restarts are exhausted,
+	// the pod group fails as with FailGroup.
+	FailurePolicyRestartGroup FailurePolicyAction = "RestartGroup"
+
+	// FailurePolicyFailGroup means the pod group is marked as Failed and its remaining members
+	// are deleted.
+	FailurePolicyFailGroup FailurePolicyAction = "FailGroup"
+)
+
+// DefaultMaxRestarts is the maximal number of restarts of a pod group if not specified.
+const DefaultMaxRestarts int32 = 3
+
+// FailurePolicy defines what happens to a pod group once one of its members fails.
+type FailurePolicy struct {
+	// Action is either None, RestartGroup or FailGroup. Defaults to None.
+	// +optional
+	// +kubebuilder:default=None
+	Action FailurePolicyAction `json:"action,omitempty"`
+
+	// MaxRestarts defines the maximal number of restarts of the pod group with the RestartGroup
+	// action. Defaults to 3.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	MaxRestarts *int32 `json:"maxRestarts,omitempty"`
 }
 
 // PodGroupStatus represents the current state of a pod group.
@@ -171,6 +500,53 @@ type PodGroupStatus struct {
 
 	// ScheduleStartTime of the group
 	ScheduleStartTime metav1.Time `json:"scheduleStartTime,omitempty"`
+
+	// The number of pods scheduled beyond MinMember.
+	// +optional
+	ScheduledBeyondMin int32 `json:"scheduledBeyondMin,omitempty"`
+
+	// RoleStatuses reports the number of pods per role of the pod group.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	RoleStatuses []PodGroupRoleStatus `json:"roleStatuses,omitempty"`
+
+	// The number of times the pod group was restarted by its failure policy.
+	// +optional
+	Restarts int32 `json:"restarts,omitempty"`
+
+	// LastRestartTime is the time the failure policy last restarted the pod group. The pods created before
+	// belong to the previous run of the pod group and get deleted.
+	// +optional
+	LastRestartTime *metav1.Time `json:"lastRestartTime,omitempty"`
+
+	// CompletionTime is the time the pod group reached the Finished or Failed phase.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Conditions represent the latest observations of the scheduler about the pod group.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// PodGroupRoleStatus represents the current state of the pods of a role inside a pod group.
+type PodGroupRoleStatus struct {
+	// Name of the role.
+	Name string `json:"name"`
+
+	// The number of actively running pods of the role.
+	// +optional
+	Running int32 `json:"running,omitempty"`
+
+	// The number of pods of the role which reached phase Succeeded.
+	// +optional
+	Succeeded int32 `json:"succeeded,omitempty"`
+
+	// The number of pods of the role which reached phase Failed.
+	// +optional
+	Failed int32 `json:"failed,omitempty"`
 }
 
 // +kubebuilder:object:root=true
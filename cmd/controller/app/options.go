@@ -17,6 +17,8 @@ limitations under the License.
 package app
 
 import (
+	"time"
+
 	"github.com/spf13/pflag"
 )
 
@@ -27,6 +29,13 @@ type ServerRunOptions struct {
 	ApiServerBurst       int
 	Workers              int
 	EnableLeaderElection bool
+	EnableAutoPodGroup   bool
+	AutoPodGroupKinds    []string
+	EnableWebhooks       bool
+	WebhookCertDir       string
+
+	PodGroupScheduleTimeout         time.Duration
+	PodGroupTTLSecondsAfterFinished int32
 }
 
 func NewServerRunOptions() *ServerRunOptions {
@@ -42,4 +51,10 @@ func (s *ServerRunOptions) addAllFlags() {
 	pflag.IntVar(&s.ApiServerBurst, "burst", 10, "burst of query apiserver.")
 	pflag.IntVar(&s.Workers, "workers", 1, "workers of scheduler-plugin-controllers.")
 	pflag.BoolVar(&s.EnableLeaderElection, "enableLeaderElection", s.EnableLeaderElection, "If EnableLeaderElection for controller.")
+	pflag.BoolVar(&s.EnableAutoPodGroup, "enableAutoPodGroup", s.EnableAutoPodGroup, "If the controller creates the pod groups of the annotated Jobs, and labels their pods through a mutating webhook.")
+	pflag.DurationVar(&s.PodGroupScheduleTimeout, "podGroupScheduleTimeout", 48*time.Hour, "Time to wait for the first member of a pod group to be bound to a node, once its members are created, before marking it as Failed. It is unrelated to the scheduleTimeoutSeconds of the pod groups, which bound their wait in Permit. 0 means no timeout.")
+	pflag.Int32Var(&s.PodGroupTTLSecondsAfterFinished, "podGroupTTLSecondsAfterFinished", -1, "Default time, in seconds, finished and failed pod groups are kept before being deleted, unless they set their ttlSecondsAfterFinished. A negative value means they are kept.")
+	pflag.BoolVar(&s.EnableWebhooks, "enableWebhooks", s.EnableWebhooks, "If the controller serves the validating and defaulting webhooks of the ElasticQuotas and PodGroups.")
+	pflag.StringVar(&s.WebhookCertDir, "webhookCertDir", "/tmp/k8s-webhook-server/serving-certs", "Directory of the tls.crt and tls.key serving certificate of the webhook server.")
+	pflag.StringSliceVar(&s.AutoPodGroupKinds, "autoPodGroupKinds", nil, "Kinds of workloads, other than Jobs, to create pod groups for, in the Kind.version.group format, e.g. StatefulSet.v1.apps.")
 }
@@ -17,13 +17,19 @@ limitations under the License.
 package app
 
 import (
+	"context"
+	"fmt"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/klog/v2/klogr"
 
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	schedulingv1a1 "sigs.k8s.io/scheduler-plugins/apis/scheduling/v1alpha1"
 	"sigs.k8s.io/scheduler-plugins/pkg/controllers"
@@ -50,7 +56,7 @@ func Run(s *ServerRunOptions) error {
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                  scheme,
 		MetricsBindAddress:      s.MetricsAddr,
-		Port:                    9443,
+		WebhookServer:           webhook.NewServer(webhook.Options{Port: 9443, CertDir: s.WebhookCertDir}),
 		HealthProbeBindAddress:  s.ProbeAddr,
 		LeaderElection:          s.EnableLeaderElection,
 		LeaderElectionID:        "sched-plugins-controllers",
@@ -61,11 +67,16 @@ func Run(s *ServerRunOptions) error {
 		return err
 	}
 
-	if err = (&controllers.PodGroupReconciler{
-		Client:  mgr.GetClient(),
-		Scheme:  mgr.GetScheme(),
-		Workers: s.Workers,
-	}).SetupWithManager(mgr); err != nil {
+	pgReconciler := &controllers.PodGroupReconciler{
+		Client:          mgr.GetClient(),
+		Scheme:          mgr.GetScheme(),
+		Workers:         s.Workers,
+		ScheduleTimeout: s.PodGroupScheduleTimeout,
+	}
+	if s.PodGroupTTLSecondsAfterFinished >= 0 {
+		pgReconciler.DefaultTTLSecondsAfterFinished = &s.PodGroupTTLSecondsAfterFinished
+	}
+	if err = pgReconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "PodGroup")
 		return err
 	}
@@ -79,6 +90,54 @@ func Run(s *ServerRunOptions) error {
 		return err
 	}
 
+	if s.EnableAutoPodGroup {
+		gvks := []schema.GroupVersionKind{controllers.JobGVK}
+		for _, kind := range s.AutoPodGroupKinds {
+			gvk, _ := schema.ParseKindArg(kind)
+			if gvk == nil {
+				err := fmt.Errorf("invalid kind %q, expected the Kind.version.group format", kind)
+				setupLog.Error(err, "unable to create controller", "controller", "Workload")
+				return err
+			}
+			if err := checkWorkloadAccess(context.Background(), mgr, *gvk); err != nil {
+				setupLog.Error(err, "unable to create controller", "controller", "Workload", "kind", gvk)
+				return err
+			}
+			gvks = append(gvks, *gvk)
+		}
+		for _, gvk := range gvks {
+			if err = (&controllers.WorkloadReconciler{
+				Client:  mgr.GetClient(),
+				Scheme:  mgr.GetScheme(),
+				Workers: s.Workers,
+				GVK:     gvk,
+			}).SetupWithManager(mgr); err != nil {
+				setupLog.Error(err, "unable to create controller", "controller", "Workload", "kind", gvk)
+				return err
+			}
+		}
+		if err = (&controllers.PodGroupLabeler{
+			Client: mgr.GetClient(),
+			GVKs:   gvks,
+		}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Pod")
+			return err
+		}
+	}
+
+	if s.EnableWebhooks {
+		if err = (&controllers.ElasticQuotaWebhook{
+			Client: mgr.GetClient(),
+		}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ElasticQuota")
+			return err
+		}
+		if err = (&controllers.PodGroupWebhook{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "PodGroup")
+			return err
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		return err
@@ -94,3 +153,32 @@ func Run(s *ServerRunOptions) error {
 	}
 	return nil
 }
+
+// checkWorkloadAccess makes sure the controller is granted access to the workloads of the given kind.
+// Otherwise their informer would keep failing in the background and their pods would silently be left
+// without pod group, since the pod labeler ignores its errors.
+func checkWorkloadAccess(ctx context.Context, mgr ctrl.Manager, gvk schema.GroupVersionKind) error {
+	mapping, err := mgr.GetRESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return err
+	}
+	for _, verb := range []string{"get", "list", "watch"} {
+		review := &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Verb:     verb,
+					Group:    gvk.Group,
+					Version:  gvk.Version,
+					Resource: mapping.Resource.Resource,
+				},
+			},
+		}
+		if err := mgr.GetClient().Create(ctx, review); err != nil {
+			return err
+		}
+		if !review.Status.Allowed {
+			return fmt.Errorf("the controller isn't allowed to %s %s, grant it access in its ClusterRole", verb, mapping.Resource.GroupResource())
+		}
+	}
+	return nil
+}
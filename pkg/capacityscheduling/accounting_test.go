@@ -0,0 +1,169 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package capacityscheduling
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	quota "k8s.io/apiserver/pkg/quota/v1"
+	"k8s.io/client-go/informers"
+	clientsetfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+	st "k8s.io/kubernetes/pkg/scheduler/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"sigs.k8s.io/scheduler-plugins/apis/scheduling/v1alpha1"
+	"sigs.k8s.io/scheduler-plugins/pkg/controllers"
+	"sigs.k8s.io/scheduler-plugins/pkg/util"
+)
+
+// TestElasticQuotaAccounting checks that the plugin and the ElasticQuota controller agree on the usage of
+// the quotas, while the pods go through their lifecycle.
+func TestElasticQuotaAccounting(t *testing.T) {
+	cpu := func(milliCPU int64) v1.ResourceList {
+		return v1.ResourceList{v1.ResourceCPU: *resource.NewMilliQuantity(milliCPU, resource.DecimalSI)}
+	}
+	makeEQ := func(name string, podSelector *metav1.LabelSelector) *v1alpha1.ElasticQuota {
+		return &v1alpha1.ElasticQuota{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: name},
+			Spec: v1alpha1.ElasticQuotaSpec{
+				Min:         cpu(4000),
+				Max:         cpu(10000),
+				PodSelector: podSelector,
+			},
+		}
+	}
+	elasticQuotas := []*v1alpha1.ElasticQuota{
+		makeEQ("default", nil),
+		makeEQ("training", &metav1.LabelSelector{MatchLabels: map[string]string{"app": "training"}}),
+	}
+	makePod := func(name, nodeName string, phase v1.PodPhase) *st.PodWrapper {
+		return st.MakePod().Namespace("ns1").Name(name).UID(name).Node(nodeName).Phase(phase)
+	}
+	terminating := makePod("terminating", "node-a", v1.PodRunning).Req(map[v1.ResourceName]string{v1.ResourceCPU: "300m"}).Terminating().Obj()
+	terminating.Finalizers = []string{"example.com/finalizer"}
+
+	steps := []struct {
+		name string
+		pods []*v1.Pod
+		// used is the expected usage of the quotas, in milli CPU.
+		used map[string]int64
+	}{
+		{
+			name: "pods created",
+			pods: []*v1.Pod{
+				makePod("running", "node-a", v1.PodRunning).Req(map[v1.ResourceName]string{v1.ResourceCPU: "1"}).
+					Overhead(cpu(100)).Obj(),
+				makePod("pulling", "node-a", v1.PodPending).Label("app", "training").
+					InitReq(map[v1.ResourceName]string{v1.ResourceCPU: "2"}).Req(map[v1.ResourceName]string{v1.ResourceCPU: "500m"}).Obj(),
+				makePod("unscheduled", "", v1.PodPending).Req(map[v1.ResourceName]string{v1.ResourceCPU: "700m"}).Obj(),
+				terminating,
+				makePod("succeeded", "node-a", v1.PodSucceeded).Req(map[v1.ResourceName]string{v1.ResourceCPU: "400m"}).Obj(),
+			},
+			used: map[string]int64{"ns1/default": 1400, "ns1/training": 2000},
+		},
+		{
+			name: "pods progressed",
+			pods: []*v1.Pod{
+				makePod("running", "node-a", v1.PodFailed).Req(map[v1.ResourceName]string{v1.ResourceCPU: "1"}).
+					Overhead(cpu(100)).Obj(),
+				makePod("pulling", "node-a", v1.PodRunning).Label("app", "training").
+					InitReq(map[v1.ResourceName]string{v1.ResourceCPU: "2"}).Req(map[v1.ResourceName]string{v1.ResourceCPU: "500m"}).Obj(),
+				makePod("unscheduled", "node-b", v1.PodPending).Req(map[v1.ResourceName]string{v1.ResourceCPU: "700m"}).Obj(),
+				makePod("succeeded", "node-a", v1.PodSucceeded).Req(map[v1.ResourceName]string{v1.ResourceCPU: "400m"}).Obj(),
+				makePod("training", "node-b", v1.PodRunning).Label("app", "training").
+					Req(map[v1.ResourceName]string{v1.ResourceCPU: "500m"}).Obj(),
+			},
+			used: map[string]int64{"ns1/default": 700, "ns1/training": 2500},
+		},
+	}
+
+	ctx := context.TODO()
+	cs := &CapacityScheduling{
+		elasticQuotaInfos: NewElasticQuotaInfos(),
+		podLister:         informers.NewSharedInformerFactory(clientsetfake.NewSimpleClientset(), 0).Core().V1().Pods().Lister(),
+	}
+	for _, eq := range elasticQuotas {
+		cs.addElasticQuota(eq)
+	}
+	handler := cs.podEventHandler()
+	var previous []*v1.Pod
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			// The plugin gets the changes of the pods, while the controller lists them.
+			for _, pod := range step.pods {
+				if old := findPod(previous, pod.Name); old != nil {
+					handler.OnUpdate(old, pod)
+				} else {
+					handler.OnAdd(pod, false)
+				}
+			}
+			for _, pod := range previous {
+				if findPod(step.pods, pod.Name) == nil {
+					handler.OnDelete(pod)
+				}
+			}
+			previous = step.pods
+
+			builder := fake.NewClientBuilder().WithScheme(scheme).WithStatusSubresource(&v1alpha1.ElasticQuota{})
+			for _, eq := range elasticQuotas {
+				builder.WithObjects(eq.DeepCopy())
+			}
+			for _, pod := range step.pods {
+				builder.WithObjects(pod.DeepCopy())
+			}
+			client := builder.Build()
+			reconciler := controllers.NewElasticQuotaReconciler(client, scheme, record.NewFakeRecorder(10))
+			for _, eq := range elasticQuotas {
+				if _, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: eq.Namespace, Name: eq.Name}}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, eq := range elasticQuotas {
+				key := getElasticQuotaKey(eq.Namespace, eq.Name)
+				got := &v1alpha1.ElasticQuota{}
+				if err := client.Get(ctx, types.NamespacedName{Namespace: eq.Namespace, Name: eq.Name}, got); err != nil {
+					t.Fatal(err)
+				}
+				controllerUsed := quota.RemoveZeros(got.Status.Used)
+				pluginUsed := quota.RemoveZeros(util.ResourceList(cs.elasticQuotaInfos[key].Used))
+				if !quota.Equals(controllerUsed, pluginUsed) {
+					t.Errorf("%v: the controller counts %v, the plugin counts %v", key, controllerUsed, pluginUsed)
+				}
+				if want := quota.RemoveZeros(cpu(step.used[key])); !quota.Equals(pluginUsed, want) {
+					t.Errorf("%v: want %v, got %v", key, want, pluginUsed)
+				}
+			}
+		})
+	}
+}
+
+func findPod(pods []*v1.Pod, name string) *v1.Pod {
+	for _, pod := range pods {
+		if pod.Name == name {
+			return pod
+		}
+	}
+	return nil
+}
@@ -19,16 +19,20 @@ package capacityscheduling
 import (
 	"context"
 	"fmt"
+	"reflect"
 	"sort"
 	"sync"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
 	policy "k8s.io/api/policy/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	quota "k8s.io/apiserver/pkg/quota/v1"
 	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	corelisters "k8s.io/client-go/listers/core/v1"
 	policylisters "k8s.io/client-go/listers/policy/v1"
@@ -40,11 +44,16 @@ import (
 	"k8s.io/kubernetes/pkg/scheduler/framework/preemption"
 	"k8s.io/kubernetes/pkg/scheduler/metrics"
 	schedutil "k8s.io/kubernetes/pkg/scheduler/util"
+	"k8s.io/utils/clock"
 	ctrlruntimecache "sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
+	"sigs.k8s.io/scheduler-plugins/apis/config"
 	"sigs.k8s.io/scheduler-plugins/apis/scheduling"
 	"sigs.k8s.io/scheduler-plugins/apis/scheduling/v1alpha1"
+	"sigs.k8s.io/scheduler-plugins/pkg/generated/clientset/versioned"
+	schedinformer "sigs.k8s.io/scheduler-plugins/pkg/generated/informers/externalversions"
+	schedlisters "sigs.k8s.io/scheduler-plugins/pkg/generated/listers/scheduling/v1alpha1"
 	"sigs.k8s.io/scheduler-plugins/pkg/util"
 )
 
@@ -60,9 +69,35 @@ type CapacityScheduling struct {
 	sync.RWMutex
 	fh                framework.Handle
 	podLister         corelisters.PodLister
+	namespaceLister   corelisters.NamespaceLister
+	nodeLister        corelisters.NodeLister
 	pdbLister         policylisters.PodDisruptionBudgetLister
+	pgLister          schedlisters.PodGroupLister
 	client            client.Client
 	elasticQuotaInfos ElasticQuotaInfos
+	// podElasticQuotas are the keys of the ElasticQuotaInfos the pods are counted in, keyed by the pod keys,
+	// so that the quota of a pod is found without going through all of them.
+	podElasticQuotas map[string]string
+	// fairSharing keeps the quotas from borrowing more than their fair share of the borrowed capacity.
+	fairSharing bool
+	// gangReservations are the reservations of the PodGroups against their quotas, keyed by the full
+	// names of the PodGroups.
+	gangReservations map[string]*gangReservation
+	// snapshot is the copy of elasticQuotaInfos shared by the scheduling cycles, and changedElasticQuotas
+	// are the keys of the ElasticQuotaInfos changed in place since the last snapshot.
+	snapshot             elasticQuotaSnapshot
+	changedElasticQuotas sets.String
+	// elasticQuotaIndex is the index of elasticQuotaInfos by namespace, nil to look the quota of a pod up
+	// among all of them.
+	elasticQuotaIndex elasticQuotaIndex
+	// windowedElasticQuotas are the ElasticQuotas with windows, keyed like elasticQuotaInfos, whose
+	// ElasticQuotaInfos are replaced when their active window changes.
+	windowedElasticQuotas map[string]*v1alpha1.ElasticQuota
+	// clock tells the time the windows of the quotas are evaluated at, the current time if nil.
+	clock clock.PassiveClock
+	// pendingDemands is the demand of the pending pods of the quotas, which fair sharing finds the starved
+	// quotas from.
+	pendingDemands pendingDemands
 }
 
 // PreFilterState computed at PreFilter and used at PostFilter or Reserve.
@@ -85,19 +120,8 @@ func (s *PreFilterState) Clone() framework.StateData {
 	return s
 }
 
-// ElasticQuotaSnapshotState stores the snapshot of elasticQuotas.
-type ElasticQuotaSnapshotState struct {
-	elasticQuotaInfos ElasticQuotaInfos
-}
-
-// Clone the ElasticQuotaSnapshot state.
-func (s *ElasticQuotaSnapshotState) Clone() framework.StateData {
-	return &ElasticQuotaSnapshotState{
-		elasticQuotaInfos: s.elasticQuotaInfos.clone(),
-	}
-}
-
 var _ framework.PreFilterPlugin = &CapacityScheduling{}
+var _ framework.FilterPlugin = &CapacityScheduling{}
 var _ framework.PostFilterPlugin = &CapacityScheduling{}
 var _ framework.ReservePlugin = &CapacityScheduling{}
 var _ framework.EnqueueExtensions = &CapacityScheduling{}
@@ -119,11 +143,25 @@ func (c *CapacityScheduling) Name() string {
 
 // New initializes a new plugin and returns it.
 func New(obj runtime.Object, handle framework.Handle) (framework.Plugin, error) {
+	var fairSharing bool
+	if obj != nil {
+		args, ok := obj.(*config.CapacitySchedulingArgs)
+		if !ok {
+			return nil, fmt.Errorf("want args to be of type CapacitySchedulingArgs, got %T", obj)
+		}
+		fairSharing = args.FairSharing
+	}
+
 	c := &CapacityScheduling{
 		fh:                handle,
 		elasticQuotaInfos: NewElasticQuotaInfos(),
 		podLister:         handle.SharedInformerFactory().Core().V1().Pods().Lister(),
+		namespaceLister:   handle.SharedInformerFactory().Core().V1().Namespaces().Lister(),
+		nodeLister:        handle.SharedInformerFactory().Core().V1().Nodes().Lister(),
 		pdbLister:         getPDBLister(handle.SharedInformerFactory()),
+		fairSharing:       fairSharing,
+		gangReservations:  make(map[string]*gangReservation),
+		clock:             clock.RealClock{},
 	}
 
 	client, err := client.New(handle.KubeConfig(), client.Options{Scheme: scheme})
@@ -132,6 +170,15 @@ func New(obj runtime.Object, handle framework.Handle) (framework.Plugin, error)
 	}
 
 	c.client = client
+	pgClient, err := versioned.NewForConfig(handle.KubeConfig())
+	if err != nil {
+		return nil, err
+	}
+	// The PodGroup informer is shared with Coscheduling, whichever plugin registers it first.
+	pgInformer := handle.SharedInformerFactory().InformerFor(&v1alpha1.PodGroup{}, func(kubernetes.Interface, time.Duration) cache.SharedIndexInformer {
+		return schedinformer.NewSharedInformerFactory(pgClient, 0).Scheduling().V1alpha1().PodGroups().Informer()
+	})
+	c.pgLister = schedlisters.NewPodGroupLister(pgInformer.GetIndexer())
 	dynamicCache, err := ctrlruntimecache.New(handle.KubeConfig(), ctrlruntimecache.Options{Scheme: scheme})
 	if err != nil {
 		return nil, err
@@ -165,28 +212,17 @@ func New(obj runtime.Object, handle framework.Handle) (framework.Plugin, error)
 	})
 
 	podInformer := handle.SharedInformerFactory().Core().V1().Pods().Informer()
-	podInformer.AddEventHandler(
-		cache.FilteringResourceEventHandler{
-			FilterFunc: func(obj interface{}) bool {
-				switch t := obj.(type) {
-				case *v1.Pod:
-					return assignedPod(t)
-				case cache.DeletedFinalStateUnknown:
-					if pod, ok := t.Obj.(*v1.Pod); ok {
-						return assignedPod(pod)
-					}
-					return false
-				default:
-					return false
-				}
-			},
-			Handler: cache.ResourceEventHandlerFuncs{
-				AddFunc:    c.addPod,
-				UpdateFunc: c.updatePod,
-				DeleteFunc: c.deletePod,
-			},
-		},
-	)
+	podInformer.AddEventHandler(c.podEventHandler())
+	podInformer.AddEventHandler(c.pendingPodEventHandler())
+	// The namespaces pooled by the quotas with a namespace selector change along with the labels of the namespaces.
+	namespaceInformer := handle.SharedInformerFactory().Core().V1().Namespaces().Informer()
+	namespaceInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.addNamespace,
+		UpdateFunc: c.updateNamespace,
+		DeleteFunc: c.deleteNamespace,
+	})
+	go c.syncElasticQuotaWindowsPeriodically(util.InformerContext(podInformer))
+	capacitySchedulings.Store(handle.SharedInformerFactory(), c)
 	klog.InfoS("CapacityScheduling start")
 	return c, nil
 }
@@ -204,16 +240,16 @@ func (c *CapacityScheduling) EventsToRegister() []framework.ClusterEventWithHint
 // PreFilter performs the following validations.
 // 1. Check if the (pod.request + eq.allocated) is less than eq.max.
 // 2. Check if the sum(eq's usage) > sum(eq's min).
+// 3. With fair sharing, check if the eq borrows more than its fair share while another eq is starved.
+// For the first member of a PodGroup, the request of the whole PodGroup is checked and reserved against the eq.
 func (c *CapacityScheduling) PreFilter(ctx context.Context, state *framework.CycleState, pod *v1.Pod) (*framework.PreFilterResult, *framework.Status) {
-	// TODO improve the efficiency of taking snapshot
-	// e.g. use a two-pointer data structure to only copy the updated EQs when necessary.
 	snapshotElasticQuota := c.snapshotElasticQuota()
 	podReq := computePodResourceRequest(pod)
 
 	state.Write(ElasticQuotaSnapshotKey, snapshotElasticQuota)
 
 	elasticQuotaInfos := snapshotElasticQuota.elasticQuotaInfos
-	eq := snapshotElasticQuota.elasticQuotaInfos[pod.Namespace]
+	eqKey, eq := snapshotElasticQuota.getElasticQuotaInfo(pod)
 	if eq == nil {
 		preFilterState := &PreFilterState{
 			podReq: *podReq,
@@ -222,13 +258,36 @@ func (c *CapacityScheduling) PreFilter(ctx context.Context, state *framework.Cyc
 		return nil, framework.NewStatus(framework.Success)
 	}
 
+	// quotaReq is the request checked against the quota: the pod request less the part of it covered by the
+	// reservation of its PodGroup, or the request of the whole PodGroup for its first member.
+	quotaReq := podReq
+	rejected := fmt.Sprintf("Pod %v/%v", pod.Namespace, pod.Name)
+	var gangReq *framework.Resource
+	if pgFullName := util.GetPodGroupFullName(pod); len(pgFullName) != 0 {
+		if !util.IsDryRun(state) {
+			// Coscheduling may still nominate the PodGroup after a failed preemption, so the reservation
+			// is only released once Coscheduling rejects the PodGroup, or on Unreserve.
+			util.OnPodGroupRejected(state, func() {
+				c.Lock()
+				defer c.Unlock()
+				c.releaseGangReservation(pgFullName)
+			})
+		}
+		if covered := c.coveredByGangReservation(pgFullName, eqKey, podReq); covered != nil {
+			quotaReq = subtractResource(podReq, covered)
+		} else if gangReq = c.getGangRequest(pod, eqKey, podReq); gangReq != nil {
+			quotaReq = maxResource(podReq, gangReq)
+			rejected = fmt.Sprintf("PodGroup %v", pgFullName)
+		}
+	}
+
 	// nominatedPodsReqInEQWithPodReq is the sum of podReq and the requested resources of the Nominated Pods
-	// which subject to the same quota(namespace) and is more important than the preemptor.
+	// which subject to the same quota and is more important than the preemptor.
 	nominatedPodsReqInEQWithPodReq := &framework.Resource{}
 	// nominatedPodsReqWithPodReq is the sum of podReq and the requested resources of the Nominated Pods
-	// which subject to the all quota(namespace). Generated Nominated Pods consist of two kinds of pods:
-	// 1. the pods subject to the same quota(namespace) and is more important than the preemptor.
-	// 2. the pods subject to the different quota(namespace) and the usage of quota(namespace) does not exceed min.
+	// which subject to the all quota. Generated Nominated Pods consist of two kinds of pods:
+	// 1. the pods subject to the same quota and is more important than the preemptor.
+	// 2. the pods subject to the different quota and the usage of quota does not exceed min.
 	nominatedPodsReqWithPodReq := &framework.Resource{}
 
 	nodeList, err := c.fh.SnapshotSharedLister().NodeInfos().List()
@@ -242,26 +301,25 @@ func (c *CapacityScheduling) PreFilter(ctx context.Context, state *framework.Cyc
 			if p.Pod.UID == pod.UID {
 				continue
 			}
-			ns := p.Pod.Namespace
-			info := c.elasticQuotaInfos[ns]
+			key, info := snapshotElasticQuota.getElasticQuotaInfo(p.Pod)
 			if info != nil {
 				pResourceRequest := util.ResourceList(computePodResourceRequest(p.Pod))
-				// If they are subject to the same quota(namespace) and p is more important than pod,
+				// If they are subject to the same quota and p is more important than pod,
 				// p will be added to the nominatedResource and totalNominatedResource.
-				// If they aren't subject to the same quota(namespace) and the usage of quota(p's namespace) does not exceed min,
+				// If they aren't subject to the same quota and the usage of p's quota does not exceed min,
 				// p will be added to the totalNominatedResource.
-				if ns == pod.Namespace && corev1helpers.PodPriority(p.Pod) >= corev1helpers.PodPriority(pod) {
+				if key == eqKey && corev1helpers.PodPriority(p.Pod) >= corev1helpers.PodPriority(pod) {
 					nominatedPodsReqInEQWithPodReq.Add(pResourceRequest)
 					nominatedPodsReqWithPodReq.Add(pResourceRequest)
-				} else if ns != pod.Namespace && !info.usedOverMin() {
+				} else if key != eqKey && !info.usedOverMin() {
 					nominatedPodsReqWithPodReq.Add(pResourceRequest)
 				}
 			}
 		}
 	}
 
-	nominatedPodsReqInEQWithPodReq.Add(util.ResourceList(podReq))
-	nominatedPodsReqWithPodReq.Add(util.ResourceList(podReq))
+	nominatedPodsReqInEQWithPodReq.Add(util.ResourceList(quotaReq))
+	nominatedPodsReqWithPodReq.Add(util.ResourceList(quotaReq))
 	preFilterState := &PreFilterState{
 		podReq:                         *podReq,
 		nominatedPodsReqInEQWithPodReq: *nominatedPodsReqInEQWithPodReq,
@@ -269,12 +327,28 @@ func (c *CapacityScheduling) PreFilter(ctx context.Context, state *framework.Cyc
 	}
 	state.Write(preFilterStateKey, preFilterState)
 
-	if eq.usedOverMaxWith(nominatedPodsReqInEQWithPodReq) {
-		return nil, framework.NewStatus(framework.Unschedulable, fmt.Sprintf("Pod %v/%v is rejected in PreFilter because ElasticQuota %v is more than Max", pod.Namespace, pod.Name, eq.Namespace))
+	// The Max of the quota of the pod and of all its ancestors must be respected.
+	if overMax := elasticQuotaInfos.usedOverMaxWith(eqKey, nominatedPodsReqInEQWithPodReq); len(overMax) != 0 {
+		return nil, framework.NewStatus(framework.Unschedulable, fmt.Sprintf("%v is rejected in PreFilter because ElasticQuota %v is more than Max", rejected, overMax))
+	}
+
+	if overLimit := elasticQuotaInfos.usedOverBorrowingLimitWith(eqKey, nominatedPodsReqInEQWithPodReq); len(overLimit) != 0 {
+		return nil, framework.NewStatus(framework.Unschedulable, fmt.Sprintf("%v is rejected in PreFilter because ElasticQuota %v is more than its borrowing limit", rejected, overLimit))
 	}
 
-	if elasticQuotaInfos.aggregatedUsedOverMinWith(*nominatedPodsReqWithPodReq) {
-		return nil, framework.NewStatus(framework.Unschedulable, fmt.Sprintf("Pod %v/%v is rejected in PreFilter because total ElasticQuota used is more than min", pod.Namespace, pod.Name))
+	if elasticQuotaInfos.aggregatedUsedOverMinWith(eqKey, *nominatedPodsReqWithPodReq) {
+		return nil, framework.NewStatus(framework.Unschedulable, fmt.Sprintf("%v is rejected in PreFilter because total ElasticQuota used is more than min", rejected))
+	}
+
+	if c.fairSharing && elasticQuotaInfos.dominantShareWith(eqKey, quotaReq) > 0 {
+		if starved := c.pendingDemands.starvedElasticQuota(elasticQuotaInfos, pod, eqKey); len(starved) != 0 {
+			return nil, framework.NewStatus(framework.Unschedulable, fmt.Sprintf("%v is rejected in PreFilter because ElasticQuota %v borrows more than its fair share while ElasticQuota %v is starved", rejected, eqKey, starved))
+		}
+	}
+
+	// The reservation is shared with the other cycles, a dry run only checks the PodGroup against the quota.
+	if gangReq != nil && !util.IsDryRun(state) {
+		c.reserveForGang(util.GetPodGroupFullName(pod), eqKey, gangReq)
 	}
 
 	return nil, framework.NewStatus(framework.Success, "")
@@ -293,12 +367,8 @@ func (c *CapacityScheduling) AddPod(ctx context.Context, cycleState *framework.C
 		return framework.NewStatus(framework.Error, err.Error())
 	}
 
-	elasticQuotaInfo := elasticQuotaSnapshotState.elasticQuotaInfos[podToAdd.Pod.Namespace]
-	if elasticQuotaInfo != nil {
-		err := elasticQuotaInfo.addPodIfNotPresent(podToAdd.Pod)
-		if err != nil {
-			klog.ErrorS(err, "Failed to add Pod to its associated elasticQuota", "pod", klog.KObj(podToAdd.Pod))
-		}
+	if err := elasticQuotaSnapshotState.addPod(podToAdd.Pod, nodeInfo.Node()); err != nil {
+		klog.ErrorS(err, "Failed to add Pod to its associated elasticQuota", "pod", klog.KObj(podToAdd.Pod))
 	}
 
 	return framework.NewStatus(framework.Success, "")
@@ -312,17 +382,47 @@ func (c *CapacityScheduling) RemovePod(ctx context.Context, cycleState *framewor
 		return framework.NewStatus(framework.Error, err.Error())
 	}
 
-	elasticQuotaInfo := elasticQuotaSnapshotState.elasticQuotaInfos[podToRemove.Pod.Namespace]
-	if elasticQuotaInfo != nil {
-		err = elasticQuotaInfo.deletePodIfPresent(podToRemove.Pod)
-		if err != nil {
-			klog.ErrorS(err, "Failed to delete Pod from its associated elasticQuota", "pod", klog.KObj(podToRemove.Pod))
-		}
+	if err := elasticQuotaSnapshotState.deletePod(podToRemove.Pod); err != nil {
+		klog.ErrorS(err, "Failed to delete Pod from its associated elasticQuota", "pod", klog.KObj(podToRemove.Pod))
 	}
 
 	return framework.NewStatus(framework.Success, "")
 }
 
+// Filter rejects the node if the pod would make the quota it is subject to use more than the Max of the flavor
+// of the node, or more than the Min of the flavor while the quotas with a flavor of the same name together use
+// more than the total of their Min of the flavor.
+func (c *CapacityScheduling) Filter(ctx context.Context, cycleState *framework.CycleState, pod *v1.Pod, nodeInfo *framework.NodeInfo) *framework.Status {
+	elasticQuotaSnapshotState, err := getElasticQuotaSnapshotState(cycleState)
+	if err != nil {
+		return framework.AsStatus(err)
+	}
+	elasticQuotaInfos := elasticQuotaSnapshotState.elasticQuotaInfos
+	eqKey, eqInfo := elasticQuotaSnapshotState.getElasticQuotaInfo(pod)
+	if eqInfo == nil {
+		return nil
+	}
+	flavor := eqInfo.flavorOf(nodeInfo.Node())
+	if flavor == nil {
+		return nil
+	}
+	preFilterState, err := getPreFilterState(cycleState)
+	if err != nil {
+		return framework.AsStatus(err)
+	}
+
+	used := flavor.Used.Clone()
+	used.Add(util.ResourceList(&preFilterState.podReq))
+	usedList := util.ResourceList(used)
+	if fits, _ := quota.LessThanOrEqual(usedList, flavor.Max); !fits {
+		return framework.NewStatus(framework.Unschedulable, fmt.Sprintf("Pod %v/%v is rejected in Filter because ElasticQuota %v is more than Max on flavor %v", pod.Namespace, pod.Name, eqKey, flavor.Name))
+	}
+	if fits, _ := quota.LessThanOrEqual(usedList, flavor.Min); !fits && elasticQuotaInfos.flavorUsedOverMinWith(flavor.Name, &preFilterState.podReq) {
+		return framework.NewStatus(framework.Unschedulable, fmt.Sprintf("Pod %v/%v is rejected in Filter because total ElasticQuota used on flavor %v is more than min", pod.Namespace, pod.Name, flavor.Name))
+	}
+	return nil
+}
+
 func (c *CapacityScheduling) PostFilter(ctx context.Context, state *framework.CycleState, pod *v1.Pod, m framework.NodeToStatusMap) (*framework.PostFilterResult, *framework.Status) {
 	defer func() {
 		metrics.PreemptionAttempts.Inc()
@@ -335,8 +435,10 @@ func (c *CapacityScheduling) PostFilter(ctx context.Context, state *framework.Cy
 		PdbLister:  c.pdbLister,
 		State:      state,
 		Interface: &preemptor{
-			fh:    c.fh,
-			state: state,
+			fh:             c.fh,
+			state:          state,
+			pendingDemands: &c.pendingDemands,
+			fairSharing:    c.fairSharing,
 		},
 	}
 
@@ -347,13 +449,15 @@ func (c *CapacityScheduling) Reserve(ctx context.Context, state *framework.Cycle
 	c.Lock()
 	defer c.Unlock()
 
-	elasticQuotaInfo := c.elasticQuotaInfos[pod.Namespace]
+	key, elasticQuotaInfo := c.getElasticQuotaInfo(pod)
 	if elasticQuotaInfo != nil {
-		err := elasticQuotaInfo.addPodIfNotPresent(pod)
+		_, err := c.addElasticQuotaPod(key, pod, c.getNode(elasticQuotaInfo, nodeName))
 		if err != nil {
 			klog.ErrorS(err, "Failed to add Pod to its associated elasticQuota", "pod", klog.KObj(pod))
 			return framework.NewStatus(framework.Error, err.Error())
 		}
+		c.elasticQuotaChanged(key)
+		c.consumeGangReservation(key, pod)
 	}
 	return framework.NewStatus(framework.Success, "")
 }
@@ -362,18 +466,25 @@ func (c *CapacityScheduling) Unreserve(ctx context.Context, state *framework.Cyc
 	c.Lock()
 	defer c.Unlock()
 
-	elasticQuotaInfo := c.elasticQuotaInfos[pod.Namespace]
+	key, elasticQuotaInfo := c.getElasticQuotaInfo(pod)
 	if elasticQuotaInfo != nil {
-		err := elasticQuotaInfo.deletePodIfPresent(pod)
+		_, err := c.deleteElasticQuotaPod(key, pod)
 		if err != nil {
 			klog.ErrorS(err, "Failed to delete Pod from its associated elasticQuota", "pod", klog.KObj(pod))
 		}
+		c.elasticQuotaChanged(key)
+	}
+	// The PodGroup of the pod gets rejected, see Coscheduling's Unreserve.
+	if pgFullName := util.GetPodGroupFullName(pod); len(pgFullName) != 0 {
+		c.releaseGangReservation(pgFullName)
 	}
 }
 
 type preemptor struct {
-	fh    framework.Handle
-	state *framework.CycleState
+	fh             framework.Handle
+	state          *framework.CycleState
+	pendingDemands *pendingDemands
+	fairSharing    bool
 }
 
 func (p *preemptor) GetOffsetAndNumCandidates(n int32) (int32, int32) {
@@ -406,6 +517,20 @@ func (p *preemptor) PodEligibleToPreemptOthers(pod *v1.Pod, nominatedNodeStatus
 		return false, "not eligible due to failed to read from cycleState"
 	}
 
+	if p.fairSharing {
+		// A pod whose quota borrows more than its fair share waits for the starved quotas rather than
+		// preempting, since it would be rejected in PreFilter again after the victims are evicted.
+		if elasticQuotaSnapshotState, err := getElasticQuotaSnapshotState(p.state); err == nil {
+			elasticQuotaInfos := elasticQuotaSnapshotState.elasticQuotaInfos
+			eqKey, eqInfo := elasticQuotaSnapshotState.getElasticQuotaInfo(pod)
+			if eqInfo != nil && elasticQuotaInfos.dominantShareWith(eqKey, &preFilterState.podReq) > 0 {
+				if starved := p.pendingDemands.starvedElasticQuota(elasticQuotaInfos, pod, eqKey); len(starved) != 0 {
+					return false, fmt.Sprintf("not eligible due to ElasticQuota %v being starved.", starved)
+				}
+			}
+		}
+	}
+
 	nomNodeName := pod.Status.NominatedNodeName
 	nodeLister := p.fh.SnapshotSharedLister().NodeInfos()
 	if len(nomNodeName) > 0 {
@@ -427,27 +552,28 @@ func (p *preemptor) PodEligibleToPreemptOthers(pod *v1.Pod, nominatedNodeStatus
 		}
 
 		podPriority := corev1helpers.PodPriority(pod)
-		preemptorEQInfo, preemptorWithEQ := elasticQuotaSnapshotState.elasticQuotaInfos[pod.Namespace]
-		if preemptorWithEQ {
+		elasticQuotaInfos := elasticQuotaSnapshotState.elasticQuotaInfos
+		preemptorEQKey, preemptorEQInfo := elasticQuotaSnapshotState.getElasticQuotaInfo(pod)
+		if preemptorEQInfo != nil {
 			moreThanMinWithPreemptor := preemptorEQInfo.usedOverMinWith(&preFilterState.nominatedPodsReqInEQWithPodReq)
 			for _, p := range nodeInfo.Pods {
 				// Checking terminating pods
 				if p.Pod.DeletionTimestamp != nil {
-					eqInfo, withEQ := elasticQuotaSnapshotState.elasticQuotaInfos[p.Pod.Namespace]
-					if !withEQ {
+					eqKey, eqInfo := elasticQuotaSnapshotState.getElasticQuotaInfo(p.Pod)
+					if eqInfo == nil {
 						continue
 					}
-					if p.Pod.Namespace == pod.Namespace && corev1helpers.PodPriority(p.Pod) < podPriority {
+					if eqKey == preemptorEQKey && corev1helpers.PodPriority(p.Pod) < podPriority {
 						// There is a terminating pod on the nominated node.
-						// If the terminating pod is in the same namespace with preemptor
+						// If the terminating pod is subject to the same quota as the preemptor
 						// and it is less important than preemptor,
 						// return false to avoid preempting more pods.
 						return false, "not eligible due to a terminating pod on the nominated node."
-					} else if p.Pod.Namespace != pod.Namespace && !moreThanMinWithPreemptor && eqInfo.usedOverMin() {
+					} else if _, reclaimable := elasticQuotaInfos.reclaimableBranch(eqKey, preemptorEQKey); eqKey != preemptorEQKey && !moreThanMinWithPreemptor && reclaimable {
 						// There is a terminating pod on the nominated node.
-						// The terminating pod isn't in the same namespace with preemptor.
+						// The terminating pod isn't subject to the same quota as the preemptor.
 						// If moreThanMinWithPreemptor is false, it indicates that preemptor can preempt the pods in other EQs whose used is over min.
-						// And if the used of terminating pod's quota is over min, so the room released by terminating pod on the nominated node can be used by the preemptor.
+						// And if the terminating pod's quota can be reclaimed by the preemptor, so the room released by terminating pod on the nominated node can be used by the preemptor.
 						// return false to avoid preempting more pods.
 						return false, "not eligible due to a terminating pod on the nominated node."
 					}
@@ -455,8 +581,7 @@ func (p *preemptor) PodEligibleToPreemptOthers(pod *v1.Pod, nominatedNodeStatus
 			}
 		} else {
 			for _, p := range nodeInfo.Pods {
-				_, withEQ := elasticQuotaSnapshotState.elasticQuotaInfos[p.Pod.Namespace]
-				if withEQ {
+				if _, eqInfo := elasticQuotaSnapshotState.getElasticQuotaInfo(p.Pod); eqInfo != nil {
 					continue
 				}
 				if p.Pod.DeletionTimestamp != nil && corev1helpers.PodPriority(p.Pod) < podPriority {
@@ -512,21 +637,41 @@ func (p *preemptor) SelectVictimsOnNode(
 		return nil
 	}
 
-	elasticQuotaInfos := elasticQuotaSnapshotState.elasticQuotaInfos
+	// The victims are removed from the ElasticQuotaInfos of the state, which are copied on write.
+	elasticQuotaInfos := elasticQuotaSnapshotState.ownElasticQuotaInfos()
 	podPriority := corev1helpers.PodPriority(pod)
-	preemptorElasticQuotaInfo, preemptorWithElasticQuota := elasticQuotaInfos[pod.Namespace]
+	preemptorElasticQuotaKey, preemptorElasticQuotaInfo := elasticQuotaSnapshotState.getElasticQuotaInfo(pod)
+	preemptorWithElasticQuota := preemptorElasticQuotaInfo != nil
 
 	// sort the pods in node by the priority class
 	sort.Slice(nodeInfo.Pods, func(i, j int) bool { return !schedutil.MoreImportantPod(nodeInfo.Pods[i].Pod, nodeInfo.Pods[j].Pod) })
 
 	var potentialVictims []*framework.PodInfo
+	// borrowedShares records, for the quotas of the victims reclaimed from other quotas, how much the
+	// branch of the quota tree they borrow through is over its min, or over its fair share with fair
+	// sharing, before any victim is removed.
+	var borrowedShares map[string]float64
+	fairSharing := p.fairSharing
+	branchShare := func(branch string) float64 {
+		if fairSharing {
+			return elasticQuotaInfos.dominantShareWith(branch, nil)
+		}
+		return elasticQuotaInfos.borrowedShare(branch)
+	}
 	if preemptorWithElasticQuota {
 		nominatedPodsReqInEQWithPodReq = preFilterState.nominatedPodsReqInEQWithPodReq
 		nominatedPodsReqWithPodReq = preFilterState.nominatedPodsReqWithPodReq
 		moreThanMinWithPreemptor := preemptorElasticQuotaInfo.usedOverMinWith(&nominatedPodsReqInEQWithPodReq)
+		var preemptorShare float64
+		if !moreThanMinWithPreemptor || fairSharing {
+			borrowedShares = make(map[string]float64)
+		}
+		if moreThanMinWithPreemptor && fairSharing {
+			preemptorShare = elasticQuotaInfos.dominantShareWith(preemptorElasticQuotaKey, &nominatedPodsReqInEQWithPodReq)
+		}
 		for _, p := range nodeInfo.Pods {
-			eqInfo, withEQ := elasticQuotaInfos[p.Pod.Namespace]
-			if !withEQ {
+			eqKey, eqInfo := elasticQuotaSnapshotState.getElasticQuotaInfo(p.Pod)
+			if eqInfo == nil {
 				continue
 			}
 
@@ -534,13 +679,29 @@ func (p *preemptor) SelectVictimsOnNode(
 				// If Preemptor.Request + Quota.Used > Quota.Min:
 				// It means that its guaranteed isn't borrowed by other
 				// quotas. So that we will select the pods which subject to the
-				// same quota(namespace) with the lower priority than the
+				// same quota with the lower priority than the
 				// preemptor's priority as potential victims in a node.
-				if p.Pod.Namespace == pod.Namespace && corev1helpers.PodPriority(p.Pod) < podPriority {
+				if eqKey == preemptorElasticQuotaKey && corev1helpers.PodPriority(p.Pod) < podPriority {
 					potentialVictims = append(potentialVictims, p)
 					if err := removePod(p); err != nil {
 						return nil, 0, framework.AsStatus(err)
 					}
+				} else if fairSharing && eqKey != preemptorElasticQuotaKey {
+					// With fair sharing, the pods of the quotas further above their fair share
+					// than the preemptor quota with the preemptor can be preempted as well.
+					branch, reclaimable := elasticQuotaInfos.reclaimableBranch(eqKey, preemptorElasticQuotaKey)
+					if !reclaimable {
+						continue
+					}
+					if _, ok := borrowedShares[eqKey]; !ok {
+						borrowedShares[eqKey] = branchShare(branch)
+					}
+					if borrowedShares[eqKey] > preemptorShare {
+						potentialVictims = append(potentialVictims, p)
+						if err := removePod(p); err != nil {
+							return nil, 0, framework.AsStatus(err)
+						}
+					}
 				}
 
 			} else {
@@ -549,8 +710,15 @@ func (p *preemptor) SelectVictimsOnNode(
 				// `borrowed` by other Quota. Potential victims in a node
 				// will be chosen from Quotas that allocates more resources
 				// than its min, i.e., borrowing resources from other
-				// Quotas.
-				if p.Pod.Namespace != pod.Namespace && eqInfo.usedOverMin() {
+				// Quotas. In a quota tree, the borrowing quota and the
+				// branch it borrows through must both be over their min.
+				if eqKey == preemptorElasticQuotaKey {
+					continue
+				}
+				if branch, reclaimable := elasticQuotaInfos.reclaimableBranch(eqKey, preemptorElasticQuotaKey); reclaimable {
+					if _, ok := borrowedShares[eqKey]; !ok {
+						borrowedShares[eqKey] = branchShare(branch)
+					}
 					potentialVictims = append(potentialVictims, p)
 					if err := removePod(p); err != nil {
 						return nil, 0, framework.AsStatus(err)
@@ -560,8 +728,7 @@ func (p *preemptor) SelectVictimsOnNode(
 		}
 	} else {
 		for _, p := range nodeInfo.Pods {
-			_, withEQ := elasticQuotaInfos[p.Pod.Namespace]
-			if withEQ {
+			if _, eqInfo := elasticQuotaSnapshotState.getElasticQuotaInfo(p.Pod); eqInfo != nil {
 				continue
 			}
 			if corev1helpers.PodPriority(p.Pod) < podPriority {
@@ -593,8 +760,9 @@ func (p *preemptor) SelectVictimsOnNode(
 	// after removing all the lower priority pods,
 	// we are almost done and this node is not suitable for preemption.
 	if preemptorWithElasticQuota {
-		if preemptorElasticQuotaInfo.usedOverMaxWith(&podReq) ||
-			elasticQuotaInfos.aggregatedUsedOverMinWith(podReq) {
+		if len(elasticQuotaInfos.usedOverMaxWith(preemptorElasticQuotaKey, &podReq)) != 0 ||
+			len(elasticQuotaInfos.usedOverBorrowingLimitWith(preemptorElasticQuotaKey, &podReq)) != 0 ||
+			elasticQuotaInfos.aggregatedUsedOverMinWith(preemptorElasticQuotaKey, podReq) {
 			return nil, 0, framework.NewStatus(framework.Unschedulable, "global quota max exceeded")
 		}
 	}
@@ -602,12 +770,20 @@ func (p *preemptor) SelectVictimsOnNode(
 	var victims []*v1.Pod
 	numViolatingVictim := 0
 	sort.Slice(potentialVictims, func(i, j int) bool {
+		// Victims reclaimed from the less overborrowed branches of the quota tree are reprieved
+		// first, so that the most overborrowed subtree gets evicted first.
+		keyI, _ := elasticQuotaSnapshotState.getElasticQuotaInfo(potentialVictims[i].Pod)
+		keyJ, _ := elasticQuotaSnapshotState.getElasticQuotaInfo(potentialVictims[j].Pod)
+		si, sj := borrowedShares[keyI], borrowedShares[keyJ]
+		if si != sj {
+			return si < sj
+		}
 		return schedutil.MoreImportantPod(potentialVictims[i].Pod, potentialVictims[j].Pod)
 	})
 	// Try to reprieve as many pods as possible. We first try to reprieve the PDB
 	// violating victims and then other non-violating ones. In both cases, we start
-	// from the highest priority victims.
-	violatingVictims, nonViolatingVictims := filterPodsWithPDBViolation(potentialVictims, pdbs)
+	// from the victims of the least overborrowed quotas and the highest priority victims.
+	violatingVictims, nonViolatingVictims := util.FilterPodsWithPDBViolation(potentialVictims, pdbs)
 	reprievePod := func(pi *framework.PodInfo) (bool, error) {
 		if err := addPod(pi); err != nil {
 			return false, err
@@ -622,7 +798,9 @@ func (p *preemptor) SelectVictimsOnNode(
 			klog.V(5).InfoS("Found a potential preemption victim on node", "pod", klog.KObj(pi.Pod), "node", klog.KObj(nodeInfo.Node()))
 		}
 
-		if preemptorWithElasticQuota && (preemptorElasticQuotaInfo.usedOverMaxWith(&nominatedPodsReqInEQWithPodReq) || elasticQuotaInfos.aggregatedUsedOverMinWith(nominatedPodsReqWithPodReq)) {
+		if preemptorWithElasticQuota && (len(elasticQuotaInfos.usedOverMaxWith(preemptorElasticQuotaKey, &nominatedPodsReqInEQWithPodReq)) != 0 ||
+			len(elasticQuotaInfos.usedOverBorrowingLimitWith(preemptorElasticQuotaKey, &nominatedPodsReqInEQWithPodReq)) != 0 ||
+			elasticQuotaInfos.aggregatedUsedOverMinWith(preemptorElasticQuotaKey, nominatedPodsReqWithPodReq)) {
 			if err := removePod(pi); err != nil {
 				return false, err
 			}
@@ -652,39 +830,88 @@ func (p *preemptor) SelectVictimsOnNode(
 
 func (c *CapacityScheduling) addElasticQuota(obj interface{}) {
 	eq := obj.(*v1alpha1.ElasticQuota)
-	oldElasticQuotaInfo := c.elasticQuotaInfos[eq.Namespace]
-	if oldElasticQuotaInfo != nil {
-		return
-	}
-
-	elasticQuotaInfo := newElasticQuotaInfo(eq.Namespace, eq.Spec.Min, eq.Spec.Max, nil)
+	key := getElasticQuotaKey(eq.Namespace, eq.Name)
 
 	c.Lock()
 	defer c.Unlock()
-	c.elasticQuotaInfos[eq.Namespace] = elasticQuotaInfo
+
+	oldElasticQuotaInfo := c.elasticQuotaInfos[key]
+	if oldElasticQuotaInfo != nil {
+		return
+	}
+	elasticQuotaInfo := newElasticQuotaInfoFromEQ(eq, c.now(), c.namespaceLister)
+	c.elasticQuotaInfos[key] = elasticQuotaInfo
+	c.elasticQuotaTreesChanged()
+	c.trackElasticQuotaWindows(key, eq)
+	// The new quota may select pods subject to another quota so far.
+	for _, namespace := range elasticQuotaInfo.namespaces() {
+		c.reassignPods(namespace)
+	}
 }
 
 func (c *CapacityScheduling) updateElasticQuota(oldObj, newObj interface{}) {
 	oldEQ := oldObj.(*v1alpha1.ElasticQuota)
 	newEQ := newObj.(*v1alpha1.ElasticQuota)
-	newEQInfo := newElasticQuotaInfo(newEQ.Namespace, newEQ.Spec.Min, newEQ.Spec.Max, nil)
+	newEQInfo := newElasticQuotaInfoFromEQ(newEQ, c.now(), c.namespaceLister)
 
 	c.Lock()
 	defer c.Unlock()
 
-	oldEQInfo := c.elasticQuotaInfos[oldEQ.Namespace]
+	namespaces := sets.NewString(newEQInfo.namespaces()...)
+	oldEQInfo := c.elasticQuotaInfos[getElasticQuotaKey(oldEQ.Namespace, oldEQ.Name)]
 	if oldEQInfo != nil {
 		newEQInfo.pods = oldEQInfo.pods
+		newEQInfo.podsShared = oldEQInfo.podsShared
 		newEQInfo.Used = oldEQInfo.Used
+		newEQInfo.podFlavors = oldEQInfo.podFlavors
+		for _, flavor := range newEQInfo.Flavors {
+			if oldFlavor := oldEQInfo.getFlavor(flavor.Name); oldFlavor != nil {
+				flavor.Used = oldFlavor.Used
+			}
+		}
+		namespaces.Insert(oldEQInfo.namespaces()...)
+	}
+	c.elasticQuotaInfos[getElasticQuotaKey(newEQ.Namespace, newEQ.Name)] = newEQInfo
+	c.elasticQuotaTreesChanged()
+	if oldEQInfo != nil && !reflect.DeepEqual(oldEQ.Spec.Flavors, newEQ.Spec.Flavors) {
+		c.chargeFlavors(newEQInfo)
+	}
+	c.trackElasticQuotaWindows(getElasticQuotaKey(newEQ.Namespace, newEQ.Name), newEQ)
+	if !reflect.DeepEqual(oldEQ.Spec.PodSelector, newEQ.Spec.PodSelector) ||
+		!reflect.DeepEqual(oldEQ.Spec.NamespaceSelector, newEQ.Spec.NamespaceSelector) {
+		for _, namespace := range namespaces.List() {
+			c.reassignPods(namespace)
+		}
 	}
-	c.elasticQuotaInfos[newEQ.Namespace] = newEQInfo
 }
 
 func (c *CapacityScheduling) deleteElasticQuota(obj interface{}) {
-	elasticQuota := obj.(*v1alpha1.ElasticQuota)
+	var elasticQuota *v1alpha1.ElasticQuota
+	switch t := obj.(type) {
+	case *v1alpha1.ElasticQuota:
+		elasticQuota = t
+	case cache.DeletedFinalStateUnknown:
+		var ok bool
+		if elasticQuota, ok = t.Obj.(*v1alpha1.ElasticQuota); !ok {
+			return
+		}
+	default:
+		return
+	}
 	c.Lock()
 	defer c.Unlock()
-	delete(c.elasticQuotaInfos, elasticQuota.Namespace)
+	key := getElasticQuotaKey(elasticQuota.Namespace, elasticQuota.Name)
+	elasticQuotaInfo := c.elasticQuotaInfos[key]
+	if elasticQuotaInfo == nil {
+		return
+	}
+	delete(c.elasticQuotaInfos, key)
+	delete(c.windowedElasticQuotas, key)
+	c.elasticQuotaTreesChanged()
+	// The pods of the deleted quota may be subject to another quota.
+	for _, namespace := range elasticQuotaInfo.namespaces() {
+		c.reassignPods(namespace)
+	}
 }
 
 func (c *CapacityScheduling) addPod(obj interface{}) {
@@ -693,32 +920,49 @@ func (c *CapacityScheduling) addPod(obj interface{}) {
 	c.Lock()
 	defer c.Unlock()
 
-	elasticQuotaInfo := c.elasticQuotaInfos[pod.Namespace]
-	// If elasticQuotaInfo is nil, try to list ElasticQuotas through elasticQuotaLister
-	if elasticQuotaInfo == nil {
+	// If no quota of the namespace is known, try to list ElasticQuotas through elasticQuotaLister
+	if !c.elasticQuotaInfos.hasNamespace(c.elasticQuotaIndex, pod.Namespace) {
 		var eqList v1alpha1.ElasticQuotaList
 		if err := c.client.List(context.Background(), &eqList, client.InNamespace(pod.Namespace)); err != nil {
 			klog.ErrorS(err, "Failed to get elasticQuota", "elasticQuota", pod.Namespace)
 			return
 		}
 
-		eqs := eqList.Items
-		// If the length of elasticQuotas is 0, return.
-		if len(eqs) == 0 {
-			return
-		}
-
-		if len(eqs) > 0 {
-			// only one elasticquota is supported in each namespace
-			eq := eqs[0]
-			elasticQuotaInfo = newElasticQuotaInfo(eq.Namespace, eq.Spec.Min, eq.Spec.Max, nil)
-			c.elasticQuotaInfos[eq.Namespace] = elasticQuotaInfo
+		for i := range eqList.Items {
+			eq := &eqList.Items[i]
+			c.elasticQuotaInfos[getElasticQuotaKey(eq.Namespace, eq.Name)] = newElasticQuotaInfoFromEQ(eq, c.now(), c.namespaceLister)
 		}
+		c.elasticQuotaTreesChanged()
+		// The pods of the namespace pending so far are subject to the listed quotas as well.
+		c.reassignPods(pod.Namespace)
 	}
 
-	err := elasticQuotaInfo.addPodIfNotPresent(pod)
-	if err != nil {
-		klog.ErrorS(err, "Failed to add Pod to its associated elasticQuota", "pod", klog.KObj(pod))
+	c.assignPod(pod)
+}
+
+// podEventHandler returns the handler of the events of the pods counting in the usage of the quotas,
+// which are accounted the same way as by the ElasticQuota controller. A pod which succeeds or fails
+// gets deleted from the quotas.
+func (c *CapacityScheduling) podEventHandler() cache.ResourceEventHandler {
+	return cache.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool {
+			switch t := obj.(type) {
+			case *v1.Pod:
+				return util.IsPodCountedInElasticQuota(t)
+			case cache.DeletedFinalStateUnknown:
+				if pod, ok := t.Obj.(*v1.Pod); ok {
+					return assignedPod(pod)
+				}
+				return false
+			default:
+				return false
+			}
+		},
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc:    c.addPod,
+			UpdateFunc: c.updatePod,
+			DeleteFunc: c.deletePod,
+		},
 	}
 }
 
@@ -730,17 +974,20 @@ func (c *CapacityScheduling) updatePod(oldObj, newObj interface{}) {
 		return
 	}
 
-	if newPod.Status.Phase != v1.PodRunning && newPod.Status.Phase != v1.PodPending {
+	if !util.IsPodCountedInElasticQuota(newPod) {
 		c.Lock()
 		defer c.Unlock()
 
-		elasticQuotaInfo := c.elasticQuotaInfos[newPod.Namespace]
-		if elasticQuotaInfo != nil {
-			err := elasticQuotaInfo.deletePodIfPresent(newPod)
-			if err != nil {
-				klog.ErrorS(err, "Failed to delete Pod from its associated elasticQuota", "pod", klog.KObj(newPod))
-			}
-		}
+		c.unassignPod(newPod)
+		return
+	}
+
+	// A change of the labels of the pod may change the quota it is subject to.
+	if !reflect.DeepEqual(oldPod.Labels, newPod.Labels) {
+		c.Lock()
+		defer c.Unlock()
+
+		c.assignPod(newPod)
 	}
 }
 
@@ -749,24 +996,317 @@ func (c *CapacityScheduling) deletePod(obj interface{}) {
 	c.Lock()
 	defer c.Unlock()
 
-	elasticQuotaInfo := c.elasticQuotaInfos[pod.Namespace]
+	c.unassignPod(pod)
+}
+
+// assignPod adds the pod to the quota it is subject to, and removes it from the other quotas, which may
+// no longer apply to its namespace. The caller must hold the lock.
+func (c *CapacityScheduling) assignPod(pod *v1.Pod) {
+	key, elasticQuotaInfo := c.getElasticQuotaInfo(pod)
+	podKey, err := framework.GetPodKey(pod)
+	if err != nil {
+		klog.ErrorS(err, "Failed to get the key of the Pod", "pod", klog.KObj(pod))
+		return
+	}
+	if previousKey, ok := c.podElasticQuotas[podKey]; ok && previousKey != key {
+		if deleted, err := c.deleteElasticQuotaPod(previousKey, pod); err != nil {
+			klog.ErrorS(err, "Failed to delete Pod from its previous elasticQuota", "pod", klog.KObj(pod))
+		} else if deleted {
+			c.elasticQuotaChanged(previousKey)
+		}
+	}
 	if elasticQuotaInfo != nil {
-		err := elasticQuotaInfo.deletePodIfPresent(pod)
+		if !elasticQuotaInfo.pods.Has(podKey) {
+			if _, err := c.addElasticQuotaPod(key, pod, c.getNode(elasticQuotaInfo, pod.Spec.NodeName)); err != nil {
+				klog.ErrorS(err, "Failed to add Pod to its associated elasticQuota", "pod", klog.KObj(pod))
+			}
+			c.elasticQuotaChanged(key)
+		}
+		c.consumeGangReservation(key, pod)
+	}
+}
+
+// unassignPod removes the pod from the quotas. The caller must hold the lock.
+func (c *CapacityScheduling) unassignPod(pod *v1.Pod) {
+	podKey, err := framework.GetPodKey(pod)
+	if err != nil {
+		klog.ErrorS(err, "Failed to get the key of the Pod", "pod", klog.KObj(pod))
+		return
+	}
+	key, ok := c.podElasticQuotas[podKey]
+	if !ok {
+		return
+	}
+	if deleted, err := c.deleteElasticQuotaPod(key, pod); err != nil {
+		klog.ErrorS(err, "Failed to delete Pod from its associated elasticQuota", "pod", klog.KObj(pod))
+	} else if deleted {
+		c.elasticQuotaChanged(key)
+	}
+}
+
+// addElasticQuotaPod adds the pod to the quota of the given key and keeps track of the quota the pod is
+// counted in. The caller must hold the lock.
+func (c *CapacityScheduling) addElasticQuotaPod(key string, pod *v1.Pod, node *v1.Node) (bool, error) {
+	added, err := c.elasticQuotaInfos.addPod(key, pod, node)
+	if added {
+		if c.podElasticQuotas == nil {
+			c.podElasticQuotas = make(map[string]string)
+		}
+		// addPod succeeded, so does GetPodKey.
+		podKey, _ := framework.GetPodKey(pod)
+		c.podElasticQuotas[podKey] = key
+	}
+	return added, err
+}
+
+// deleteElasticQuotaPod deletes the pod from the quota of the given key, and forgets the quota the pod is
+// counted in. The caller must hold the lock.
+func (c *CapacityScheduling) deleteElasticQuotaPod(key string, pod *v1.Pod) (bool, error) {
+	deleted, err := c.elasticQuotaInfos.deletePod(key, pod)
+	if podKey, keyErr := framework.GetPodKey(pod); keyErr == nil && c.podElasticQuotas[podKey] == key {
+		delete(c.podElasticQuotas, podKey)
+	}
+	return deleted, err
+}
+
+// getNode returns the node of the given name if the quota has flavors, so that the pods of the quota get
+// charged to the flavor of their node, or nil.
+func (c *CapacityScheduling) getNode(info *ElasticQuotaInfo, nodeName string) *v1.Node {
+	if len(info.Flavors) == 0 || len(nodeName) == 0 || c.nodeLister == nil {
+		return nil
+	}
+	node, err := c.nodeLister.Get(nodeName)
+	if err != nil {
+		klog.V(4).InfoS("Failed to get the node of the Pod, the Pod isn't charged to a flavor", "node", nodeName, "err", err)
+		return nil
+	}
+	return node
+}
+
+// chargeFlavors charges the pods of the quota to the flavors of their nodes again, after the flavors of the
+// quota changed. The caller must hold the lock.
+func (c *CapacityScheduling) chargeFlavors(info *ElasticQuotaInfo) {
+	info.podFlavors = nil
+	for _, flavor := range info.Flavors {
+		flavor.Used = framework.NewResource(nil)
+	}
+	for _, namespace := range info.namespaces() {
+		pods, err := c.podLister.Pods(namespace).List(labels.Everything())
 		if err != nil {
-			klog.ErrorS(err, "Failed to delete Pod from its associated elasticQuota", "pod", klog.KObj(pod))
+			klog.ErrorS(err, "Failed to list pods", "namespace", namespace)
+			continue
+		}
+		for _, pod := range pods {
+			podKey, err := framework.GetPodKey(pod)
+			if err != nil || !info.pods.Has(podKey) {
+				continue
+			}
+			flavor := info.flavorOf(c.getNode(info, pod.Spec.NodeName))
+			if flavor == nil {
+				continue
+			}
+			flavor.Used.Add(util.ResourceList(computePodResourceRequest(pod)))
+			if info.podFlavors == nil {
+				info.podFlavors = make(map[string]string)
+			}
+			info.podFlavors[podKey] = flavor.Name
+		}
+	}
+}
+
+// elasticQuotaChanged records that the ElasticQuotaInfo of the given key changed in place, along with the
+// usage of the descendants of its ancestors, so that the next snapshot copies them again. The caller must
+// hold the lock.
+func (c *CapacityScheduling) elasticQuotaChanged(key string) {
+	if c.changedElasticQuotas == nil {
+		c.changedElasticQuotas = sets.NewString()
+	}
+	c.changedElasticQuotas.Insert(c.elasticQuotaInfos.lineage(key)...)
+}
+
+// elasticQuotaTreesChanged updates the usage of the descendants of the quotas and the index of the quotas
+// after quotas were added, replaced or deleted. The caller must hold the lock.
+func (c *CapacityScheduling) elasticQuotaTreesChanged() {
+	for _, key := range c.elasticQuotaInfos.resetDescendantsUsed() {
+		c.elasticQuotaChanged(key)
+	}
+	c.elasticQuotaIndex = newElasticQuotaIndex(c.elasticQuotaInfos)
+}
+
+// getElasticQuotaInfo returns the key and the ElasticQuotaInfo of the quota the pod is subject to, or nil.
+// The caller must hold the lock.
+func (c *CapacityScheduling) getElasticQuotaInfo(pod *v1.Pod) (string, *ElasticQuotaInfo) {
+	return c.elasticQuotaInfos.getIndexedElasticQuotaInfo(c.elasticQuotaIndex, pod)
+}
+
+// reassignPods moves the pods of the namespace to the quota they are subject to, after the quotas
+// applying to the namespace changed. The caller must hold the lock.
+func (c *CapacityScheduling) reassignPods(namespace string) {
+	pods, err := c.podLister.Pods(namespace).List(labels.Everything())
+	if err != nil {
+		klog.ErrorS(err, "Failed to list pods", "namespace", namespace)
+		return
+	}
+	for _, pod := range pods {
+		if !util.IsPodCountedInElasticQuota(pod) {
+			c.trackPendingPod(pod)
+			continue
+		}
+		c.assignPod(pod)
+	}
+}
+
+func (c *CapacityScheduling) addNamespace(obj interface{}) {
+	namespace := obj.(*v1.Namespace)
+	c.syncNamespace(namespace.Name, namespace.Labels, true)
+}
+
+func (c *CapacityScheduling) updateNamespace(oldObj, newObj interface{}) {
+	oldNamespace := oldObj.(*v1.Namespace)
+	newNamespace := newObj.(*v1.Namespace)
+	if reflect.DeepEqual(oldNamespace.Labels, newNamespace.Labels) {
+		return
+	}
+	c.syncNamespace(newNamespace.Name, newNamespace.Labels, true)
+}
+
+func (c *CapacityScheduling) deleteNamespace(obj interface{}) {
+	var namespace *v1.Namespace
+	switch t := obj.(type) {
+	case *v1.Namespace:
+		namespace = t
+	case cache.DeletedFinalStateUnknown:
+		var ok bool
+		if namespace, ok = t.Obj.(*v1.Namespace); !ok {
+			return
+		}
+	default:
+		return
+	}
+	c.syncNamespace(namespace.Name, nil, false)
+}
+
+// syncNamespace updates the namespaces pooled by the quotas with a namespace selector after the namespace
+// was added, relabeled or deleted, and moves the pods of the namespace to the quota they are subject to.
+func (c *CapacityScheduling) syncNamespace(name string, namespaceLabels map[string]string, exists bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	changed := false
+	for key, info := range c.elasticQuotaInfos {
+		if info.NamespaceSelector == nil {
+			continue
+		}
+		selected := exists && info.NamespaceSelector.Matches(labels.Set(namespaceLabels))
+		if selected == info.Namespaces.Has(name) {
+			continue
+		}
+		namespaces := sets.NewString(info.Namespaces.UnsortedList()...)
+		if selected {
+			namespaces.Insert(name)
+		} else {
+			namespaces.Delete(name)
 		}
+		info.Namespaces = namespaces
+		c.elasticQuotaChanged(key)
+		changed = true
+	}
+	if changed {
+		c.elasticQuotaIndex = newElasticQuotaIndex(c.elasticQuotaInfos)
+		c.reassignPods(name)
 	}
 }
 
-// getElasticQuotasSnapshot will return the snapshot of elasticQuotas.
+// snapshotElasticQuota returns the snapshot of elasticQuotas, which only copies the ElasticQuotaInfos
+// changed since the last snapshot.
 func (c *CapacityScheduling) snapshotElasticQuota() *ElasticQuotaSnapshotState {
-	c.RLock()
-	defer c.RUnlock()
+	c.Lock()
+	defer c.Unlock()
 
-	elasticQuotaInfosDeepCopy := c.elasticQuotaInfos.clone()
+	elasticQuotaInfos := c.snapshot.update(c.elasticQuotaInfos, c.changedElasticQuotas)
+	c.changedElasticQuotas = nil
 	return &ElasticQuotaSnapshotState{
-		elasticQuotaInfos: elasticQuotaInfosDeepCopy,
+		elasticQuotaInfos: elasticQuotaInfos,
+		index:             c.elasticQuotaIndex,
+	}
+}
+
+// getElasticQuotaKey returns the key of the ElasticQuota of the given namespace and name in ElasticQuotaInfos.
+func getElasticQuotaKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// getParentKey returns the key of the parent of the ElasticQuota in the quota tree, or an empty string.
+func getParentKey(eq *v1alpha1.ElasticQuota) string {
+	if eq.Spec.Parent == nil {
+		return ""
 	}
+	return getElasticQuotaKey(eq.Spec.Parent.Namespace, eq.Spec.Parent.Name)
+}
+
+// newElasticQuotaInfoFromEQ returns the ElasticQuotaInfo of the ElasticQuota, without usage, with the Min
+// and Max in effect at the given time.
+func newElasticQuotaInfoFromEQ(eq *v1alpha1.ElasticQuota, now time.Time, namespaceLister corelisters.NamespaceLister) *ElasticQuotaInfo {
+	min, max, window := util.GetElasticQuotaBounds(eq, now)
+	elasticQuotaInfo := newElasticQuotaInfo(eq.Namespace, min, max, nil)
+	elasticQuotaInfo.Window = window
+	elasticQuotaInfo.Parent = getParentKey(eq)
+	selector, err := util.GetElasticQuotaPodSelector(eq)
+	if err != nil {
+		klog.ErrorS(err, "Invalid pod selector, no pod is subject to the elasticQuota", "elasticQuota", klog.KObj(eq))
+		selector = labels.Nothing()
+	}
+	elasticQuotaInfo.PodSelector = selector
+	if eq.Spec.BorrowingLimit != nil {
+		borrowingCap := make(v1.ResourceList, len(eq.Spec.BorrowingLimit))
+		for name, limit := range eq.Spec.BorrowingLimit {
+			quant := min[name]
+			quant.Add(limit)
+			borrowingCap[name] = quant
+		}
+		elasticQuotaInfo.BorrowingCap = newUnboundedResource(borrowingCap)
+	}
+	if eq.Spec.LendingLimit != nil {
+		elasticQuotaInfo.LendingLimit = newUnboundedResource(eq.Spec.LendingLimit)
+	}
+	elasticQuotaInfo.Weight = eq.Spec.FairSharingWeight
+	for i, selector := range util.GetElasticQuotaFlavorSelectors(eq) {
+		flavor := &eq.Spec.Flavors[i]
+		elasticQuotaInfo.Flavors = append(elasticQuotaInfo.Flavors, &ElasticQuotaFlavorInfo{
+			Name:         flavor.Name,
+			NodeSelector: selector,
+			Min:          flavor.Min,
+			Max:          flavor.Max,
+			Used:         framework.NewResource(nil),
+		})
+	}
+
+	namespaceSelector, err := util.GetElasticQuotaNamespaceSelector(eq)
+	if err != nil {
+		klog.ErrorS(err, "Invalid namespace selector, no pod is subject to the elasticQuota", "elasticQuota", klog.KObj(eq))
+		namespaceSelector = labels.Nothing()
+	}
+	if namespaceSelector != nil {
+		elasticQuotaInfo.NamespaceSelector = namespaceSelector
+		elasticQuotaInfo.Namespaces = sets.NewString()
+		namespaces, err := namespaceLister.List(namespaceSelector)
+		if err != nil {
+			klog.ErrorS(err, "Failed to list the namespaces selected by the elasticQuota", "elasticQuota", klog.KObj(eq))
+		}
+		for _, namespace := range namespaces {
+			elasticQuotaInfo.Namespaces.Insert(namespace.Name)
+		}
+	}
+	return elasticQuotaInfo
+}
+
+// newUnboundedResource returns the resources of the list, unbounded for the resources not listed.
+func newUnboundedResource(list v1.ResourceList) *framework.Resource {
+	resources := makeResourceListForBound(UpperBoundOfMax)
+	for name, quant := range list {
+		resources[name] = quant
+	}
+	return framework.NewResource(resources)
 }
 
 func getPreFilterState(cycleState *framework.CycleState) (*PreFilterState, error) {
@@ -801,103 +1341,11 @@ func getPDBLister(informerFactory informers.SharedInformerFactory) policylisters
 	return informerFactory.Policy().V1().PodDisruptionBudgets().Lister()
 }
 
-// computePodResourceRequest returns a framework.Resource that covers the largest
-// width in each resource dimension. Because init-containers run sequentially, we collect
-// the max in each dimension iteratively. In contrast, we sum the resource vectors for
-// regular containers since they run simultaneously.
-//
-// If Pod Overhead is specified and the feature gate is set, the resources defined for Overhead
-// are added to the calculated Resource request sum
-//
-// Example:
-//
-// Pod:
-//
-//	InitContainers
-//	  IC1:
-//	    CPU: 2
-//	    Memory: 1G
-//	  IC2:
-//	    CPU: 2
-//	    Memory: 3G
-//	Containers
-//	  C1:
-//	    CPU: 2
-//	    Memory: 1G
-//	  C2:
-//	    CPU: 1
-//	    Memory: 1G
-//
-// Result: CPU: 3, Memory: 3G
+// computePodResourceRequest returns the resources the pod uses from the quota it is subject to, that is the
+// higher of the sum of the requests of its containers and of the highest request of its init containers,
+// plus its overhead.
 func computePodResourceRequest(pod *v1.Pod) *framework.Resource {
-	result := &framework.Resource{}
-	for _, container := range pod.Spec.Containers {
-		result.Add(container.Resources.Requests)
-	}
-
-	// take max_resource(sum_pod, any_init_container)
-	for _, container := range pod.Spec.InitContainers {
-		result.SetMaxResource(container.Resources.Requests)
-	}
-
-	// If Overhead is being utilized, add to the total requests for the pod
-	if pod.Spec.Overhead != nil {
-		result.Add(pod.Spec.Overhead)
-	}
-
-	return result
-}
-
-// filterPodsWithPDBViolation groups the given "pods" into two groups of "violatingPods"
-// and "nonViolatingPods" based on whether their PDBs will be violated if they are
-// preempted.
-// This function is stable and does not change the order of received pods. So, if it
-// receives a sorted list, grouping will preserve the order of the input list.
-func filterPodsWithPDBViolation(podInfos []*framework.PodInfo, pdbs []*policy.PodDisruptionBudget) (violatingPods, nonViolatingPods []*framework.PodInfo) {
-	pdbsAllowed := make([]int32, len(pdbs))
-	for i, pdb := range pdbs {
-		pdbsAllowed[i] = pdb.Status.DisruptionsAllowed
-	}
-
-	for _, podInfo := range podInfos {
-		pod := podInfo.Pod
-		pdbForPodIsViolated := false
-		// A pod with no labels will not match any PDB. So, no need to check.
-		if len(pod.Labels) != 0 {
-			for i, pdb := range pdbs {
-				if pdb.Namespace != pod.Namespace {
-					continue
-				}
-				selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
-				if err != nil {
-					continue
-				}
-				// A PDB with a nil or empty selector matches nothing.
-				if selector.Empty() || !selector.Matches(labels.Set(pod.Labels)) {
-					continue
-				}
-
-				// Existing in DisruptedPods means it has been processed in API server,
-				// we don't treat it as a violating case.
-				if _, exist := pdb.Status.DisruptedPods[pod.Name]; exist {
-					continue
-				}
-				// Only decrement the matched pdb when it's not in its <DisruptedPods>;
-				// otherwise we may over-decrement the budget number.
-				pdbsAllowed[i]--
-				// We have found a matching PDB.
-				if pdbsAllowed[i] < 0 {
-					pdbForPodIsViolated = true
-				}
-			}
-		}
-		if pdbForPodIsViolated {
-			violatingPods = append(violatingPods, podInfo)
-		} else {
-			nonViolatingPods = append(nonViolatingPods, podInfo)
-		}
-	}
-	return violatingPods, nonViolatingPods
+	return framework.NewResource(util.GetPodElasticQuotaRequest(pod))
 }
 
 // assignedPod selects pods that are assigned (scheduled and running).
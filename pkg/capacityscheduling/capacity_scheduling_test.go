@@ -18,6 +18,7 @@ package capacityscheduling
 
 import (
 	"context"
+	"fmt"
 	"reflect"
 	"sort"
 	"testing"
@@ -30,6 +31,7 @@ import (
 	apiruntime "k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/informers"
 	clientsetfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/events"
 	extenderv1 "k8s.io/kube-scheduler/extender/v1"
 	"k8s.io/kubernetes/pkg/scheduler/framework"
@@ -44,6 +46,7 @@ import (
 	imageutils "k8s.io/kubernetes/test/utils/image"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/scheduler-plugins/apis/scheduling/v1alpha1"
 	testutil "sigs.k8s.io/scheduler-plugins/test/util"
 )
@@ -127,6 +130,44 @@ func TestPreFilter(t *testing.T) {
 				framework.Unschedulable,
 			},
 		},
+		{
+			name: "the borrowing limit is exceeded",
+			podInfos: []podInfo{
+				{podName: "ns1-p1", podNamespace: "ns1", memReq: 200},
+				{podName: "ns1-p2", podNamespace: "ns1", memReq: 400},
+			},
+			elasticQuotas: map[string]*ElasticQuotaInfo{
+				"ns1": {
+					Namespace: "ns1",
+					Min: &framework.Resource{
+						Memory: 1000,
+					},
+					Max: &framework.Resource{
+						Memory: 2000,
+					},
+					BorrowingCap: newUnboundedResource(v1.ResourceList{
+						v1.ResourceMemory: *resource.NewQuantity(1200, resource.BinarySI),
+					}),
+					Used: &framework.Resource{
+						Memory: 900,
+					},
+				},
+				"ns2": {
+					Namespace: "ns2",
+					Min: &framework.Resource{
+						Memory: 1000,
+					},
+					Max: &framework.Resource{
+						Memory: 2000,
+					},
+					Used: &framework.Resource{},
+				},
+			},
+			expected: []framework.Code{
+				framework.Success,
+				framework.Unschedulable,
+			},
+		},
 		{
 			name: "without elasticQuotaInfo",
 			podInfos: []podInfo{
@@ -181,6 +222,132 @@ func TestPreFilter(t *testing.T) {
 	}
 }
 
+func TestPreFilterFairSharing(t *testing.T) {
+	makeInfo := func(namespace string, used, max int64, weight *int32) *ElasticQuotaInfo {
+		return &ElasticQuotaInfo{
+			Namespace: namespace,
+			Min:       &framework.Resource{Memory: 1000},
+			Max:       &framework.Resource{Memory: max},
+			Used:      &framework.Resource{Memory: used},
+			Weight:    weight,
+		}
+	}
+	weight := int32(4)
+	tests := []struct {
+		name          string
+		fairSharing   bool
+		pod           *v1.Pod
+		pendingPods   []*v1.Pod
+		elasticQuotas map[string]*ElasticQuotaInfo
+		expected      framework.Code
+	}{
+		{
+			name:        "quota above its fair share while another quota is starved",
+			fairSharing: true,
+			pod:         makePod("a-p", "a", 100, 0, 0, 0, "a-p", ""),
+			pendingPods: []*v1.Pod{makePod("b-p", "b", 200, 0, 0, 0, "b-p", "")},
+			elasticQuotas: map[string]*ElasticQuotaInfo{
+				"a/eq": makeInfo("a", 1500, 3000, nil),
+				"b/eq": makeInfo("b", 1000, 3000, nil),
+				"c/eq": makeInfo("c", 0, 3000, nil),
+			},
+			expected: framework.Unschedulable,
+		},
+		{
+			name:        "fair sharing disabled",
+			pod:         makePod("a-p", "a", 100, 0, 0, 0, "a-p", ""),
+			pendingPods: []*v1.Pod{makePod("b-p", "b", 200, 0, 0, 0, "b-p", "")},
+			elasticQuotas: map[string]*ElasticQuotaInfo{
+				"a/eq": makeInfo("a", 1500, 3000, nil),
+				"b/eq": makeInfo("b", 1000, 3000, nil),
+				"c/eq": makeInfo("c", 0, 3000, nil),
+			},
+			expected: framework.Success,
+		},
+		{
+			name:        "quota starting to borrow",
+			fairSharing: true,
+			pod:         makePod("a-p", "a", 200, 0, 0, 0, "a-p", ""),
+			pendingPods: []*v1.Pod{makePod("b-p", "b", 200, 0, 0, 0, "b-p", "")},
+			elasticQuotas: map[string]*ElasticQuotaInfo{
+				"a/eq": makeInfo("a", 900, 3000, nil),
+				"b/eq": makeInfo("b", 1000, 3000, nil),
+				"c/eq": makeInfo("c", 0, 3000, nil),
+			},
+			expected: framework.Success,
+		},
+		{
+			name:        "weighted quota within its fair share",
+			fairSharing: true,
+			pod:         makePod("a-p", "a", 100, 0, 0, 0, "a-p", ""),
+			pendingPods: []*v1.Pod{makePod("b-p", "b", 200, 0, 0, 0, "b-p", "")},
+			elasticQuotas: map[string]*ElasticQuotaInfo{
+				"a/eq": makeInfo("a", 1500, 3000, &weight),
+				"b/eq": makeInfo("b", 1200, 3000, nil),
+				"c/eq": makeInfo("c", 0, 3000, nil),
+			},
+			expected: framework.Success,
+		},
+		{
+			name:        "pending pod of the other quota over its max",
+			fairSharing: true,
+			pod:         makePod("a-p", "a", 100, 0, 0, 0, "a-p", ""),
+			pendingPods: []*v1.Pod{makePod("b-p", "b", 200, 0, 0, 0, "b-p", "")},
+			elasticQuotas: map[string]*ElasticQuotaInfo{
+				"a/eq": makeInfo("a", 1500, 3000, nil),
+				"b/eq": makeInfo("b", 1000, 1000, nil),
+				"c/eq": makeInfo("c", 0, 3000, nil),
+			},
+			expected: framework.Success,
+		},
+		{
+			name:        "other quota without pending pods",
+			fairSharing: true,
+			pod:         makePod("a-p", "a", 100, 0, 0, 0, "a-p", ""),
+			pendingPods: []*v1.Pod{makePod("b-p", "b", 200, 0, 0, 0, "b-p", "node-a")},
+			elasticQuotas: map[string]*ElasticQuotaInfo{
+				"a/eq": makeInfo("a", 1500, 3000, nil),
+				"b/eq": makeInfo("b", 1000, 3000, nil),
+				"c/eq": makeInfo("c", 0, 3000, nil),
+			},
+			expected: framework.Success,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			registeredPlugins := []st.RegisterPluginFunc{
+				st.RegisterQueueSortPlugin(queuesort.Name, queuesort.New),
+				st.RegisterBindPlugin(defaultbinder.Name, defaultbinder.New),
+			}
+			fwk, err := st.NewFramework(
+				ctx, registeredPlugins, "",
+				frameworkruntime.WithPodNominator(testutil.NewPodNominator(nil)),
+				frameworkruntime.WithSnapshotSharedLister(testutil.NewFakeSharedLister(make([]*v1.Pod, 0), make([]*v1.Node, 0))),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cs := &CapacityScheduling{
+				elasticQuotaInfos: tt.elasticQuotas,
+				fh:                fwk,
+				fairSharing:       tt.fairSharing,
+			}
+			handler := cs.pendingPodEventHandler()
+			handler.OnAdd(tt.pod, false)
+			for _, p := range tt.pendingPods {
+				handler.OnAdd(p, false)
+			}
+			if _, got := cs.PreFilter(ctx, framework.NewCycleState(), tt.pod); got.Code() != tt.expected {
+				t.Errorf("expected %v, got %v : %v", tt.expected, got.Code(), got.Message())
+			}
+		})
+	}
+}
+
 func TestPostFilter(t *testing.T) {
 	res := map[v1.ResourceName]string{v1.ResourceMemory: "150"}
 	tests := []struct {
@@ -608,6 +775,7 @@ func TestDryRunPreemption(t *testing.T) {
 		nodes         []*v1.Node
 		nodesStatuses framework.NodeToStatusMap
 		elasticQuotas map[string]*ElasticQuotaInfo
+		fairSharing   bool
 		want          []preemption.Candidate
 	}{
 		{
@@ -714,6 +882,106 @@ func TestDryRunPreemption(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "hierarchical preemption evicts from the most overborrowed subtree first",
+			pod:  makePod("t1-p", "ns1", 50, 0, 0, highPriority, "t1-p", ""),
+			pods: []*v1.Pod{
+				makePod("t1-p1", "ns2", 50, 0, 0, midPriority, "t1-p1", "node-a"),
+				makePod("t1-p2", "ns3", 100, 0, 0, highPriority, "t1-p2", "node-a"),
+			},
+			nodes: []*v1.Node{
+				st.MakeNode().Name("node-a").Capacity(res).Obj(),
+			},
+			elasticQuotas: map[string]*ElasticQuotaInfo{
+				"org": {
+					Namespace: "org",
+					Max:       &framework.Resource{Memory: 1000},
+					Min:       &framework.Resource{Memory: 1000},
+					Used:      &framework.Resource{},
+				},
+				"ns1": {
+					Namespace: "ns1",
+					Parent:    "org",
+					Max:       &framework.Resource{Memory: 1000},
+					Min:       &framework.Resource{Memory: 100},
+					Used:      &framework.Resource{},
+				},
+				"ns2": {
+					Namespace: "ns2",
+					Parent:    "org",
+					Max:       &framework.Resource{Memory: 1000},
+					Min:       &framework.Resource{Memory: 100},
+					Used:      &framework.Resource{Memory: 150},
+				},
+				"ns3": {
+					Namespace: "ns3",
+					Parent:    "org",
+					Max:       &framework.Resource{Memory: 1000},
+					Min:       &framework.Resource{Memory: 100},
+					Used:      &framework.Resource{Memory: 250},
+				},
+			},
+			nodesStatuses: framework.NodeToStatusMap{
+				"node-a": framework.NewStatus(framework.Unschedulable),
+			},
+			want: []preemption.Candidate{
+				&candidate{
+					victims: &extenderv1.Victims{
+						Pods: []*v1.Pod{
+							makePod("t1-p2", "ns3", 100, 0, 0, highPriority, "t1-p2", "node-a"),
+						},
+						NumPDBViolations: 0,
+					},
+					name: "node-a",
+				},
+			},
+		},
+		{
+			name:        "fair sharing preemption evicts from the quota furthest above its fair share",
+			pod:         makePod("t1-p", "ns1", 50, 0, 0, highPriority, "t1-p", ""),
+			fairSharing: true,
+			pods: []*v1.Pod{
+				makePod("t1-p1", "ns1", 60, 0, 0, midPriority, "t1-p1", "node-a"),
+				makePod("t1-p2", "ns2", 80, 0, 0, midPriority, "t1-p2", "node-a"),
+			},
+			nodes: []*v1.Node{
+				st.MakeNode().Name("node-a").Capacity(res).Obj(),
+			},
+			elasticQuotas: map[string]*ElasticQuotaInfo{
+				"ns1": {
+					Namespace: "ns1",
+					Max:       &framework.Resource{Memory: 1000},
+					Min:       &framework.Resource{Memory: 50},
+					Used:      &framework.Resource{Memory: 60},
+				},
+				"ns2": {
+					Namespace: "ns2",
+					Max:       &framework.Resource{Memory: 1000},
+					Min:       &framework.Resource{Memory: 10},
+					Used:      &framework.Resource{Memory: 80},
+				},
+				"ns3": {
+					Namespace: "ns3",
+					Max:       &framework.Resource{Memory: 1000},
+					Min:       &framework.Resource{Memory: 1000},
+					Used:      &framework.Resource{},
+				},
+			},
+			nodesStatuses: framework.NodeToStatusMap{
+				"node-a": framework.NewStatus(framework.Unschedulable),
+			},
+			want: []preemption.Candidate{
+				&candidate{
+					victims: &extenderv1.Victims{
+						Pods: []*v1.Pod{
+							makePod("t1-p2", "ns2", 80, 0, 0, midPriority, "t1-p2", "node-a"),
+						},
+						NumPDBViolations: 0,
+					},
+					name: "node-a",
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -746,6 +1014,7 @@ func TestDryRunPreemption(t *testing.T) {
 			}
 
 			podReq := computePodResourceRequest(tt.pod)
+			ElasticQuotaInfos(tt.elasticQuotas).resetDescendantsUsed()
 			elasticQuotaSnapshotState := &ElasticQuotaSnapshotState{
 				elasticQuotaInfos: tt.elasticQuotas,
 			}
@@ -764,8 +1033,9 @@ func TestDryRunPreemption(t *testing.T) {
 				PdbLister:  getPDBLister(fwk.SharedInformerFactory()),
 				State:      state,
 				Interface: &preemptor{
-					fh:    fwk,
-					state: state,
+					fh:          fwk,
+					state:       state,
+					fairSharing: tt.fairSharing,
 				},
 			}
 
@@ -790,10 +1060,10 @@ func TestDryRunPreemption(t *testing.T) {
 				t.Fatalf("Unexpected candidate length: want %v, but bot %v", len(tt.want), len(got))
 			}
 			for i, c := range got {
-				if diff := gocmp.Diff(c.Victims(), got[i].Victims()); diff != "" {
+				if diff := gocmp.Diff(tt.want[i].Victims(), c.Victims()); diff != "" {
 					t.Errorf("Unexpected victims at index %v (-want, +got): %s", i, diff)
 				}
-				if diff := gocmp.Diff(c.Name(), got[i].Name()); diff != "" {
+				if diff := gocmp.Diff(tt.want[i].Name(), c.Name()); diff != "" {
 					t.Errorf("Unexpected victims at index %v (-want, +got): %s", i, diff)
 				}
 			}
@@ -1015,7 +1285,7 @@ func TestPodEligibleToPreemptOthers(t *testing.T) {
 func TestAddElasticQuota(t *testing.T) {
 	tests := []struct {
 		name          string
-		ns            []string
+		keys          []string
 		elasticQuotas []*v1alpha1.ElasticQuota
 		expected      map[string]*ElasticQuotaInfo
 	}{
@@ -1024,9 +1294,9 @@ func TestAddElasticQuota(t *testing.T) {
 			elasticQuotas: []*v1alpha1.ElasticQuota{
 				makeEQ("ns1", "t1-eq1", makeResourceList(100, 1000), makeResourceList(10, 100)),
 			},
-			ns: []string{"ns1"},
+			keys: []string{"ns1/t1-eq1"},
 			expected: map[string]*ElasticQuotaInfo{
-				"ns1": {
+				"ns1/t1-eq1": {
 					Namespace: "ns1",
 					pods:      sets.String{},
 					Max: &framework.Resource{
@@ -1049,9 +1319,9 @@ func TestAddElasticQuota(t *testing.T) {
 			elasticQuotas: []*v1alpha1.ElasticQuota{
 				makeEQ("ns1", "t1-eq1", nil, makeResourceList(10, 100)),
 			},
-			ns: []string{"ns1"},
+			keys: []string{"ns1/t1-eq1"},
 			expected: map[string]*ElasticQuotaInfo{
-				"ns1": {
+				"ns1/t1-eq1": {
 					Namespace: "ns1",
 					pods:      sets.String{},
 					Max: &framework.Resource{
@@ -1075,9 +1345,9 @@ func TestAddElasticQuota(t *testing.T) {
 			elasticQuotas: []*v1alpha1.ElasticQuota{
 				makeEQ("ns1", "t1-eq1", makeResourceList(100, 1000), nil),
 			},
-			ns: []string{"ns1"},
+			keys: []string{"ns1/t1-eq1"},
 			expected: map[string]*ElasticQuotaInfo{
-				"ns1": {
+				"ns1/t1-eq1": {
 					Namespace: "ns1",
 					pods:      sets.String{},
 					Max: &framework.Resource{
@@ -1101,9 +1371,9 @@ func TestAddElasticQuota(t *testing.T) {
 			elasticQuotas: []*v1alpha1.ElasticQuota{
 				makeEQ("ns1", "t1-eq1", nil, nil),
 			},
-			ns: []string{"ns1"},
+			keys: []string{"ns1/t1-eq1"},
 			expected: map[string]*ElasticQuotaInfo{
-				"ns1": {
+				"ns1/t1-eq1": {
 					Namespace: "ns1",
 					pods:      sets.String{},
 					Max: &framework.Resource{
@@ -1149,15 +1419,16 @@ func TestAddElasticQuota(t *testing.T) {
 			cs := &CapacityScheduling{
 				elasticQuotaInfos: map[string]*ElasticQuotaInfo{},
 				fh:                fwk,
+				podLister:         informers.NewSharedInformerFactory(clientsetfake.NewSimpleClientset(), 0).Core().V1().Pods().Lister(),
 			}
 
 			for _, elasticQuota := range tt.elasticQuotas {
 				cs.addElasticQuota(elasticQuota)
 			}
 
-			for _, ns := range tt.ns {
-				if got := cs.elasticQuotaInfos[ns]; !reflect.DeepEqual(got, tt.expected[ns]) {
-					t.Errorf("expected %v, got %v", tt.expected[ns], got)
+			for _, key := range tt.keys {
+				if got := cs.elasticQuotaInfos[key]; !reflect.DeepEqual(got, tt.expected[key]) {
+					t.Errorf("expected %v, got %v", tt.expected[key], got)
 				}
 			}
 		})
@@ -1167,7 +1438,7 @@ func TestAddElasticQuota(t *testing.T) {
 func TestUpdateElasticQuota(t *testing.T) {
 	tests := []struct {
 		name            string
-		ns              []string
+		keys            []string
 		oldElasticQuota *v1alpha1.ElasticQuota
 		newElasticQuota *v1alpha1.ElasticQuota
 		expected        map[string]*ElasticQuotaInfo
@@ -1176,9 +1447,9 @@ func TestUpdateElasticQuota(t *testing.T) {
 			name:            "Update ElasticQuota without Used",
 			oldElasticQuota: makeEQ("ns1", "t1-eq1", makeResourceList(100, 1000), makeResourceList(10, 100)),
 			newElasticQuota: makeEQ("ns1", "t1-eq1", makeResourceList(300, 1000), makeResourceList(10, 100)),
-			ns:              []string{"ns1"},
+			keys:            []string{"ns1/t1-eq1"},
 			expected: map[string]*ElasticQuotaInfo{
-				"ns1": {
+				"ns1/t1-eq1": {
 					Namespace: "ns1",
 					pods:      sets.String{},
 					Max: &framework.Resource{
@@ -1222,13 +1493,14 @@ func TestUpdateElasticQuota(t *testing.T) {
 			cs := &CapacityScheduling{
 				elasticQuotaInfos: map[string]*ElasticQuotaInfo{},
 				fh:                fwk,
+				podLister:         informers.NewSharedInformerFactory(clientsetfake.NewSimpleClientset(), 0).Core().V1().Pods().Lister(),
 			}
 			cs.addElasticQuota(tt.oldElasticQuota)
 			cs.updateElasticQuota(tt.oldElasticQuota, tt.newElasticQuota)
 
-			for _, ns := range tt.ns {
-				if got := cs.elasticQuotaInfos[ns]; !reflect.DeepEqual(got, tt.expected[ns]) {
-					t.Errorf("expected %v, got %v", tt.expected[ns], got)
+			for _, key := range tt.keys {
+				if got := cs.elasticQuotaInfos[key]; !reflect.DeepEqual(got, tt.expected[key]) {
+					t.Errorf("expected %v, got %v", tt.expected[key], got)
 				}
 			}
 		})
@@ -1238,14 +1510,22 @@ func TestUpdateElasticQuota(t *testing.T) {
 func TestDeleteElasticQuota(t *testing.T) {
 	tests := []struct {
 		name         string
-		ns           []string
+		keys         []string
 		elasticQuota *v1alpha1.ElasticQuota
+		tombstone    bool
 		expected     map[string]*ElasticQuotaInfo
 	}{
 		{
 			name:         "Delete ElasticQuota",
 			elasticQuota: makeEQ("ns1", "t1-eq1", makeResourceList(300, 1000), makeResourceList(10, 100)),
-			ns:           []string{"ns1"},
+			keys:         []string{"ns1/t1-eq1"},
+			expected:     map[string]*ElasticQuotaInfo{},
+		},
+		{
+			name:         "Delete ElasticQuota from its tombstone",
+			elasticQuota: makeEQ("ns1", "t1-eq1", makeResourceList(300, 1000), makeResourceList(10, 100)),
+			tombstone:    true,
+			keys:         []string{"ns1/t1-eq1"},
 			expected:     map[string]*ElasticQuotaInfo{},
 		},
 	}
@@ -1274,13 +1554,18 @@ func TestDeleteElasticQuota(t *testing.T) {
 			cs := &CapacityScheduling{
 				elasticQuotaInfos: map[string]*ElasticQuotaInfo{},
 				fh:                fwk,
+				podLister:         informers.NewSharedInformerFactory(clientsetfake.NewSimpleClientset(), 0).Core().V1().Pods().Lister(),
 			}
 			cs.addElasticQuota(tt.elasticQuota)
-			cs.deleteElasticQuota(tt.elasticQuota)
+			if tt.tombstone {
+				cs.deleteElasticQuota(cache.DeletedFinalStateUnknown{Key: "ns1/t1-eq1", Obj: tt.elasticQuota})
+			} else {
+				cs.deleteElasticQuota(tt.elasticQuota)
+			}
 
-			for _, ns := range tt.ns {
-				if got := cs.elasticQuotaInfos[ns]; !reflect.DeepEqual(got, tt.expected[ns]) {
-					t.Errorf("expected %v, got %v", tt.expected[ns], got)
+			for _, key := range tt.keys {
+				if got := cs.elasticQuotaInfos[key]; !reflect.DeepEqual(got, tt.expected[key]) {
+					t.Errorf("expected %v, got %v", tt.expected[key], got)
 				}
 			}
 		})
@@ -1290,7 +1575,7 @@ func TestDeleteElasticQuota(t *testing.T) {
 func TestAddPod(t *testing.T) {
 	tests := []struct {
 		name         string
-		ns           []string
+		keys         []string
 		elasticQuota *v1alpha1.ElasticQuota
 		pods         []*v1.Pod
 		expected     map[string]*ElasticQuotaInfo
@@ -1303,9 +1588,9 @@ func TestAddPod(t *testing.T) {
 				makePod("t1-p2", "ns1", 50, 10, 0, midPriority, "t1-p2", "node-a"),
 				makePod("t1-p3", "ns1", 50, 10, 0, midPriority, "t1-p3", "node-a"),
 			},
-			ns: []string{"ns1"},
+			keys: []string{"ns1/t1-eq1"},
 			expected: map[string]*ElasticQuotaInfo{
-				"ns1": {
+				"ns1/t1-eq1": {
 					Namespace: "ns1",
 					pods:      sets.NewString("t1-p1", "t1-p2", "t1-p3"),
 					Max: &framework.Resource{
@@ -1352,14 +1637,15 @@ func TestAddPod(t *testing.T) {
 			cs := &CapacityScheduling{
 				elasticQuotaInfos: map[string]*ElasticQuotaInfo{},
 				fh:                fwk,
+				podLister:         informers.NewSharedInformerFactory(clientsetfake.NewSimpleClientset(), 0).Core().V1().Pods().Lister(),
 			}
 			cs.addElasticQuota(tt.elasticQuota)
 			for _, pod := range tt.pods {
 				cs.addPod(pod)
 			}
-			for _, ns := range tt.ns {
-				if got := cs.elasticQuotaInfos[ns]; !reflect.DeepEqual(got, tt.expected[ns]) {
-					t.Errorf("expected %v, got %v", tt.expected[ns], got)
+			for _, key := range tt.keys {
+				if got := cs.elasticQuotaInfos[key]; !reflect.DeepEqual(got, tt.expected[key]) {
+					t.Errorf("expected %v, got %v", tt.expected[key], got)
 				}
 			}
 		})
@@ -1369,7 +1655,7 @@ func TestAddPod(t *testing.T) {
 func TestUpdatePod(t *testing.T) {
 	tests := []struct {
 		name         string
-		ns           []string
+		keys         []string
 		elasticQuota *v1alpha1.ElasticQuota
 		updatePods   [][2]*v1.Pod
 		expected     map[string]*ElasticQuotaInfo
@@ -1383,9 +1669,9 @@ func TestUpdatePod(t *testing.T) {
 					makePodWithStatus(makePod("t1-p1", "ns1", 100, 30, 0, highPriority, "t1-p1", "node-a"), v1.PodRunning),
 				},
 			},
-			ns: []string{"ns1"},
+			keys: []string{"ns1/t1-eq1"},
 			expected: map[string]*ElasticQuotaInfo{
-				"ns1": {
+				"ns1/t1-eq1": {
 					Namespace: "ns1",
 					pods:      sets.NewString("t1-p1"),
 					Max: &framework.Resource{
@@ -1415,9 +1701,9 @@ func TestUpdatePod(t *testing.T) {
 					makePodWithStatus(makePod("t1-p2", "ns1", 100, 30, 0, highPriority, "t1-p2", "node-a"), v1.PodFailed),
 				},
 			},
-			ns: []string{"ns1"},
+			keys: []string{"ns1/t1-eq1"},
 			expected: map[string]*ElasticQuotaInfo{
-				"ns1": {
+				"ns1/t1-eq1": {
 					Namespace: "ns1",
 					pods:      sets.String{},
 					Max: &framework.Resource{
@@ -1464,15 +1750,16 @@ func TestUpdatePod(t *testing.T) {
 			cs := &CapacityScheduling{
 				elasticQuotaInfos: map[string]*ElasticQuotaInfo{},
 				fh:                fwk,
+				podLister:         informers.NewSharedInformerFactory(clientsetfake.NewSimpleClientset(), 0).Core().V1().Pods().Lister(),
 			}
 			cs.addElasticQuota(tt.elasticQuota)
 			for _, pods := range tt.updatePods {
 				cs.addPod(pods[0])
 				cs.updatePod(pods[0], pods[1])
 			}
-			for _, ns := range tt.ns {
-				if got := cs.elasticQuotaInfos[ns]; !reflect.DeepEqual(got, tt.expected[ns]) {
-					t.Errorf("expected %v, got %v", tt.expected[ns], got)
+			for _, key := range tt.keys {
+				if got := cs.elasticQuotaInfos[key]; !reflect.DeepEqual(got, tt.expected[key]) {
+					t.Errorf("expected %v, got %v", tt.expected[key], got)
 				}
 			}
 		})
@@ -1482,7 +1769,7 @@ func TestUpdatePod(t *testing.T) {
 func TestDeletePod(t *testing.T) {
 	tests := []struct {
 		name         string
-		ns           []string
+		keys         []string
 		elasticQuota *v1alpha1.ElasticQuota
 		existingPods []*v1.Pod
 		deletePods   []*v1.Pod
@@ -1499,9 +1786,9 @@ func TestDeletePod(t *testing.T) {
 				makePod("t1-p1", "ns1", 100, 30, 0, midPriority, "t1-p1", "node-a"),
 				makePod("t1-p2", "ns1", 100, 30, 0, highPriority, "t1-p2", "node-a"),
 			},
-			ns: []string{"ns1"},
+			keys: []string{"ns1/t1-eq1"},
 			expected: map[string]*ElasticQuotaInfo{
-				"ns1": {
+				"ns1/t1-eq1": {
 					Namespace: "ns1",
 					pods:      sets.NewString(),
 					Max: &framework.Resource{
@@ -1532,9 +1819,9 @@ func TestDeletePod(t *testing.T) {
 			deletePods: []*v1.Pod{
 				makePod("t1-p1", "ns1", 100, 30, 0, midPriority, "t1-p1", "node-a"),
 			},
-			ns: []string{"ns1"},
+			keys: []string{"ns1/t1-eq1"},
 			expected: map[string]*ElasticQuotaInfo{
-				"ns1": {
+				"ns1/t1-eq1": {
 					Namespace: "ns1",
 					pods:      sets.NewString("t1-p2"),
 					Max: &framework.Resource{
@@ -1581,6 +1868,7 @@ func TestDeletePod(t *testing.T) {
 			cs := &CapacityScheduling{
 				elasticQuotaInfos: map[string]*ElasticQuotaInfo{},
 				fh:                fwk,
+				podLister:         informers.NewSharedInformerFactory(clientsetfake.NewSimpleClientset(), 0).Core().V1().Pods().Lister(),
 			}
 			cs.addElasticQuota(tt.elasticQuota)
 			for _, existingpod := range tt.existingPods {
@@ -1589,15 +1877,387 @@ func TestDeletePod(t *testing.T) {
 			for _, deletepod := range tt.deletePods {
 				cs.deletePod(deletepod)
 			}
-			for _, ns := range tt.ns {
-				if got := cs.elasticQuotaInfos[ns]; !reflect.DeepEqual(got, tt.expected[ns]) {
-					t.Errorf("expected %v, got %v", tt.expected[ns], got)
+			for _, key := range tt.keys {
+				if got := cs.elasticQuotaInfos[key]; !reflect.DeepEqual(got, tt.expected[key]) {
+					t.Errorf("expected %v, got %v", tt.expected[key], got)
 				}
 			}
 		})
 	}
 }
 
+func TestElasticQuotaPodSelector(t *testing.T) {
+	defaultEQ := makeEQ("ns1", "default", makeResourceList(100, 1000), makeResourceList(10, 100))
+	trainingEQ := makeEQ("ns1", "training", makeResourceList(100, 1000), makeResourceList(10, 100))
+	trainingEQ.Spec.PodSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"app": "training"}}
+	// other overlaps with training, which takes precedence because of its name.
+	otherEQ := makeEQ("ns1", "zz-other", makeResourceList(100, 1000), makeResourceList(10, 100))
+	otherEQ.Spec.PodSelector = &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+		{Key: "app", Operator: metav1.LabelSelectorOpExists},
+	}}
+
+	trainingPod := makePodWithStatus(makePod("t1-p1", "ns1", 50, 10, 0, midPriority, "t1-p1", "node-a"), v1.PodRunning)
+	trainingPod.Labels = map[string]string{"app": "training"}
+	inferencePod := makePodWithStatus(makePod("t1-p2", "ns1", 50, 10, 0, midPriority, "t1-p2", "node-a"), v1.PodRunning)
+	inferencePod.Labels = map[string]string{"app": "inference"}
+	unlabeledPod := makePodWithStatus(makePod("t1-p3", "ns1", 50, 10, 0, midPriority, "t1-p3", "node-a"), v1.PodRunning)
+
+	podInformer := informers.NewSharedInformerFactory(clientsetfake.NewSimpleClientset(), 0).Core().V1().Pods()
+	cs := &CapacityScheduling{
+		elasticQuotaInfos: map[string]*ElasticQuotaInfo{},
+		podLister:         podInformer.Lister(),
+	}
+	expectPods := func(step string, expected map[string]sets.String) {
+		t.Helper()
+		for key, pods := range expected {
+			info := cs.elasticQuotaInfos[key]
+			if info == nil {
+				t.Fatalf("%v: expected ElasticQuota %v to exist", step, key)
+			}
+			if !info.pods.Equal(pods) {
+				t.Errorf("%v: expected ElasticQuota %v to have pods %v, got %v", step, key, pods.List(), info.pods.List())
+			}
+			if info.Used.Memory != int64(pods.Len())*50 {
+				t.Errorf("%v: expected ElasticQuota %v to use %v memory, got %v", step, key, pods.Len()*50, info.Used.Memory)
+			}
+			for _, podKey := range pods.List() {
+				if got := cs.podElasticQuotas[podKey]; got != key {
+					t.Errorf("%v: expected pod %v to be tracked in ElasticQuota %v, got %q", step, podKey, key, got)
+				}
+			}
+		}
+	}
+
+	cs.addElasticQuota(defaultEQ)
+	for _, pod := range []*v1.Pod{trainingPod, inferencePod, unlabeledPod} {
+		podInformer.Informer().GetStore().Add(pod)
+		cs.addPod(pod)
+	}
+	expectPods("only the default quota", map[string]sets.String{
+		"ns1/default": sets.NewString("t1-p1", "t1-p2", "t1-p3"),
+	})
+
+	cs.addElasticQuota(otherEQ)
+	cs.addElasticQuota(trainingEQ)
+	expectPods("quotas with a pod selector added", map[string]sets.String{
+		"ns1/default":  sets.NewString("t1-p3"),
+		"ns1/training": sets.NewString("t1-p1"),
+		"ns1/zz-other": sets.NewString("t1-p2"),
+	})
+
+	relabeledPod := unlabeledPod.DeepCopy()
+	relabeledPod.Labels = map[string]string{"app": "training"}
+	podInformer.Informer().GetStore().Update(relabeledPod)
+	cs.updatePod(unlabeledPod, relabeledPod)
+	expectPods("pod relabeled", map[string]sets.String{
+		"ns1/default":  sets.NewString(),
+		"ns1/training": sets.NewString("t1-p1", "t1-p3"),
+		"ns1/zz-other": sets.NewString("t1-p2"),
+	})
+
+	cs.deleteElasticQuota(trainingEQ)
+	expectPods("quota with a pod selector deleted", map[string]sets.String{
+		"ns1/default":  sets.NewString(),
+		"ns1/zz-other": sets.NewString("t1-p1", "t1-p2", "t1-p3"),
+	})
+
+	podInformer.Informer().GetStore().Delete(inferencePod)
+	cs.deletePod(inferencePod)
+	expectPods("pod deleted", map[string]sets.String{
+		"ns1/zz-other": sets.NewString("t1-p1", "t1-p3"),
+	})
+	if _, ok := cs.podElasticQuotas["t1-p2"]; ok {
+		t.Errorf("expected the deleted pod not to be tracked anymore")
+	}
+}
+
+func TestElasticQuotaNamespaceSelector(t *testing.T) {
+	pooledEQ := makeEQ("admin", "team-a", makeResourceList(100, 120), makeResourceList(10, 100))
+	pooledEQ.Spec.NamespaceSelector = &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}}
+	// The quota of its own namespace takes precedence over the pooled quota.
+	ownEQ := makeEQ("team-a-2", "own", makeResourceList(100, 1000), makeResourceList(10, 100))
+
+	pod1 := makePodWithStatus(makePod("t1-p1", "team-a-1", 50, 10, 0, midPriority, "t1-p1", "node-a"), v1.PodRunning)
+	pod2 := makePodWithStatus(makePod("t1-p2", "team-a-2", 50, 10, 0, midPriority, "t1-p2", "node-a"), v1.PodRunning)
+	pod3 := makePodWithStatus(makePod("t1-p3", "team-a-3", 50, 10, 0, midPriority, "t1-p3", "node-a"), v1.PodRunning)
+
+	informerFactory := informers.NewSharedInformerFactory(clientsetfake.NewSimpleClientset(), 0)
+	podInformer := informerFactory.Core().V1().Pods()
+	namespaceInformer := informerFactory.Core().V1().Namespaces()
+	namespaces := map[string]*v1.Namespace{}
+	for _, name := range []string{"team-a-1", "team-a-2", "team-a-3"} {
+		namespaces[name] = &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"team": "a"}}}
+		namespaceInformer.Informer().GetStore().Add(namespaces[name])
+	}
+	cs := &CapacityScheduling{
+		elasticQuotaInfos: map[string]*ElasticQuotaInfo{},
+		podLister:         podInformer.Lister(),
+		namespaceLister:   namespaceInformer.Lister(),
+		client:            fake.NewClientBuilder().WithScheme(scheme).Build(),
+	}
+	expectPods := func(step string, expected map[string]sets.String) {
+		t.Helper()
+		for key, pods := range expected {
+			info := cs.elasticQuotaInfos[key]
+			if info == nil {
+				t.Fatalf("%v: expected ElasticQuota %v to exist", step, key)
+			}
+			if !info.pods.Equal(pods) {
+				t.Errorf("%v: expected ElasticQuota %v to have pods %v, got %v", step, key, pods.List(), info.pods.List())
+			}
+			if info.Used.Memory != int64(pods.Len())*50 {
+				t.Errorf("%v: expected ElasticQuota %v to use %v memory, got %v", step, key, pods.Len()*50, info.Used.Memory)
+			}
+			for _, podKey := range pods.List() {
+				if got := cs.podElasticQuotas[podKey]; got != key {
+					t.Errorf("%v: expected pod %v to be tracked in ElasticQuota %v, got %q", step, podKey, key, got)
+				}
+			}
+		}
+	}
+
+	cs.addElasticQuota(ownEQ)
+	for _, pod := range []*v1.Pod{pod1, pod2, pod3} {
+		podInformer.Informer().GetStore().Add(pod)
+		cs.addPod(pod)
+	}
+	expectPods("only the quota of a namespace", map[string]sets.String{
+		"team-a-2/own": sets.NewString("t1-p2"),
+	})
+
+	cs.addElasticQuota(pooledEQ)
+	expectPods("pooled quota added", map[string]sets.String{
+		"admin/team-a": sets.NewString("t1-p1", "t1-p3"),
+		"team-a-2/own": sets.NewString("t1-p2"),
+	})
+	// The Max of the pooled quota bounds the usage of all its namespaces.
+	newPod := makePod("t1-p4", "team-a-1", 50, 10, 0, midPriority, "t1-p4", "")
+	key, _ := cs.elasticQuotaInfos.getElasticQuotaInfo(newPod)
+	if key != "admin/team-a" {
+		t.Fatalf("expected the new pod to be subject to the pooled quota, got %q", key)
+	}
+	if overMax := cs.elasticQuotaInfos.usedOverMaxWith(key, computePodResourceRequest(newPod)); overMax != key {
+		t.Errorf("expected the pooled quota to be over its Max, got %q", overMax)
+	}
+
+	relabeled := namespaces["team-a-3"].DeepCopy()
+	relabeled.Labels = map[string]string{"team": "b"}
+	namespaceInformer.Informer().GetStore().Update(relabeled)
+	cs.updateNamespace(namespaces["team-a-3"], relabeled)
+	expectPods("namespace left the pool", map[string]sets.String{
+		"admin/team-a": sets.NewString("t1-p1"),
+		"team-a-2/own": sets.NewString("t1-p2"),
+	})
+
+	cs.deleteElasticQuota(ownEQ)
+	expectPods("quota of a namespace deleted", map[string]sets.String{
+		"admin/team-a": sets.NewString("t1-p1", "t1-p2"),
+	})
+}
+
+func TestElasticQuotaFlavors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	makeNode := func(name string, labels map[string]string) *v1.Node {
+		return &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+	a100Node := makeNode("node-a", map[string]string{"gpu": "a100"})
+	t4Node := makeNode("node-b", map[string]string{"gpu": "t4"})
+	cpuNode := makeNode("node-c", nil)
+	nodes := []*v1.Node{a100Node, t4Node, cpuNode}
+
+	flavor := func(name, gpu string, min, max v1.ResourceList) v1alpha1.ElasticQuotaFlavor {
+		return v1alpha1.ElasticQuotaFlavor{
+			Name:         name,
+			NodeSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"gpu": gpu}},
+			Min:          min,
+			Max:          max,
+		}
+	}
+	memory := func(value int64) v1.ResourceList {
+		return v1.ResourceList{v1.ResourceMemory: *resource.NewQuantity(value, resource.BinarySI)}
+	}
+	eq1 := makeEQ("ns1", "eq1", makeResourceList(1000, 1000), makeResourceList(500, 500))
+	eq1.Spec.Flavors = []v1alpha1.ElasticQuotaFlavor{
+		flavor("a100", "a100", memory(100), memory(200)),
+		flavor("t4", "t4", nil, memory(50)),
+	}
+	eq2 := makeEQ("ns2", "eq2", makeResourceList(1000, 1000), makeResourceList(500, 500))
+	eq2.Spec.Flavors = []v1alpha1.ElasticQuotaFlavor{flavor("a100", "a100", memory(100), nil)}
+
+	informerFactory := informers.NewSharedInformerFactory(clientsetfake.NewSimpleClientset(), 0)
+	podInformer := informerFactory.Core().V1().Pods()
+	nodeInformer := informerFactory.Core().V1().Nodes()
+	for _, node := range nodes {
+		nodeInformer.Informer().GetStore().Add(node)
+	}
+	fwk, err := st.NewFramework(
+		ctx, []st.RegisterPluginFunc{
+			st.RegisterQueueSortPlugin(queuesort.Name, queuesort.New),
+			st.RegisterBindPlugin(defaultbinder.Name, defaultbinder.New),
+		}, "",
+		frameworkruntime.WithPodNominator(testutil.NewPodNominator(nil)),
+		frameworkruntime.WithSnapshotSharedLister(testutil.NewFakeSharedLister(nil, nodes)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := &CapacityScheduling{
+		elasticQuotaInfos: map[string]*ElasticQuotaInfo{},
+		podLister:         podInformer.Lister(),
+		nodeLister:        nodeInformer.Lister(),
+		fh:                fwk,
+	}
+	cs.addElasticQuota(eq1)
+	cs.addElasticQuota(eq2)
+
+	p1 := makePodWithStatus(makePod("p1", "ns1", 100, 0, 0, midPriority, "p1", "node-a"), v1.PodRunning)
+	p2 := makePodWithStatus(makePod("p2", "ns2", 50, 0, 0, midPriority, "p2", "node-a"), v1.PodRunning)
+	podInformer.Informer().GetStore().Add(p1)
+	cs.addPod(p1)
+	if used := cs.elasticQuotaInfos["ns1/eq1"].getFlavor("a100").Used.Memory; used != 100 {
+		t.Errorf("expected flavor a100 of ns1/eq1 to use 100 memory, got %v", used)
+	}
+
+	expectFilter := func(step string, pod *v1.Pod, expected map[string]framework.Code) {
+		t.Helper()
+		state := framework.NewCycleState()
+		if _, status := cs.PreFilter(ctx, state, pod); !status.IsSuccess() {
+			t.Fatalf("%v: expected PreFilter to succeed, got %v", step, status.Message())
+		}
+		for _, node := range nodes {
+			nodeInfo := framework.NewNodeInfo()
+			nodeInfo.SetNode(node)
+			if got := cs.Filter(ctx, state, pod, nodeInfo); got.Code() != expected[node.Name] {
+				t.Errorf("%v: expected %v on %v, got %v : %v", step, expected[node.Name], node.Name, got.Code(), got.Message())
+			}
+		}
+	}
+	pod := makePod("p3", "ns1", 60, 0, 0, midPriority, "p3", "")
+	expectFilter("borrowing the unused Min of the flavor", pod, map[string]framework.Code{
+		"node-a": framework.Success,
+		"node-b": framework.Unschedulable,
+		"node-c": framework.Success,
+	})
+	expectFilter("over the Max of the flavor", makePod("p4", "ns1", 150, 0, 0, midPriority, "p4", ""), map[string]framework.Code{
+		"node-a": framework.Unschedulable,
+		"node-b": framework.Unschedulable,
+		"node-c": framework.Success,
+	})
+
+	podInformer.Informer().GetStore().Add(p2)
+	cs.addPod(p2)
+	expectFilter("Min of the flavor used by the other quotas", pod, map[string]framework.Code{
+		"node-a": framework.Unschedulable,
+		"node-b": framework.Unschedulable,
+		"node-c": framework.Success,
+	})
+
+	podInformer.Informer().GetStore().Delete(p2)
+	cs.deletePod(p2)
+	if used := cs.elasticQuotaInfos["ns2/eq2"].getFlavor("a100").Used.Memory; used != 0 {
+		t.Errorf("expected flavor a100 of ns2/eq2 to use no memory once its pod deleted, got %v", used)
+	}
+
+	// The pods are charged again to the flavors of their nodes when the flavors change.
+	newEQ1 := eq1.DeepCopy()
+	newEQ1.Spec.Flavors = []v1alpha1.ElasticQuotaFlavor{flavor("a100", "t4", memory(100), memory(200))}
+	cs.updateElasticQuota(eq1, newEQ1)
+	if used := cs.elasticQuotaInfos["ns1/eq1"].getFlavor("a100").Used.Memory; used != 0 {
+		t.Errorf("expected flavor a100 of ns1/eq1 to use no memory once it no longer selects node-a, got %v", used)
+	}
+	if used := cs.elasticQuotaInfos["ns1/eq1"].Used.Memory; used != 100 {
+		t.Errorf("expected ns1/eq1 to still use 100 memory, got %v", used)
+	}
+}
+
+// BenchmarkPreFilter measures PreFilter with 2000 quotas, either unchanged between the scheduling cycles or
+// with one of them changed by a pod reserved or unreserved before each cycle. Its cost doesn't depend on the
+// total number of pods subject to the quotas.
+func BenchmarkPreFilter(b *testing.B) {
+	const numQuotas = 2000
+	// In the quota trees, the quotas are the children of numQuotas/childrenPerParent parent quotas, and
+	// lend at most half of their Min.
+	const childrenPerParent = 50
+	for _, numPods := range []int{5000, 20000, 50000} {
+		for _, tc := range []struct{ hierarchical, changed bool }{{false, false}, {false, true}, {true, false}, {true, true}} {
+			hierarchical, changed := tc.hierarchical, tc.changed
+			name := fmt.Sprintf("%d pods", numPods)
+			if hierarchical {
+				name += "/quota trees"
+			}
+			if changed {
+				name += "/one changed quota"
+			} else {
+				name += "/unchanged quotas"
+			}
+			b.Run(name, func(b *testing.B) {
+				ctx := context.Background()
+				fwk, err := st.NewFramework(
+					ctx, []st.RegisterPluginFunc{
+						st.RegisterQueueSortPlugin(queuesort.Name, queuesort.New),
+						st.RegisterBindPlugin(defaultbinder.Name, defaultbinder.New),
+					}, "",
+					frameworkruntime.WithPodNominator(testutil.NewPodNominator(nil)),
+					frameworkruntime.WithSnapshotSharedLister(testutil.NewFakeSharedLister(nil, []*v1.Node{st.MakeNode().Name("node-a").Obj()})),
+				)
+				if err != nil {
+					b.Fatal(err)
+				}
+				cs := &CapacityScheduling{
+					elasticQuotaInfos: NewElasticQuotaInfos(),
+					fh:                fwk,
+				}
+				for i := 0; i < numQuotas; i++ {
+					namespace := fmt.Sprintf("ns%d", i)
+					info := newElasticQuotaInfo(namespace,
+						makeResourceList(100*int64(numPods), 100*int64(numPods)), makeResourceList(int64(numPods), int64(numPods)), nil)
+					if hierarchical {
+						info.Parent = getElasticQuotaKey(fmt.Sprintf("org%d", i/childrenPerParent), "eq")
+						info.LendingLimit = framework.NewResource(makeResourceList(50*int64(numPods), 50*int64(numPods)))
+					}
+					cs.elasticQuotaInfos[getElasticQuotaKey(namespace, "eq")] = info
+				}
+				if hierarchical {
+					for i := 0; i < numQuotas/childrenPerParent; i++ {
+						namespace := fmt.Sprintf("org%d", i)
+						min := makeResourceList(childrenPerParent*100*int64(numPods), childrenPerParent*100*int64(numPods))
+						cs.elasticQuotaInfos[getElasticQuotaKey(namespace, "eq")] = newElasticQuotaInfo(namespace, min, min, nil)
+					}
+				}
+				for i := 0; i < numPods; i++ {
+					name := fmt.Sprintf("p%d", i)
+					pod := makePod(name, fmt.Sprintf("ns%d", i%numQuotas), 1, 1, 0, midPriority, name, "node-a")
+					if err := cs.elasticQuotaInfos[getElasticQuotaKey(pod.Namespace, "eq")].addPodIfNotPresent(pod, nil); err != nil {
+						b.Fatal(err)
+					}
+				}
+				cs.elasticQuotaTreesChanged()
+				pod := makePod("preemptor", "ns0", 1, 1, 0, midPriority, "preemptor", "")
+				reserved := makePod("reserved", "ns1", 1, 1, 0, midPriority, "reserved", "node-a")
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if changed {
+						b.StopTimer()
+						if i%2 == 0 {
+							cs.Reserve(ctx, nil, reserved, "node-a")
+						} else {
+							cs.Unreserve(ctx, nil, reserved, "node-a")
+						}
+						b.StartTimer()
+					}
+					if _, status := cs.PreFilter(ctx, framework.NewCycleState(), pod); !status.IsSuccess() {
+						b.Fatal(status.AsError())
+					}
+				}
+			})
+		}
+	}
+}
+
 func makePod(podName string, namespace string, memReq int64, cpuReq int64, gpuReq int64, priority int32, uid string, nodeName string) *v1.Pod {
 	pause := imageutils.GetPauseImageName()
 	pod := st.MakePod().Namespace(namespace).Name(podName).Container(pause).
@@ -18,10 +18,13 @@ package capacityscheduling
 
 import (
 	"math"
+	"reflect"
 
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/sets"
+	quota "k8s.io/apiserver/pkg/quota/v1"
 	"k8s.io/kubernetes/pkg/scheduler/framework"
 	"sigs.k8s.io/scheduler-plugins/pkg/util"
 )
@@ -37,35 +40,486 @@ func NewElasticQuotaInfos() ElasticQuotaInfos {
 	return make(ElasticQuotaInfos)
 }
 
-func (e ElasticQuotaInfos) clone() ElasticQuotaInfos {
-	elasticQuotas := make(ElasticQuotaInfos)
-	for key, elasticQuotaInfo := range e {
-		elasticQuotas[key] = elasticQuotaInfo.clone()
+// aggregatedUsedOverMinWith checks whether the podRequest of a pod subject to the quota of the given key
+// makes the total usage of the quotas exceed the total of their Min. The unused Min the other quotas don't
+// lend because of their lending limits counts as used.
+func (e ElasticQuotaInfos) aggregatedUsedOverMinWith(key string, podRequest framework.Resource) bool {
+	used := framework.NewResource(nil)
+	for _, elasticQuotaInfo := range e {
+		used.Add(util.ResourceList(elasticQuotaInfo.Used))
 	}
-	return elasticQuotas
+
+	used.Add(util.ResourceList(e.unlendableMinFor(key)))
+	used.Add(util.ResourceList(&podRequest))
+	return cmp(used, e.totalMin(), LowerBoundOfMin)
 }
 
-func (e ElasticQuotaInfos) aggregatedUsedOverMinWith(podRequest framework.Resource) bool {
-	used := framework.NewResource(nil)
-	min := framework.NewResource(nil)
+// flavorUsedOverMinWith checks whether the podRequest makes the total usage of the flavors of the given name of
+// the quotas exceed the total of their Min, for the resources listed in the Min of the flavors.
+func (e ElasticQuotaInfos) flavorUsedOverMinWith(name string, podRequest *framework.Resource) bool {
+	used := podRequest.Clone()
+	var min v1.ResourceList
+	for _, info := range e {
+		if flavor := info.getFlavor(name); flavor != nil {
+			used.Add(util.ResourceList(flavor.Used))
+			min = quota.Add(min, flavor.Min)
+		}
+	}
+	fits, _ := quota.LessThanOrEqual(util.ResourceList(used), min)
+	return !fits
+}
 
+// totalMin returns the total of the Min of the quotas. Since the Min of a quota includes the Min of its
+// descendants, only the Min of the roots of the quota trees are summed up.
+func (e ElasticQuotaInfos) totalMin() *framework.Resource {
+	min := framework.NewResource(nil)
 	for _, elasticQuotaInfo := range e {
-		used.Add(util.ResourceList(elasticQuotaInfo.Used))
-		min.Add(util.ResourceList(elasticQuotaInfo.Min))
+		if e.isRoot(elasticQuotaInfo) {
+			min.Add(util.ResourceList(elasticQuotaInfo.Min))
+		}
 	}
+	return min
+}
 
-	used.Add(util.ResourceList(&podRequest))
-	return cmp(used, min, LowerBoundOfMin)
+// unlendableMinFor returns the unused Min of the quotas that the lending limits of the quotas keep from
+// the quota of the given key. The lending limit of a quota doesn't apply to its descendants, and the
+// lending limit of an ancestor bounds what the quotas of its subtree keep together.
+func (e ElasticQuotaInfos) unlendableMinFor(key string) *framework.Resource {
+	lineage := sets.NewString(e.lineage(key)...)
+	children := make(map[string][]string)
+	var roots []string
+	for k, info := range e {
+		if e.isRoot(info) {
+			roots = append(roots, k)
+		} else {
+			children[info.Parent] = append(children[info.Parent], k)
+		}
+	}
+
+	var unlendable func(k string) *framework.Resource
+	unlendable = func(k string) *framework.Resource {
+		kept := framework.NewResource(nil)
+		for _, child := range children[k] {
+			kept.Add(util.ResourceList(unlendable(child)))
+		}
+		if !lineage.Has(k) {
+			kept = maxResource(kept, e.unlendableMin(k))
+		}
+		return kept
+	}
+
+	kept := framework.NewResource(nil)
+	for _, root := range roots {
+		kept.Add(util.ResourceList(unlendable(root)))
+	}
+	return kept
+}
+
+// unlendableMin returns the unused Min of the quota of the given key, which the quota and its descendants
+// don't use, beyond its lending limit.
+func (e ElasticQuotaInfos) unlendableMin(key string) *framework.Resource {
+	kept := framework.NewResource(nil)
+	info := e[key]
+	if info == nil || info.LendingLimit == nil || info.Min == nil {
+		return kept
+	}
+	used := e.subtreeUsed(key)
+	unlendable := func(min, used, limit int64) int64 {
+		if unused := min - used; unused > limit {
+			return unused - limit
+		}
+		return 0
+	}
+	kept.MilliCPU = unlendable(info.Min.MilliCPU, used.MilliCPU, info.LendingLimit.MilliCPU)
+	kept.Memory = unlendable(info.Min.Memory, used.Memory, info.LendingLimit.Memory)
+	kept.EphemeralStorage = unlendable(info.Min.EphemeralStorage, used.EphemeralStorage, info.LendingLimit.EphemeralStorage)
+	for name, min := range info.Min.ScalarResources {
+		if limit, ok := info.LendingLimit.ScalarResources[name]; ok {
+			kept.SetScalar(name, unlendable(min, used.ScalarResources[name], limit))
+		}
+	}
+	return kept
+}
+
+// isRoot checks whether the quota is the root of its quota tree.
+func (e ElasticQuotaInfos) isRoot(info *ElasticQuotaInfo) bool {
+	return len(info.Parent) == 0 || e[info.Parent] == nil
+}
+
+// elasticQuotaIndex is the keys of the quotas applying to each namespace, so that the quota of a pod is looked
+// for among the quotas of its namespace only. An index is replaced, never modified, once the quotas or the
+// namespaces they apply to change, so that it can be shared by the snapshots of the quotas.
+type elasticQuotaIndex map[string][]string
+
+// newElasticQuotaIndex returns the index of the quotas by the namespaces they apply to.
+func newElasticQuotaIndex(e ElasticQuotaInfos) elasticQuotaIndex {
+	index := make(elasticQuotaIndex)
+	for key, info := range e {
+		for _, namespace := range info.namespaces() {
+			index[namespace] = append(index[namespace], key)
+		}
+	}
+	return index
+}
+
+// hasNamespace checks whether a quota applying to the namespace is known, looking it up in the index, if any.
+func (e ElasticQuotaInfos) hasNamespace(index elasticQuotaIndex, namespace string) bool {
+	if index != nil {
+		return len(index[namespace]) != 0
+	}
+	for _, info := range e {
+		if info.scope().AppliesTo(namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+// getIndexedElasticQuotaInfo is getElasticQuotaInfo among the quotas of the namespace of the pod in the index,
+// or among all the quotas without index.
+func (e ElasticQuotaInfos) getIndexedElasticQuotaInfo(index elasticQuotaIndex, pod *v1.Pod) (string, *ElasticQuotaInfo) {
+	if index == nil {
+		return e.getElasticQuotaInfo(pod)
+	}
+	var key string
+	var info *ElasticQuotaInfo
+	for _, k := range index[pod.Namespace] {
+		if candidate := e[k]; candidate != nil {
+			key, info = preferElasticQuotaInfo(pod, key, info, k, candidate)
+		}
+	}
+	return key, info
+}
+
+// getElasticQuotaInfo returns the key and the ElasticQuotaInfo of the quota the pod is subject to,
+// or nil if the pod isn't subject to any quota.
+func (e ElasticQuotaInfos) getElasticQuotaInfo(pod *v1.Pod) (string, *ElasticQuotaInfo) {
+	var key string
+	var info *ElasticQuotaInfo
+	for k, candidate := range e {
+		key, info = preferElasticQuotaInfo(pod, key, info, k, candidate)
+	}
+	return key, info
+}
+
+// preferElasticQuotaInfo returns the key and the ElasticQuotaInfo of the candidate quota if it selects the pod
+// and takes precedence over the given quota, if any, and those of the given quota otherwise.
+func preferElasticQuotaInfo(pod *v1.Pod, key string, info *ElasticQuotaInfo, candidateKey string, candidate *ElasticQuotaInfo) (string, *ElasticQuotaInfo) {
+	if !candidate.scope().SelectsPod(pod) {
+		return key, info
+	}
+	if info == nil || util.ElasticQuotaTakesPrecedence(candidateKey, candidate.scope(), key, info.scope()) {
+		return candidateKey, candidate
+	}
+	return key, info
+}
+
+// lineage returns the given key followed by the keys of the ancestors of the quota, up to the root of its tree.
+func (e ElasticQuotaInfos) lineage(key string) []string {
+	var keys []string
+	visited := sets.NewString()
+	for len(key) != 0 && !visited.Has(key) {
+		info := e[key]
+		if info == nil {
+			break
+		}
+		visited.Insert(key)
+		keys = append(keys, key)
+		key = info.Parent
+	}
+	return keys
+}
+
+// subtreeUsed returns the resources used by the quota of the given key and all its descendants.
+func (e ElasticQuotaInfos) subtreeUsed(key string) *framework.Resource {
+	info := e[key]
+	if info == nil {
+		return framework.NewResource(nil)
+	}
+	used := framework.NewResource(nil)
+	if info.Used != nil {
+		used.Add(util.ResourceList(info.Used))
+	}
+	if info.descendantsUsed != nil {
+		used.Add(util.ResourceList(info.descendantsUsed))
+	}
+	return used
+}
+
+// resetDescendantsUsed computes again the usage of the descendants of every quota, after the quota trees
+// changed, and returns the keys of the quotas whose descendants usage changed.
+func (e ElasticQuotaInfos) resetDescendantsUsed() []string {
+	descendantsUsed := make(map[string]*framework.Resource)
+	for key, info := range e {
+		if info.Used == nil {
+			continue
+		}
+		for _, ancestor := range e.lineage(key)[1:] {
+			if descendantsUsed[ancestor] == nil {
+				descendantsUsed[ancestor] = framework.NewResource(nil)
+			}
+			descendantsUsed[ancestor].Add(util.ResourceList(info.Used))
+		}
+	}
+	var changed []string
+	for key, info := range e {
+		if used := descendantsUsed[key]; !reflect.DeepEqual(used, info.descendantsUsed) {
+			info.descendantsUsed = used
+			changed = append(changed, key)
+		}
+	}
+	return changed
+}
+
+// updateAncestorsUsed adds the request, times sign, to the usage of the descendants of the ancestors of the
+// quota of the given key, after the usage of the quota changed by as much.
+func (e ElasticQuotaInfos) updateAncestorsUsed(key string, request *framework.Resource, sign int64) {
+	for _, ancestor := range e.lineage(key)[1:] {
+		info := e[ancestor]
+		if info.descendantsUsed == nil {
+			info.descendantsUsed = framework.NewResource(nil)
+		}
+		used := info.descendantsUsed
+		used.MilliCPU += sign * request.MilliCPU
+		used.Memory += sign * request.Memory
+		used.EphemeralStorage += sign * request.EphemeralStorage
+		for name, value := range request.ScalarResources {
+			used.SetScalar(name, used.ScalarResources[name]+sign*value)
+		}
+	}
+}
+
+// reserveResource adds the request to the usage of the quota of the given key and of its ancestors.
+func (e ElasticQuotaInfos) reserveResource(key string, request *framework.Resource) {
+	if info := e[key]; info != nil {
+		info.reserveResource(*request)
+		e.updateAncestorsUsed(key, request, 1)
+	}
+}
+
+// unreserveResource subtracts the request from the usage of the quota of the given key and of its ancestors.
+func (e ElasticQuotaInfos) unreserveResource(key string, request *framework.Resource) {
+	if info := e[key]; info != nil {
+		info.unreserveResource(*request)
+		e.updateAncestorsUsed(key, request, -1)
+	}
+}
+
+// addPod adds the pod to the quota of the given key, if it isn't there yet, and returns whether it was added.
+func (e ElasticQuotaInfos) addPod(key string, pod *v1.Pod, node *v1.Node) (bool, error) {
+	info := e[key]
+	if info == nil {
+		return false, nil
+	}
+	podKey, err := framework.GetPodKey(pod)
+	if err != nil || info.pods.Has(podKey) {
+		return false, err
+	}
+	if err := info.addPodIfNotPresent(pod, node); err != nil {
+		return false, err
+	}
+	e.updateAncestorsUsed(key, computePodResourceRequest(pod), 1)
+	return true, nil
+}
+
+// deletePod deletes the pod from the quota of the given key, if it is there, and returns whether it was deleted.
+func (e ElasticQuotaInfos) deletePod(key string, pod *v1.Pod) (bool, error) {
+	info := e[key]
+	if info == nil {
+		return false, nil
+	}
+	podKey, err := framework.GetPodKey(pod)
+	if err != nil || !info.pods.Has(podKey) {
+		return false, err
+	}
+	if err := info.deletePodIfPresent(pod); err != nil {
+		return false, err
+	}
+	e.updateAncestorsUsed(key, computePodResourceRequest(pod), -1)
+	return true, nil
+}
+
+// usedOverMaxWith returns the key of the quota, among the quota of the given key and its ancestors, whose
+// Max gets exceeded with the podRequest, or an empty string. The usage of an ancestor includes the usage
+// of all its descendants.
+func (e ElasticQuotaInfos) usedOverMaxWith(key string, podRequest *framework.Resource) string {
+	for _, k := range e.lineage(key) {
+		if e[k].Max == nil {
+			continue
+		}
+		if cmp2(podRequest, e.subtreeUsed(k), e[k].Max, UpperBoundOfMax) {
+			return k
+		}
+	}
+	return ""
+}
+
+// usedOverBorrowingLimitWith returns the key of the quota, among the quota of the given key and its ancestors,
+// which borrows more than its borrowing limit with the podRequest, or an empty string. The usage of an ancestor
+// includes the usage of all its descendants.
+func (e ElasticQuotaInfos) usedOverBorrowingLimitWith(key string, podRequest *framework.Resource) string {
+	for _, k := range e.lineage(key) {
+		if e[k].BorrowingCap == nil {
+			continue
+		}
+		if cmp2(podRequest, e.subtreeUsed(k), e[k].BorrowingCap, UpperBoundOfMax) {
+			return k
+		}
+	}
+	return ""
+}
+
+// subtreeUsedOverMin checks whether the quota of the given key and its descendants use more than its Min.
+func (e ElasticQuotaInfos) subtreeUsedOverMin(key string) bool {
+	info := e[key]
+	if info == nil {
+		return false
+	}
+	if info.Min == nil {
+		return true
+	}
+	return cmp(e.subtreeUsed(key), info.Min, LowerBoundOfMin)
+}
+
+// reclaimableBranch returns the key of the branch the quota of victimKey borrows resources through, as seen
+// from the quota of preemptorKey: the ancestor of the victim quota, or the victim quota itself, right below
+// their lowest common ancestor, or the root of the tree of the victim quota if they don't share a tree.
+// The pods of the victim quota can be preempted to give the preemptor quota back its Min only if both
+// the victim quota and that branch use more than their Min: the unused Min of a quota is lent to its
+// siblings first, and borrowing within the Min of a common ancestor is only reclaimed by its descendants.
+func (e ElasticQuotaInfos) reclaimableBranch(victimKey, preemptorKey string) (string, bool) {
+	preemptorLineage := sets.NewString(e.lineage(preemptorKey)...)
+	var branch string
+	for _, k := range e.lineage(victimKey) {
+		if preemptorLineage.Has(k) {
+			break
+		}
+		branch = k
+	}
+	if len(branch) == 0 || !e.subtreeUsedOverMin(victimKey) || !e.subtreeUsedOverMin(branch) {
+		return "", false
+	}
+	return branch, true
+}
+
+// borrowedShare returns the greatest ratio, among the resources, between the resources used by the quota
+// of the given key and its descendants, and its Min. The higher, the more the subtree borrows.
+func (e ElasticQuotaInfos) borrowedShare(key string) float64 {
+	info := e[key]
+	if info == nil {
+		return 0
+	}
+	return usageRatio(e.subtreeUsed(key), info.Min)
+}
+
+// usageRatio returns the greatest ratio, among the resources, between used and min, infinite if a resource
+// is used without min.
+func usageRatio(used, min *framework.Resource) float64 {
+	if min == nil {
+		min = framework.NewResource(nil)
+	}
+	var ratio float64
+	update := func(u, m int64) {
+		if u <= 0 {
+			return
+		}
+		if m <= 0 {
+			ratio = math.Inf(1)
+		} else if float64(u)/float64(m) > ratio {
+			ratio = float64(u) / float64(m)
+		}
+	}
+	update(used.MilliCPU, min.MilliCPU)
+	update(used.Memory, min.Memory)
+	update(used.EphemeralStorage, min.EphemeralStorage)
+	for name, quant := range used.ScalarResources {
+		update(quant, min.ScalarResources[name])
+	}
+	return ratio
+}
+
+// dominantShareWith returns the weighted dominant share of the quota of the given key in the borrowed capacity
+// with the podRequest, if any: the greatest ratio, among the resources, between what the quota and its
+// descendants use above the Min of the quota, and the total of the Min of the quotas, divided by the weight
+// of the quota. Zero if the quota doesn't borrow. The higher, the further the quota is above its fair share.
+func (e ElasticQuotaInfos) dominantShareWith(key string, podRequest *framework.Resource) float64 {
+	info := e[key]
+	if info == nil {
+		return 0
+	}
+	used := e.subtreeUsed(key)
+	if podRequest != nil {
+		used.Add(util.ResourceList(podRequest))
+	}
+	min := info.Min
+	if min == nil {
+		min = framework.NewResource(nil)
+	}
+	capacity := e.totalMin()
+	var share float64
+	update := func(u, m, c int64) {
+		borrowed := u - m
+		if borrowed <= 0 {
+			return
+		}
+		if c <= 0 {
+			share = math.Inf(1)
+		} else if float64(borrowed)/float64(c) > share {
+			share = float64(borrowed) / float64(c)
+		}
+	}
+	update(used.MilliCPU, min.MilliCPU, capacity.MilliCPU)
+	update(used.Memory, min.Memory, capacity.Memory)
+	update(used.EphemeralStorage, min.EphemeralStorage, capacity.EphemeralStorage)
+	for name, quant := range used.ScalarResources {
+		update(quant, min.ScalarResources[name], capacity.ScalarResources[name])
+	}
+	if share == 0 || info.Weight == nil {
+		return share
+	}
+	if *info.Weight <= 0 {
+		return math.Inf(1)
+	}
+	return share / float64(*info.Weight)
 }
 
 // ElasticQuotaInfo is a wrapper to a ElasticQuota with information.
-// Each namespace can only have one ElasticQuota.
+// The ElasticQuotaInfos are keyed by the namespace and the name of their ElasticQuota.
 type ElasticQuotaInfo struct {
 	Namespace string
-	pods      sets.String
-	Min       *framework.Resource
-	Max       *framework.Resource
-	Used      *framework.Resource
+	// Parent is the key of the parent quota in the quota tree, empty for a root quota.
+	Parent string
+	// PodSelector selects the pods of the namespace subject to the quota, nil for all of them.
+	PodSelector labels.Selector
+	// NamespaceSelector selects the namespaces pooled by the quota, nil if the quota applies to its namespace.
+	NamespaceSelector labels.Selector
+	// Namespaces are the namespaces currently selected by NamespaceSelector. The set is replaced,
+	// never modified, so that it can be shared by the clones of the quota.
+	Namespaces sets.String
+	// BorrowingCap is the most the quota and its descendants may use, i.e. its Min plus its borrowing limit,
+	// unbounded for the resources without borrowing limit. Nil if the quota has no borrowing limit.
+	BorrowingCap *framework.Resource
+	// LendingLimit is the most of the unused Min of the quota that the quotas outside its subtree may borrow,
+	// unbounded for the resources without lending limit. Nil if the quota has no lending limit.
+	LendingLimit *framework.Resource
+	// Weight is the weight of the quota when the borrowed capacity is shared fairly, nil for the default of 1.
+	Weight *int32
+	// Window is the name of the window of the quota whose Min and Max are in effect, empty if none is active.
+	Window string
+	// Flavors are the flavors of the quota, in order.
+	Flavors []*ElasticQuotaFlavorInfo
+	// podFlavors are the names of the flavors the pods of the quota are charged to, by pod key.
+	podFlavors map[string]string
+	pods       sets.String
+	// podsShared tells that pods and podFlavors are shared with a clone of the quota, so they are copied
+	// before they get modified.
+	podsShared bool
+	Min        *framework.Resource
+	Max        *framework.Resource
+	Used       *framework.Resource
+	// descendantsUsed is the usage of the descendants of the quota, kept up to date along with their Used so
+	// that the usage of a subtree doesn't depend on the number of quotas. Nil if the quota has no descendants.
+	descendantsUsed *framework.Resource
 }
 
 func newElasticQuotaInfo(namespace string, min, max, used v1.ResourceList) *ElasticQuotaInfo {
@@ -86,6 +540,53 @@ func newElasticQuotaInfo(namespace string, min, max, used v1.ResourceList) *Elas
 	return elasticQuotaInfo
 }
 
+// ElasticQuotaFlavorInfo is the usage of a flavor of a quota, charged with the pods of the quota running on the
+// nodes of the flavor.
+type ElasticQuotaFlavorInfo struct {
+	Name         string
+	NodeSelector labels.Selector
+	// Min and Max only bound the resources they list. They are never modified, and shared by the clones.
+	Min  v1.ResourceList
+	Max  v1.ResourceList
+	Used *framework.Resource
+}
+
+// getFlavor returns the flavor of the given name, or nil.
+func (e *ElasticQuotaInfo) getFlavor(name string) *ElasticQuotaFlavorInfo {
+	for _, flavor := range e.Flavors {
+		if flavor.Name == name {
+			return flavor
+		}
+	}
+	return nil
+}
+
+// flavorOf returns the first flavor selecting the node, or nil if none does or the node is unknown.
+func (e *ElasticQuotaInfo) flavorOf(node *v1.Node) *ElasticQuotaFlavorInfo {
+	if node == nil {
+		return nil
+	}
+	for _, flavor := range e.Flavors {
+		if flavor.NodeSelector.Matches(labels.Set(node.Labels)) {
+			return flavor
+		}
+	}
+	return nil
+}
+
+// scope returns the pods the quota applies to.
+func (e *ElasticQuotaInfo) scope() util.ElasticQuotaScope {
+	return util.ElasticQuotaScope{Namespace: e.Namespace, Namespaces: e.Namespaces, PodSelector: e.PodSelector}
+}
+
+// namespaces returns the namespaces the quota applies to.
+func (e *ElasticQuotaInfo) namespaces() []string {
+	if e.Namespaces == nil {
+		return []string{e.Namespace}
+	}
+	return e.Namespaces.List()
+}
+
 func (e *ElasticQuotaInfo) reserveResource(request framework.Resource) {
 	e.Used.Memory += request.Memory
 	e.Used.MilliCPU += request.MilliCPU
@@ -130,10 +631,29 @@ func (e *ElasticQuotaInfo) usedOverMin() bool {
 	return cmp(e.Used, e.Min, LowerBoundOfMin)
 }
 
+// clone returns a copy of the quota, which shares the pods of the quota until it modifies them. The quota
+// must not modify its pods either afterwards, unless they are marked as shared with sharePods.
 func (e *ElasticQuotaInfo) clone() *ElasticQuotaInfo {
 	newEQInfo := &ElasticQuotaInfo{
-		Namespace: e.Namespace,
-		pods:      sets.NewString(),
+		Namespace:         e.Namespace,
+		Parent:            e.Parent,
+		PodSelector:       e.PodSelector,
+		NamespaceSelector: e.NamespaceSelector,
+		Namespaces:        e.Namespaces,
+		Weight:            e.Weight,
+		Window:            e.Window,
+		podFlavors:        e.podFlavors,
+		pods:              e.pods,
+		podsShared:        true,
+	}
+	for _, flavor := range e.Flavors {
+		newEQInfo.Flavors = append(newEQInfo.Flavors, &ElasticQuotaFlavorInfo{
+			Name:         flavor.Name,
+			NodeSelector: flavor.NodeSelector,
+			Min:          flavor.Min,
+			Max:          flavor.Max,
+			Used:         flavor.Used.Clone(),
+		})
 	}
 
 	if e.Min != nil {
@@ -145,17 +665,42 @@ func (e *ElasticQuotaInfo) clone() *ElasticQuotaInfo {
 	if e.Used != nil {
 		newEQInfo.Used = e.Used.Clone()
 	}
-	if len(e.pods) > 0 {
-		pods := e.pods.List()
-		for _, pod := range pods {
-			newEQInfo.pods.Insert(pod)
-		}
+	if e.descendantsUsed != nil {
+		newEQInfo.descendantsUsed = e.descendantsUsed.Clone()
+	}
+	if e.BorrowingCap != nil {
+		newEQInfo.BorrowingCap = e.BorrowingCap.Clone()
+	}
+	if e.LendingLimit != nil {
+		newEQInfo.LendingLimit = e.LendingLimit.Clone()
 	}
 
 	return newEQInfo
 }
 
-func (e *ElasticQuotaInfo) addPodIfNotPresent(pod *v1.Pod) error {
+// sharePods marks the pods of the quota as shared with a clone, which the quota keeps modifying.
+func (e *ElasticQuotaInfo) sharePods() {
+	e.podsShared = true
+}
+
+// ownPods copies the pods of the quota if they are shared, before they get modified.
+func (e *ElasticQuotaInfo) ownPods() {
+	if !e.podsShared {
+		return
+	}
+	e.pods = sets.NewString(e.pods.UnsortedList()...)
+	if e.podFlavors != nil {
+		podFlavors := make(map[string]string, len(e.podFlavors))
+		for pod, flavor := range e.podFlavors {
+			podFlavors[pod] = flavor
+		}
+		e.podFlavors = podFlavors
+	}
+	e.podsShared = false
+}
+
+// addPodIfNotPresent adds the pod to the quota, and charges it to the flavor of its node, if the node is known.
+func (e *ElasticQuotaInfo) addPodIfNotPresent(pod *v1.Pod, node *v1.Node) error {
 	key, err := framework.GetPodKey(pod)
 	if err != nil {
 		return err
@@ -165,9 +710,17 @@ func (e *ElasticQuotaInfo) addPodIfNotPresent(pod *v1.Pod) error {
 		return nil
 	}
 
+	e.ownPods()
 	e.pods.Insert(key)
 	podRequest := computePodResourceRequest(pod)
 	e.reserveResource(*podRequest)
+	if flavor := e.flavorOf(node); flavor != nil {
+		flavor.Used.Add(util.ResourceList(podRequest))
+		if e.podFlavors == nil {
+			e.podFlavors = make(map[string]string)
+		}
+		e.podFlavors[key] = flavor.Name
+	}
 
 	return nil
 }
@@ -182,9 +735,16 @@ func (e *ElasticQuotaInfo) deletePodIfPresent(pod *v1.Pod) error {
 		return nil
 	}
 
+	e.ownPods()
 	e.pods.Delete(key)
 	podRequest := computePodResourceRequest(pod)
 	e.unreserveResource(*podRequest)
+	if name, ok := e.podFlavors[key]; ok {
+		delete(e.podFlavors, key)
+		if flavor := e.getFlavor(name); flavor != nil {
+			flavor.Used = subtractResource(flavor.Used, podRequest)
+		}
+	}
 
 	return nil
 }
@@ -223,6 +783,64 @@ func cmp2(x1, x2, y *framework.Resource, bound int64) bool {
 	return false
 }
 
+// maxResource returns the greatest of x and y for each resource.
+func maxResource(x, y *framework.Resource) *framework.Resource {
+	result := x.Clone()
+	result.SetMaxResource(util.ResourceList(y))
+	return result
+}
+
+// minResource returns the least of x and y for each resource of x.
+func minResource(x, y *framework.Resource) *framework.Resource {
+	min := func(a, b int64) int64 {
+		if a < b {
+			return a
+		}
+		return b
+	}
+	result := &framework.Resource{
+		MilliCPU:         min(x.MilliCPU, y.MilliCPU),
+		Memory:           min(x.Memory, y.Memory),
+		EphemeralStorage: min(x.EphemeralStorage, y.EphemeralStorage),
+	}
+	for name, quant := range x.ScalarResources {
+		result.SetScalar(name, min(quant, y.ScalarResources[name]))
+	}
+	return result
+}
+
+// subtractResource returns x minus y for each resource of x, floored at zero.
+func subtractResource(x, y *framework.Resource) *framework.Resource {
+	sub := func(a, b int64) int64 {
+		if a > b {
+			return a - b
+		}
+		return 0
+	}
+	result := &framework.Resource{
+		MilliCPU:         sub(x.MilliCPU, y.MilliCPU),
+		Memory:           sub(x.Memory, y.Memory),
+		EphemeralStorage: sub(x.EphemeralStorage, y.EphemeralStorage),
+	}
+	for name, quant := range x.ScalarResources {
+		result.SetScalar(name, sub(quant, y.ScalarResources[name]))
+	}
+	return result
+}
+
+// scaleResource returns r times n.
+func scaleResource(r *framework.Resource, n int64) *framework.Resource {
+	result := &framework.Resource{
+		MilliCPU:         r.MilliCPU * n,
+		Memory:           r.Memory * n,
+		EphemeralStorage: r.EphemeralStorage * n,
+	}
+	for name, quant := range r.ScalarResources {
+		result.SetScalar(name, quant*n)
+	}
+	return result
+}
+
 func makeResourceListForBound(bound int64) v1.ResourceList {
 	return v1.ResourceList{
 		v1.ResourceCPU:              *resource.NewMilliQuantity(bound, resource.DecimalSI),
@@ -17,13 +17,17 @@ limitations under the License.
 package capacityscheduling
 
 import (
+	"math"
 	"reflect"
 	"testing"
 
 	"k8s.io/apimachinery/pkg/util/sets"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/kubernetes/pkg/scheduler/framework"
+	st "k8s.io/kubernetes/pkg/scheduler/testing"
 )
 
 func TestReserveResource(t *testing.T) {
@@ -630,3 +634,185 @@ func TestNewElasticQuotaInfo(t *testing.T) {
 		})
 	}
 }
+
+func TestElasticQuotaTree(t *testing.T) {
+	// org (min 150, max 160)
+	// ├── team-a (min 60, max 150)
+	// │   ├── a1 (min 30)
+	// │   └── a2 (min 30)
+	// └── team-b (min 40, max 150)
+	infos := ElasticQuotaInfos{
+		"org":    {Namespace: "org", Min: &framework.Resource{Memory: 150}, Max: &framework.Resource{Memory: 160}, Used: &framework.Resource{}},
+		"team-a": {Namespace: "team-a", Parent: "org", Min: &framework.Resource{Memory: 60}, Max: &framework.Resource{Memory: 150}, Used: &framework.Resource{}},
+		"a1":     {Namespace: "a1", Parent: "team-a", Min: &framework.Resource{Memory: 30}, Max: &framework.Resource{Memory: 150}, Used: &framework.Resource{Memory: 10}},
+		"a2":     {Namespace: "a2", Parent: "team-a", Min: &framework.Resource{Memory: 30}, Max: &framework.Resource{Memory: 150}, Used: &framework.Resource{Memory: 40}},
+		"team-b": {Namespace: "team-b", Parent: "org", Min: &framework.Resource{Memory: 40}, Max: &framework.Resource{Memory: 150}, Used: &framework.Resource{Memory: 50}},
+	}
+	infos.resetDescendantsUsed()
+
+	if got := infos.subtreeUsed("team-a").Memory; got != 50 {
+		t.Errorf("Expected team-a subtree to use 50, got %v", got)
+	}
+	if got := infos.subtreeUsed("org").Memory; got != 100 {
+		t.Errorf("Expected org subtree to use 100, got %v", got)
+	}
+
+	tests := []struct {
+		name     string
+		key      string
+		request  int64
+		expected string
+	}{
+		{name: "fits in every level", key: "a1", request: 10},
+		{name: "max of the root is exceeded", key: "a1", request: 70, expected: "org"},
+		{name: "max of the quota itself is exceeded", key: "team-b", request: 101, expected: "team-b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := infos.usedOverMaxWith(tt.key, &framework.Resource{Memory: tt.request}); got != tt.expected {
+				t.Errorf("Expected %q to be over max, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	// Only the min of the root counts for the aggregated min, as it includes the min of its descendants.
+	if infos.aggregatedUsedOverMinWith("a1", framework.Resource{Memory: 10}) {
+		t.Error("Expected aggregated used not to be over the min of the root")
+	}
+
+	// a2 borrows the unused min of its sibling a1 within team-a, which a1 can reclaim.
+	if branch, ok := infos.reclaimableBranch("a2", "a1"); !ok || branch != "a2" {
+		t.Errorf("Expected a1 to reclaim from a2 through a2, got %v, %v", branch, ok)
+	}
+	// team-a doesn't use more than its min, so team-b can't reclaim from a2.
+	if _, ok := infos.reclaimableBranch("a2", "team-b"); ok {
+		t.Error("Expected team-b not to reclaim from a2")
+	}
+	// team-b borrows from the min of team-a, which a1 can reclaim.
+	if branch, ok := infos.reclaimableBranch("team-b", "a1"); !ok || branch != "team-b" {
+		t.Errorf("Expected a1 to reclaim from team-b through team-b, got %v, %v", branch, ok)
+	}
+
+	if got := infos.borrowedShare("team-b"); got != 1.25 {
+		t.Errorf("Expected team-b borrowed share to be 1.25, got %v", got)
+	}
+}
+
+func TestElasticQuotaBorrowingAndLendingLimits(t *testing.T) {
+	limit := func(memory int64) *framework.Resource {
+		return newUnboundedResource(v1.ResourceList{v1.ResourceMemory: *resource.NewQuantity(memory, resource.BinarySI)})
+	}
+	// lender keeps 50 of its 80 unused min, and borrower may only use 40 above its min.
+	infos := ElasticQuotaInfos{
+		"lender": {Namespace: "lender", Min: &framework.Resource{Memory: 100}, Used: &framework.Resource{Memory: 20},
+			LendingLimit: limit(30)},
+		"borrower": {Namespace: "borrower", Min: &framework.Resource{Memory: 50}, Used: &framework.Resource{Memory: 50},
+			BorrowingCap: limit(90)},
+		"other": {Namespace: "other", Min: &framework.Resource{Memory: 50}, Used: &framework.Resource{}},
+	}
+
+	if got := infos.usedOverBorrowingLimitWith("borrower", &framework.Resource{Memory: 40, MilliCPU: 1000}); got != "" {
+		t.Errorf("Expected borrower to be within its borrowing limit, got %q", got)
+	}
+	if got := infos.usedOverBorrowingLimitWith("borrower", &framework.Resource{Memory: 45}); got != "borrower" {
+		t.Errorf("Expected borrower to be over its borrowing limit, got %q", got)
+	}
+
+	tests := []struct {
+		name     string
+		key      string
+		request  int64
+		expected bool
+	}{
+		{name: "borrowing within the lending limit", key: "borrower", request: 80},
+		{name: "borrowing beyond the lending limit", key: "borrower", request: 81, expected: true},
+		{name: "lending limit doesn't apply to the lender", key: "lender", request: 110},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := infos.aggregatedUsedOverMinWith(tt.key, framework.Resource{Memory: tt.request}); got != tt.expected {
+				t.Errorf("Expected aggregated used over min to be %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	// dept (min 100, lends 10)
+	// ├── d1 (min 60, lends nothing)
+	// └── d2 (min 40)
+	tree := ElasticQuotaInfos{
+		"dept": {Namespace: "dept", Min: &framework.Resource{Memory: 100}, Used: &framework.Resource{}, LendingLimit: limit(10)},
+		"d1":   {Namespace: "d1", Parent: "dept", Min: &framework.Resource{Memory: 60}, Used: &framework.Resource{}, LendingLimit: limit(0)},
+		"d2":   {Namespace: "d2", Parent: "dept", Min: &framework.Resource{Memory: 40}, Used: &framework.Resource{}},
+		"root": {Namespace: "root", Min: &framework.Resource{Memory: 10}, Used: &framework.Resource{}},
+	}
+	tree.resetDescendantsUsed()
+	// The lending limit of dept bounds what its subtree keeps from the other trees.
+	if got := tree.unlendableMinFor("root").Memory; got != 90 {
+		t.Errorf("Expected dept to keep 90 from root, got %v", got)
+	}
+	// Only the lending limit of d1 applies to its sibling.
+	if got := tree.unlendableMinFor("d2").Memory; got != 60 {
+		t.Errorf("Expected d1 to keep 60 from d2, got %v", got)
+	}
+}
+
+func TestElasticQuotaDominantShare(t *testing.T) {
+	weight, zero := int32(2), int32(0)
+	infos := ElasticQuotaInfos{
+		"dept": {Namespace: "dept", Min: &framework.Resource{MilliCPU: 1000, Memory: 100}, Used: &framework.Resource{}},
+		"d1": {Namespace: "d1", Parent: "dept", Min: &framework.Resource{MilliCPU: 500, Memory: 50},
+			Used: &framework.Resource{MilliCPU: 700, Memory: 90}},
+		"d2": {Namespace: "d2", Parent: "dept", Min: &framework.Resource{MilliCPU: 500, Memory: 50},
+			Used: &framework.Resource{MilliCPU: 100}, Weight: &weight},
+		"other": {Namespace: "other", Min: &framework.Resource{MilliCPU: 1000, Memory: 100},
+			Used: &framework.Resource{}, Weight: &zero},
+	}
+	infos.resetDescendantsUsed()
+
+	tests := []struct {
+		name     string
+		key      string
+		request  *framework.Resource
+		expected float64
+	}{
+		// Memory is the dominant resource of d1: 40 borrowed out of 200, against 200m out of 2 CPUs.
+		{name: "dominant resource", key: "d1", expected: 0.2},
+		{name: "quota within its min", key: "d2"},
+		{name: "weighted share with the request", key: "d2", request: &framework.Resource{MilliCPU: 800}, expected: 0.1},
+		{name: "subtree within the min of the parent", key: "dept"},
+		{name: "quota of weight zero", key: "other", request: &framework.Resource{Memory: 101}, expected: math.Inf(1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := infos.dominantShareWith(tt.key, tt.request); got != tt.expected {
+				t.Errorf("Expected dominant share %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestElasticQuotaIndex(t *testing.T) {
+	infos := ElasticQuotaInfos{
+		"ns1/eq":       {Namespace: "ns1"},
+		"ns1/selected": {Namespace: "ns1", PodSelector: labels.SelectorFromSet(labels.Set{"team": "a"})},
+		"ns2/eq":       {Namespace: "ns2"},
+		"pool/eq":      {Namespace: "pool", NamespaceSelector: labels.Everything(), Namespaces: sets.NewString("ns2", "ns3")},
+	}
+	index := newElasticQuotaIndex(infos)
+
+	for _, pod := range []*v1.Pod{
+		makePod("p1", "ns1", 0, 0, 0, 0, "p1", ""),
+		st.MakePod().Name("p2").Namespace("ns1").Label("team", "a").Obj(),
+		makePod("p3", "ns2", 0, 0, 0, 0, "p3", ""),
+		makePod("p4", "ns3", 0, 0, 0, 0, "p4", ""),
+		makePod("p5", "ns4", 0, 0, 0, 0, "p5", ""),
+	} {
+		wantKey, _ := infos.getElasticQuotaInfo(pod)
+		if gotKey, _ := infos.getIndexedElasticQuotaInfo(index, pod); gotKey != wantKey {
+			t.Errorf("expected %q for pod %v, got %q", wantKey, pod.Name, gotKey)
+		}
+	}
+	if !infos.hasNamespace(index, "ns3") || infos.hasNamespace(index, "ns4") {
+		t.Errorf("expected only the namespaces of the quotas in the index, got %v", index)
+	}
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package capacityscheduling
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+
+	"sigs.k8s.io/scheduler-plugins/apis/scheduling/v1alpha1"
+	"sigs.k8s.io/scheduler-plugins/pkg/util"
+)
+
+// gangReservation is the part of the aggregate request of a PodGroup reserved against its quota when
+// its first member passes PreFilter, which its members haven't used yet. The reservation counts in the
+// usage of the quota, so that a PodGroup is admitted by its quota as a whole or not at all.
+type gangReservation struct {
+	elasticQuotaKey string
+	reserved        *framework.Resource
+	// pods are the keys of the members whose request was taken from the reservation.
+	pods sets.String
+}
+
+// getGangRequest returns what the PodGroup of the pod needs from the quota of the given key: the minResources
+// of the PodGroup, or else its minMember times the request of the pod, less the requests of its members
+// already reserved or assigned, which the quota already counts. It returns nil if the pod doesn't belong to a known PodGroup, or if
+// the assigned members already use the request of the PodGroup.
+func (c *CapacityScheduling) getGangRequest(pod *v1.Pod, eqKey string, podReq *framework.Resource) *framework.Resource {
+	pgName := util.GetPodGroupLabel(pod)
+	if len(pgName) == 0 {
+		return nil
+	}
+	pg, err := c.pgLister.PodGroups(pod.Namespace).Get(pgName)
+	if err != nil {
+		klog.V(4).InfoS("Failed to get the PodGroup of the pod, admitting it alone", "pod", klog.KObj(pod), "err", err)
+		return nil
+	}
+
+	var request *framework.Resource
+	if minResources := util.GetMinResources(pg); minResources != nil {
+		// The number of pods is not subject to the quotas.
+		delete(minResources, v1.ResourcePods)
+		request = framework.NewResource(minResources)
+	} else {
+		request = scaleResource(podReq, int64(util.GetMinMember(pg)))
+	}
+
+	pods, err := c.podLister.Pods(pod.Namespace).List(labels.SelectorFromSet(labels.Set{v1alpha1.PodGroupLabel: pgName}))
+	if err != nil {
+		klog.ErrorS(err, "Failed to list the members of the PodGroup", "podGroup", klog.KObj(pg))
+	}
+	c.RLock()
+	defer c.RUnlock()
+	info := c.elasticQuotaInfos[eqKey]
+	if info == nil {
+		return nil
+	}
+	for _, p := range pods {
+		if podKey, err := framework.GetPodKey(p); err == nil && p.UID != pod.UID && info.pods.Has(podKey) {
+			request = subtractResource(request, computePodResourceRequest(p))
+		}
+	}
+	if isZeroResource(request) {
+		return nil
+	}
+	return request
+}
+
+// coveredByGangReservation returns the part of the request of the pod covered by the reservation of its
+// PodGroup against the quota of the given key, or nil if the PodGroup has no reservation.
+func (c *CapacityScheduling) coveredByGangReservation(pgFullName, eqKey string, podReq *framework.Resource) *framework.Resource {
+	c.RLock()
+	defer c.RUnlock()
+
+	r := c.gangReservations[pgFullName]
+	if r == nil || r.elasticQuotaKey != eqKey {
+		return nil
+	}
+	return minResource(podReq, r.reserved)
+}
+
+// reserveForGang reserves the request of the PodGroup against the quota of the given key, unless the
+// PodGroup got a reservation meanwhile.
+func (c *CapacityScheduling) reserveForGang(pgFullName, eqKey string, request *framework.Resource) {
+	c.Lock()
+	defer c.Unlock()
+
+	info := c.elasticQuotaInfos[eqKey]
+	if info == nil || c.gangReservations[pgFullName] != nil {
+		return
+	}
+	c.elasticQuotaInfos.reserveResource(eqKey, request)
+	c.elasticQuotaChanged(eqKey)
+	if c.gangReservations == nil {
+		c.gangReservations = make(map[string]*gangReservation)
+	}
+	c.gangReservations[pgFullName] = &gangReservation{
+		elasticQuotaKey: eqKey,
+		reserved:        request.Clone(),
+		pods:            sets.NewString(),
+	}
+	klog.V(4).InfoS("Reserved the request of the PodGroup against its elasticQuota", "podGroup", pgFullName, "elasticQuota", eqKey)
+}
+
+// consumeGangReservation takes the request of the pod, just added to the quota of the given key, from the
+// reservation of its PodGroup, since the pod now counts in the usage of the quota. The caller must hold the lock.
+func (c *CapacityScheduling) consumeGangReservation(eqKey string, pod *v1.Pod) {
+	pgFullName := util.GetPodGroupFullName(pod)
+	r := c.gangReservations[pgFullName]
+	if r == nil || r.elasticQuotaKey != eqKey {
+		return
+	}
+	podKey, err := framework.GetPodKey(pod)
+	if err != nil || r.pods.Has(podKey) {
+		return
+	}
+	r.pods.Insert(podKey)
+	consumed := minResource(computePodResourceRequest(pod), r.reserved)
+	r.reserved = subtractResource(r.reserved, consumed)
+	if c.elasticQuotaInfos[eqKey] != nil {
+		c.elasticQuotaInfos.unreserveResource(eqKey, consumed)
+		c.elasticQuotaChanged(eqKey)
+	}
+	if isZeroResource(r.reserved) {
+		delete(c.gangReservations, pgFullName)
+	}
+}
+
+// releaseGangReservation gives the quota back what is left of the reservation of the PodGroup, when the
+// PodGroup gets rejected. The caller must hold the lock.
+func (c *CapacityScheduling) releaseGangReservation(pgFullName string) {
+	r := c.gangReservations[pgFullName]
+	if r == nil {
+		return
+	}
+	delete(c.gangReservations, pgFullName)
+	if c.elasticQuotaInfos[r.elasticQuotaKey] != nil {
+		c.elasticQuotaInfos.unreserveResource(r.elasticQuotaKey, r.reserved)
+		c.elasticQuotaChanged(r.elasticQuotaKey)
+	}
+	klog.V(4).InfoS("Released the reservation of the PodGroup", "podGroup", pgFullName, "elasticQuota", r.elasticQuotaKey)
+}
+
+// isZeroResource checks whether none of the resources is requested.
+func isZeroResource(r *framework.Resource) bool {
+	return !cmp(r, framework.NewResource(nil), LowerBoundOfMin)
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package capacityscheduling
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/informers"
+	clientsetfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/defaultbinder"
+	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/queuesort"
+	frameworkruntime "k8s.io/kubernetes/pkg/scheduler/framework/runtime"
+	st "k8s.io/kubernetes/pkg/scheduler/testing"
+
+	"sigs.k8s.io/scheduler-plugins/apis/scheduling/v1alpha1"
+	schedlisters "sigs.k8s.io/scheduler-plugins/pkg/generated/listers/scheduling/v1alpha1"
+	"sigs.k8s.io/scheduler-plugins/pkg/util"
+	testutil "sigs.k8s.io/scheduler-plugins/test/util"
+)
+
+func TestGangAdmission(t *testing.T) {
+	makeMember := func(name string) *v1.Pod {
+		pod := makePod(name, "ns1", 300, 0, 0, 0, name, "")
+		pod.Labels = map[string]string{v1alpha1.PodGroupLabel: "pg"}
+		return pod
+	}
+	makeElasticQuotas := func() map[string]*ElasticQuotaInfo {
+		return map[string]*ElasticQuotaInfo{
+			"ns1/eq": {
+				Namespace: "ns1",
+				pods:      sets.NewString(),
+				Min:       &framework.Resource{Memory: 1000},
+				Max:       &framework.Resource{Memory: 1000},
+				Used:      &framework.Resource{},
+			},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		minMember  int32
+		minMemory  string
+		wantCode   framework.Code
+		wantUsed   int64
+		wantStatus string
+	}{
+		{
+			name:      "the PodGroup fits in the quota",
+			minMember: 3,
+			wantCode:  framework.Success,
+			wantUsed:  900,
+		},
+		{
+			name:       "the PodGroup doesn't fit in the quota",
+			minMember:  4,
+			wantCode:   framework.Unschedulable,
+			wantStatus: "PodGroup ns1/pg is rejected in PreFilter because ElasticQuota ns1/eq is more than Max",
+		},
+		{
+			name:      "the minResources of the PodGroup are reserved",
+			minMember: 4,
+			minMemory: "800",
+			wantCode:  framework.Success,
+			wantUsed:  800,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			registeredPlugins := []st.RegisterPluginFunc{
+				st.RegisterQueueSortPlugin(queuesort.Name, queuesort.New),
+				st.RegisterBindPlugin(defaultbinder.Name, defaultbinder.New),
+			}
+			fwk, err := st.NewFramework(
+				ctx, registeredPlugins, "",
+				frameworkruntime.WithPodNominator(testutil.NewPodNominator(nil)),
+				frameworkruntime.WithSnapshotSharedLister(testutil.NewFakeSharedLister(make([]*v1.Pod, 0), make([]*v1.Node, 0))),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pg := &v1alpha1.PodGroup{
+				ObjectMeta: metav1.ObjectMeta{Name: "pg", Namespace: "ns1"},
+				Spec:       v1alpha1.PodGroupSpec{MinMember: tt.minMember},
+			}
+			if len(tt.minMemory) != 0 {
+				pg.Spec.MinResources = v1.ResourceList{v1.ResourceMemory: resource.MustParse(tt.minMemory)}
+			}
+			first, second := makeMember("p1"), makeMember("p2")
+			informerFactory := informers.NewSharedInformerFactory(clientsetfake.NewSimpleClientset(), 0)
+			podInformer := informerFactory.Core().V1().Pods().Informer()
+			podInformer.GetStore().Add(first)
+			podInformer.GetStore().Add(second)
+
+			cs := &CapacityScheduling{
+				elasticQuotaInfos: makeElasticQuotas(),
+				fh:                fwk,
+				podLister:         informerFactory.Core().V1().Pods().Lister(),
+				pgLister:          makePodGroupLister(pg),
+			}
+			// A dry run checks the PodGroup against the quota without reserving anything.
+			if _, status := cs.PreFilter(ctx, util.NewDryRunCycleState(), first); status.Code() != tt.wantCode {
+				t.Fatalf("expected %v in a dry run, got %v : %v", tt.wantCode, status.Code(), status.Message())
+			}
+			if len(cs.gangReservations) != 0 {
+				t.Errorf("expected no reservation after a dry run, got %v", cs.gangReservations)
+			}
+
+			state := framework.NewCycleState()
+			_, status := cs.PreFilter(ctx, state, first)
+			if status.Code() != tt.wantCode {
+				t.Fatalf("expected %v, got %v : %v", tt.wantCode, status.Code(), status.Message())
+			}
+			if tt.wantCode != framework.Success {
+				if status.Message() != tt.wantStatus {
+					t.Errorf("expected message %q, got %q", tt.wantStatus, status.Message())
+				}
+				if len(cs.gangReservations) != 0 {
+					t.Errorf("expected no reservation, got %v", cs.gangReservations)
+				}
+				return
+			}
+			info := cs.elasticQuotaInfos["ns1/eq"]
+			if info.Used.Memory != tt.wantUsed {
+				t.Errorf("expected the reservation to use %v, got %v", tt.wantUsed, info.Used.Memory)
+			}
+
+			// The other members are covered by the reservation, unlike the pods outside of the PodGroup.
+			if _, status := cs.PreFilter(ctx, framework.NewCycleState(), second); !status.IsSuccess() {
+				t.Errorf("expected the second member to be admitted, got %v", status.Message())
+			}
+			other := makePod("other", "ns1", 300, 0, 0, 0, "other", "")
+			if _, status := cs.PreFilter(ctx, framework.NewCycleState(), other); status.IsSuccess() {
+				t.Errorf("expected the pod outside of the PodGroup to be rejected")
+			}
+
+			// The reservation outlives a failed preemption, Coscheduling may still nominate the PodGroup.
+			if _, status := cs.PostFilter(ctx, state, first, framework.NodeToStatusMap{}); status.IsSuccess() {
+				t.Errorf("expected the preemption to fail")
+			}
+			if info.Used.Memory != tt.wantUsed {
+				t.Errorf("expected the reservation to be kept, got %v", info.Used.Memory)
+			}
+
+			// The members reserved on a node take their request from the reservation.
+			if status := cs.Reserve(ctx, framework.NewCycleState(), first, "node-a"); !status.IsSuccess() {
+				t.Fatal(status.AsError())
+			}
+			if info.Used.Memory != tt.wantUsed {
+				t.Errorf("expected the usage to stay %v, got %v", tt.wantUsed, info.Used.Memory)
+			}
+
+			// The reservation is released when the PodGroup gets rejected.
+			cs.Unreserve(ctx, framework.NewCycleState(), first, "node-a")
+			if info.Used.Memory != 0 {
+				t.Errorf("expected the reservation to be released, got %v", info.Used.Memory)
+			}
+			if len(cs.gangReservations) != 0 {
+				t.Errorf("expected no reservation, got %v", cs.gangReservations)
+			}
+
+			// The reservation is released when Coscheduling rejects the PodGroup as well.
+			state = framework.NewCycleState()
+			if _, status := cs.PreFilter(ctx, state, first); !status.IsSuccess() {
+				t.Fatalf("expected the PodGroup to be admitted again, got %v", status.Message())
+			}
+			if info.Used.Memory != tt.wantUsed {
+				t.Errorf("expected the reservation to use %v, got %v", tt.wantUsed, info.Used.Memory)
+			}
+			util.RejectPodGroup(state)
+			if info.Used.Memory != 0 || len(cs.gangReservations) != 0 {
+				t.Errorf("expected the reservation to be released, got %v", info.Used.Memory)
+			}
+		})
+	}
+}
+
+func makePodGroupLister(pgs ...*v1alpha1.PodGroup) schedlisters.PodGroupLister {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, pg := range pgs {
+		indexer.Add(pg)
+	}
+	return schedlisters.NewPodGroupLister(indexer)
+}
@@ -0,0 +1,221 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package capacityscheduling
+
+import (
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+// pendingPod is a pod waiting to be scheduled, with the quota it is subject to.
+type pendingPod struct {
+	elasticQuotaKey string
+	schedulerName   string
+	request         *framework.Resource
+}
+
+// pendingDemand is the demand of the pending pods of a quota.
+type pendingDemand struct {
+	pods sets.String
+	// minRequest is the lowest request of the pods for each resource. A quota can't borrow capacity for any
+	// of its pods if it can't for minRequest.
+	minRequest *framework.Resource
+}
+
+// pendingDemands tracks the demand of the pods waiting to be scheduled, by scheduler name and quota key,
+// so that the starved quotas are found without listing the pods.
+type pendingDemands struct {
+	sync.RWMutex
+	pods    map[string]*pendingPod
+	demands map[string]map[string]*pendingDemand
+}
+
+// set records the pod as pending in the quota of the given key.
+func (d *pendingDemands) set(podKey string, pod *v1.Pod, eqKey string) {
+	d.Lock()
+	defer d.Unlock()
+
+	if p := d.pods[podKey]; p != nil {
+		if p.elasticQuotaKey == eqKey && p.schedulerName == pod.Spec.SchedulerName {
+			return
+		}
+		d.deleteLocked(podKey)
+	}
+	if d.pods == nil {
+		d.pods = make(map[string]*pendingPod)
+		d.demands = make(map[string]map[string]*pendingDemand)
+	}
+	p := &pendingPod{
+		elasticQuotaKey: eqKey,
+		schedulerName:   pod.Spec.SchedulerName,
+		request:         computePodResourceRequest(pod),
+	}
+	d.pods[podKey] = p
+	if d.demands[p.schedulerName] == nil {
+		d.demands[p.schedulerName] = make(map[string]*pendingDemand)
+	}
+	demand := d.demands[p.schedulerName][eqKey]
+	if demand == nil {
+		demand = &pendingDemand{pods: sets.NewString(), minRequest: p.request.Clone()}
+		d.demands[p.schedulerName][eqKey] = demand
+	} else {
+		demand.minRequest = minResource(demand.minRequest, p.request)
+	}
+	demand.pods.Insert(podKey)
+}
+
+// delete forgets the pod.
+func (d *pendingDemands) delete(podKey string) {
+	d.Lock()
+	defer d.Unlock()
+
+	d.deleteLocked(podKey)
+}
+
+func (d *pendingDemands) deleteLocked(podKey string) {
+	p := d.pods[podKey]
+	if p == nil {
+		return
+	}
+	delete(d.pods, podKey)
+	demand := d.demands[p.schedulerName][p.elasticQuotaKey]
+	demand.pods.Delete(podKey)
+	if demand.pods.Len() == 0 {
+		delete(d.demands[p.schedulerName], p.elasticQuotaKey)
+		if len(d.demands[p.schedulerName]) == 0 {
+			delete(d.demands, p.schedulerName)
+		}
+		return
+	}
+	demand.minRequest = nil
+	for k := range demand.pods {
+		if demand.minRequest == nil {
+			demand.minRequest = d.pods[k].request.Clone()
+		} else {
+			demand.minRequest = minResource(demand.minRequest, d.pods[k].request)
+		}
+	}
+}
+
+// starvedElasticQuota returns the key of a quota with pods pending for the scheduler of the pod, which it
+// could borrow capacity for, and a lower dominant share than the quota of the given key, or an empty string.
+// The ancestors and the descendants of the quota of the given key share its usage and are never starved by it.
+func (d *pendingDemands) starvedElasticQuota(elasticQuotaInfos ElasticQuotaInfos, pod *v1.Pod, eqKey string) string {
+	share := elasticQuotaInfos.dominantShareWith(eqKey, nil)
+	if share == 0 {
+		return ""
+	}
+
+	d.RLock()
+	defer d.RUnlock()
+
+	lineage := sets.NewString(elasticQuotaInfos.lineage(eqKey)...)
+	for key, demand := range d.demands[pod.Spec.SchedulerName] {
+		if key == eqKey || lineage.Has(key) || elasticQuotaInfos[key] == nil ||
+			sets.NewString(elasticQuotaInfos.lineage(key)...).Has(eqKey) {
+			continue
+		}
+		if len(elasticQuotaInfos.usedOverMaxWith(key, demand.minRequest)) != 0 ||
+			len(elasticQuotaInfos.usedOverBorrowingLimitWith(key, demand.minRequest)) != 0 {
+			continue
+		}
+		if elasticQuotaInfos.dominantShareWith(key, nil) < share {
+			return key
+		}
+	}
+	return ""
+}
+
+// isPendingPod tells whether the pod waits to be scheduled.
+func isPendingPod(pod *v1.Pod) bool {
+	return !assignedPod(pod) && pod.DeletionTimestamp == nil &&
+		pod.Status.Phase != v1.PodSucceeded && pod.Status.Phase != v1.PodFailed
+}
+
+// pendingPodEventHandler returns the handler of the events of the pending pods, whose demand the starved
+// quotas are found from.
+func (c *CapacityScheduling) pendingPodEventHandler() cache.ResourceEventHandler {
+	return cache.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool {
+			switch t := obj.(type) {
+			case *v1.Pod:
+				return isPendingPod(t)
+			case cache.DeletedFinalStateUnknown:
+				if pod, ok := t.Obj.(*v1.Pod); ok {
+					return !assignedPod(pod)
+				}
+				return false
+			default:
+				return false
+			}
+		},
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc: c.addPendingPod,
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				c.addPendingPod(newObj)
+			},
+			DeleteFunc: c.deletePendingPod,
+		},
+	}
+}
+
+func (c *CapacityScheduling) addPendingPod(obj interface{}) {
+	pod := obj.(*v1.Pod)
+	c.RLock()
+	defer c.RUnlock()
+
+	c.trackPendingPod(pod)
+}
+
+func (c *CapacityScheduling) deletePendingPod(obj interface{}) {
+	var pod *v1.Pod
+	switch t := obj.(type) {
+	case *v1.Pod:
+		pod = t
+	case cache.DeletedFinalStateUnknown:
+		pod = t.Obj.(*v1.Pod)
+	default:
+		return
+	}
+	podKey, err := framework.GetPodKey(pod)
+	if err != nil {
+		klog.ErrorS(err, "Failed to get the key of the Pod", "pod", klog.KObj(pod))
+		return
+	}
+	c.pendingDemands.delete(podKey)
+}
+
+// trackPendingPod records the pod in the demand of the quota it is subject to if it is pending, or forgets
+// it. The caller must hold the lock.
+func (c *CapacityScheduling) trackPendingPod(pod *v1.Pod) {
+	podKey, err := framework.GetPodKey(pod)
+	if err != nil {
+		klog.ErrorS(err, "Failed to get the key of the Pod", "pod", klog.KObj(pod))
+		return
+	}
+	key, info := c.getElasticQuotaInfo(pod)
+	if info == nil || !isPendingPod(pod) {
+		c.pendingDemands.delete(podKey)
+		return
+	}
+	c.pendingDemands.set(podKey, pod, key)
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package capacityscheduling
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	clientsetfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPendingDemands(t *testing.T) {
+	informerFactory := informers.NewSharedInformerFactory(clientsetfake.NewSimpleClientset(), 0)
+	podInformer := informerFactory.Core().V1().Pods().Informer()
+	c := &CapacityScheduling{
+		elasticQuotaInfos: NewElasticQuotaInfos(),
+		podLister:         informerFactory.Core().V1().Pods().Lister(),
+	}
+	handler := c.pendingPodEventHandler()
+	p1 := makePod("p1", "ns1", 10, 30, 0, 0, "p1", "")
+	p2 := makePod("p2", "ns1", 20, 20, 0, 0, "p2", "")
+	for _, p := range []*v1.Pod{p1, p2} {
+		podInformer.GetStore().Add(p)
+		handler.OnAdd(p, false)
+	}
+	if len(c.pendingDemands.pods) != 0 {
+		t.Fatalf("expected the pods without quota not to be tracked, got %v", c.pendingDemands.pods)
+	}
+
+	// The pending pods of the namespace are tracked once a quota applies to them.
+	c.addElasticQuota(makeEQ("ns1", "eq1", makeResourceList(1000, 1000), makeResourceList(100, 100)))
+	demand := c.pendingDemands.demands[""]["ns1/eq1"]
+	if demand == nil || demand.pods.Len() != 2 {
+		t.Fatalf("expected the two pending pods in the demand of the quota, got %+v", demand)
+	}
+	if demand.minRequest.Memory != 10 || demand.minRequest.MilliCPU != 20 {
+		t.Errorf("expected the least request of the pods for each resource, got %+v", demand.minRequest)
+	}
+
+	// A bound pod is no longer pending.
+	bound := p1.DeepCopy()
+	bound.Spec.NodeName = "node-a"
+	handler.OnUpdate(p1, bound)
+	if demand.pods.Len() != 1 || demand.minRequest.Memory != 20 || demand.minRequest.MilliCPU != 20 {
+		t.Errorf("expected the demand of the remaining pod, got %+v", demand)
+	}
+
+	handler.OnDelete(p2)
+	if len(c.pendingDemands.pods) != 0 || len(c.pendingDemands.demands) != 0 {
+		t.Errorf("expected no pending demand, got %+v", c.pendingDemands.demands)
+	}
+}
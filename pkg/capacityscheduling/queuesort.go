@@ -0,0 +1,177 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package capacityscheduling
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	corev1helpers "k8s.io/component-helpers/scheduling/corev1"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+// QueueSortName is the name of the QueueSort plugin used in the Registry and configurations.
+const QueueSortName = "CapacitySchedulingQueueSort"
+
+// capacitySchedulings are the CapacityScheduling plugins keyed by the informer factories they were built with,
+// which the profiles of a scheduler share along with the QueueSort plugin.
+var capacitySchedulings sync.Map
+
+// QueueSort is a QueueSort plugin ordering the pods with the usage of their quotas tracked by the
+// CapacityScheduling plugin, so that a burst of pods of a quota borrowing resources doesn't starve the quotas
+// below their Min.
+type QueueSort struct {
+	informerFactory    informers.SharedInformerFactory
+	capacityScheduling atomic.Pointer[CapacityScheduling]
+
+	sync.Mutex
+	// queuedRanks are the ranks of the pods as of their insertion into the queue, keyed by the UIDs of the
+	// pods. The activeQ is a heap which isn't sorted again when the quotas change, so the rank of a pod must
+	// not change while it is queued.
+	queuedRanks map[types.UID]queuedRank
+}
+
+// queuedRank is the rank of the quota of a pod as of the insertion of the pod into the queue at timestamp.
+type queuedRank struct {
+	timestamp time.Time
+	rank      quotaRank
+}
+
+var _ framework.QueueSortPlugin = &QueueSort{}
+
+// NewQueueSort initializes a new QueueSort plugin and returns it.
+func NewQueueSort(_ runtime.Object, handle framework.Handle) (framework.Plugin, error) {
+	q := &QueueSort{
+		informerFactory: handle.SharedInformerFactory(),
+		queuedRanks:     make(map[types.UID]queuedRank),
+	}
+	// The ranks of the pods leaving the queue are forgotten.
+	handle.SharedInformerFactory().Core().V1().Pods().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(_, newObj interface{}) {
+			if pod, ok := newObj.(*v1.Pod); ok && pod.Spec.NodeName != "" {
+				q.forget(pod.UID)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if pod, ok := obj.(*v1.Pod); ok {
+				q.forget(pod.UID)
+			}
+		},
+	})
+	return q, nil
+}
+
+// Name returns name of the plugin. It is used in logs, etc.
+func (q *QueueSort) Name() string {
+	return QueueSortName
+}
+
+// Less is used to sort pods in the scheduling queue in the following order.
+// 1. Compare the priorities of Pods.
+// 2. Favor the Pods whose quota and its descendants use no more than the Min of the quota.
+// 3. Compare the usage ratios of the quotas of Pods, see usageRatio.
+// 4. Compare the timestamps of Pods.
+// The quotas are ranked with the usage tracked by the CapacityScheduling plugin when Pods are added to the
+// queue, and the rank of a Pod doesn't change until it is added again. The Pods not subject to a quota come
+// after the Pods of the quotas under their Min and before the Pods of the borrowing quotas. Without
+// CapacityScheduling plugin, the quotas are ignored.
+func (q *QueueSort) Less(podInfo1, podInfo2 *framework.QueuedPodInfo) bool {
+	prio1 := corev1helpers.PodPriority(podInfo1.Pod)
+	prio2 := corev1helpers.PodPriority(podInfo2.Pod)
+	if prio1 != prio2 {
+		return prio1 > prio2
+	}
+	rank1, rank2 := q.rank(podInfo1), q.rank(podInfo2)
+	if rank1.underMin != rank2.underMin {
+		return rank1.underMin
+	}
+	if rank1.usageRatio != rank2.usageRatio {
+		return rank1.usageRatio < rank2.usageRatio
+	}
+	return podInfo1.Timestamp.Before(podInfo2.Timestamp)
+}
+
+// rank returns the rank of the quota of the queued pod, computed the first time the pod is compared after
+// it was added to the queue, which refreshes its timestamp.
+func (q *QueueSort) rank(podInfo *framework.QueuedPodInfo) quotaRank {
+	q.Lock()
+	defer q.Unlock()
+	if queued, ok := q.queuedRanks[podInfo.Pod.UID]; ok && queued.timestamp.Equal(podInfo.Timestamp) {
+		return queued.rank
+	}
+	var rank quotaRank
+	if c := q.getCapacityScheduling(); c != nil {
+		rank = c.queueRank(podInfo.Pod)
+	}
+	q.queuedRanks[podInfo.Pod.UID] = queuedRank{timestamp: podInfo.Timestamp, rank: rank}
+	return rank
+}
+
+// forget forgets the rank of the pod once it left the queue.
+func (q *QueueSort) forget(uid types.UID) {
+	q.Lock()
+	defer q.Unlock()
+	delete(q.queuedRanks, uid)
+}
+
+// getCapacityScheduling returns the CapacityScheduling plugin built with the informer factory of the QueueSort
+// plugin, or nil if there is none.
+func (q *QueueSort) getCapacityScheduling() *CapacityScheduling {
+	if c := q.capacityScheduling.Load(); c != nil {
+		return c
+	}
+	c, ok := capacitySchedulings.Load(q.informerFactory)
+	if !ok {
+		return nil
+	}
+	q.capacityScheduling.Store(c.(*CapacityScheduling))
+	return c.(*CapacityScheduling)
+}
+
+// quotaRank is the rank of a quota in the scheduling queue.
+type quotaRank struct {
+	// underMin tells whether the quota and its descendants use no more than the Min of the quota.
+	underMin bool
+	// usageRatio is the usage ratio of the quota and its descendants to the Min of the quota.
+	usageRatio float64
+}
+
+// queueRank returns the rank of the quota the pod is subject to, with the current usage of the quota and its
+// descendants, or the zero rank if the pod isn't subject to a quota.
+func (c *CapacityScheduling) queueRank(pod *v1.Pod) quotaRank {
+	c.RLock()
+	defer c.RUnlock()
+
+	key, info := c.getElasticQuotaInfo(pod)
+	if info == nil {
+		return quotaRank{}
+	}
+	used := c.elasticQuotaInfos.subtreeUsed(key)
+	return quotaRank{
+		underMin:   info.Min != nil && !cmp(used, info.Min, LowerBoundOfMin),
+		usageRatio: usageRatio(used, info.Min),
+	}
+}
@@ -0,0 +1,132 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package capacityscheduling
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	clientsetfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+func TestQueueSortLess(t *testing.T) {
+	informerFactory := informers.NewSharedInformerFactory(clientsetfake.NewSimpleClientset(), 0)
+	c := &CapacityScheduling{
+		elasticQuotaInfos: NewElasticQuotaInfos(),
+		podLister:         informerFactory.Core().V1().Pods().Lister(),
+	}
+	addEQ := func(namespace, name string, usedCPU int64) {
+		c.addElasticQuota(makeEQ(namespace, name, makeResourceList(4000, 4000), makeResourceList(1000, 1000)))
+		c.assignPod(makePod("used", namespace, 100, usedCPU, 0, 0, namespace+"/used", "node-a"))
+	}
+	// borrowing is above its Min, owed is far below it, and busy is close to it.
+	addEQ("ns1", "borrowing", 1200)
+	addEQ("ns2", "owed", 200)
+	addEQ("ns3", "busy", 500)
+	q := &QueueSort{queuedRanks: make(map[types.UID]queuedRank)}
+	q.capacityScheduling.Store(c)
+
+	now := time.Now()
+	podInfo := func(name, namespace string, priority int32, age time.Duration) *framework.QueuedPodInfo {
+		return &framework.QueuedPodInfo{
+			PodInfo:   mustNewPodInfo(t, makePod(name, namespace, 0, 10, 0, priority, namespace+"/"+name, "")),
+			Timestamp: now.Add(-age),
+		}
+	}
+	tests := []struct {
+		name     string
+		p1, p2   *framework.QueuedPodInfo
+		expected bool
+	}{
+		{
+			name:     "higher priority first",
+			p1:       podInfo("p1", "ns1", highPriority, 0),
+			p2:       podInfo("p2", "ns2", midPriority, time.Hour),
+			expected: true,
+		},
+		{
+			name:     "quota under its Min before a borrowing quota",
+			p1:       podInfo("p1", "ns2", midPriority, 0),
+			p2:       podInfo("p2", "ns1", midPriority, time.Hour),
+			expected: true,
+		},
+		{
+			name:     "lower usage ratio first",
+			p1:       podInfo("p1", "ns3", midPriority, time.Hour),
+			p2:       podInfo("p2", "ns2", midPriority, 0),
+			expected: false,
+		},
+		{
+			name:     "pod without quota before a borrowing quota",
+			p1:       podInfo("p1", "ns4", midPriority, 0),
+			p2:       podInfo("p2", "ns1", midPriority, time.Hour),
+			expected: true,
+		},
+		{
+			name:     "pod without quota after a quota under its Min",
+			p1:       podInfo("p1", "ns4", midPriority, time.Hour),
+			p2:       podInfo("p2", "ns3", midPriority, 0),
+			expected: false,
+		},
+		{
+			name:     "same quota, older pod first",
+			p1:       podInfo("p1", "ns1", midPriority, time.Hour),
+			p2:       podInfo("p2", "ns1", midPriority, 0),
+			expected: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := q.Less(tt.p1, tt.p2); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	// The ranks of the queued pods don't change along with the usage of their quotas, so that the order of
+	// the pods already in the queue stays consistent.
+	owed, busy := podInfo("p1", "ns2", midPriority, time.Hour), podInfo("p2", "ns3", midPriority, 0)
+	if !q.Less(owed, busy) {
+		t.Errorf("expected the pods of the quota with the lower usage ratio first")
+	}
+	c.assignPod(makePod("more", "ns2", 0, 1800, 0, 0, "ns2/more", "node-a"))
+	if !q.Less(owed, busy) {
+		t.Errorf("expected the rank of a queued pod not to change")
+	}
+	// A pod added to the queue again is ranked with the current usage of its quota.
+	owed.Timestamp = now
+	if q.Less(owed, busy) {
+		t.Errorf("expected the pods of a quota above its Min to come after the pods of a quota under its Min")
+	}
+	// The rank of a pod leaving the queue is forgotten.
+	q.forget(owed.Pod.UID)
+	if _, ok := q.queuedRanks[owed.Pod.UID]; ok {
+		t.Errorf("expected the rank of the pod to be forgotten")
+	}
+}
+
+func mustNewPodInfo(t *testing.T, pod *v1.Pod) *framework.PodInfo {
+	podInfo, err := framework.NewPodInfo(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return podInfo
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package capacityscheduling
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+// elasticQuotaSnapshot is the versioned copy of the ElasticQuotaInfos of the plugin shared by the scheduling
+// cycles. A version is never modified: the next one shares the copies of the ElasticQuotaInfos which didn't
+// change, and only copies again those which did, so that taking a snapshot doesn't depend on the number of
+// pods subject to the quotas.
+type elasticQuotaSnapshot struct {
+	version           int64
+	elasticQuotaInfos ElasticQuotaInfos
+	// sources are the ElasticQuotaInfos of the plugin the ElasticQuotaInfos of the snapshot are copies of.
+	sources map[string]*ElasticQuotaInfo
+}
+
+// update brings the snapshot up to date with the ElasticQuotaInfos of the plugin, given the keys of those
+// changed in place since the last update, and returns its ElasticQuotaInfos, which must not be modified.
+// The ElasticQuotaInfos added or replaced since the last update are copied as well.
+func (s *elasticQuotaSnapshot) update(elasticQuotaInfos ElasticQuotaInfos, changed sets.String) ElasticQuotaInfos {
+	if s.elasticQuotaInfos != nil && len(changed) == 0 && len(s.sources) == len(elasticQuotaInfos) {
+		unchanged := true
+		for key, info := range elasticQuotaInfos {
+			if s.sources[key] != info {
+				unchanged = false
+				break
+			}
+		}
+		if unchanged {
+			return s.elasticQuotaInfos
+		}
+	}
+
+	snapshot := make(ElasticQuotaInfos, len(elasticQuotaInfos))
+	sources := make(map[string]*ElasticQuotaInfo, len(elasticQuotaInfos))
+	for key, info := range elasticQuotaInfos {
+		if copied, ok := s.elasticQuotaInfos[key]; ok && s.sources[key] == info && !changed.Has(key) {
+			snapshot[key] = copied
+		} else {
+			snapshot[key] = info.clone()
+			info.sharePods()
+		}
+		sources[key] = info
+	}
+	s.version++
+	s.elasticQuotaInfos = snapshot
+	s.sources = sources
+	return snapshot
+}
+
+// ElasticQuotaSnapshotState stores the snapshot of elasticQuotas. The ElasticQuotaInfos are shared with
+// the snapshot of the plugin and with the clones of the state until the state modifies them, when they
+// get copied.
+type ElasticQuotaSnapshotState struct {
+	elasticQuotaInfos ElasticQuotaInfos
+	// index is the index of the quotas by namespace at the time of the snapshot, nil to look the quota of a
+	// pod up among all of them.
+	index elasticQuotaIndex
+	// owned are the keys of the ElasticQuotaInfos the state copied, which it may modify. It is nil as long
+	// as the map of the ElasticQuotaInfos is shared as well.
+	owned sets.String
+}
+
+// Clone the ElasticQuotaSnapshot state. Only the ElasticQuotaInfos the state modified are copied.
+func (s *ElasticQuotaSnapshotState) Clone() framework.StateData {
+	if len(s.owned) == 0 {
+		return &ElasticQuotaSnapshotState{
+			elasticQuotaInfos: s.elasticQuotaInfos,
+			index:             s.index,
+		}
+	}
+	elasticQuotaInfos := make(ElasticQuotaInfos, len(s.elasticQuotaInfos))
+	for key, info := range s.elasticQuotaInfos {
+		if s.owned.Has(key) {
+			// The state keeps modifying its own copy.
+			info = info.clone()
+			info.ownPods()
+		}
+		elasticQuotaInfos[key] = info
+	}
+	return &ElasticQuotaSnapshotState{
+		elasticQuotaInfos: elasticQuotaInfos,
+		index:             s.index,
+		owned:             sets.NewString(s.owned.UnsortedList()...),
+	}
+}
+
+// getElasticQuotaInfo returns the key and the ElasticQuotaInfo of the quota the pod is subject to, or nil.
+func (s *ElasticQuotaSnapshotState) getElasticQuotaInfo(pod *v1.Pod) (string, *ElasticQuotaInfo) {
+	return s.elasticQuotaInfos.getIndexedElasticQuotaInfo(s.index, pod)
+}
+
+// ownElasticQuotaInfos gives the state its own map of the ElasticQuotaInfos, so that the ElasticQuotaInfos
+// copied when the state modifies them replace the shared ones in the returned map.
+func (s *ElasticQuotaSnapshotState) ownElasticQuotaInfos() ElasticQuotaInfos {
+	if s.owned == nil {
+		elasticQuotaInfos := make(ElasticQuotaInfos, len(s.elasticQuotaInfos))
+		for key, info := range s.elasticQuotaInfos {
+			elasticQuotaInfos[key] = info
+		}
+		s.elasticQuotaInfos = elasticQuotaInfos
+		s.owned = sets.NewString()
+	}
+	return s.elasticQuotaInfos
+}
+
+// elasticQuotaInfoForUpdate returns the ElasticQuotaInfo of the given key, copied first if it is shared.
+func (s *ElasticQuotaSnapshotState) elasticQuotaInfoForUpdate(key string) *ElasticQuotaInfo {
+	if s.owned.Has(key) {
+		return s.elasticQuotaInfos[key]
+	}
+	elasticQuotaInfos := s.ownElasticQuotaInfos()
+	info := elasticQuotaInfos[key].clone()
+	elasticQuotaInfos[key] = info
+	s.owned.Insert(key)
+	return info
+}
+
+// lineageForUpdate copies the ElasticQuotaInfo of the given key and those of its ancestors, which share its
+// usage, if they are shared.
+func (s *ElasticQuotaSnapshotState) lineageForUpdate(key string) {
+	for _, k := range s.elasticQuotaInfos.lineage(key) {
+		s.elasticQuotaInfoForUpdate(k)
+	}
+}
+
+// addPod adds the pod to the quota it is subject to, if it isn't there yet, charging it to the flavor of the
+// node, if any.
+func (s *ElasticQuotaSnapshotState) addPod(pod *v1.Pod, node *v1.Node) error {
+	key, info := s.getElasticQuotaInfo(pod)
+	if info == nil {
+		return nil
+	}
+	podKey, err := framework.GetPodKey(pod)
+	if err != nil {
+		return err
+	}
+	if info.pods.Has(podKey) {
+		return nil
+	}
+	s.lineageForUpdate(key)
+	_, err = s.elasticQuotaInfos.addPod(key, pod, node)
+	return err
+}
+
+// deletePod deletes the pod from the quota it is subject to, if it is there.
+func (s *ElasticQuotaSnapshotState) deletePod(pod *v1.Pod) error {
+	key, info := s.getElasticQuotaInfo(pod)
+	if info == nil {
+		return nil
+	}
+	podKey, err := framework.GetPodKey(pod)
+	if err != nil {
+		return err
+	}
+	if !info.pods.Has(podKey) {
+		return nil
+	}
+	s.lineageForUpdate(key)
+	_, err = s.elasticQuotaInfos.deletePod(key, pod)
+	return err
+}
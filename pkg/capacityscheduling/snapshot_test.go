@@ -0,0 +1,171 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package capacityscheduling
+
+import (
+	"context"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/informers"
+	clientsetfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+func TestElasticQuotaSnapshot(t *testing.T) {
+	c := &CapacityScheduling{
+		elasticQuotaInfos: NewElasticQuotaInfos(),
+		podLister:         informers.NewSharedInformerFactory(clientsetfake.NewSimpleClientset(), 0).Core().V1().Pods().Lister(),
+	}
+	c.addElasticQuota(makeEQ("ns1", "eq1", makeResourceList(1000, 1000), makeResourceList(100, 100)))
+	c.addElasticQuota(makeEQ("ns2", "eq2", makeResourceList(1000, 1000), makeResourceList(100, 100)))
+	c.assignPod(makePod("p1", "ns1", 10, 10, 0, 0, "p1", "node-a"))
+
+	first := c.snapshotElasticQuota().elasticQuotaInfos
+	if first["ns1/eq1"] == c.elasticQuotaInfos["ns1/eq1"] || first["ns1/eq1"].Used.MilliCPU != 10 {
+		t.Fatalf("expected a copy of the quotas, got %+v", first["ns1/eq1"])
+	}
+
+	// Without changes, the snapshot is shared.
+	version := c.snapshot.version
+	if second := c.snapshotElasticQuota().elasticQuotaInfos; c.snapshot.version != version || second["ns1/eq1"] != first["ns1/eq1"] {
+		t.Errorf("expected the snapshot to be reused")
+	}
+
+	// Only the changed quota is copied again, and the previous snapshot isn't modified.
+	c.Reserve(context.TODO(), framework.NewCycleState(), makePod("p2", "ns2", 10, 20, 0, 0, "p2", "node-a"), "node-a")
+	third := c.snapshotElasticQuota().elasticQuotaInfos
+	if c.snapshot.version != version+1 {
+		t.Errorf("expected version %v, got %v", version+1, c.snapshot.version)
+	}
+	if third["ns1/eq1"] != first["ns1/eq1"] {
+		t.Errorf("expected the unchanged quota to be shared")
+	}
+	if third["ns2/eq2"] == first["ns2/eq2"] || third["ns2/eq2"].Used.MilliCPU != 20 {
+		t.Errorf("expected a new copy of the changed quota, got %+v", third["ns2/eq2"])
+	}
+	if first["ns2/eq2"].Used.MilliCPU != 0 || first["ns2/eq2"].pods.Len() != 0 {
+		t.Errorf("expected the previous snapshot to be left alone, got %+v", first["ns2/eq2"])
+	}
+	// The copies share the pods of the quotas until either side modifies them.
+	if !third["ns2/eq2"].pods.Has("p2") || !c.elasticQuotaInfos["ns2/eq2"].podsShared {
+		t.Errorf("expected the pods of the quota to be shared with the snapshot, got %+v", third["ns2/eq2"])
+	}
+	c.Unreserve(context.TODO(), framework.NewCycleState(), makePod("p2", "ns2", 10, 20, 0, 0, "p2", "node-a"), "node-a")
+	if !third["ns2/eq2"].pods.Has("p2") || c.elasticQuotaInfos["ns2/eq2"].pods.Has("p2") {
+		t.Errorf("expected the snapshot to keep its pods, got %v", third["ns2/eq2"].pods)
+	}
+
+	// A deleted quota leaves the snapshot.
+	c.deleteElasticQuota(makeEQ("ns2", "eq2", nil, nil))
+	if fourth := c.snapshotElasticQuota().elasticQuotaInfos; len(fourth) != 1 || fourth["ns1/eq1"] != first["ns1/eq1"] {
+		t.Errorf("expected only the remaining quota, got %v", fourth)
+	}
+}
+
+func TestElasticQuotaSnapshotStateCopyOnWrite(t *testing.T) {
+	shared := ElasticQuotaInfos{
+		"ns1/eq1": {
+			Namespace: "ns1",
+			pods:      sets.NewString("p1"),
+			Min:       &framework.Resource{MilliCPU: 100},
+			Max:       &framework.Resource{MilliCPU: 1000},
+			Used:      &framework.Resource{MilliCPU: 10},
+		},
+		"ns2/eq2": {
+			Namespace: "ns2",
+			pods:      sets.NewString(),
+			Min:       &framework.Resource{MilliCPU: 100},
+			Max:       &framework.Resource{MilliCPU: 1000},
+			Used:      &framework.Resource{},
+		},
+	}
+	state := &ElasticQuotaSnapshotState{elasticQuotaInfos: shared}
+
+	// Adding a pod already there doesn't copy anything.
+	if err := state.addPod(makePod("p1", "ns1", 0, 10, 0, 0, "p1", "node-a"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if state.owned != nil {
+		t.Errorf("expected the state to share its quotas, owns %v", state.owned)
+	}
+
+	if err := state.deletePod(makePod("p1", "ns1", 0, 10, 0, 0, "p1", "node-a")); err != nil {
+		t.Fatal(err)
+	}
+	if got := state.elasticQuotaInfos["ns1/eq1"].Used.MilliCPU; got != 0 {
+		t.Errorf("expected the pod to be deleted from the state, used %v", got)
+	}
+	if shared["ns1/eq1"].Used.MilliCPU != 10 || !shared["ns1/eq1"].pods.Has("p1") {
+		t.Errorf("expected the shared quota to be left alone, got %+v", shared["ns1/eq1"])
+	}
+	if state.elasticQuotaInfos["ns2/eq2"] != shared["ns2/eq2"] {
+		t.Errorf("expected the unchanged quota to be shared")
+	}
+
+	// The clones of the state get their own copies of the quotas modified by the state.
+	clone := state.Clone().(*ElasticQuotaSnapshotState)
+	if err := clone.addPod(makePod("p3", "ns1", 0, 30, 0, 0, "p3", "node-a"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := state.elasticQuotaInfos["ns1/eq1"].Used.MilliCPU; got != 0 {
+		t.Errorf("expected the state to be left alone by its clone, used %v", got)
+	}
+	if got := clone.elasticQuotaInfos["ns1/eq1"].Used.MilliCPU; got != 30 {
+		t.Errorf("expected the pod to be added to the clone, used %v", got)
+	}
+}
+
+func TestElasticQuotaSnapshotStateTree(t *testing.T) {
+	shared := ElasticQuotaInfos{
+		"org/eq": {
+			Namespace: "org",
+			pods:      sets.NewString(),
+			Min:       &framework.Resource{MilliCPU: 100},
+			Max:       &framework.Resource{MilliCPU: 1000},
+			Used:      &framework.Resource{},
+		},
+		"ns1/eq1": {
+			Namespace: "ns1",
+			Parent:    "org/eq",
+			pods:      sets.NewString("p1"),
+			Min:       &framework.Resource{MilliCPU: 100},
+			Max:       &framework.Resource{MilliCPU: 1000},
+			Used:      &framework.Resource{MilliCPU: 10},
+		},
+	}
+	shared.resetDescendantsUsed()
+	state := &ElasticQuotaSnapshotState{elasticQuotaInfos: shared}
+
+	// The usage of the subtree of the parent follows the pods of its child, in the copy of the parent.
+	if err := state.addPod(makePod("p2", "ns1", 0, 20, 0, 0, "p2", "node-a"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := state.elasticQuotaInfos.subtreeUsed("org/eq").MilliCPU; got != 30 {
+		t.Errorf("expected the subtree of the parent to use 30, got %v", got)
+	}
+	if got := shared.subtreeUsed("org/eq").MilliCPU; got != 10 {
+		t.Errorf("expected the shared parent to be left alone, got %v", got)
+	}
+
+	if err := state.deletePod(makePod("p1", "ns1", 0, 10, 0, 0, "p1", "node-a")); err != nil {
+		t.Fatal(err)
+	}
+	if got := state.elasticQuotaInfos.subtreeUsed("org/eq").MilliCPU; got != 20 {
+		t.Errorf("expected the subtree of the parent to use 20, got %v", got)
+	}
+}
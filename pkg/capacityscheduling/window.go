@@ -0,0 +1,182 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package capacityscheduling
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	apipod "k8s.io/kubernetes/pkg/api/v1/pod"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+	schedutil "k8s.io/kubernetes/pkg/scheduler/util"
+
+	"sigs.k8s.io/scheduler-plugins/apis/scheduling/v1alpha1"
+	"sigs.k8s.io/scheduler-plugins/pkg/util"
+)
+
+// now returns the time the windows of the quotas are evaluated at.
+func (c *CapacityScheduling) now() time.Time {
+	if c.clock == nil {
+		return time.Now()
+	}
+	return c.clock.Now()
+}
+
+// trackElasticQuotaWindows keeps track of the ElasticQuota of the given key if it has windows. The caller must
+// hold the lock.
+func (c *CapacityScheduling) trackElasticQuotaWindows(key string, eq *v1alpha1.ElasticQuota) {
+	if len(eq.Spec.Windows) == 0 {
+		delete(c.windowedElasticQuotas, key)
+		return
+	}
+	if c.windowedElasticQuotas == nil {
+		c.windowedElasticQuotas = make(map[string]*v1alpha1.ElasticQuota)
+	}
+	c.windowedElasticQuotas[key] = eq
+}
+
+// syncElasticQuotaWindowsPeriodically syncs the windows of the quotas at the start of every minute, which
+// is the resolution of the windows, until the context is done.
+func (c *CapacityScheduling) syncElasticQuotaWindowsPeriodically(ctx context.Context) {
+	for {
+		now := time.Now()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(now.Truncate(time.Minute).Add(time.Minute).Sub(now)):
+		}
+		c.syncElasticQuotaWindows(ctx)
+	}
+}
+
+// syncElasticQuotaWindows replaces the ElasticQuotaInfos of the quotas whose active window changed, so that
+// their Min and Max in effect change, and reclaims the resources the quotas now use over their Max.
+func (c *CapacityScheduling) syncElasticQuotaWindows(ctx context.Context) {
+	now := c.now()
+	var switched []*v1alpha1.ElasticQuota
+	c.RLock()
+	for key, eq := range c.windowedElasticQuotas {
+		info := c.elasticQuotaInfos[key]
+		if info == nil {
+			continue
+		}
+		if _, _, window := util.GetElasticQuotaBounds(eq, now); window != info.Window {
+			switched = append(switched, eq)
+		}
+	}
+	c.RUnlock()
+
+	for _, eq := range switched {
+		c.updateElasticQuota(eq, eq)
+		_, _, window := util.GetElasticQuotaBounds(eq, now)
+		klog.V(2).InfoS("ElasticQuota switched windows", "elasticQuota", klog.KObj(eq), "window", window)
+	}
+	for _, eq := range switched {
+		c.reclaimOverMax(ctx, getElasticQuotaKey(eq.Namespace, eq.Name))
+	}
+}
+
+// reclaimOverMax preempts the least important pods of the quota of the given key and its descendants, until
+// their usage fits in the Max of the quota again. The terminating pods are expected to free their resources.
+func (c *CapacityScheduling) reclaimOverMax(ctx context.Context, key string) {
+	state := c.snapshotElasticQuota()
+	overMax := func() bool {
+		info := state.elasticQuotaInfos[key]
+		return info != nil && info.Max != nil && cmp(state.elasticQuotaInfos.subtreeUsed(key), info.Max, UpperBoundOfMax)
+	}
+	if !overMax() {
+		return
+	}
+
+	// Only the pods of the namespaces of the quota and its descendants are looked at, and those the quotas
+	// track are kept.
+	var candidates []*v1.Pod
+	for eqKey, info := range state.elasticQuotaInfos {
+		if info.pods.Len() == 0 || !sets.NewString(state.elasticQuotaInfos.lineage(eqKey)...).Has(key) {
+			continue
+		}
+		for _, namespace := range info.namespaces() {
+			pods, err := c.podLister.Pods(namespace).List(labels.Everything())
+			if err != nil {
+				klog.ErrorS(err, "Failed to list the pods to reclaim the resources of the elasticQuota", "elasticQuota", key, "namespace", namespace)
+				continue
+			}
+			for _, pod := range pods {
+				podKey, err := framework.GetPodKey(pod)
+				if err != nil || !info.pods.Has(podKey) {
+					continue
+				}
+				if pod.DeletionTimestamp != nil {
+					if err := state.deletePod(pod); err != nil {
+						klog.ErrorS(err, "Failed to delete the pod from the snapshot of the elasticQuotas", "pod", klog.KObj(pod))
+					}
+					continue
+				}
+				candidates = append(candidates, pod)
+			}
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return schedutil.MoreImportantPod(candidates[j], candidates[i])
+	})
+
+	var victims []*v1.Pod
+	for _, pod := range candidates {
+		if !overMax() {
+			break
+		}
+		if err := state.deletePod(pod); err != nil {
+			klog.ErrorS(err, "Failed to delete the pod from the snapshot of the elasticQuotas", "pod", klog.KObj(pod))
+			continue
+		}
+		victims = append(victims, pod)
+	}
+	for _, victim := range victims {
+		if err := c.preemptToReclaim(ctx, key, victim); err != nil {
+			klog.ErrorS(err, "Failed to preempt the pod to reclaim the resources of the elasticQuota", "pod", klog.KObj(victim), "elasticQuota", key)
+		}
+	}
+}
+
+// preemptToReclaim preempts the pod the way the scheduler preempts its victims, for the quota of the given key.
+func (c *CapacityScheduling) preemptToReclaim(ctx context.Context, key string, victim *v1.Pod) error {
+	cs := c.fh.ClientSet()
+	condition := &v1.PodCondition{
+		Type:    v1.DisruptionTarget,
+		Status:  v1.ConditionTrue,
+		Reason:  v1.PodReasonPreemptionByScheduler,
+		Message: fmt.Sprintf("%s: preempting to fit the usage of elasticQuota %s in its Max", victim.Spec.SchedulerName, key),
+	}
+	newStatus := victim.Status.DeepCopy()
+	if apipod.UpdatePodCondition(newStatus, condition) {
+		if err := schedutil.PatchPodStatus(ctx, cs, victim, newStatus); err != nil {
+			return err
+		}
+	}
+	if err := schedutil.DeletePod(ctx, cs, victim); err != nil {
+		return err
+	}
+	klog.V(2).InfoS("Preempted the pod to reclaim the resources of the elasticQuota", "pod", klog.KObj(victim), "elasticQuota", key)
+	c.fh.EventRecorder().Eventf(victim, nil, v1.EventTypeNormal, "Preempted", "Preempting", "Preempted to fit the usage of ElasticQuota %v in its Max", key)
+	return nil
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package capacityscheduling
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	clientsetfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/events"
+	frameworkruntime "k8s.io/kubernetes/pkg/scheduler/framework/runtime"
+	st "k8s.io/kubernetes/pkg/scheduler/testing"
+	testingclock "k8s.io/utils/clock/testing"
+
+	"sigs.k8s.io/scheduler-plugins/apis/scheduling/v1alpha1"
+)
+
+func TestSyncElasticQuotaWindows(t *testing.T) {
+	pods := []*v1.Pod{
+		makePod("p1", "ns1", 0, 100, 0, highPriority, "p1", "node-a"),
+		makePod("p2", "ns1", 0, 200, 0, 0, "p2", "node-a"),
+		makePod("p3", "ns1", 0, 150, 0, midPriority, "p3", "node-a"),
+	}
+	var objs []v1.Pod
+	for _, pod := range pods {
+		objs = append(objs, *pod)
+	}
+	cs := clientsetfake.NewSimpleClientset(&v1.PodList{Items: objs})
+	informerFactory := informers.NewSharedInformerFactory(cs, 0)
+	podInformer := informerFactory.Core().V1().Pods().Informer()
+	for _, pod := range pods {
+		podInformer.GetStore().Add(pod)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fwk, err := st.NewFramework(
+		ctx,
+		makeRegisteredPlugin(),
+		"default-scheduler",
+		frameworkruntime.WithClientSet(cs),
+		frameworkruntime.WithEventRecorder(&events.FakeRecorder{}),
+		frameworkruntime.WithInformerFactory(informerFactory),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock := testingclock.NewFakePassiveClock(time.Date(2023, time.October, 16, 21, 59, 0, 0, time.UTC))
+	c := &CapacityScheduling{
+		fh:                fwk,
+		elasticQuotaInfos: NewElasticQuotaInfos(),
+		podLister:         informerFactory.Core().V1().Pods().Lister(),
+		clock:             clock,
+	}
+	eq := makeEQ("ns1", "eq1", makeResourceList(1000, 1000), makeResourceList(100, 100))
+	eq.Spec.Windows = []v1alpha1.ElasticQuotaWindow{
+		{
+			Name:  "overnight",
+			Start: "22:00",
+			End:   "06:00",
+			Max:   v1.ResourceList{v1.ResourceCPU: *resource.NewMilliQuantity(300, resource.DecimalSI)},
+		},
+	}
+	c.addElasticQuota(eq)
+	for _, pod := range pods {
+		c.assignPod(pod)
+	}
+
+	// The window isn't active yet.
+	c.syncElasticQuotaWindows(ctx)
+	if info := c.elasticQuotaInfos["ns1/eq1"]; info.Window != "" || info.Max.MilliCPU != 1000 {
+		t.Fatalf("expected the base Max, got window %q and %+v", info.Window, info.Max)
+	}
+
+	// The Max of the window takes effect, and the least important pods are preempted until the usage fits.
+	clock.SetTime(time.Date(2023, time.October, 16, 22, 0, 0, 0, time.UTC))
+	c.syncElasticQuotaWindows(ctx)
+	info := c.elasticQuotaInfos["ns1/eq1"]
+	if info.Window != "overnight" || info.Max.MilliCPU != 300 || info.Max.Memory != 1000 {
+		t.Errorf("expected the Max of the window, got window %q and %+v", info.Window, info.Max)
+	}
+	if info.Used.MilliCPU != 450 {
+		t.Errorf("expected the usage to be kept, got %+v", info.Used)
+	}
+	if snapshot := c.snapshotElasticQuota().elasticQuotaInfos["ns1/eq1"]; snapshot.Max.MilliCPU != 300 {
+		t.Errorf("expected the snapshot to get the Max of the window, got %+v", snapshot.Max)
+	}
+	for _, tt := range []struct {
+		name      string
+		preempted bool
+	}{
+		{name: "p1"},
+		{name: "p2", preempted: true},
+		{name: "p3"},
+	} {
+		_, err := cs.CoreV1().Pods("ns1").Get(ctx, tt.name, metav1.GetOptions{})
+		if preempted := errors.IsNotFound(err); preempted != tt.preempted {
+			t.Errorf("%v: expected preempted %v, got %v (%v)", tt.name, tt.preempted, preempted, err)
+		}
+	}
+
+	// The base values are back at the end of the window.
+	clock.SetTime(time.Date(2023, time.October, 17, 6, 0, 0, 0, time.UTC))
+	c.syncElasticQuotaWindows(ctx)
+	if info := c.elasticQuotaInfos["ns1/eq1"]; info.Window != "" || info.Max.MilliCPU != 1000 {
+		t.Errorf("expected the base Max, got window %q and %+v", info.Window, info.Max)
+	}
+}
@@ -19,39 +19,64 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
 	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
 	quota "k8s.io/apiserver/pkg/quota/v1"
 	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/clock"
 
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	schedv1alpha1 "sigs.k8s.io/scheduler-plugins/apis/scheduling/v1alpha1"
+	"sigs.k8s.io/scheduler-plugins/pkg/util"
 )
 
 type ElasticQuotaReconciler struct {
 	recorder record.EventRecorder
+	// clock tells the time the windows of the quotas are evaluated at, the current time if nil.
+	clock clock.PassiveClock
 
 	client.Client
 	Scheme  *runtime.Scheme
 	Workers int
 }
 
+// NewElasticQuotaReconciler returns an ElasticQuotaReconciler recording its events with the given recorder,
+// for use without a manager.
+func NewElasticQuotaReconciler(client client.Client, scheme *runtime.Scheme, recorder record.EventRecorder) *ElasticQuotaReconciler {
+	return &ElasticQuotaReconciler{
+		recorder: recorder,
+		Client:   client,
+		Scheme:   scheme,
+	}
+}
+
 // +kubebuilder:rbac:groups=scheduling.x-k8s.io,resources=elasticquota,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=scheduling.x-k8s.io,resources=elasticquota/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=scheduling.x-k8s.io,resources=elasticquota/finalizers,verbs=update
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
 func (r *ElasticQuotaReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := log.FromContext(ctx)
 	log.Info("reconciling")
+	// The quotas of the other namespaces are listed as well, since an ElasticQuota
+	// can have a parent, and the aggregated usage of a quota covers its subtree.
 	eqList := &schedv1alpha1.ElasticQuotaList{}
-	if err := r.List(ctx, eqList, client.InNamespace(req.Namespace)); err != nil {
+	if err := r.List(ctx, eqList); err != nil {
 		if apierrs.IsNotFound(err) {
 			log.V(5).Info("no elasticquota found")
 			return ctrl.Result{}, nil
@@ -60,104 +85,530 @@ func (r *ElasticQuotaReconciler) Reconcile(ctx context.Context, req ctrl.Request
 		return ctrl.Result{}, err
 	}
 
-	// TODO: When elastic quota supports multiple instances in a namespace, modify this
-	if len(eqList.Items) == 0 {
+	// The Min and Max in effect are those of the active windows of the quotas. The status of the quotas is
+	// only patched, so that their spec can be overridden with the Min and Max in effect.
+	now := time.Now()
+	if r.clock != nil {
+		now = r.clock.Now()
+	}
+	activeWindows := make(map[*schedv1alpha1.ElasticQuota]string, len(eqList.Items))
+	for i := range eqList.Items {
+		eq := &eqList.Items[i]
+		if len(eq.Spec.Windows) == 0 {
+			continue
+		}
+		if eq.Namespace == req.Namespace {
+			for j := range eq.Spec.Windows {
+				if err := util.ValidateElasticQuotaWindow(&eq.Spec.Windows[j]); err != nil {
+					r.recorder.Eventf(eq, v1.EventTypeWarning, "InvalidWindow", "Invalid window %q, it is never active: %v", eq.Spec.Windows[j].Name, err)
+				}
+			}
+		}
+		eq.Spec.Min, eq.Spec.Max, activeWindows[eq] = util.GetElasticQuotaBounds(eq, now)
+	}
+
+	// The namespaces are only needed to find the namespaces pooled by the quotas with a namespace selector.
+	var namespaces []v1.Namespace
+	for i := range eqList.Items {
+		if eqList.Items[i].Spec.NamespaceSelector != nil {
+			namespaceList := &v1.NamespaceList{}
+			if err := r.List(ctx, namespaceList); err != nil {
+				return ctrl.Result{}, err
+			}
+			namespaces = namespaceList.Items
+			break
+		}
+	}
+
+	// The nodes are only needed to find the flavors the pods of the quotas with flavors are charged to.
+	var nodeLabels map[string]labels.Set
+	for i := range eqList.Items {
+		if len(eqList.Items[i].Spec.Flavors) != 0 {
+			nodeList := &v1.NodeList{}
+			if err := r.List(ctx, nodeList); err != nil {
+				return ctrl.Result{}, err
+			}
+			nodeLabels = make(map[string]labels.Set, len(nodeList.Items))
+			for _, node := range nodeList.Items {
+				nodeLabels[node.Name] = node.Labels
+			}
+			break
+		}
+	}
+
+	// The usage of the pods of the namespace changes the usage of the quotas applying to the namespace,
+	// which may belong to other namespaces, and the aggregated usage of all their ancestors. The quotas
+	// of the namespace are synced as well, since they may have just stopped applying to the namespace.
+	var eqs []*schedv1alpha1.ElasticQuota
+	scopes := make([]util.ElasticQuotaScope, len(eqList.Items))
+	for i := range eqList.Items {
+		eq := &eqList.Items[i]
+		scopes[i] = r.getElasticQuotaScope(eq, namespaces, eq.Namespace == req.Namespace)
+		if eq.Namespace != req.Namespace && !scopes[i].AppliesTo(req.Namespace) {
+			continue
+		}
+		for _, q := range getElasticQuotaLineage(eqList.Items, eq) {
+			if !containsElasticQuota(eqs, q) {
+				eqs = append(eqs, q)
+			}
+		}
+	}
+	if len(eqs) == 0 {
 		log.V(5).Info("no elasticquota found")
 		return ctrl.Result{}, nil
 	}
+	// The part of their Min the siblings of those quotas lend changes with what those quotas borrow.
+	for _, q := range append([]*schedv1alpha1.ElasticQuota(nil), eqs...) {
+		parent := getElasticQuotaParent(eqList.Items, q)
+		for i := range eqList.Items {
+			sibling := &eqList.Items[i]
+			if getElasticQuotaParent(eqList.Items, sibling) == parent && !containsElasticQuota(eqs, sibling) {
+				eqs = append(eqs, sibling)
+			}
+		}
+	}
 
-	eq := &eqList.Items[0]
-	used, err := r.computeElasticQuotaUsed(ctx, req.Namespace, eq)
-	if err != nil {
-		return ctrl.Result{}, err
+	usageByQuota := make(map[types.NamespacedName]*elasticQuotaUsage)
+	for i := range eqList.Items {
+		usageByQuota[types.NamespacedName{Namespace: eqList.Items[i].Namespace, Name: eqList.Items[i].Name}] = newElasticQuotaUsage(&eqList.Items[i])
+	}
+	computedNamespaces := sets.NewString()
+	getUsage := func(q *schedv1alpha1.ElasticQuota) (*elasticQuotaUsage, error) {
+		for _, namespace := range getElasticQuotaNamespaces(scopes[indexOfElasticQuota(eqList.Items, q)]) {
+			if computedNamespaces.Has(namespace) {
+				continue
+			}
+			if err := r.computeElasticQuotasUsed(ctx, namespace, eqList.Items, scopes, nodeLabels, usageByQuota); err != nil {
+				return nil, err
+			}
+			computedNamespaces.Insert(namespace)
+		}
+		return usageByQuota[types.NamespacedName{Namespace: q.Namespace, Name: q.Name}], nil
+	}
+	getUsed := func(q *schedv1alpha1.ElasticQuota) (v1.ResourceList, error) {
+		usage, err := getUsage(q)
+		if err != nil {
+			return nil, err
+		}
+		return usage.used, nil
 	}
 
-	// Ignore this loop if the usage value has not changed
-	if apiequality.Semantic.DeepEqual(used, eq.Status.Used) {
-		return ctrl.Result{}, nil
+	// getAggregatedUsed returns the usage of the quota and all its descendants, or nil if it has none.
+	getAggregatedUsed := func(q *schedv1alpha1.ElasticQuota) (v1.ResourceList, error) {
+		var aggregatedUsed v1.ResourceList
+		for i := range eqList.Items {
+			descendant := &eqList.Items[i]
+			if descendant == q || !isElasticQuotaDescendant(eqList.Items, descendant, q) {
+				continue
+			}
+			descendantUsed, err := getUsed(descendant)
+			if err != nil {
+				return nil, err
+			}
+			aggregatedUsed = quota.Add(aggregatedUsed, descendantUsed)
+		}
+		if aggregatedUsed == nil {
+			return nil, nil
+		}
+		used, err := getUsed(q)
+		if err != nil {
+			return nil, err
+		}
+		return quota.Add(aggregatedUsed, used), nil
+	}
+	subtreeUsedByQuota := make(map[*schedv1alpha1.ElasticQuota]v1.ResourceList)
+	getSubtreeUsed := func(q *schedv1alpha1.ElasticQuota) (v1.ResourceList, error) {
+		if subtreeUsed, ok := subtreeUsedByQuota[q]; ok {
+			return subtreeUsed, nil
+		}
+		subtreeUsed, err := getAggregatedUsed(q)
+		if err == nil && subtreeUsed == nil {
+			subtreeUsed, err = getUsed(q)
+		}
+		if err != nil {
+			return nil, err
+		}
+		subtreeUsedByQuota[q] = subtreeUsed
+		return subtreeUsed, nil
+	}
+	// getLent returns the part of the unused Min of the quota borrowed by its siblings.
+	getLent := func(q *schedv1alpha1.ElasticQuota) (v1.ResourceList, error) {
+		parent := getElasticQuotaParent(eqList.Items, q)
+		var lendable, totalLendable, totalBorrowed v1.ResourceList
+		for i := range eqList.Items {
+			sibling := &eqList.Items[i]
+			if getElasticQuotaParent(eqList.Items, sibling) != parent {
+				continue
+			}
+			siblingUsed, err := getSubtreeUsed(sibling)
+			if err != nil {
+				return nil, err
+			}
+			siblingLendable := getLendable(sibling, siblingUsed)
+			if sibling == q {
+				lendable = siblingLendable
+			}
+			totalLendable = quota.Add(totalLendable, siblingLendable)
+			totalBorrowed = quota.Add(totalBorrowed, getBorrowed(sibling, siblingUsed))
+		}
+		return getLent(lendable, totalLendable, totalBorrowed), nil
 	}
 
-	// create a usage object that is based on the elastic quota version that will handle updates
-	// by default, we set used to the current status
-	newEQ := eq.DeepCopy()
-	newEQ.Status.Used = used
-	if err = r.patchElasticQuota(ctx, eq, newEQ); err != nil {
-		return ctrl.Result{}, err
+	for _, q := range eqs {
+		usage, err := getUsage(q)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		aggregatedUsed, err := getAggregatedUsed(q)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		subtreeUsed, err := getSubtreeUsed(q)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		borrowed := getBorrowed(q, subtreeUsed)
+		lent, err := getLent(q)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+
+		flavors := usage.getFlavorStatuses(q)
+
+		// Ignore this quota if the usage value has not changed
+		if apiequality.Semantic.DeepEqual(usage.used, q.Status.Used) &&
+			apiequality.Semantic.DeepEqual(usage.pending, q.Status.Pending) &&
+			apiequality.Semantic.DeepEqual(usage.terminating, q.Status.Terminating) &&
+			apiequality.Semantic.DeepEqual(aggregatedUsed, q.Status.AggregatedUsed) &&
+			apiequality.Semantic.DeepEqual(borrowed, q.Status.Borrowed) &&
+			apiequality.Semantic.DeepEqual(lent, q.Status.Lent) &&
+			apiequality.Semantic.DeepEqual(flavors, q.Status.Flavors) &&
+			activeWindows[q] == q.Status.ActiveWindow {
+			continue
+		}
+
+		// create a usage object that is based on the elastic quota version that will handle updates
+		// by default, we set used to the current status
+		newEQ := q.DeepCopy()
+		newEQ.Status.Used = usage.used
+		newEQ.Status.Pending = usage.pending
+		newEQ.Status.Terminating = usage.terminating
+		newEQ.Status.AggregatedUsed = aggregatedUsed
+		newEQ.Status.Borrowed = borrowed
+		newEQ.Status.Lent = lent
+		newEQ.Status.Flavors = flavors
+		newEQ.Status.ActiveWindow = activeWindows[q]
+		if err = r.patchElasticQuota(ctx, q, newEQ); err != nil {
+			return ctrl.Result{}, err
+		}
+		r.recorder.Event(q, v1.EventTypeNormal, "Synced", fmt.Sprintf("Elastic Quota %s synced successfully", types.NamespacedName{Namespace: q.Namespace, Name: q.Name}))
+	}
+
+	// The quotas are synced again when one of their windows starts or ends.
+	var nextWindowChange time.Time
+	for _, q := range eqs {
+		if next := util.NextElasticQuotaWindowChange(q, now); !next.IsZero() && (nextWindowChange.IsZero() || next.Before(nextWindowChange)) {
+			nextWindowChange = next
+		}
+	}
+	if !nextWindowChange.IsZero() {
+		return ctrl.Result{RequeueAfter: nextWindowChange.Sub(now)}, nil
 	}
-	r.recorder.Event(eq, v1.EventTypeNormal, "Synced", fmt.Sprintf("Elastic Quota %s synced successfully", req.NamespacedName))
 	return ctrl.Result{}, nil
 }
 
+// getElasticQuotaLineage returns the ElasticQuota followed by its ancestors, up to the root of its quota tree.
+func getElasticQuotaLineage(eqs []schedv1alpha1.ElasticQuota, eq *schedv1alpha1.ElasticQuota) []*schedv1alpha1.ElasticQuota {
+	var lineage []*schedv1alpha1.ElasticQuota
+	visited := sets.NewString()
+	for eq != nil && !visited.Has(eq.Namespace+"/"+eq.Name) {
+		visited.Insert(eq.Namespace + "/" + eq.Name)
+		lineage = append(lineage, eq)
+		parent := eq.Spec.Parent
+		eq = nil
+		if parent == nil {
+			break
+		}
+		for i := range eqs {
+			if eqs[i].Namespace == parent.Namespace && eqs[i].Name == parent.Name {
+				eq = &eqs[i]
+				break
+			}
+		}
+	}
+	return lineage
+}
+
+// getElasticQuotaScope returns the pods the ElasticQuota applies to, given the namespaces of the cluster.
+// An invalid selector makes the ElasticQuota apply to no pod, and is reported if requested.
+func (r *ElasticQuotaReconciler) getElasticQuotaScope(eq *schedv1alpha1.ElasticQuota, namespaces []v1.Namespace, report bool) util.ElasticQuotaScope {
+	scope := util.ElasticQuotaScope{Namespace: eq.Namespace}
+	podSelector, err := util.GetElasticQuotaPodSelector(eq)
+	if err != nil {
+		if report {
+			r.recorder.Eventf(eq, v1.EventTypeWarning, "InvalidPodSelector", "Invalid pod selector, no pod is subject to the quota: %v", err)
+		}
+		podSelector = labels.Nothing()
+	}
+	scope.PodSelector = podSelector
+
+	namespaceSelector, err := util.GetElasticQuotaNamespaceSelector(eq)
+	if err != nil {
+		if report {
+			r.recorder.Eventf(eq, v1.EventTypeWarning, "InvalidNamespaceSelector", "Invalid namespace selector, no pod is subject to the quota: %v", err)
+		}
+		namespaceSelector = labels.Nothing()
+	}
+	if namespaceSelector != nil {
+		scope.Namespaces = sets.NewString()
+		for _, namespace := range namespaces {
+			if namespaceSelector.Matches(labels.Set(namespace.Labels)) {
+				scope.Namespaces.Insert(namespace.Name)
+			}
+		}
+	}
+	return scope
+}
+
+// getElasticQuotaNamespaces returns the namespaces an ElasticQuota of the given scope applies to.
+func getElasticQuotaNamespaces(scope util.ElasticQuotaScope) []string {
+	if scope.Namespaces == nil {
+		return []string{scope.Namespace}
+	}
+	return scope.Namespaces.List()
+}
+
+func indexOfElasticQuota(eqs []schedv1alpha1.ElasticQuota, eq *schedv1alpha1.ElasticQuota) int {
+	for i := range eqs {
+		if &eqs[i] == eq {
+			return i
+		}
+	}
+	return -1
+}
+
+// getElasticQuotaParent returns the parent of the ElasticQuota, or nil for the root of a quota tree.
+func getElasticQuotaParent(eqs []schedv1alpha1.ElasticQuota, eq *schedv1alpha1.ElasticQuota) *schedv1alpha1.ElasticQuota {
+	lineage := getElasticQuotaLineage(eqs, eq)
+	if len(lineage) < 2 {
+		return nil
+	}
+	return lineage[1]
+}
+
+func containsElasticQuota(eqs []*schedv1alpha1.ElasticQuota, eq *schedv1alpha1.ElasticQuota) bool {
+	for _, q := range eqs {
+		if q == eq {
+			return true
+		}
+	}
+	return false
+}
+
+// isElasticQuotaDescendant checks whether the ElasticQuota eq is in the subtree of the ElasticQuota ancestor.
+func isElasticQuotaDescendant(eqs []schedv1alpha1.ElasticQuota, eq, ancestor *schedv1alpha1.ElasticQuota) bool {
+	for _, q := range getElasticQuotaLineage(eqs, eq) {
+		if q == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
 func (r *ElasticQuotaReconciler) patchElasticQuota(ctx context.Context, old, new *schedv1alpha1.ElasticQuota) error {
 	patch := client.MergeFrom(old)
 	return r.Status().Patch(ctx, new, patch)
 }
 
-func (r *ElasticQuotaReconciler) computeElasticQuotaUsed(ctx context.Context, namespace string, eq *schedv1alpha1.ElasticQuota) (v1.ResourceList, error) {
-	used := newZeroUsed(eq)
+// elasticQuotaUsage is the usage of an ElasticQuota, along with the parts of it used by the pods which don't run
+// yet and by the terminating pods, or nil if there are none, and the usage of each of its flavors.
+type elasticQuotaUsage struct {
+	used        v1.ResourceList
+	pending     v1.ResourceList
+	terminating v1.ResourceList
+	flavors     map[string]v1.ResourceList
+}
+
+// newElasticQuotaUsage returns the usage of an ElasticQuota without pods: the resources it bounds are reported
+// as unused, for the ElasticQuota and each of its flavors.
+func newElasticQuotaUsage(eq *schedv1alpha1.ElasticQuota) *elasticQuotaUsage {
+	usage := &elasticQuotaUsage{used: newZeroUsed(eq)}
+	if len(eq.Spec.Flavors) != 0 {
+		usage.flavors = make(map[string]v1.ResourceList, len(eq.Spec.Flavors))
+		for _, f := range eq.Spec.Flavors {
+			used := v1.ResourceList{}
+			for _, name := range append(quota.ResourceNames(f.Min), quota.ResourceNames(f.Max)...) {
+				used[name] = *resource.NewQuantity(0, resource.DecimalSI)
+			}
+			usage.flavors[f.Name] = used
+		}
+	}
+	return usage
+}
+
+// getFlavorStatuses returns the usage of the flavors of the ElasticQuota, in the order of its spec,
+// or nil if it has no flavors.
+func (u *elasticQuotaUsage) getFlavorStatuses(eq *schedv1alpha1.ElasticQuota) []schedv1alpha1.ElasticQuotaFlavorStatus {
+	var statuses []schedv1alpha1.ElasticQuotaFlavorStatus
+	for _, f := range eq.Spec.Flavors {
+		statuses = append(statuses, schedv1alpha1.ElasticQuotaFlavorStatus{Name: f.Name, Used: u.flavors[f.Name]})
+	}
+	return statuses
+}
+
+// computeElasticQuotasUsed adds the usage of the pods of the namespace to the usage of the ElasticQuotas applying
+// to the namespace in usages. The scopes are the pods the ElasticQuotas apply to. Each pod is accounted to the only
+// ElasticQuota it is subject to, and the ElasticQuotas overlapping with the one a pod is subject to are reported.
+// The pods bound to a node are also accounted to the flavor of their ElasticQuota matching the labels of the node,
+// given in nodeLabels. The pods are accounted the same way as by the CapacityScheduling plugin.
+func (r *ElasticQuotaReconciler) computeElasticQuotasUsed(ctx context.Context, namespace string, eqs []schedv1alpha1.ElasticQuota, scopes []util.ElasticQuotaScope, nodeLabels map[string]labels.Set, usages map[types.NamespacedName]*elasticQuotaUsage) error {
+	var candidates []int
+	for i := range eqs {
+		if scopes[i].AppliesTo(namespace) {
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
 	podList := &v1.PodList{}
 	if err := r.List(ctx, podList, client.InNamespace(namespace)); err != nil {
-		return nil, err
+		return err
+	}
+
+	flavorSelectors := make(map[int][]labels.Selector)
+	for _, i := range candidates {
+		if len(eqs[i].Spec.Flavors) != 0 {
+			flavorSelectors[i] = util.GetElasticQuotaFlavorSelectors(&eqs[i])
+		}
 	}
 
+	keyOf := func(i int) string {
+		return eqs[i].Namespace + "/" + eqs[i].Name
+	}
+	overlaps := make(map[int]string)
 	for _, p := range podList.Items {
-		if p.Status.Phase == v1.PodRunning {
-			used = quota.Add(used, computePodResourceRequest(&p))
-		}
-	}
-	return used, nil
-}
-
-// computePodResourceRequest returns a v1.ResourceList that covers the largest
-// width in each resource dimension. Because init-containers run sequentially, we collect
-// the max in each dimension iteratively. In contrast, we sum the resource vectors for
-// regular containers since they run simultaneously.
-//
-// If Pod Overhead is specified and the feature gate is set, the resources defined for Overhead
-// are added to the calculated Resource request sum
-//
-// Example:
-//
-// Pod:
-//
-//	InitContainers
-//	  IC1:
-//	    CPU: 2
-//	    Memory: 1G
-//	  IC2:
-//	    CPU: 2
-//	    Memory: 3G
-//	Containers
-//	  C1:
-//	    CPU: 2
-//	    Memory: 1G
-//	  C2:
-//	    CPU: 1
-//	    Memory: 1G
-//
-// Result: CPU: 3, Memory: 3G
-func computePodResourceRequest(pod *v1.Pod) v1.ResourceList {
-	result := v1.ResourceList{}
-	for _, container := range pod.Spec.Containers {
-		result = quota.Add(result, container.Resources.Requests)
-	}
-	initRes := v1.ResourceList{}
-	// take max_resource for init_containers
-	for _, container := range pod.Spec.InitContainers {
-		initRes = quota.Max(initRes, container.Resources.Requests)
-	}
-	// If Overhead is being utilized, add to the total requests for the pod
-	if pod.Spec.Overhead != nil {
-		quota.Add(result, pod.Spec.Overhead)
-	}
-	// take max_resource for init_containers and containers
-	return quota.Max(result, initRes)
-}
-
-// newZeroUsed will return the zero value of the union of min and max
+		selected := -1
+		for _, i := range candidates {
+			if !scopes[i].SelectsPod(&p) {
+				continue
+			}
+			if selected == -1 || util.ElasticQuotaTakesPrecedence(keyOf(i), scopes[i], keyOf(selected), scopes[selected]) {
+				selected = i
+			}
+		}
+		if selected == -1 {
+			continue
+		}
+		for _, i := range candidates {
+			if i != selected && scopes[i].SelectsPod(&p) && util.ElasticQuotasOverlap(scopes[i], scopes[selected]) {
+				name := eqs[selected].Name
+				if eqs[selected].Namespace != eqs[i].Namespace {
+					name = keyOf(selected)
+				}
+				podName := p.Name
+				if p.Namespace != eqs[i].Namespace {
+					podName = p.Namespace + "/" + p.Name
+				}
+				overlaps[i] = fmt.Sprintf("Pod %v is also selected by ElasticQuota %v, which takes precedence", podName, name)
+			}
+		}
+		if !util.IsPodCountedInElasticQuota(&p) {
+			continue
+		}
+		usage := usages[types.NamespacedName{Namespace: eqs[selected].Namespace, Name: eqs[selected].Name}]
+		request := util.GetPodElasticQuotaRequest(&p)
+		usage.used = quota.Add(usage.used, request)
+		if p.DeletionTimestamp != nil {
+			usage.terminating = quota.Add(usage.terminating, request)
+		} else if p.Status.Phase == v1.PodPending {
+			usage.pending = quota.Add(usage.pending, request)
+		}
+		if selectors := flavorSelectors[selected]; selectors != nil && len(p.Spec.NodeName) != 0 {
+			if f := util.GetElasticQuotaFlavorIndex(selectors, nodeLabels[p.Spec.NodeName]); f != -1 {
+				name := eqs[selected].Spec.Flavors[f].Name
+				usage.flavors[name] = quota.Add(usage.flavors[name], request)
+			}
+		}
+	}
+	for i, message := range overlaps {
+		r.recorder.Event(&eqs[i], v1.EventTypeWarning, "PodSelectorOverlap", message)
+	}
+	return nil
+}
+
+// getBorrowed returns the resources the ElasticQuota and its descendants, which use subtreeUsed, use above
+// the Min of the ElasticQuota, or nil if they don't use more than its Min.
+func getBorrowed(eq *schedv1alpha1.ElasticQuota, subtreeUsed v1.ResourceList) v1.ResourceList {
+	var borrowed v1.ResourceList
+	for name, used := range subtreeUsed {
+		over := used.DeepCopy()
+		if min, ok := eq.Spec.Min[name]; ok {
+			over.Sub(min)
+		}
+		if over.Sign() > 0 {
+			if borrowed == nil {
+				borrowed = v1.ResourceList{}
+			}
+			borrowed[name] = over
+		}
+	}
+	return borrowed
+}
+
+// getLendable returns the unused Min the ElasticQuota, whose subtree uses subtreeUsed, can lend within its
+// lending limit, or nil if it can't lend anything.
+func getLendable(eq *schedv1alpha1.ElasticQuota, subtreeUsed v1.ResourceList) v1.ResourceList {
+	var lendable v1.ResourceList
+	for name, min := range eq.Spec.Min {
+		unused := min.DeepCopy()
+		unused.Sub(subtreeUsed[name])
+		if limit, ok := eq.Spec.LendingLimit[name]; ok && limit.Cmp(unused) < 0 {
+			unused = limit.DeepCopy()
+		}
+		if unused.Sign() > 0 {
+			if lendable == nil {
+				lendable = v1.ResourceList{}
+			}
+			lendable[name] = unused
+		}
+	}
+	return lendable
+}
+
+// getLent returns the part of lendable which is lent, when a group of quotas that can lend totalLendable
+// altogether lends totalBorrowed: each quota lends in proportion to what it can lend.
+func getLent(lendable, totalLendable, totalBorrowed v1.ResourceList) v1.ResourceList {
+	var lent v1.ResourceList
+	for name, quant := range lendable {
+		borrowed, ok := totalBorrowed[name]
+		if !ok {
+			continue
+		}
+		total := totalLendable[name]
+		share := quant.DeepCopy()
+		if borrowed.Cmp(total) < 0 {
+			share = *resource.NewMilliQuantity(int64(float64(quant.MilliValue())*float64(borrowed.MilliValue())/float64(total.MilliValue())), quant.Format)
+		}
+		if share.Sign() > 0 {
+			if lent == nil {
+				lent = v1.ResourceList{}
+			}
+			lent[name] = share
+		}
+	}
+	return lent
+}
+
+// newZeroUsed will return the zero value of the union of min and max, including those of the windows
 func newZeroUsed(eq *schedv1alpha1.ElasticQuota) v1.ResourceList {
 	minResources := quota.ResourceNames(eq.Spec.Min)
 	maxResources := quota.ResourceNames(eq.Spec.Max)
+	for _, w := range eq.Spec.Windows {
+		minResources = append(minResources, quota.ResourceNames(w.Min)...)
+		maxResources = append(maxResources, quota.ResourceNames(w.Max)...)
+	}
 	res := v1.ResourceList{}
 	for _, v := range minResources {
 		res[v] = *resource.NewQuantity(0, resource.DecimalSI)
@@ -168,11 +619,43 @@ func newZeroUsed(eq *schedv1alpha1.ElasticQuota) v1.ResourceList {
 	return res
 }
 
+func enqueueParentElasticQuota(_ context.Context, obj client.Object) []reconcile.Request {
+	eq, ok := obj.(*schedv1alpha1.ElasticQuota)
+	if !ok || eq.Spec.Parent == nil {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: eq.Spec.Parent.Namespace, Name: eq.Spec.Parent.Name}}}
+}
+
+// enqueuePooledElasticQuotas enqueues the namespaces of the ElasticQuotas with a namespace selector, since
+// the namespaces they pool may change with the labels of the namespace.
+func (r *ElasticQuotaReconciler) enqueuePooledElasticQuotas(ctx context.Context, _ client.Object) []reconcile.Request {
+	eqList := &schedv1alpha1.ElasticQuotaList{}
+	if err := r.List(ctx, eqList); err != nil {
+		log.FromContext(ctx).Error(err, "Unable to retrieve elasticquota")
+		return nil
+	}
+	var requests []reconcile.Request
+	namespaces := sets.NewString()
+	for _, eq := range eqList.Items {
+		if eq.Spec.NamespaceSelector == nil || namespaces.Has(eq.Namespace) {
+			continue
+		}
+		namespaces.Insert(eq.Namespace)
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: eq.Namespace, Name: eq.Name}})
+	}
+	return requests
+}
+
 func (r *ElasticQuotaReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	r.recorder = mgr.GetEventRecorderFor("ElasticQuotaController")
 	return ctrl.NewControllerManagedBy(mgr).
 		Watches(&v1.Pod{}, &handler.EnqueueRequestForObject{}).
 		For(&schedv1alpha1.ElasticQuota{}).
+		// The aggregated usage of the parent changes when a child quota is added or removed.
+		Watches(&schedv1alpha1.ElasticQuota{}, handler.EnqueueRequestsFromMapFunc(enqueueParentElasticQuota)).
+		Watches(&v1.Namespace{}, handler.EnqueueRequestsFromMapFunc(r.enqueuePooledElasticQuotas),
+			builder.WithPredicates(predicate.LabelChangedPredicate{})).
 		WithOptions(controller.Options{MaxConcurrentReconciles: r.Workers}).
 		Complete(r)
 }
@@ -33,6 +33,7 @@ import (
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
+	testingclock "k8s.io/utils/clock/testing"
 
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -57,7 +58,7 @@ func TestElasticQuotaController_Run(t *testing.T) {
 					Max(testutil.MakeResourceList().CPU(5).Mem(15).GPU(1).Obj()).Obj(),
 			},
 			pods: []*v1.Pod{
-				testutil.MakePod("t1-ns1", "pod1").Phase(v1.PodRunning).Container(
+				testutil.MakePod("t1-ns1", "pod1").Phase(v1.PodRunning).Node("node-a").Container(
 					testutil.MakeResourceList().CPU(1).Mem(2).GPU(1).Obj()).Obj(),
 				testutil.MakePod("t1-ns1", "pod2").Phase(v1.PodPending).Container(
 					testutil.MakeResourceList().CPU(1).Mem(2).GPU(0).Obj()).Obj(),
@@ -77,13 +78,13 @@ func TestElasticQuotaController_Run(t *testing.T) {
 
 			pods: []*v1.Pod{
 				// CPU: 2, Mem: 4
-				testutil.MakePod("t2-ns1", "pod1").Phase(v1.PodRunning).
+				testutil.MakePod("t2-ns1", "pod1").Phase(v1.PodRunning).Node("node-a").
 					Container(
 						testutil.MakeResourceList().CPU(1).Mem(2).Obj()).
 					Container(
 						testutil.MakeResourceList().CPU(1).Mem(2).Obj()).Obj(),
 				// CPU: 3, Mem: 3
-				testutil.MakePod("t2-ns1", "pod2").Phase(v1.PodRunning).
+				testutil.MakePod("t2-ns1", "pod2").Phase(v1.PodRunning).Node("node-a").
 					InitContainerRequest(
 						testutil.MakeResourceList().CPU(2).Mem(1).Obj()).
 					InitContainerRequest(
@@ -110,17 +111,17 @@ func TestElasticQuotaController_Run(t *testing.T) {
 			},
 			pods: []*v1.Pod{
 				// CPU: 2, Mem: 4
-				testutil.MakePod("t3-ns1", "pod1").Phase(v1.PodRunning).
+				testutil.MakePod("t3-ns1", "pod1").Phase(v1.PodRunning).Node("node-a").
 					Container(testutil.MakeResourceList().CPU(1).Mem(2).GPU(1).Obj()).
 					Container(testutil.MakeResourceList().CPU(1).Mem(2).Obj()).Obj(),
 				// CPU: 3, Mem: 3
-				testutil.MakePod("t3-ns1", "pod1").Phase(v1.PodPending).
+				testutil.MakePod("t3-ns1", "pod1").Phase(v1.PodPending).Node("node-a").
 					InitContainerRequest(testutil.MakeResourceList().CPU(2).Mem(1).Obj()).
 					InitContainerRequest(testutil.MakeResourceList().CPU(2).Mem(3).Obj()).
 					Container(testutil.MakeResourceList().CPU(2).Mem(1).Obj()).
 					Container(testutil.MakeResourceList().CPU(1).Mem(1).Obj()).Obj(),
 				// CPU: 4, Mem: 3
-				testutil.MakePod("t3-ns2", "pod2").Phase(v1.PodRunning).
+				testutil.MakePod("t3-ns2", "pod2").Phase(v1.PodRunning).Node("node-a").
 					InitContainerRequest(testutil.MakeResourceList().CPU(2).Mem(1).Obj()).
 					InitContainerRequest(testutil.MakeResourceList().CPU(2).Mem(3).Obj()).
 					Container(testutil.MakeResourceList().CPU(3).Mem(1).Obj()).
@@ -170,7 +171,7 @@ func TestElasticQuotaController_Run(t *testing.T) {
 					Max(testutil.MakeResourceList().CPU(50).Mem(15).Obj()).Obj(),
 			},
 			pods: []*v1.Pod{
-				testutil.MakePod("t6-ns3", "pod1").Phase(v1.PodRunning).
+				testutil.MakePod("t6-ns3", "pod1").Phase(v1.PodRunning).Node("node-a").
 					Container(testutil.MakeResourceList().CPU(1).Mem(2).GPU(1).Obj()).
 					Container(testutil.MakeResourceList().CPU(1).Mem(2).Obj()).Obj(),
 			},
@@ -230,6 +231,414 @@ func TestElasticQuotaController_Run(t *testing.T) {
 	}
 }
 
+func TestElasticQuotaController_AggregatedUsed(t *testing.T) {
+	ctx := context.TODO()
+	elasticQuotas := []*v1alpha1.ElasticQuota{
+		testutil.MakeEQ("org", "org").
+			Min(testutil.MakeResourceList().CPU(10).Mem(20).Obj()).
+			Max(testutil.MakeResourceList().CPU(10).Mem(20).Obj()).Obj(),
+		testutil.MakeEQ("team", "team").Parent("org", "org").
+			Min(testutil.MakeResourceList().CPU(6).Mem(10).Obj()).
+			Max(testutil.MakeResourceList().CPU(10).Mem(20).Obj()).Obj(),
+		testutil.MakeEQ("dev", "dev").Parent("team", "team").
+			Min(testutil.MakeResourceList().CPU(3).Mem(5).Obj()).
+			Max(testutil.MakeResourceList().CPU(10).Mem(20).Obj()).Obj(),
+		testutil.MakeEQ("other", "other").
+			Min(testutil.MakeResourceList().CPU(3).Mem(5).Obj()).
+			Max(testutil.MakeResourceList().CPU(10).Mem(20).Obj()).Obj(),
+	}
+	pods := []*v1.Pod{
+		testutil.MakePod("org", "pod1").Phase(v1.PodRunning).Node("node-a").
+			Container(testutil.MakeResourceList().CPU(1).Mem(1).Obj()).Obj(),
+		testutil.MakePod("team", "pod1").Phase(v1.PodRunning).Node("node-a").
+			Container(testutil.MakeResourceList().CPU(2).Mem(2).Obj()).Obj(),
+		testutil.MakePod("dev", "pod1").Phase(v1.PodRunning).Node("node-a").
+			Container(testutil.MakeResourceList().CPU(3).Mem(3).Obj()).Obj(),
+		testutil.MakePod("other", "pod1").Phase(v1.PodRunning).Node("node-a").
+			Container(testutil.MakeResourceList().CPU(4).Mem(4).Obj()).Obj(),
+	}
+	want := []*v1alpha1.ElasticQuota{
+		testutil.MakeEQ("org", "org").
+			Used(testutil.MakeResourceList().CPU(1).Mem(1).Obj()).
+			AggregatedUsed(testutil.MakeResourceList().CPU(6).Mem(6).Obj()).Obj(),
+		testutil.MakeEQ("team", "team").
+			Used(testutil.MakeResourceList().CPU(2).Mem(2).Obj()).
+			AggregatedUsed(testutil.MakeResourceList().CPU(5).Mem(5).Obj()).Obj(),
+		testutil.MakeEQ("dev", "dev").
+			Used(testutil.MakeResourceList().CPU(3).Mem(3).Obj()).Obj(),
+		testutil.MakeEQ("other", "other").
+			Used(testutil.MakeResourceList().CPU(4).Mem(4).Obj()).Obj(),
+	}
+
+	controller, kClient := setUpEQ(ctx, t, elasticQuotas, pods)
+	controller.recorder = record.NewFakeRecorder(len(elasticQuotas) * len(elasticQuotas))
+	// Reconciling the leaf quotas is enough to update the aggregated usage of their ancestors.
+	for _, namespace := range []string{"dev", "other"} {
+		if _, err := controller.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{
+			Namespace: namespace,
+			Name:      namespace,
+		}}); err != nil {
+			t.Fatalf("reconcile: (%v)", err)
+		}
+	}
+
+	for _, v := range want {
+		eq := &v1alpha1.ElasticQuota{}
+		if err := kClient.Get(ctx, client.ObjectKeyFromObject(v), eq); err != nil {
+			t.Fatal(err)
+		}
+		if !quota.Equals(eq.Status.Used, v.Status.Used) {
+			t.Errorf("%v: want used %v, got %v", v.Name, v.Status.Used, eq.Status.Used)
+		}
+		if !quota.Equals(eq.Status.AggregatedUsed, v.Status.AggregatedUsed) {
+			t.Errorf("%v: want aggregated used %v, got %v", v.Name, v.Status.AggregatedUsed, eq.Status.AggregatedUsed)
+		}
+	}
+}
+
+func TestElasticQuotaController_PodSelector(t *testing.T) {
+	ctx := context.TODO()
+	training := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "training"}}
+	anyApp := &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+		{Key: "app", Operator: metav1.LabelSelectorOpExists},
+	}}
+	elasticQuotas := []*v1alpha1.ElasticQuota{
+		testutil.MakeEQ("ns1", "default").
+			Max(testutil.MakeResourceList().CPU(10).Mem(20).Obj()).Obj(),
+		testutil.MakeEQ("ns1", "training").PodSelector(training).
+			Max(testutil.MakeResourceList().CPU(10).Mem(20).Obj()).Obj(),
+		testutil.MakeEQ("ns1", "zz-apps").PodSelector(anyApp).
+			Max(testutil.MakeResourceList().CPU(10).Mem(20).Obj()).Obj(),
+	}
+	pods := []*v1.Pod{
+		testutil.MakePod("ns1", "pod1").Phase(v1.PodRunning).Node("node-a").Label("app", "training").
+			Container(testutil.MakeResourceList().CPU(1).Mem(1).Obj()).Obj(),
+		testutil.MakePod("ns1", "pod2").Phase(v1.PodRunning).Node("node-a").Label("app", "inference").
+			Container(testutil.MakeResourceList().CPU(2).Mem(2).Obj()).Obj(),
+		testutil.MakePod("ns1", "pod3").Phase(v1.PodRunning).Node("node-a").
+			Container(testutil.MakeResourceList().CPU(3).Mem(3).Obj()).Obj(),
+	}
+	want := map[string]v1.ResourceList{
+		"default":  testutil.MakeResourceList().CPU(3).Mem(3).Obj(),
+		"training": testutil.MakeResourceList().CPU(1).Mem(1).Obj(),
+		"zz-apps":  testutil.MakeResourceList().CPU(2).Mem(2).Obj(),
+	}
+
+	controller, kClient := setUpEQ(ctx, t, elasticQuotas, pods)
+	recorder := record.NewFakeRecorder(10)
+	controller.recorder = recorder
+	if _, err := controller.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "ns1", Name: "pod1"}}); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+
+	for name, used := range want {
+		eq := &v1alpha1.ElasticQuota{}
+		if err := kClient.Get(ctx, types.NamespacedName{Namespace: "ns1", Name: name}, eq); err != nil {
+			t.Fatal(err)
+		}
+		if !quota.Equals(eq.Status.Used, used) {
+			t.Errorf("%v: want used %v, got %v", name, used, eq.Status.Used)
+		}
+	}
+
+	// pod1 is selected by both training and zz-apps, which overlap.
+	wantEvent := "Warning PodSelectorOverlap Pod pod1 is also selected by ElasticQuota training, which takes precedence"
+	var found bool
+	for len(recorder.Events) > 0 {
+		if <-recorder.Events == wantEvent {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("want event %q", wantEvent)
+	}
+}
+
+func TestElasticQuotaController_NamespaceSelector(t *testing.T) {
+	ctx := context.TODO()
+	elasticQuotas := []*v1alpha1.ElasticQuota{
+		testutil.MakeEQ("admin", "team-a").
+			NamespaceSelector(&metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}}).
+			Max(testutil.MakeResourceList().CPU(10).Mem(20).Obj()).Obj(),
+		// The quota of its own namespace takes precedence over the pooled quota.
+		testutil.MakeEQ("team-a-2", "own").
+			Max(testutil.MakeResourceList().CPU(10).Mem(20).Obj()).Obj(),
+	}
+	pods := []*v1.Pod{
+		testutil.MakePod("team-a-1", "pod1").Phase(v1.PodRunning).Node("node-a").
+			Container(testutil.MakeResourceList().CPU(1).Mem(1).Obj()).Obj(),
+		testutil.MakePod("team-a-3", "pod2").Phase(v1.PodRunning).Node("node-a").
+			Container(testutil.MakeResourceList().CPU(2).Mem(2).Obj()).Obj(),
+		testutil.MakePod("team-a-2", "pod3").Phase(v1.PodRunning).Node("node-a").
+			Container(testutil.MakeResourceList().CPU(3).Mem(3).Obj()).Obj(),
+		testutil.MakePod("team-b", "pod4").Phase(v1.PodRunning).Node("node-a").
+			Container(testutil.MakeResourceList().CPU(4).Mem(4).Obj()).Obj(),
+	}
+	controller, kClient := setUpEQ(ctx, t, elasticQuotas, pods)
+	controller.recorder = record.NewFakeRecorder(10)
+	for name, team := range map[string]string{"admin": "", "team-a-1": "a", "team-a-2": "a", "team-a-3": "a", "team-b": "b"} {
+		ns := &v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"team": team}}}
+		if err := kClient.Create(ctx, ns); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expectUsed := func(namespace, name string, want v1.ResourceList) {
+		t.Helper()
+		eq := &v1alpha1.ElasticQuota{}
+		if err := kClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, eq); err != nil {
+			t.Fatal(err)
+		}
+		if !quota.Equals(eq.Status.Used, want) {
+			t.Errorf("%v/%v: want used %v, got %v", namespace, name, want, eq.Status.Used)
+		}
+	}
+
+	// A pod event of any pooled namespace syncs the pooled quota with the usage of all its namespaces.
+	for _, namespace := range []string{"team-a-1", "team-a-2"} {
+		if _, err := controller.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: namespace}}); err != nil {
+			t.Fatalf("reconcile: (%v)", err)
+		}
+	}
+	expectUsed("admin", "team-a", testutil.MakeResourceList().CPU(3).Mem(3).Obj())
+	expectUsed("team-a-2", "own", testutil.MakeResourceList().CPU(3).Mem(3).Obj())
+
+	// A namespace leaving the pool is no longer accounted to the pooled quota.
+	ns := &v1.Namespace{}
+	if err := kClient.Get(ctx, types.NamespacedName{Name: "team-a-3"}, ns); err != nil {
+		t.Fatal(err)
+	}
+	ns.Labels["team"] = "b"
+	if err := kClient.Update(ctx, ns); err != nil {
+		t.Fatal(err)
+	}
+	requests := controller.enqueuePooledElasticQuotas(ctx, ns)
+	if len(requests) != 1 || requests[0].Namespace != "admin" {
+		t.Fatalf("want the namespace of the pooled quota to be enqueued, got %v", requests)
+	}
+	if _, err := controller.Reconcile(ctx, requests[0]); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	expectUsed("admin", "team-a", testutil.MakeResourceList().CPU(1).Mem(1).Obj())
+}
+
+func TestElasticQuotaController_BorrowedAndLent(t *testing.T) {
+	ctx := context.TODO()
+	elasticQuotas := []*v1alpha1.ElasticQuota{
+		// lender can only lend 4 of its 8 unused cpus.
+		testutil.MakeEQ("ns1", "lender").LendingLimit(testutil.MakeResourceList().CPU(4).Obj()).
+			Min(testutil.MakeResourceList().CPU(10).Mem(10).Obj()).Obj(),
+		testutil.MakeEQ("ns2", "other").
+			Min(testutil.MakeResourceList().CPU(6).Mem(10).Obj()).Obj(),
+		testutil.MakeEQ("ns3", "borrower").
+			Min(testutil.MakeResourceList().CPU(2).Mem(10).Obj()).Obj(),
+	}
+	pods := []*v1.Pod{
+		testutil.MakePod("ns1", "pod1").Phase(v1.PodRunning).Node("node-a").
+			Container(testutil.MakeResourceList().CPU(2).Mem(1).Obj()).Obj(),
+		testutil.MakePod("ns3", "pod2").Phase(v1.PodRunning).Node("node-a").
+			Container(testutil.MakeResourceList().CPU(7).Mem(1).Obj()).Obj(),
+	}
+	controller, kClient := setUpEQ(ctx, t, elasticQuotas, pods)
+	controller.recorder = record.NewFakeRecorder(10)
+	// The siblings of the borrowing quota are synced along with it.
+	if _, err := controller.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "ns3", Name: "pod2"}}); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+
+	// The 5 borrowed cpus are lent in proportion to the 4 and 6 cpus lender and other can lend.
+	want := map[string]struct {
+		borrowed v1.ResourceList
+		lent     v1.ResourceList
+	}{
+		"ns1/lender":   {lent: testutil.MakeResourceList().CPU(2).Obj()},
+		"ns2/other":    {lent: testutil.MakeResourceList().CPU(3).Obj()},
+		"ns3/borrower": {borrowed: testutil.MakeResourceList().CPU(5).Obj()},
+	}
+	for _, q := range elasticQuotas {
+		key := types.NamespacedName{Namespace: q.Namespace, Name: q.Name}
+		eq := &v1alpha1.ElasticQuota{}
+		if err := kClient.Get(ctx, key, eq); err != nil {
+			t.Fatal(err)
+		}
+		if !quota.Equals(eq.Status.Borrowed, want[key.String()].borrowed) {
+			t.Errorf("%v: want borrowed %v, got %v", key, want[key.String()].borrowed, eq.Status.Borrowed)
+		}
+		if !quota.Equals(eq.Status.Lent, want[key.String()].lent) {
+			t.Errorf("%v: want lent %v, got %v", key, want[key.String()].lent, eq.Status.Lent)
+		}
+	}
+}
+
+func TestElasticQuotaController_PendingAndTerminating(t *testing.T) {
+	ctx := context.TODO()
+	elasticQuotas := []*v1alpha1.ElasticQuota{
+		testutil.MakeEQ("ns1", "eq").
+			Min(testutil.MakeResourceList().CPU(10).Mem(10).Obj()).Obj(),
+	}
+	terminating := testutil.MakePod("ns1", "pod3").Phase(v1.PodRunning).Node("node-a").
+		Container(testutil.MakeResourceList().CPU(3).Mem(1).Obj()).Obj()
+	terminating.Finalizers = []string{"example.com/finalizer"}
+	pods := []*v1.Pod{
+		testutil.MakePod("ns1", "pod1").Phase(v1.PodRunning).Node("node-a").
+			Container(testutil.MakeResourceList().CPU(1).Mem(1).Obj()).Obj(),
+		testutil.MakePod("ns1", "pod2").Phase(v1.PodPending).Node("node-a").
+			Container(testutil.MakeResourceList().CPU(2).Mem(1).Obj()).Obj(),
+		terminating,
+		// Neither the pods waiting to be scheduled nor the terminated pods count.
+		testutil.MakePod("ns1", "pod4").Phase(v1.PodPending).
+			Container(testutil.MakeResourceList().CPU(4).Mem(1).Obj()).Obj(),
+		testutil.MakePod("ns1", "pod5").Phase(v1.PodSucceeded).Node("node-a").
+			Container(testutil.MakeResourceList().CPU(5).Mem(1).Obj()).Obj(),
+	}
+	controller, kClient := setUpEQ(ctx, t, elasticQuotas, pods)
+	controller.recorder = record.NewFakeRecorder(10)
+	// The finalizer keeps the pod terminating.
+	if err := kClient.Delete(ctx, terminating); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := controller.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "ns1", Name: "eq"}}); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+
+	eq := &v1alpha1.ElasticQuota{}
+	if err := kClient.Get(ctx, types.NamespacedName{Namespace: "ns1", Name: "eq"}, eq); err != nil {
+		t.Fatal(err)
+	}
+	if want := testutil.MakeResourceList().CPU(6).Mem(3).Obj(); !quota.Equals(eq.Status.Used, want) {
+		t.Errorf("want used %v, got %v", want, eq.Status.Used)
+	}
+	if want := testutil.MakeResourceList().CPU(2).Mem(1).Obj(); !quota.Equals(eq.Status.Pending, want) {
+		t.Errorf("want pending %v, got %v", want, eq.Status.Pending)
+	}
+	if want := testutil.MakeResourceList().CPU(3).Mem(1).Obj(); !quota.Equals(eq.Status.Terminating, want) {
+		t.Errorf("want terminating %v, got %v", want, eq.Status.Terminating)
+	}
+}
+
+func TestElasticQuotaController_Windows(t *testing.T) {
+	ctx := context.TODO()
+	eq := testutil.MakeEQ("ns1", "eq").
+		Min(testutil.MakeResourceList().CPU(10).Mem(10).Obj()).Obj()
+	eq.Spec.Windows = []v1alpha1.ElasticQuotaWindow{
+		{
+			Name:  "overnight",
+			Start: "22:00",
+			End:   "06:00",
+			Min:   testutil.MakeResourceList().CPU(2).Obj(),
+		},
+	}
+	pods := []*v1.Pod{
+		testutil.MakePod("ns1", "pod1").Phase(v1.PodRunning).Node("node-a").
+			Container(testutil.MakeResourceList().CPU(5).Mem(1).Obj()).Obj(),
+	}
+	controller, kClient := setUpEQ(ctx, t, []*v1alpha1.ElasticQuota{eq}, pods)
+	clock := testingclock.NewFakePassiveClock(time.Date(2023, time.October, 16, 23, 0, 0, 0, time.UTC))
+	controller.clock = clock
+
+	tests := []struct {
+		name         string
+		now          time.Time
+		activeWindow string
+		borrowed     v1.ResourceList
+		requeueAfter time.Duration
+	}{
+		{
+			name:         "in the window",
+			now:          time.Date(2023, time.October, 16, 23, 0, 0, 0, time.UTC),
+			activeWindow: "overnight",
+			borrowed:     testutil.MakeResourceList().CPU(3).Obj(),
+			requeueAfter: 7 * time.Hour,
+		},
+		{
+			name:         "after the window",
+			now:          time.Date(2023, time.October, 17, 6, 0, 0, 0, time.UTC),
+			requeueAfter: 16 * time.Hour,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock.SetTime(tt.now)
+			result, err := controller.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "ns1", Name: "eq"}})
+			if err != nil {
+				t.Fatalf("reconcile: (%v)", err)
+			}
+			if result.RequeueAfter != tt.requeueAfter {
+				t.Errorf("want requeue after %v, got %v", tt.requeueAfter, result.RequeueAfter)
+			}
+			got := &v1alpha1.ElasticQuota{}
+			if err := kClient.Get(ctx, types.NamespacedName{Namespace: "ns1", Name: "eq"}, got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Status.ActiveWindow != tt.activeWindow {
+				t.Errorf("want active window %q, got %q", tt.activeWindow, got.Status.ActiveWindow)
+			}
+			if !quota.Equals(got.Status.Borrowed, tt.borrowed) {
+				t.Errorf("want borrowed %v, got %v", tt.borrowed, got.Status.Borrowed)
+			}
+			// The spec is left alone.
+			if !quota.Equals(got.Spec.Min, eq.Spec.Min) {
+				t.Errorf("want min %v, got %v", eq.Spec.Min, got.Spec.Min)
+			}
+		})
+	}
+}
+
+func TestElasticQuotaController_Flavors(t *testing.T) {
+	ctx := context.TODO()
+	eq := testutil.MakeEQ("ns1", "eq").
+		Max(testutil.MakeResourceList().CPU(10).Obj()).Obj()
+	eq.Spec.Flavors = []v1alpha1.ElasticQuotaFlavor{
+		{
+			Name:         "a100",
+			NodeSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"gpu": "a100"}},
+			Max:          testutil.MakeResourceList().GPU(4).Obj(),
+		},
+		{
+			Name:         "t4",
+			NodeSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"gpu": "t4"}},
+			Min:          testutil.MakeResourceList().GPU(2).Obj(),
+		},
+	}
+	pods := []*v1.Pod{
+		testutil.MakePod("ns1", "pod1").Phase(v1.PodRunning).Node("node-a").
+			Container(testutil.MakeResourceList().CPU(1).GPU(1).Obj()).Obj(),
+		testutil.MakePod("ns1", "pod2").Phase(v1.PodRunning).Node("node-c").
+			Container(testutil.MakeResourceList().CPU(1).Obj()).Obj(),
+		testutil.MakePod("ns1", "pod3").Phase(v1.PodPending).
+			Container(testutil.MakeResourceList().CPU(1).GPU(1).Obj()).Obj(),
+	}
+	controller, kClient := setUpEQ(ctx, t, []*v1alpha1.ElasticQuota{eq}, pods)
+	for name, labels := range map[string]map[string]string{"node-a": {"gpu": "a100"}, "node-c": nil} {
+		if err := kClient.Create(ctx, &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := controller.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "ns1", Name: "eq"}}); err != nil {
+		t.Fatalf("reconcile: (%v)", err)
+	}
+	got := &v1alpha1.ElasticQuota{}
+	if err := kClient.Get(ctx, types.NamespacedName{Namespace: "ns1", Name: "eq"}, got); err != nil {
+		t.Fatal(err)
+	}
+	want := []v1alpha1.ElasticQuotaFlavorStatus{
+		{Name: "a100", Used: testutil.MakeResourceList().CPU(1).GPU(1).Obj()},
+		{Name: "t4", Used: testutil.MakeResourceList().GPU(0).Obj()},
+	}
+	if len(got.Status.Flavors) != len(want) {
+		t.Fatalf("want flavors %v, got %v", want, got.Status.Flavors)
+	}
+	for i := range want {
+		if got.Status.Flavors[i].Name != want[i].Name || !quota.Equals(got.Status.Flavors[i].Used, want[i].Used) {
+			t.Errorf("want flavor %v, got %v", want[i], got.Status.Flavors[i])
+		}
+	}
+	if wantUsed := testutil.MakeResourceList().CPU(2).GPU(1).Obj(); !quota.Equals(got.Status.Used, wantUsed) {
+		t.Errorf("want used %v, got %v", wantUsed, got.Status.Used)
+	}
+}
+
 func setUpEQ(ctx context.Context,
 	t *testing.T,
 	eqs []*v1alpha1.ElasticQuota,
@@ -0,0 +1,372 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/go-logr/logr"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/pointer"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	schedv1alpha1 "sigs.k8s.io/scheduler-plugins/apis/scheduling/v1alpha1"
+	"sigs.k8s.io/scheduler-plugins/pkg/util"
+)
+
+// ElasticQuotaWebhook defaults and validates the ElasticQuotas, so that the CapacityScheduling plugin never has to
+// guess the bounds of an inconsistent quota, nor which of two quotas selecting the same pods applies.
+type ElasticQuotaWebhook struct {
+	log logr.Logger
+
+	client.Client
+}
+
+// +kubebuilder:webhook:path=/mutate-scheduling-x-k8s-io-v1alpha1-elasticquota,mutating=true,failurePolicy=fail,sideEffects=None,groups=scheduling.x-k8s.io,resources=elasticquotas,verbs=create;update,versions=v1alpha1,name=melasticquota.scheduling.x-k8s.io,admissionReviewVersions=v1
+// +kubebuilder:webhook:path=/validate-scheduling-x-k8s-io-v1alpha1-elasticquota,mutating=false,failurePolicy=fail,sideEffects=None,groups=scheduling.x-k8s.io,resources=elasticquotas,verbs=create;update,versions=v1alpha1,name=velasticquota.scheduling.x-k8s.io,admissionReviewVersions=v1
+// +kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
+
+const (
+	// elasticQuotaNamespaceField indexes the quotas by the namespace they apply to, see elasticQuotaNamespace.
+	elasticQuotaNamespaceField = "elasticQuotaNamespace"
+	// elasticQuotaRootField indexes the quotas without parent.
+	elasticQuotaRootField = "elasticQuotaRoot"
+	// anyNamespace is the namespace the quotas with a namespace selector are indexed under.
+	anyNamespace = "*"
+)
+
+// elasticQuotaNamespace returns the namespace the quota applies to, or anyNamespace if it has a namespace selector.
+func elasticQuotaNamespace(eq *schedv1alpha1.ElasticQuota) string {
+	if eq.Spec.NamespaceSelector != nil {
+		return anyNamespace
+	}
+	return eq.Namespace
+}
+
+func indexElasticQuotaNamespace(obj client.Object) []string {
+	return []string{elasticQuotaNamespace(obj.(*schedv1alpha1.ElasticQuota))}
+}
+
+func indexElasticQuotaRoot(obj client.Object) []string {
+	if obj.(*schedv1alpha1.ElasticQuota).Spec.Parent != nil {
+		return nil
+	}
+	return []string{"true"}
+}
+
+var _ admission.CustomDefaulter = &ElasticQuotaWebhook{}
+var _ admission.CustomValidator = &ElasticQuotaWebhook{}
+
+// Default sets the Min of the resources bounded by the Max of the quota, or of one of its windows, but missing
+// from its Min to zero, so that the quota lists the same resources in both, and sets its fairSharingWeight to 1.
+func (w *ElasticQuotaWebhook) Default(_ context.Context, obj runtime.Object) error {
+	eq, ok := obj.(*schedv1alpha1.ElasticQuota)
+	if !ok {
+		return fmt.Errorf("expected an ElasticQuota but got a %T", obj)
+	}
+	bounded := make([]v1.ResourceList, 0, len(eq.Spec.Windows)+1)
+	bounded = append(bounded, eq.Spec.Max)
+	for i := range eq.Spec.Windows {
+		bounded = append(bounded, eq.Spec.Windows[i].Max)
+	}
+	for _, max := range bounded {
+		for name := range max {
+			if _, ok := eq.Spec.Min[name]; ok {
+				continue
+			}
+			if eq.Spec.Min == nil {
+				eq.Spec.Min = make(v1.ResourceList)
+			}
+			eq.Spec.Min[name] = *resource.NewQuantity(0, resource.DecimalSI)
+		}
+	}
+	if eq.Spec.FairSharingWeight == nil {
+		eq.Spec.FairSharingWeight = pointer.Int32(1)
+	}
+	return nil
+}
+
+// ValidateCreate validates the quota, see validate.
+func (w *ElasticQuotaWebhook) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	eq, ok := obj.(*schedv1alpha1.ElasticQuota)
+	if !ok {
+		return nil, fmt.Errorf("expected an ElasticQuota but got a %T", obj)
+	}
+	return w.validate(ctx, nil, eq)
+}
+
+// ValidateUpdate validates the quota, see validate.
+func (w *ElasticQuotaWebhook) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	oldEQ, ok := oldObj.(*schedv1alpha1.ElasticQuota)
+	if !ok {
+		return nil, fmt.Errorf("expected an ElasticQuota but got a %T", oldObj)
+	}
+	eq, ok := newObj.(*schedv1alpha1.ElasticQuota)
+	if !ok {
+		return nil, fmt.Errorf("expected an ElasticQuota but got a %T", newObj)
+	}
+	return w.validate(ctx, oldEQ, eq)
+}
+
+// ValidateDelete accepts the deletion of any quota.
+func (w *ElasticQuotaWebhook) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validate rejects the quotas whose spec is inconsistent, whose parent would make a cycle, or which may select
+// the same pods as another quota without one taking precedence over the other. The overlaps the quota already
+// had before an update are tolerated, so that the quotas created before the webhook can still be updated.
+// It warns when the sum of the Min of the root quotas exceeds the allocatable resources of the cluster.
+func (w *ElasticQuotaWebhook) validate(ctx context.Context, oldEQ, eq *schedv1alpha1.ElasticQuota) (admission.Warnings, error) {
+	allErrs := validateElasticQuotaSpec(&eq.Spec, field.NewPath("spec"))
+
+	parentErrs, err := w.validateElasticQuotaParent(ctx, eq)
+	if err != nil {
+		return nil, err
+	}
+	allErrs = append(allErrs, parentErrs...)
+	// Only the quotas of the same namespace, or those with a namespace selector as well, may select the same pods.
+	quotas := &schedv1alpha1.ElasticQuotaList{}
+	if err := w.List(ctx, quotas, client.MatchingFields{elasticQuotaNamespaceField: elasticQuotaNamespace(eq)}); err != nil {
+		return nil, err
+	}
+	for i := range quotas.Items {
+		other := &quotas.Items[i]
+		if other.Namespace == eq.Namespace && other.Name == eq.Name {
+			continue
+		}
+		if !util.ElasticQuotasMayOverlap(eq, other) || (oldEQ != nil && util.ElasticQuotasMayOverlap(oldEQ, other)) {
+			continue
+		}
+		allErrs = append(allErrs, field.Forbidden(elasticQuotaScopePath(eq),
+			fmt.Sprintf("may select the same pods as ElasticQuota %s/%s", other.Namespace, other.Name)))
+	}
+	if len(allErrs) != 0 {
+		return nil, apierrors.NewInvalid(schedv1alpha1.SchemeGroupVersion.WithKind("ElasticQuota").GroupKind(), eq.Name, allErrs)
+	}
+	return w.warnMinOverAllocatable(ctx, eq), nil
+}
+
+// validateElasticQuotaSpec validates the spec of a quota on its own.
+func validateElasticQuotaSpec(spec *schedv1alpha1.ElasticQuotaSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	allErrs = append(allErrs, validateNonNegativeResourceList(spec.Min, fldPath.Child("min"))...)
+	allErrs = append(allErrs, validateNonNegativeResourceList(spec.Max, fldPath.Child("max"))...)
+	allErrs = append(allErrs, validateNonNegativeResourceList(spec.BorrowingLimit, fldPath.Child("borrowingLimit"))...)
+	allErrs = append(allErrs, validateNonNegativeResourceList(spec.LendingLimit, fldPath.Child("lendingLimit"))...)
+	allErrs = append(allErrs, validateMinNotOverMax(spec.Min, spec.Max, fldPath.Child("min"))...)
+
+	eq := &schedv1alpha1.ElasticQuota{Spec: *spec}
+	names := sets.NewString()
+	for i := range spec.Windows {
+		window := &spec.Windows[i]
+		windowPath := fldPath.Child("windows").Index(i)
+		if len(window.Name) == 0 {
+			allErrs = append(allErrs, field.Required(windowPath.Child("name"), ""))
+		} else if names.Has(window.Name) {
+			allErrs = append(allErrs, field.Duplicate(windowPath.Child("name"), window.Name))
+		}
+		names.Insert(window.Name)
+		if err := util.ValidateElasticQuotaWindow(window); err != nil {
+			allErrs = append(allErrs, field.Invalid(windowPath, window.Name, err.Error()))
+		}
+		allErrs = append(allErrs, validateNonNegativeResourceList(window.Min, windowPath.Child("min"))...)
+		allErrs = append(allErrs, validateNonNegativeResourceList(window.Max, windowPath.Child("max"))...)
+		min, max := util.GetElasticQuotaWindowBounds(eq, window)
+		allErrs = append(allErrs, validateMinNotOverMax(min, max, windowPath.Child("min"))...)
+	}
+
+	opts := metav1validation.LabelSelectorValidationOptions{}
+	names = sets.NewString()
+	for i := range spec.Flavors {
+		flavor := &spec.Flavors[i]
+		flavorPath := fldPath.Child("flavors").Index(i)
+		if len(flavor.Name) == 0 {
+			allErrs = append(allErrs, field.Required(flavorPath.Child("name"), ""))
+		} else if names.Has(flavor.Name) {
+			allErrs = append(allErrs, field.Duplicate(flavorPath.Child("name"), flavor.Name))
+		}
+		names.Insert(flavor.Name)
+		if flavor.NodeSelector == nil {
+			allErrs = append(allErrs, field.Required(flavorPath.Child("nodeSelector"), ""))
+		} else {
+			allErrs = append(allErrs, metav1validation.ValidateLabelSelector(flavor.NodeSelector, opts, flavorPath.Child("nodeSelector"))...)
+		}
+		allErrs = append(allErrs, validateNonNegativeResourceList(flavor.Min, flavorPath.Child("min"))...)
+		allErrs = append(allErrs, validateNonNegativeResourceList(flavor.Max, flavorPath.Child("max"))...)
+		allErrs = append(allErrs, validateMinNotOverMax(flavor.Min, flavor.Max, flavorPath.Child("min"))...)
+	}
+
+	if spec.PodSelector != nil {
+		allErrs = append(allErrs, metav1validation.ValidateLabelSelector(spec.PodSelector, opts, fldPath.Child("podSelector"))...)
+	}
+	if spec.NamespaceSelector != nil {
+		allErrs = append(allErrs, metav1validation.ValidateLabelSelector(spec.NamespaceSelector, opts, fldPath.Child("namespaceSelector"))...)
+	}
+	return allErrs
+}
+
+// validateElasticQuotaParent checks that the parent of the quota, if any, doesn't make a cycle with the existing
+// quotas, by walking up the ancestors of the quota. The parent doesn't have to exist yet.
+func (w *ElasticQuotaWebhook) validateElasticQuotaParent(ctx context.Context, eq *schedv1alpha1.ElasticQuota) (field.ErrorList, error) {
+	fldPath := field.NewPath("spec", "parent")
+	self := schedv1alpha1.ElasticQuotaReference{Namespace: eq.Namespace, Name: eq.Name}
+	visited := make(map[schedv1alpha1.ElasticQuotaReference]bool)
+	for parent := eq.Spec.Parent; parent != nil && !visited[*parent]; {
+		if *parent == self {
+			if len(visited) == 0 {
+				return field.ErrorList{field.Invalid(fldPath, *parent, "must not refer to the quota itself")}, nil
+			}
+			return field.ErrorList{field.Invalid(fldPath, *parent, "must not make a cycle of quotas")}, nil
+		}
+		visited[*parent] = true
+		ancestor := &schedv1alpha1.ElasticQuota{}
+		if err := w.Get(ctx, types.NamespacedName{Namespace: parent.Namespace, Name: parent.Name}, ancestor); err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		parent = ancestor.Spec.Parent
+	}
+	return nil, nil
+}
+
+// elasticQuotaScopePath returns the path of the field deciding which pods the quota selects.
+func elasticQuotaScopePath(eq *schedv1alpha1.ElasticQuota) *field.Path {
+	switch {
+	case eq.Spec.PodSelector != nil:
+		return field.NewPath("spec", "podSelector")
+	case eq.Spec.NamespaceSelector != nil:
+		return field.NewPath("spec", "namespaceSelector")
+	default:
+		return field.NewPath("metadata", "namespace")
+	}
+}
+
+// warnMinOverAllocatable warns when the sum of the Min of the root quotas exceeds the allocatable resources of
+// the nodes, for the resources of the Min of the quota, since the quotas then can't all get their Min.
+func (w *ElasticQuotaWebhook) warnMinOverAllocatable(ctx context.Context, eq *schedv1alpha1.ElasticQuota) admission.Warnings {
+	if eq.Spec.Parent != nil || len(eq.Spec.Min) == 0 {
+		return nil
+	}
+	roots := &schedv1alpha1.ElasticQuotaList{}
+	if err := w.List(ctx, roots, client.MatchingFields{elasticQuotaRootField: "true"}); err != nil {
+		w.log.Error(err, "Unable to list the root ElasticQuotas")
+		return nil
+	}
+	quotas := roots.Items
+	nodes := &v1.NodeList{}
+	if err := w.List(ctx, nodes); err != nil {
+		w.log.Error(err, "Unable to list the nodes")
+		return nil
+	}
+	allocatable := make(v1.ResourceList)
+	for i := range nodes.Items {
+		addResourceList(allocatable, nodes.Items[i].Status.Allocatable)
+	}
+	mins := eq.Spec.Min.DeepCopy()
+	for i := range quotas {
+		if quotas[i].Namespace != eq.Namespace || quotas[i].Name != eq.Name {
+			addResourceList(mins, quotas[i].Spec.Min)
+		}
+	}
+
+	var warnings admission.Warnings
+	for _, name := range sortedResourceNames(eq.Spec.Min) {
+		min, alloc := mins[name], allocatable[name]
+		if min.Cmp(alloc) > 0 {
+			warnings = append(warnings, fmt.Sprintf("the sum of the min of the root ElasticQuotas, %s of %s, exceeds the allocatable %s of the cluster",
+				min.String(), name, alloc.String()))
+		}
+	}
+	return warnings
+}
+
+// SetupWebhookWithManager registers the webhooks in the webhook server of the Manager.
+func (w *ElasticQuotaWebhook) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	w.log = mgr.GetLogger().WithName("ElasticQuotaWebhook")
+
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &schedv1alpha1.ElasticQuota{}, elasticQuotaNamespaceField, indexElasticQuotaNamespace); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &schedv1alpha1.ElasticQuota{}, elasticQuotaRootField, indexElasticQuotaRoot); err != nil {
+		return err
+	}
+
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&schedv1alpha1.ElasticQuota{}).
+		WithDefaulter(w).
+		WithValidator(w).
+		Complete()
+}
+
+// validateNonNegativeResourceList checks that the quantities of the list are not negative.
+func validateNonNegativeResourceList(list v1.ResourceList, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	for _, name := range sortedResourceNames(list) {
+		if quantity := list[name]; quantity.Sign() < 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Key(string(name)), quantity.String(), "must be greater than or equal to 0"))
+		}
+	}
+	return allErrs
+}
+
+// validateMinNotOverMax checks that the quantities of min don't exceed those of max. A resource missing from max
+// is unbounded.
+func validateMinNotOverMax(min, max v1.ResourceList, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	for _, name := range sortedResourceNames(min) {
+		minQuantity := min[name]
+		if maxQuantity, ok := max[name]; ok && minQuantity.Cmp(maxQuantity) > 0 {
+			allErrs = append(allErrs, field.Invalid(fldPath.Key(string(name)), minQuantity.String(),
+				fmt.Sprintf("must be less than or equal to the max %s", maxQuantity.String())))
+		}
+	}
+	return allErrs
+}
+
+// addResourceList adds the quantities of the list to the sum.
+func addResourceList(sum, list v1.ResourceList) {
+	for name, quantity := range list {
+		total := sum[name]
+		total.Add(quantity)
+		sum[name] = total
+	}
+}
+
+// sortedResourceNames returns the names of the resources of the list in order, so that errors and warnings are
+// reported in a stable order.
+func sortedResourceNames(list v1.ResourceList) []v1.ResourceName {
+	names := make([]v1.ResourceName, 0, len(list))
+	for name := range list {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	return names
+}
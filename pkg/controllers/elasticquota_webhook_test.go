@@ -0,0 +1,219 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	quota "k8s.io/apiserver/pkg/quota/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/klog/v2/klogr"
+
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/scheduler-plugins/apis/scheduling/v1alpha1"
+	testutil "sigs.k8s.io/scheduler-plugins/test/integration"
+)
+
+func TestElasticQuotaWebhook_Default(t *testing.T) {
+	eq := testutil.MakeEQ("ns1", "eq1").
+		Min(testutil.MakeResourceList().CPU(1).Obj()).
+		Max(testutil.MakeResourceList().CPU(2).Mem(4).Obj()).Obj()
+	eq.Spec.Windows = []v1alpha1.ElasticQuotaWindow{{Name: "night", Start: "22:00", End: "06:00", Max: testutil.MakeResourceList().GPU(1).Obj()}}
+	if err := (&ElasticQuotaWebhook{}).Default(context.TODO(), eq); err != nil {
+		t.Fatal(err)
+	}
+	want := v1.ResourceList{
+		v1.ResourceCPU:    resource.MustParse("1"),
+		v1.ResourceMemory: resource.MustParse("0"),
+		"nvidia.com/gpu":  resource.MustParse("0"),
+	}
+	if !quota.Equals(eq.Spec.Min, want) {
+		t.Errorf("want min %v, got %v", want, eq.Spec.Min)
+	}
+	if eq.Spec.FairSharingWeight == nil || *eq.Spec.FairSharingWeight != 1 {
+		t.Errorf("want a fairSharingWeight of 1, got %v", eq.Spec.FairSharingWeight)
+	}
+}
+
+func TestElasticQuotaWebhook_Validate(t *testing.T) {
+	s := scheme.Scheme
+	utilruntime.Must(v1alpha1.AddToScheme(s))
+
+	selector := func(key, value string) *metav1.LabelSelector {
+		return &metav1.LabelSelector{MatchLabels: map[string]string{key: value}}
+	}
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node-a"},
+		Status:     v1.NodeStatus{Allocatable: testutil.MakeResourceList().CPU(10).Mem(20).Obj()},
+	}
+	existing := []*v1alpha1.ElasticQuota{
+		testutil.MakeEQ("ns1", "eq1").Min(testutil.MakeResourceList().CPU(6).Obj()).Obj(),
+		testutil.MakeEQ("ns2", "team-a").PodSelector(selector("team", "a")).Parent("ns1", "eq1").Obj(),
+		testutil.MakeEQ("ns3", "eq3").Parent("ns2", "team-a").Obj(),
+		testutil.MakeEQ("ns4", "old1").Obj(),
+		testutil.MakeEQ("ns4", "old2").Obj(),
+		func() *v1alpha1.ElasticQuota {
+			eq := testutil.MakeEQ("ns6", "batch").Obj()
+			eq.Spec.NamespaceSelector = selector("tier", "batch")
+			return eq
+		}(),
+	}
+	cases := []struct {
+		name         string
+		old          *v1alpha1.ElasticQuota
+		eq           *v1alpha1.ElasticQuota
+		wantFields   []string
+		wantWarnings int
+	}{
+		{
+			name: "valid quota",
+			eq: testutil.MakeEQ("ns5", "eq5").
+				Min(testutil.MakeResourceList().CPU(2).Obj()).
+				Max(testutil.MakeResourceList().CPU(4).Obj()).Obj(),
+		},
+		{
+			name: "min over max and negative quantities",
+			eq: testutil.MakeEQ("ns5", "eq5").
+				Min(testutil.MakeResourceList().CPU(4).Obj()).
+				Max(testutil.MakeResourceList().CPU(2).Mem(-1).Obj()).
+				BorrowingLimit(testutil.MakeResourceList().CPU(-1).Obj()).Obj(),
+			wantFields: []string{"spec.max[memory]", "spec.borrowingLimit[cpu]", "spec.min[cpu]"},
+		},
+		{
+			name: "invalid windows",
+			eq: func() *v1alpha1.ElasticQuota {
+				eq := testutil.MakeEQ("ns5", "eq5").
+					Min(testutil.MakeResourceList().CPU(2).Obj()).
+					Max(testutil.MakeResourceList().CPU(4).Obj()).Obj()
+				eq.Spec.Windows = []v1alpha1.ElasticQuotaWindow{
+					{Name: "day", Start: "09:00", End: "18:00", Max: testutil.MakeResourceList().CPU(1).Obj()},
+					{Name: "day", Start: "22:00", End: "06:00", TimeZone: "Nowhere/Atlantis"},
+				}
+				return eq
+			}(),
+			wantFields: []string{"spec.windows[0].min[cpu]", "spec.windows[1].name", "spec.windows[1]"},
+		},
+		{
+			name: "invalid flavors",
+			eq: func() *v1alpha1.ElasticQuota {
+				eq := testutil.MakeEQ("ns5", "eq5").Obj()
+				eq.Spec.Flavors = []v1alpha1.ElasticQuotaFlavor{
+					{
+						Name:         "a100",
+						NodeSelector: selector("gpu", "a100"),
+						Min:          testutil.MakeResourceList().GPU(4).Obj(),
+						Max:          testutil.MakeResourceList().GPU(2).Obj(),
+					},
+					{Name: "a100", Max: testutil.MakeResourceList().GPU(-1).Obj()},
+				}
+				return eq
+			}(),
+			wantFields: []string{"spec.flavors[0].min[nvidia.com/gpu]", "spec.flavors[1].name", "spec.flavors[1].nodeSelector", "spec.flavors[1].max[nvidia.com/gpu]"},
+		},
+		{
+			name:       "second quota of a namespace",
+			eq:         testutil.MakeEQ("ns1", "eq2").Obj(),
+			wantFields: []string{"metadata.namespace"},
+		},
+		{
+			name: "quotas with disjoint pod selectors",
+			eq:   testutil.MakeEQ("ns2", "team-b").PodSelector(selector("team", "b")).Obj(),
+		},
+		{
+			name:       "quotas with overlapping pod selectors",
+			eq:         testutil.MakeEQ("ns2", "gpu").PodSelector(selector("gpu", "true")).Obj(),
+			wantFields: []string{"spec.podSelector"},
+		},
+		{
+			name: "quotas with overlapping namespace selectors",
+			eq: func() *v1alpha1.ElasticQuota {
+				eq := testutil.MakeEQ("ns7", "pool").Obj()
+				eq.Spec.NamespaceSelector = selector("tier", "batch")
+				return eq
+			}(),
+			wantFields: []string{"spec.namespaceSelector"},
+		},
+		{
+			name: "update of a quota already overlapping",
+			old:  testutil.MakeEQ("ns4", "old1").Obj(),
+			eq:   testutil.MakeEQ("ns4", "old1").Max(testutil.MakeResourceList().CPU(4).Obj()).Obj(),
+		},
+		{
+			name:       "parent making a cycle",
+			eq:         testutil.MakeEQ("ns1", "eq1").Parent("ns3", "eq3").Obj(),
+			wantFields: []string{"spec.parent"},
+		},
+		{
+			name:       "quota as its own parent",
+			eq:         testutil.MakeEQ("ns5", "eq5").Parent("ns5", "eq5").Obj(),
+			wantFields: []string{"spec.parent"},
+		},
+		{
+			name:         "sum of the min over the allocatable of the cluster",
+			eq:           testutil.MakeEQ("ns5", "eq5").Min(testutil.MakeResourceList().CPU(6).Obj()).Obj(),
+			wantWarnings: 1,
+		},
+		{
+			name: "min of a child quota",
+			eq:   testutil.MakeEQ("ns5", "eq5").Min(testutil.MakeResourceList().CPU(6).Obj()).Parent("ns1", "eq1").Obj(),
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			builder := fake.NewClientBuilder().WithScheme(s).WithObjects(node).
+				WithIndex(&v1alpha1.ElasticQuota{}, elasticQuotaNamespaceField, indexElasticQuotaNamespace).
+				WithIndex(&v1alpha1.ElasticQuota{}, elasticQuotaRootField, indexElasticQuotaRoot)
+			for _, eq := range existing {
+				builder.WithObjects(eq.DeepCopy())
+			}
+			w := &ElasticQuotaWebhook{
+				log:    klogr.New().WithName("elasticQuotaWebhookTest"),
+				Client: builder.Build(),
+			}
+			var warnings []string
+			var err error
+			if c.old == nil {
+				warnings, err = w.ValidateCreate(context.TODO(), c.eq)
+			} else {
+				warnings, err = w.ValidateUpdate(context.TODO(), c.old, c.eq)
+			}
+			if len(warnings) != c.wantWarnings {
+				t.Errorf("want %d warnings, got %v", c.wantWarnings, warnings)
+			}
+			var fields []string
+			if err != nil {
+				statusErr, ok := err.(*apierrors.StatusError)
+				if !ok || !apierrors.IsInvalid(err) {
+					t.Fatalf("want an Invalid error, got %v", err)
+				}
+				for _, cause := range statusErr.ErrStatus.Details.Causes {
+					fields = append(fields, cause.Field)
+				}
+			}
+			if !reflect.DeepEqual(fields, c.wantFields) {
+				t.Errorf("want errors on %v, got %v", c.wantFields, err)
+			}
+		})
+	}
+}
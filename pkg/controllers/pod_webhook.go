@@ -0,0 +1,113 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	schedv1alpha1 "sigs.k8s.io/scheduler-plugins/apis/scheduling/v1alpha1"
+	"sigs.k8s.io/scheduler-plugins/pkg/util"
+)
+
+// PodGroupLabeler adds the PodGroupLabel to the pods created by the workloads the WorkloadReconciler
+// creates pod groups for, so that they get scheduled as a gang.
+type PodGroupLabeler struct {
+	log logr.Logger
+
+	client.Client
+	// GVKs are the kinds of the workloads.
+	GVKs []schema.GroupVersionKind
+}
+
+// +kubebuilder:webhook:path=/mutate--v1-pod,mutating=true,failurePolicy=ignore,sideEffects=None,groups="",resources=pods,verbs=create,versions=v1,name=podgroup.scheduling.x-k8s.io,admissionReviewVersions=v1
+
+var _ admission.CustomDefaulter = &PodGroupLabeler{}
+
+// Default labels the pod with the name of the pod group of its controller, if the controller is one of
+// the workloads opted in the automatic creation of its pod group. Pods which already have the label are
+// left untouched. Errors are only logged, so that the pod creation never fails because of the labeler.
+func (l *PodGroupLabeler) Default(ctx context.Context, obj runtime.Object) error {
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return fmt.Errorf("expected a Pod but got a %T", obj)
+	}
+	if len(util.GetPodGroupLabel(pod)) != 0 {
+		return nil
+	}
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil {
+		return nil
+	}
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil || !l.watches(gv.WithKind(ref.Kind)) {
+		return nil
+	}
+
+	namespace := pod.Namespace
+	if len(namespace) == 0 {
+		// The namespace of a pod isn't set yet when it's created through the namespaced endpoint.
+		if req, err := admission.RequestFromContext(ctx); err == nil {
+			namespace = req.Namespace
+		}
+	}
+	workload := &unstructured.Unstructured{}
+	workload.SetGroupVersionKind(gv.WithKind(ref.Kind))
+	if err := l.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ref.Name}, workload); err != nil {
+		l.log.Error(err, "Unable to retrieve the controller of the pod", "namespace", namespace, "controller", ref.Name)
+		return nil
+	}
+	if workload.GetUID() != ref.UID || !podGroupCreationEnabled(workload) {
+		return nil
+	}
+
+	if pod.Labels == nil {
+		pod.Labels = make(map[string]string)
+	}
+	pod.Labels[schedv1alpha1.PodGroupLabel] = workload.GetName()
+	return nil
+}
+
+func (l *PodGroupLabeler) watches(gvk schema.GroupVersionKind) bool {
+	for _, watched := range l.GVKs {
+		if watched == gvk {
+			return true
+		}
+	}
+	return false
+}
+
+// SetupWebhookWithManager registers the webhook in the webhook server of the Manager.
+func (l *PodGroupLabeler) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	l.log = mgr.GetLogger().WithName("PodGroupLabeler")
+
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&v1.Pod{}).
+		WithDefaulter(l).
+		Complete()
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/klog/v2/klogr"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"sigs.k8s.io/scheduler-plugins/apis/scheduling/v1alpha1"
+)
+
+func TestPodGroupLabeler(t *testing.T) {
+	optIn := map[string]string{v1alpha1.PodGroupCreateAnnotation: "true"}
+	ownedBy := func(apiVersion, kind, name string, uid types.UID) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{APIVersion: apiVersion, Kind: kind, Name: name, UID: uid, Controller: pointer.Bool(true)}}
+	}
+	cases := []struct {
+		name         string
+		labels       map[string]string
+		owners       []metav1.OwnerReference
+		desiredLabel string
+	}{
+		{
+			name:         "pod of an annotated job",
+			owners:       ownedBy("batch/v1", "Job", "job", "job"),
+			desiredLabel: "job",
+		},
+		{
+			name:   "pod of a job without the annotation",
+			owners: ownedBy("batch/v1", "Job", "other", "other"),
+		},
+		{
+			name:   "pod of a job recreated with the same name",
+			owners: ownedBy("batch/v1", "Job", "job", "old-job"),
+		},
+		{
+			name:   "pod of an unwatched kind",
+			owners: ownedBy("apps/v1", "ReplicaSet", "job", "job"),
+		},
+		{
+			name: "pod without controller",
+		},
+		{
+			name:         "pod already in a pod group",
+			labels:       map[string]string{v1alpha1.PodGroupLabel: "pg"},
+			owners:       ownedBy("batch/v1", "Job", "job", "job"),
+			desiredLabel: "pg",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			kClient := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithRuntimeObjects(makeJob("job", optIn, nil, nil), makeJob("other", nil, nil, nil)).
+				Build()
+			l := &PodGroupLabeler{
+				log:    klogr.New().WithName("podGroupLabelerTest"),
+				Client: kClient,
+				GVKs:   []schema.GroupVersionKind{JobGVK},
+			}
+			pod := &v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "pod", Labels: c.labels, OwnerReferences: c.owners},
+			}
+			// The namespace of the pod comes from the admission request.
+			ctx := admission.NewContextWithRequest(context.TODO(), admission.Request{
+				AdmissionRequest: admissionv1.AdmissionRequest{Namespace: "default"},
+			})
+			if err := l.Default(ctx, pod); err != nil {
+				t.Fatal(err)
+			}
+			var want map[string]string
+			if len(c.desiredLabel) != 0 {
+				want = map[string]string{v1alpha1.PodGroupLabel: c.desiredLabel}
+			}
+			if !reflect.DeepEqual(pod.Labels, want) {
+				t.Errorf("want labels %v, got %v", want, pod.Labels)
+			}
+		})
+	}
+}
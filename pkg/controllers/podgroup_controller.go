@@ -26,6 +26,8 @@ import (
 	"github.com/go-logr/logr"
 	v1 "k8s.io/api/core/v1"
 	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
@@ -48,11 +50,18 @@ type PodGroupReconciler struct {
 	client.Client
 	Scheme  *runtime.Scheme
 	Workers int
+	// ScheduleTimeout is the time the controller waits for the first member of a pod group to be bound
+	// before marking it as Failed. Zero means no timeout.
+	ScheduleTimeout time.Duration
+	// DefaultTTLSecondsAfterFinished is the TTLSecondsAfterFinished of the pod groups which don't
+	// set it. Nil means they are kept.
+	DefaultTTLSecondsAfterFinished *int32
 }
 
 // +kubebuilder:rbac:groups=scheduling.x-k8s.io,resources=podgroups,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=scheduling.x-k8s.io,resources=podgroups/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=scheduling.x-k8s.io,resources=podgroups/finalizers,verbs=update
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -76,21 +85,8 @@ func (r *PodGroupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		return ctrl.Result{}, err
 	}
 
-	if pg.Status.Phase == schedv1alpha1.PodGroupFinished ||
-		pg.Status.Phase == schedv1alpha1.PodGroupFailed {
-		return ctrl.Result{}, nil
-	}
-	// If startScheduleTime - createTime > 2days,
-	// do not reconcile again because pod may have been GCed
-	if (pg.Status.Phase == schedv1alpha1.PodGroupScheduling || pg.Status.Phase == schedv1alpha1.PodGroupPending) && pg.Status.Running == 0 &&
-		pg.Status.ScheduleStartTime.Sub(pg.CreationTimestamp.Time) > 48*time.Hour {
-		r.recorder.Event(pg, v1.EventTypeWarning,
-			"Timeout", "schedule time longer than 48 hours")
-		return ctrl.Result{}, nil
-	}
-
 	podList := &v1.PodList{}
-	if err := r.List(ctx, podList,
+	if err := r.List(ctx, podList, client.InNamespace(pg.Namespace),
 		client.MatchingLabelsSelector{
 			Selector: labels.Set(map[string]string{
 				schedv1alpha1.PodGroupLabel: pg.Name}).AsSelector(),
@@ -98,19 +94,67 @@ func (r *PodGroupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		log.Error(err, "List pods for group failed")
 		return ctrl.Result{}, err
 	}
-	pods := podList.Items
+	// Pods being deleted, e.g. by the failure policy, are not members of the group anymore, nor are the
+	// pods of the run of the group before its last restart, which are deleted again in case the restart
+	// was interrupted.
+	pods := make([]v1.Pod, 0, len(podList.Items))
+	var stalePods []v1.Pod
+	for _, pod := range podList.Items {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		if pg.Status.LastRestartTime != nil && pod.CreationTimestamp.Before(pg.Status.LastRestartTime) {
+			stalePods = append(stalePods, pod)
+			continue
+		}
+		pods = append(pods, pod)
+	}
+	if _, err := r.deletePods(ctx, stalePods, false); err != nil {
+		log.Error(err, "Delete pods of the previous run of the group failed")
+		return ctrl.Result{}, err
+	}
+
+	// A pod group failed on the schedule timeout of the controller is scheduled again once one of its members
+	// gets bound after all, e.g. once the cluster scaled up.
+	recovered := pg.Status.Phase == schedv1alpha1.PodGroupFailed && failedOnScheduleTimeout(pg) && hasBoundMember(pods)
+	if !recovered && (pg.Status.Phase == schedv1alpha1.PodGroupFinished ||
+		pg.Status.Phase == schedv1alpha1.PodGroupFailed) {
+		// The failure policy may have been interrupted before deleting the remaining members.
+		if failGroupPolicy(pg) {
+			if _, err := r.deletePods(ctx, pods, true); err != nil {
+				log.Error(err, "Delete remaining members of the failed group failed")
+				return ctrl.Result{}, err
+			}
+		}
+		return r.cleanUpFinishedPodGroup(ctx, pg)
+	}
 
 	pgCopy := pg.DeepCopy()
+	var result ctrl.Result
+	// deleteMembers runs the deletions of the failure policy, once the status of the pod group is persisted,
+	// so that the restarts are counted even if the pod group is reconciled again before.
+	var deleteMembers func() error
+	if recovered {
+		pgCopy.Status.Phase = schedv1alpha1.PodGroupScheduling
+		pgCopy.Status.CompletionTime = nil
+		meta.RemoveStatusCondition(&pgCopy.Status.Conditions, schedv1alpha1.PodGroupFailedCondition)
+		r.recorder.Event(pgCopy, v1.EventTypeNormal, "Recovered", "A member was bound after the schedule timeout")
+	}
 	switch pgCopy.Status.Phase {
 	case "":
 		pgCopy.Status.Phase = schedv1alpha1.PodGroupPending
+		pgCopy.Status.ScheduleStartTime = metav1.Now()
 	case schedv1alpha1.PodGroupPending:
 		if len(pods) >= int(pg.Spec.MinMember) {
 			pgCopy.Status.Phase = schedv1alpha1.PodGroupScheduling
+			// The schedule timeout only starts once the members are created.
+			pgCopy.Status.ScheduleStartTime = metav1.Now()
 			fillOccupiedObj(pgCopy, &pods[0])
 		}
 	default:
 		pgCopy.Status.Running, pgCopy.Status.Succeeded, pgCopy.Status.Failed = getCurrentPodStats(pods)
+		pgCopy.Status.RoleStatuses = getCurrentRoleStats(pg.Spec.Roles, pods)
+		pgCopy.Status.ScheduledBeyondMin = getScheduledBeyondMin(pods, pg.Spec.MinMember)
 		if len(pods) < int(pg.Spec.MinMember) {
 			pgCopy.Status.Phase = schedv1alpha1.PodGroupPending
 			break
@@ -127,21 +171,228 @@ func (r *PodGroupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		if pgCopy.Status.Failed != 0 &&
 			pgCopy.Status.Failed+pgCopy.Status.Running+pgCopy.Status.Succeeded >= pg.Spec.MinMember {
 			pgCopy.Status.Phase = schedv1alpha1.PodGroupFailed
+			meta.SetStatusCondition(&pgCopy.Status.Conditions, metav1.Condition{
+				Type:    schedv1alpha1.PodGroupFailedCondition,
+				Status:  metav1.ConditionTrue,
+				Reason:  schedv1alpha1.PodGroupReasonMemberFailed,
+				Message: fmt.Sprintf("Pod %v failed", getFailedPodName(pods)),
+			})
 		}
 		if pgCopy.Status.Succeeded >= pg.Spec.MinMember {
 			pgCopy.Status.Phase = schedv1alpha1.PodGroupFinished
 		}
+		if pgCopy.Status.Phase == schedv1alpha1.PodGroupFailed {
+			deleteMembers = r.applyFailurePolicy(ctx, pgCopy, pods)
+		}
+	}
+
+	if pgCopy.Status.Phase == schedv1alpha1.PodGroupScheduling {
+		if timeout, timedOut := r.scheduleTimedOut(pgCopy, pods); timedOut {
+			pgCopy.Status.Phase = schedv1alpha1.PodGroupFailed
+			message := fmt.Sprintf("No member was bound within the schedule timeout of %v", timeout)
+			meta.SetStatusCondition(&pgCopy.Status.Conditions, metav1.Condition{
+				Type:    schedv1alpha1.PodGroupFailedCondition,
+				Status:  metav1.ConditionTrue,
+				Reason:  schedv1alpha1.PodGroupReasonScheduleTimeout,
+				Message: message,
+			})
+			r.recorder.Event(pgCopy, v1.EventTypeWarning, schedv1alpha1.PodGroupReasonScheduleTimeout, message)
+		} else if timeout > 0 {
+			result = ctrl.Result{RequeueAfter: timeout - time.Since(getScheduleStartTime(pgCopy))}
+		}
+	}
+
+	if pgCopy.Status.Phase == schedv1alpha1.PodGroupFinished || pgCopy.Status.Phase == schedv1alpha1.PodGroupFailed {
+		now := metav1.Now()
+		pgCopy.Status.CompletionTime = &now
+		if ttl := r.getTTLSecondsAfterFinished(pgCopy); ttl != nil {
+			result = ctrl.Result{RequeueAfter: time.Duration(*ttl) * time.Second}
+		}
+	}
+
+	if patchResult, err := r.patchPodGroup(ctx, pg, pgCopy); err != nil || patchResult.Requeue {
+		return patchResult, err
+	}
+	if deleteMembers != nil {
+		if err := deleteMembers(); err != nil {
+			log.Error(err, "Apply failure policy failed")
+			return ctrl.Result{}, err
+		}
+	}
+	return result, nil
+}
+
+// scheduleTimedOut checks whether the schedule timeout of the controller has expired without any member of
+// the pod group bound to a node, and returns the timeout. The scheduleTimeoutSeconds of the pod group is only
+// the time its members wait for each other in Permit, and doesn't fail the pod group.
+func (r *PodGroupReconciler) scheduleTimedOut(pg *schedv1alpha1.PodGroup, pods []v1.Pod) (time.Duration, bool) {
+	timeout := r.ScheduleTimeout
+	if timeout <= 0 || hasBoundMember(pods) {
+		return 0, false
+	}
+	return timeout, time.Since(getScheduleStartTime(pg)) >= timeout
+}
+
+// hasBoundMember checks whether a member of the pod group is bound to a node.
+func hasBoundMember(pods []v1.Pod) bool {
+	for _, pod := range pods {
+		if pod.Spec.NodeName != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// failedOnScheduleTimeout checks whether the pod group failed because of the schedule timeout.
+func failedOnScheduleTimeout(pg *schedv1alpha1.PodGroup) bool {
+	condition := meta.FindStatusCondition(pg.Status.Conditions, schedv1alpha1.PodGroupFailedCondition)
+	return condition != nil && condition.Reason == schedv1alpha1.PodGroupReasonScheduleTimeout
+}
+
+// getScheduleStartTime returns the time the pod group started waiting to be scheduled.
+func getScheduleStartTime(pg *schedv1alpha1.PodGroup) time.Time {
+	if pg.Status.ScheduleStartTime.IsZero() {
+		return pg.CreationTimestamp.Time
+	}
+	return pg.Status.ScheduleStartTime.Time
+}
+
+// getTTLSecondsAfterFinished returns the TTLSecondsAfterFinished of the pod group, or else the default
+// of the controller.
+func (r *PodGroupReconciler) getTTLSecondsAfterFinished(pg *schedv1alpha1.PodGroup) *int32 {
+	if pg.Spec.TTLSecondsAfterFinished != nil {
+		return pg.Spec.TTLSecondsAfterFinished
+	}
+	return r.DefaultTTLSecondsAfterFinished
+}
+
+// cleanUpFinishedPodGroup deletes the finished or failed pod group once its TTL has expired,
+// or requeues it until then.
+func (r *PodGroupReconciler) cleanUpFinishedPodGroup(ctx context.Context, pg *schedv1alpha1.PodGroup) (ctrl.Result, error) {
+	ttl := r.getTTLSecondsAfterFinished(pg)
+	if ttl == nil {
+		return ctrl.Result{}, nil
+	}
+	if pg.Status.CompletionTime == nil {
+		// The pod group completed before the controller recorded completion times.
+		pgCopy := pg.DeepCopy()
+		now := metav1.Now()
+		pgCopy.Status.CompletionTime = &now
+		if result, err := r.patchPodGroup(ctx, pg, pgCopy); err != nil || result.Requeue {
+			return result, err
+		}
+		return ctrl.Result{RequeueAfter: time.Duration(*ttl) * time.Second}, nil
+	}
+
+	if remaining := time.Until(pg.Status.CompletionTime.Add(time.Duration(*ttl) * time.Second)); remaining > 0 {
+		return ctrl.Result{RequeueAfter: remaining}, nil
+	}
+	if err := r.Delete(ctx, pg, client.Preconditions{UID: &pg.UID}); err != nil && !apierrs.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+	log.FromContext(ctx).V(3).Info("Deleted expired pod group", "ttlSecondsAfterFinished", *ttl)
+	return ctrl.Result{}, nil
+}
+
+// applyFailurePolicy updates the status of the failed pod group according to its failure policy, and returns
+// the deletion of its members to run once the status is persisted, or nil. With RestartGroup, all the members
+// get deleted and the pod group goes back to Pending, as long as the restarts aren't exhausted. With FailGroup,
+// or once the restarts are exhausted, the remaining members get deleted and the pod group stays Failed.
+func (r *PodGroupReconciler) applyFailurePolicy(ctx context.Context, pg *schedv1alpha1.PodGroup, pods []v1.Pod) func() error {
+	policy := pg.Spec.FailurePolicy
+	if policy == nil || policy.Action == "" || policy.Action == schedv1alpha1.FailurePolicyNone {
+		return nil
+	}
+	failed := getFailedPodName(pods)
+
+	if policy.Action == schedv1alpha1.FailurePolicyRestartGroup {
+		maxRestarts := getMaxRestarts(policy)
+		if pg.Status.Restarts < maxRestarts {
+			// The pods created from now on belong to the next run, the API server stores times in seconds.
+			now := metav1.Now().Rfc3339Copy()
+			pg.Status.Restarts++
+			pg.Status.LastRestartTime = &now
+			pg.Status.Phase = schedv1alpha1.PodGroupPending
+			pg.Status.ScheduleStartTime = now
+			meta.RemoveStatusCondition(&pg.Status.Conditions, schedv1alpha1.PodGroupFailedCondition)
+			pg.Status.Running, pg.Status.Succeeded, pg.Status.Failed = 0, 0, 0
+			pg.Status.RoleStatuses = getCurrentRoleStats(pg.Spec.Roles, nil)
+			pg.Status.ScheduledBeyondMin = 0
+			return func() error {
+				if _, err := r.deletePods(ctx, pods, false); err != nil {
+					return err
+				}
+				r.recorder.Eventf(pg, v1.EventTypeWarning, "RestartGroup",
+					"Pod %v failed, restarting the pod group (%d/%d)", failed, pg.Status.Restarts, maxRestarts)
+				return nil
+			}
+		}
 	}
 
-	return r.patchPodGroup(ctx, pg, pgCopy)
+	return func() error {
+		if policy.Action == schedv1alpha1.FailurePolicyRestartGroup {
+			r.recorder.Eventf(pg, v1.EventTypeWarning, "RestartLimitExceeded",
+				"Pod %v failed, the pod group was already restarted %d times", failed, pg.Status.Restarts)
+		}
+		deleted, err := r.deletePods(ctx, pods, true)
+		if err != nil {
+			return err
+		}
+		r.recorder.Eventf(pg, v1.EventTypeWarning, "FailGroup",
+			"Pod %v failed, deleted %d remaining members of the pod group", failed, deleted)
+		return nil
+	}
+}
+
+// getMaxRestarts returns the maximal number of restarts of the failure policy.
+func getMaxRestarts(policy *schedv1alpha1.FailurePolicy) int32 {
+	if policy.MaxRestarts != nil {
+		return *policy.MaxRestarts
+	}
+	return schedv1alpha1.DefaultMaxRestarts
+}
+
+// failGroupPolicy checks whether the failure policy of the failed pod group deletes its remaining members,
+// i.e. its action is FailGroup, or RestartGroup with the restarts exhausted, and a member failed.
+func failGroupPolicy(pg *schedv1alpha1.PodGroup) bool {
+	policy := pg.Spec.FailurePolicy
+	if pg.Status.Phase != schedv1alpha1.PodGroupFailed || policy == nil ||
+		(policy.Action != schedv1alpha1.FailurePolicyFailGroup && policy.Action != schedv1alpha1.FailurePolicyRestartGroup) {
+		return false
+	}
+	condition := meta.FindStatusCondition(pg.Status.Conditions, schedv1alpha1.PodGroupFailedCondition)
+	return condition != nil && condition.Reason == schedv1alpha1.PodGroupReasonMemberFailed
+}
+
+// deletePods deletes the given pods, only the ones which haven't terminated yet if activeOnly is set.
+// It returns the number of pods deleted.
+func (r *PodGroupReconciler) deletePods(ctx context.Context, pods []v1.Pod, activeOnly bool) (int, error) {
+	var deleted int
+	for i := range pods {
+		pod := &pods[i]
+		if activeOnly && (pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed) {
+			continue
+		}
+		if err := r.Delete(ctx, pod); err != nil && !apierrs.IsNotFound(err) {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
 }
 
 func (r *PodGroupReconciler) patchPodGroup(ctx context.Context, old, new *schedv1alpha1.PodGroup) (ctrl.Result, error) {
-	patch := client.MergeFrom(old)
-	if err := r.Status().Patch(ctx, new, patch); err != nil {
+	// A merge patch replaces the whole list of conditions, so the status patch is sent with the
+	// resourceVersion of the pod group read by the controller. If the scheduler wrote a condition
+	// in the meantime, the patch is rejected with a conflict and the pod group is reconciled again.
+	if err := r.Status().Patch(ctx, new, client.MergeFromWithOptions(old, client.MergeFromWithOptimisticLock{})); err != nil {
+		if apierrs.IsConflict(err) {
+			log.FromContext(ctx).V(5).Info("Pod group changed meanwhile, reconciling it again")
+			return ctrl.Result{Requeue: true}, nil
+		}
 		return ctrl.Result{}, err
 	}
-	err := r.Patch(ctx, new, patch)
+	err := r.Patch(ctx, new, client.MergeFrom(old))
 	return ctrl.Result{}, err
 }
 
@@ -168,6 +419,51 @@ func getCurrentPodStats(pods []v1.Pod) (int32, int32, int32) {
 	return running, succeeded, failed
 }
 
+// getCurrentRoleStats returns the number of running, succeeded and failed pods of each role.
+func getCurrentRoleStats(roles []schedv1alpha1.PodGroupRole, pods []v1.Pod) []schedv1alpha1.PodGroupRoleStatus {
+	if len(roles) == 0 {
+		return nil
+	}
+
+	podsPerRole := make(map[string][]v1.Pod)
+	for _, pod := range pods {
+		role := util.GetPodGroupRole(&pod)
+		podsPerRole[role] = append(podsPerRole[role], pod)
+	}
+	statuses := make([]schedv1alpha1.PodGroupRoleStatus, 0, len(roles))
+	for _, role := range roles {
+		status := schedv1alpha1.PodGroupRoleStatus{Name: role.Name}
+		status.Running, status.Succeeded, status.Failed = getCurrentPodStats(podsPerRole[role.Name])
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// getScheduledBeyondMin returns the number of pods scheduled beyond minMember,
+// not counting the pods which failed.
+func getScheduledBeyondMin(pods []v1.Pod, minMember int32) int32 {
+	var scheduled int32
+	for _, pod := range pods {
+		if pod.Spec.NodeName != "" && pod.Status.Phase != v1.PodFailed {
+			scheduled++
+		}
+	}
+	if scheduled <= minMember {
+		return 0
+	}
+	return scheduled - minMember
+}
+
+// getFailedPodName returns the name of the first failed pod.
+func getFailedPodName(pods []v1.Pod) string {
+	for _, pod := range pods {
+		if pod.Status.Phase == v1.PodFailed {
+			return pod.Name
+		}
+	}
+	return ""
+}
+
 func fillOccupiedObj(pg *schedv1alpha1.PodGroup, pod *v1.Pod) {
 	if len(pod.OwnerReferences) == 0 {
 		return
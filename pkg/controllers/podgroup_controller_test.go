@@ -18,12 +18,17 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
 	"sort"
 	"strings"
 	"testing"
 	"time"
 
 	v1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
@@ -31,10 +36,12 @@ import (
 	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2/klogr"
 	st "k8s.io/kubernetes/pkg/scheduler/testing"
+	"k8s.io/utils/pointer"
 
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
 
 	"sigs.k8s.io/scheduler-plugins/apis/scheduling/v1alpha1"
 )
@@ -128,13 +135,13 @@ func Test_Run(t *testing.T) {
 			podNextPhase:      v1.PodSucceeded,
 		},
 		{
-			name:               "Group should not enqueue, created too long",
+			name:               "Group created long ago starts running",
 			pgName:             "pg8",
 			minMember:          2,
 			podNames:           []string{"pod1", "pod2"},
 			podPhase:           v1.PodRunning,
 			previousPhase:      v1alpha1.PodGroupPending,
-			desiredGroupPhase:  v1alpha1.PodGroupPending,
+			desiredGroupPhase:  v1alpha1.PodGroupRunning,
 			podGroupCreateTime: &createTime,
 		},
 		{
@@ -268,6 +275,750 @@ func TestFillGroupStatusOccupied(t *testing.T) {
 	}
 }
 
+func TestFillGroupStatusRoles(t *testing.T) {
+	ctx := context.TODO()
+	pg := makePG("pg", 3, v1alpha1.PodGroupScheduling, nil)
+	pg.Spec.Roles = []v1alpha1.PodGroupRole{
+		{Name: "launcher", MinMember: 1},
+		{Name: "worker", MinMember: 2},
+	}
+	makeRolePod := func(name, role string, phase v1.PodPhase) *v1.Pod {
+		pod := st.MakePod().Namespace("default").Name(name).Obj()
+		pod.Labels = map[string]string{v1alpha1.PodGroupLabel: "pg", v1alpha1.PodGroupRoleLabel: role}
+		pod.Status.Phase = phase
+		return pod
+	}
+	objs := []runtime.Object{
+		pg,
+		makeRolePod("launcher", "launcher", v1.PodRunning),
+		makeRolePod("worker-1", "worker", v1.PodRunning),
+		makeRolePod("worker-2", "worker", v1.PodSucceeded),
+		makeRolePod("worker-3", "worker", v1.PodFailed),
+	}
+	s := scheme.Scheme
+	s.AddKnownTypes(v1alpha1.SchemeGroupVersion, pg)
+	kClient := fake.NewClientBuilder().
+		WithScheme(s).
+		WithStatusSubresource(&v1alpha1.PodGroup{}).
+		WithRuntimeObjects(objs...).
+		Build()
+	controller := &PodGroupReconciler{
+		Client:   kClient,
+		Scheme:   s,
+		recorder: record.NewFakeRecorder(3),
+		log:      klogr.New().WithName("podGroupTest"),
+	}
+
+	if _, err := controller.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "pg", Namespace: "default"}}); err != nil {
+		t.Fatal(err)
+	}
+	got := &v1alpha1.PodGroup{}
+	if err := kClient.Get(ctx, client.ObjectKeyFromObject(pg), got); err != nil {
+		t.Fatal(err)
+	}
+	want := []v1alpha1.PodGroupRoleStatus{
+		{Name: "launcher", Running: 1},
+		{Name: "worker", Running: 1, Succeeded: 1, Failed: 1},
+	}
+	if !reflect.DeepEqual(got.Status.RoleStatuses, want) {
+		t.Errorf("want %v, got %v", want, got.Status.RoleStatuses)
+	}
+}
+
+func TestReconcilePreservesConditions(t *testing.T) {
+	ctx := context.TODO()
+	controller, kClient := setUp(ctx, []string{"pod1", "pod2"}, "pg", v1.PodRunning, 2, v1alpha1.PodGroupScheduling, nil, nil)
+	pg := &v1alpha1.PodGroup{}
+	if err := kClient.Get(ctx, types.NamespacedName{Name: "pg", Namespace: "default"}, pg); err != nil {
+		t.Fatal(err)
+	}
+	conditions := []metav1.Condition{
+		{
+			Type:               v1alpha1.PodGroupSchedulable,
+			Status:             metav1.ConditionTrue,
+			Reason:             v1alpha1.PodGroupReasonScheduled,
+			Message:            "The quorum of the PodGroup is scheduled",
+			LastTransitionTime: metav1.Now().Rfc3339Copy(),
+		},
+	}
+	pg.Status.Conditions = conditions
+	if err := kClient.Status().Update(ctx, pg); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := controller.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "pg", Namespace: "default"}}); err != nil {
+		t.Fatal(err)
+	}
+	got := &v1alpha1.PodGroup{}
+	if err := kClient.Get(ctx, types.NamespacedName{Name: "pg", Namespace: "default"}, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Status.Phase != v1alpha1.PodGroupRunning {
+		t.Errorf("want phase %v, got %v", v1alpha1.PodGroupRunning, got.Status.Phase)
+	}
+	if !reflect.DeepEqual(got.Status.Conditions, conditions) {
+		t.Errorf("want conditions %v, got %v", conditions, got.Status.Conditions)
+	}
+}
+
+func TestPatchPodGroupConflict(t *testing.T) {
+	ctx := context.TODO()
+	s := scheme.Scheme
+	pg := makePG("pg", 2, v1alpha1.PodGroupScheduling, nil)
+	s.AddKnownTypes(v1alpha1.SchemeGroupVersion, pg)
+	// The fake client ignores the resourceVersion of the status patches, check it like the API server does.
+	kClient := fake.NewClientBuilder().
+		WithScheme(s).
+		WithStatusSubresource(&v1alpha1.PodGroup{}).
+		WithRuntimeObjects(pg).
+		WithInterceptorFuncs(interceptor.Funcs{
+			SubResourcePatch: func(ctx context.Context, c client.Client, subResourceName string, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+				data, err := patch.Data(obj)
+				if err != nil {
+					return err
+				}
+				var patched metav1.PartialObjectMetadata
+				if err := json.Unmarshal(data, &patched); err != nil {
+					return err
+				}
+				current := &v1alpha1.PodGroup{}
+				if err := c.Get(ctx, client.ObjectKeyFromObject(obj), current); err != nil {
+					return err
+				}
+				if rv := patched.ResourceVersion; rv != "" && rv != current.ResourceVersion {
+					return apierrs.NewConflict(v1alpha1.Resource("podgroups"), obj.GetName(), fmt.Errorf("object was modified"))
+				}
+				return c.SubResource(subResourceName).Patch(ctx, obj, patch, opts...)
+			},
+		}).
+		Build()
+	controller := &PodGroupReconciler{
+		Client:   kClient,
+		Scheme:   s,
+		recorder: record.NewFakeRecorder(3),
+		log:      klogr.New().WithName("podGroupTest"),
+	}
+	key := types.NamespacedName{Name: "pg", Namespace: "default"}
+	old := &v1alpha1.PodGroup{}
+	if err := kClient.Get(ctx, key, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// The scheduler writes a condition after the controller read the pod group.
+	scheduled := old.DeepCopy()
+	scheduled.Status.Conditions = []metav1.Condition{
+		{
+			Type:               v1alpha1.PodGroupSchedulable,
+			Status:             metav1.ConditionFalse,
+			Reason:             v1alpha1.PodGroupReasonUnschedulable,
+			Message:            "0/3 nodes are available",
+			LastTransitionTime: metav1.Now().Rfc3339Copy(),
+		},
+	}
+	if err := kClient.Status().Update(ctx, scheduled); err != nil {
+		t.Fatal(err)
+	}
+
+	pgCopy := old.DeepCopy()
+	pgCopy.Status.Phase = v1alpha1.PodGroupFailed
+	meta.SetStatusCondition(&pgCopy.Status.Conditions, metav1.Condition{
+		Type:   v1alpha1.PodGroupFailedCondition,
+		Status: metav1.ConditionTrue,
+		Reason: v1alpha1.PodGroupReasonScheduleTimeout,
+	})
+	result, err := controller.patchPodGroup(ctx, old, pgCopy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Requeue {
+		t.Errorf("want the pod group to be requeued on conflict")
+	}
+	got := &v1alpha1.PodGroup{}
+	if err := kClient.Get(ctx, key, got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Status.Phase != v1alpha1.PodGroupScheduling || !reflect.DeepEqual(got.Status.Conditions, scheduled.Status.Conditions) {
+		t.Errorf("want the status written by the scheduler to be kept, got %v", got.Status)
+	}
+
+	// Reconciled again, the pod group is patched on top of the condition of the scheduler.
+	pgCopy = got.DeepCopy()
+	pgCopy.Status.Phase = v1alpha1.PodGroupFailed
+	if result, err := controller.patchPodGroup(ctx, got, pgCopy); err != nil || result.Requeue {
+		t.Fatalf("want the patch to succeed, got %v, %v", result, err)
+	}
+}
+
+func TestFailurePolicy(t *testing.T) {
+	ctx := context.TODO()
+	cases := []struct {
+		name          string
+		policy        *v1alpha1.FailurePolicy
+		restarts      int32
+		desiredPhase  v1alpha1.PodGroupPhase
+		desiredPods   []string
+		desiredEvents []string
+		restartsAfter int32
+	}{
+		{
+			name:         "no failure policy",
+			desiredPhase: v1alpha1.PodGroupFailed,
+			desiredPods:  []string{"pod1", "pod2", "pod3"},
+		},
+		{
+			name:         "None",
+			policy:       &v1alpha1.FailurePolicy{Action: v1alpha1.FailurePolicyNone},
+			desiredPhase: v1alpha1.PodGroupFailed,
+			desiredPods:  []string{"pod1", "pod2", "pod3"},
+		},
+		{
+			name:          "FailGroup deletes the remaining members",
+			policy:        &v1alpha1.FailurePolicy{Action: v1alpha1.FailurePolicyFailGroup},
+			desiredPhase:  v1alpha1.PodGroupFailed,
+			desiredPods:   []string{"pod1", "pod3"},
+			desiredEvents: []string{"Warning FailGroup Pod pod1 failed, deleted 1 remaining members of the pod group"},
+		},
+		{
+			name:          "RestartGroup deletes all the members",
+			policy:        &v1alpha1.FailurePolicy{Action: v1alpha1.FailurePolicyRestartGroup},
+			restarts:      1,
+			desiredPhase:  v1alpha1.PodGroupPending,
+			desiredEvents: []string{"Warning RestartGroup Pod pod1 failed, restarting the pod group (2/3)"},
+			restartsAfter: 2,
+		},
+		{
+			name:         "RestartGroup fails the group once the restarts are exhausted",
+			policy:       &v1alpha1.FailurePolicy{Action: v1alpha1.FailurePolicyRestartGroup, MaxRestarts: pointer.Int32(1)},
+			restarts:     1,
+			desiredPhase: v1alpha1.PodGroupFailed,
+			desiredPods:  []string{"pod1", "pod3"},
+			desiredEvents: []string{
+				"Warning RestartLimitExceeded Pod pod1 failed, the pod group was already restarted 1 times",
+				"Warning FailGroup Pod pod1 failed, deleted 1 remaining members of the pod group",
+			},
+			restartsAfter: 1,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pg := makePG("pg", 3, v1alpha1.PodGroupRunning, nil)
+			pg.Spec.FailurePolicy = c.policy
+			pg.Status.Restarts = c.restarts
+			objs := []runtime.Object{pg}
+			for _, p := range []struct {
+				name  string
+				phase v1.PodPhase
+			}{{"pod1", v1.PodFailed}, {"pod2", v1.PodRunning}, {"pod3", v1.PodSucceeded}} {
+				pod := st.MakePod().Namespace("default").Name(p.name).Label(v1alpha1.PodGroupLabel, "pg").Obj()
+				pod.Status.Phase = p.phase
+				objs = append(objs, pod)
+			}
+			s := scheme.Scheme
+			s.AddKnownTypes(v1alpha1.SchemeGroupVersion, pg)
+			kClient := fake.NewClientBuilder().
+				WithScheme(s).
+				WithStatusSubresource(&v1alpha1.PodGroup{}).
+				WithRuntimeObjects(objs...).
+				Build()
+			recorder := record.NewFakeRecorder(3)
+			controller := &PodGroupReconciler{
+				Client:   kClient,
+				Scheme:   s,
+				recorder: recorder,
+				log:      klogr.New().WithName("podGroupTest"),
+			}
+
+			if _, err := controller.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "pg", Namespace: "default"}}); err != nil {
+				t.Fatal(err)
+			}
+			got := &v1alpha1.PodGroup{}
+			if err := kClient.Get(ctx, client.ObjectKeyFromObject(pg), got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Status.Phase != c.desiredPhase {
+				t.Errorf("want phase %v, got %v", c.desiredPhase, got.Status.Phase)
+			}
+			if got.Status.Restarts != c.restartsAfter {
+				t.Errorf("want %v restarts, got %v", c.restartsAfter, got.Status.Restarts)
+			}
+			podList := &v1.PodList{}
+			if err := kClient.List(ctx, podList); err != nil {
+				t.Fatal(err)
+			}
+			var pods []string
+			for _, pod := range podList.Items {
+				pods = append(pods, pod.Name)
+			}
+			if !reflect.DeepEqual(pods, c.desiredPods) {
+				t.Errorf("want pods %v, got %v", c.desiredPods, pods)
+			}
+			close(recorder.Events)
+			var events []string
+			for event := range recorder.Events {
+				events = append(events, event)
+			}
+			if !reflect.DeepEqual(events, c.desiredEvents) {
+				t.Errorf("want events %v, got %v", c.desiredEvents, events)
+			}
+		})
+	}
+}
+
+func TestFailurePolicyPersistsStatusFirst(t *testing.T) {
+	ctx := context.TODO()
+	restartTime := metav1.NewTime(time.Now().Add(-time.Minute).Truncate(time.Second))
+	failGroup := &v1alpha1.FailurePolicy{Action: v1alpha1.FailurePolicyFailGroup}
+	restartGroup := &v1alpha1.FailurePolicy{Action: v1alpha1.FailurePolicyRestartGroup}
+	cases := []struct {
+		name          string
+		policy        *v1alpha1.FailurePolicy
+		phase         v1alpha1.PodGroupPhase
+		reason        string
+		restartTime   *metav1.Time
+		conflict      bool
+		desiredPods   []string
+		restartsAfter int32
+	}{
+		{
+			name:        "conflicting status patch deletes no member",
+			policy:      restartGroup,
+			phase:       v1alpha1.PodGroupRunning,
+			conflict:    true,
+			desiredPods: []string{"pod1", "pod2", "pod3"},
+		},
+		{
+			name:          "interrupted restart deletes the members of the previous run",
+			policy:        restartGroup,
+			phase:         v1alpha1.PodGroupPending,
+			restartTime:   &restartTime,
+			desiredPods:   []string{"pod4"},
+			restartsAfter: 1,
+		},
+		{
+			name:        "interrupted FailGroup deletes the remaining members",
+			policy:      failGroup,
+			phase:       v1alpha1.PodGroupFailed,
+			reason:      v1alpha1.PodGroupReasonMemberFailed,
+			desiredPods: []string{"pod1", "pod3"},
+		},
+		{
+			name:        "FailGroup keeps the members of a group failed on schedule timeout",
+			policy:      failGroup,
+			phase:       v1alpha1.PodGroupFailed,
+			reason:      v1alpha1.PodGroupReasonScheduleTimeout,
+			desiredPods: []string{"pod1", "pod2", "pod3", "pod4"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pg := makePG("pg", 3, c.phase, nil)
+			pg.Spec.FailurePolicy = c.policy
+			if c.restartTime != nil {
+				pg.Status.Restarts = 1
+				pg.Status.LastRestartTime = c.restartTime
+			}
+			if c.reason != "" {
+				meta.SetStatusCondition(&pg.Status.Conditions, metav1.Condition{
+					Type:   v1alpha1.PodGroupFailedCondition,
+					Status: metav1.ConditionTrue,
+					Reason: c.reason,
+				})
+			}
+			objs := []runtime.Object{pg}
+			for _, p := range []struct {
+				name    string
+				phase   v1.PodPhase
+				created time.Time
+			}{
+				{"pod1", v1.PodFailed, restartTime.Add(-time.Hour)},
+				{"pod2", v1.PodRunning, restartTime.Add(-time.Hour)},
+				{"pod3", v1.PodSucceeded, restartTime.Add(-time.Hour)},
+				{"pod4", v1.PodPending, restartTime.Add(time.Second)},
+			} {
+				if c.conflict && p.name == "pod4" {
+					continue
+				}
+				pod := st.MakePod().Namespace("default").Name(p.name).Label(v1alpha1.PodGroupLabel, "pg").Obj()
+				pod.Status.Phase = p.phase
+				pod.CreationTimestamp = metav1.NewTime(p.created)
+				objs = append(objs, pod)
+			}
+			s := scheme.Scheme
+			s.AddKnownTypes(v1alpha1.SchemeGroupVersion, pg)
+			kClient := fake.NewClientBuilder().
+				WithScheme(s).
+				WithStatusSubresource(&v1alpha1.PodGroup{}).
+				WithRuntimeObjects(objs...).
+				WithInterceptorFuncs(interceptor.Funcs{
+					SubResourcePatch: func(ctx context.Context, cl client.Client, subResourceName string, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) error {
+						if c.conflict {
+							return apierrs.NewConflict(v1alpha1.Resource("podgroups"), obj.GetName(), fmt.Errorf("object was modified"))
+						}
+						return cl.SubResource(subResourceName).Patch(ctx, obj, patch, opts...)
+					},
+				}).
+				Build()
+			controller := &PodGroupReconciler{
+				Client:   kClient,
+				Scheme:   s,
+				recorder: record.NewFakeRecorder(3),
+				log:      klogr.New().WithName("podGroupTest"),
+			}
+
+			result, err := controller.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "pg", Namespace: "default"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Requeue != c.conflict {
+				t.Errorf("want requeue %v, got %v", c.conflict, result.Requeue)
+			}
+			got := &v1alpha1.PodGroup{}
+			if err := kClient.Get(ctx, client.ObjectKeyFromObject(pg), got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Status.Restarts != c.restartsAfter {
+				t.Errorf("want %v restarts, got %v", c.restartsAfter, got.Status.Restarts)
+			}
+			podList := &v1.PodList{}
+			if err := kClient.List(ctx, podList); err != nil {
+				t.Fatal(err)
+			}
+			var pods []string
+			for _, pod := range podList.Items {
+				pods = append(pods, pod.Name)
+			}
+			if !reflect.DeepEqual(pods, c.desiredPods) {
+				t.Errorf("want pods %v, got %v", c.desiredPods, pods)
+			}
+		})
+	}
+}
+
+func TestScheduleTimeout(t *testing.T) {
+	ctx := context.TODO()
+	startTime := metav1.NewTime(time.Now().Add(-time.Minute))
+	cases := []struct {
+		name              string
+		timeout           time.Duration
+		timeoutSeconds    *int32
+		minMember         int32
+		previousPhase     v1alpha1.PodGroupPhase
+		failedReason      string
+		podPhase          v1.PodPhase
+		nodeName          string
+		desiredGroupPhase v1alpha1.PodGroupPhase
+		desiredCondition  *metav1.Condition
+		requeue           bool
+	}{
+		{
+			name:              "no member bound within the timeout of the controller",
+			timeout:           30 * time.Second,
+			podPhase:          v1.PodPending,
+			desiredGroupPhase: v1alpha1.PodGroupFailed,
+			desiredCondition: &metav1.Condition{
+				Type:    v1alpha1.PodGroupFailedCondition,
+				Status:  metav1.ConditionTrue,
+				Reason:  v1alpha1.PodGroupReasonScheduleTimeout,
+				Message: "No member was bound within the schedule timeout of 30s",
+			},
+		},
+		{
+			name:              "members bound but not running yet, e.g. pulling their images",
+			timeout:           30 * time.Second,
+			podPhase:          v1.PodPending,
+			nodeName:          "node-a",
+			desiredGroupPhase: v1alpha1.PodGroupScheduling,
+		},
+		{
+			name:              "members run within the timeout of the controller",
+			timeout:           30 * time.Second,
+			podPhase:          v1.PodRunning,
+			nodeName:          "node-a",
+			desiredGroupPhase: v1alpha1.PodGroupRunning,
+		},
+		{
+			name:              "timeout of the controller not expired yet",
+			timeout:           300 * time.Second,
+			podPhase:          v1.PodPending,
+			desiredGroupPhase: v1alpha1.PodGroupScheduling,
+			requeue:           true,
+		},
+		{
+			name:              "scheduleTimeoutSeconds of the pod group only bounds the wait in Permit",
+			timeout:           300 * time.Second,
+			timeoutSeconds:    pointer.Int32(10),
+			podPhase:          v1.PodPending,
+			desiredGroupPhase: v1alpha1.PodGroupScheduling,
+			requeue:           true,
+		},
+		{
+			name:              "pod group failed on the schedule timeout with a member bound since",
+			timeout:           30 * time.Second,
+			previousPhase:     v1alpha1.PodGroupFailed,
+			failedReason:      v1alpha1.PodGroupReasonScheduleTimeout,
+			podPhase:          v1.PodRunning,
+			nodeName:          "node-a",
+			desiredGroupPhase: v1alpha1.PodGroupRunning,
+		},
+		{
+			name:              "pod group failed on the schedule timeout without member bound",
+			timeout:           30 * time.Second,
+			previousPhase:     v1alpha1.PodGroupFailed,
+			failedReason:      v1alpha1.PodGroupReasonScheduleTimeout,
+			podPhase:          v1.PodPending,
+			desiredGroupPhase: v1alpha1.PodGroupFailed,
+			desiredCondition: &metav1.Condition{
+				Type:   v1alpha1.PodGroupFailedCondition,
+				Status: metav1.ConditionTrue,
+				Reason: v1alpha1.PodGroupReasonScheduleTimeout,
+			},
+		},
+		{
+			name:              "pod group failed on a member failure stays failed",
+			timeout:           30 * time.Second,
+			previousPhase:     v1alpha1.PodGroupFailed,
+			failedReason:      v1alpha1.PodGroupReasonMemberFailed,
+			podPhase:          v1.PodRunning,
+			nodeName:          "node-a",
+			desiredGroupPhase: v1alpha1.PodGroupFailed,
+			desiredCondition: &metav1.Condition{
+				Type:   v1alpha1.PodGroupFailedCondition,
+				Status: metav1.ConditionTrue,
+				Reason: v1alpha1.PodGroupReasonMemberFailed,
+			},
+		},
+		{
+			name:              "pending pod group waiting for its members",
+			timeout:           30 * time.Second,
+			minMember:         3,
+			previousPhase:     v1alpha1.PodGroupPending,
+			podPhase:          v1.PodPending,
+			desiredGroupPhase: v1alpha1.PodGroupPending,
+		},
+		{
+			name:              "no timeout",
+			podPhase:          v1.PodPending,
+			desiredGroupPhase: v1alpha1.PodGroupScheduling,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			minMember, previousPhase := c.minMember, c.previousPhase
+			if minMember == 0 {
+				minMember = 2
+			}
+			if previousPhase == "" {
+				previousPhase = v1alpha1.PodGroupScheduling
+			}
+			controller, kClient := setUp(ctx, []string{"pod1", "pod2"}, "pg", c.podPhase, minMember, previousPhase, nil, nil)
+			controller.ScheduleTimeout = c.timeout
+			pg := &v1alpha1.PodGroup{}
+			key := types.NamespacedName{Name: "pg", Namespace: "default"}
+			if err := kClient.Get(ctx, key, pg); err != nil {
+				t.Fatal(err)
+			}
+			pg.Spec.ScheduleTimeoutSeconds = c.timeoutSeconds
+			if err := kClient.Update(ctx, pg); err != nil {
+				t.Fatal(err)
+			}
+			pg.Status.ScheduleStartTime = startTime
+			if c.failedReason != "" {
+				meta.SetStatusCondition(&pg.Status.Conditions, metav1.Condition{
+					Type:   v1alpha1.PodGroupFailedCondition,
+					Status: metav1.ConditionTrue,
+					Reason: c.failedReason,
+				})
+				now := metav1.Now()
+				pg.Status.CompletionTime = &now
+			}
+			if err := kClient.Status().Update(ctx, pg); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range []string{"pod1", "pod2"} {
+				pod := &v1.Pod{}
+				if err := kClient.Get(ctx, types.NamespacedName{Name: name, Namespace: "default"}, pod); err != nil {
+					t.Fatal(err)
+				}
+				pod.Spec.NodeName = c.nodeName
+				if err := kClient.Update(ctx, pod); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			result, err := controller.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (result.RequeueAfter > 0) != c.requeue {
+				t.Errorf("want requeue %v, got %v", c.requeue, result.RequeueAfter)
+			}
+			got := &v1alpha1.PodGroup{}
+			if err := kClient.Get(ctx, key, got); err != nil {
+				t.Fatal(err)
+			}
+			if got.Status.Phase != c.desiredGroupPhase {
+				t.Errorf("want phase %v, got %v", c.desiredGroupPhase, got.Status.Phase)
+			}
+			condition := meta.FindStatusCondition(got.Status.Conditions, v1alpha1.PodGroupFailedCondition)
+			if c.desiredCondition == nil {
+				if condition != nil {
+					t.Errorf("want no condition, got %v", condition)
+				}
+			} else if condition == nil || condition.Reason != c.desiredCondition.Reason ||
+				(c.desiredCondition.Message != "" && condition.Message != c.desiredCondition.Message) {
+				t.Errorf("want condition %v, got %v", c.desiredCondition, condition)
+			}
+			if (c.desiredGroupPhase == v1alpha1.PodGroupFailed) != (got.Status.CompletionTime != nil) {
+				t.Errorf("want the completion time set only for a failed pod group, got %v", got.Status.CompletionTime)
+			}
+		})
+	}
+}
+
+func TestTTLSecondsAfterFinished(t *testing.T) {
+	ctx := context.TODO()
+	longAgo := metav1.NewTime(time.Now().Add(-time.Hour))
+	cases := []struct {
+		name           string
+		phase          v1alpha1.PodGroupPhase
+		ttl            *int32
+		defaultTTL     *int32
+		completionTime *metav1.Time
+		deleted        bool
+		requeue        bool
+	}{
+		{
+			name:           "finished pod group without TTL is kept",
+			phase:          v1alpha1.PodGroupFinished,
+			completionTime: &longAgo,
+		},
+		{
+			name:           "expired pod group is deleted",
+			phase:          v1alpha1.PodGroupFinished,
+			ttl:            pointer.Int32(60),
+			completionTime: &longAgo,
+			deleted:        true,
+		},
+		{
+			name:           "expired pod group is deleted with the default TTL",
+			phase:          v1alpha1.PodGroupFailed,
+			defaultTTL:     pointer.Int32(0),
+			completionTime: &longAgo,
+			deleted:        true,
+		},
+		{
+			name:           "TTL of the pod group overrides the default",
+			phase:          v1alpha1.PodGroupFailed,
+			ttl:            pointer.Int32(7200),
+			defaultTTL:     pointer.Int32(0),
+			completionTime: &longAgo,
+			requeue:        true,
+		},
+		{
+			name:    "completion time is recorded for completed pod groups",
+			phase:   v1alpha1.PodGroupFinished,
+			ttl:     pointer.Int32(60),
+			requeue: true,
+		},
+		{
+			name:    "pod group which just finished is requeued",
+			phase:   v1alpha1.PodGroupRunning,
+			ttl:     pointer.Int32(60),
+			requeue: true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pg := makePG("pg", 2, c.phase, nil)
+			pg.Spec.TTLSecondsAfterFinished = c.ttl
+			pg.Status.CompletionTime = c.completionTime
+			objs := []runtime.Object{pg}
+			for _, pod := range makePods([]string{"pod1", "pod2"}, "pg", v1.PodSucceeded, nil) {
+				objs = append(objs, pod)
+			}
+			s := scheme.Scheme
+			s.AddKnownTypes(v1alpha1.SchemeGroupVersion, pg)
+			kClient := fake.NewClientBuilder().
+				WithScheme(s).
+				WithStatusSubresource(&v1alpha1.PodGroup{}).
+				WithRuntimeObjects(objs...).
+				Build()
+			controller := &PodGroupReconciler{
+				Client:                         kClient,
+				Scheme:                         s,
+				recorder:                       record.NewFakeRecorder(3),
+				log:                            klogr.New().WithName("podGroupTest"),
+				DefaultTTLSecondsAfterFinished: c.defaultTTL,
+			}
+
+			result, err := controller.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "pg", Namespace: "default"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (result.RequeueAfter > 0) != c.requeue {
+				t.Errorf("want requeue %v, got %v", c.requeue, result.RequeueAfter)
+			}
+			got := &v1alpha1.PodGroup{}
+			err = kClient.Get(ctx, client.ObjectKeyFromObject(pg), got)
+			if c.deleted {
+				if !apierrs.IsNotFound(err) {
+					t.Errorf("want the pod group to be deleted, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Status.CompletionTime == nil {
+				t.Errorf("want the completion time to be set")
+			}
+		})
+	}
+}
+
+func TestGetScheduledBeyondMin(t *testing.T) {
+	makePod := func(name, node string, phase v1.PodPhase) v1.Pod {
+		pod := st.MakePod().Namespace("default").Name(name).Node(node).Obj()
+		pod.Status.Phase = phase
+		return *pod
+	}
+	pods := []v1.Pod{
+		makePod("pod1", "node", v1.PodRunning),
+		makePod("pod2", "node", v1.PodRunning),
+		makePod("pod3", "node", v1.PodSucceeded),
+		makePod("pod4", "node", v1.PodFailed),
+		makePod("pod5", "", v1.PodPending),
+	}
+	cases := []struct {
+		name      string
+		minMember int32
+		want      int32
+	}{
+		{
+			name:      "pods scheduled beyond minMember",
+			minMember: 1,
+			want:      2,
+		},
+		{
+			name:      "pods scheduled equal minMember",
+			minMember: 3,
+			want:      0,
+		},
+		{
+			name:      "pods scheduled less than minMember",
+			minMember: 5,
+			want:      0,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := getScheduledBeyondMin(pods, c.minMember); got != c.want {
+				t.Errorf("want %v, got %v", c.want, got)
+			}
+		})
+	}
+}
+
 func setUp(ctx context.Context,
 	podNames []string,
 	pgName string,
@@ -291,9 +1042,10 @@ func setUp(ctx context.Context,
 		Build()
 
 	controller := &PodGroupReconciler{
-		Client:   client,
-		Scheme:   s,
-		recorder: record.NewFakeRecorder(3),
+		Client:          client,
+		Scheme:          s,
+		recorder:        record.NewFakeRecorder(3),
+		ScheduleTimeout: 48 * time.Hour,
 
 		log: klogr.New().WithName("podGroupTest"),
 	}
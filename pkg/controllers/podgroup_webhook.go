@@ -0,0 +1,150 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/pointer"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	schedv1alpha1 "sigs.k8s.io/scheduler-plugins/apis/scheduling/v1alpha1"
+)
+
+// PodGroupWebhook defaults and validates the PodGroups.
+type PodGroupWebhook struct{}
+
+// +kubebuilder:webhook:path=/mutate-scheduling-x-k8s-io-v1alpha1-podgroup,mutating=true,failurePolicy=fail,sideEffects=None,groups=scheduling.x-k8s.io,resources=podgroups,verbs=create;update,versions=v1alpha1,name=mpodgroup.scheduling.x-k8s.io,admissionReviewVersions=v1
+// +kubebuilder:webhook:path=/validate-scheduling-x-k8s-io-v1alpha1-podgroup,mutating=false,failurePolicy=fail,sideEffects=None,groups=scheduling.x-k8s.io,resources=podgroups,verbs=create;update,versions=v1alpha1,name=vpodgroup.scheduling.x-k8s.io,admissionReviewVersions=v1
+
+var _ admission.CustomDefaulter = &PodGroupWebhook{}
+var _ admission.CustomValidator = &PodGroupWebhook{}
+
+// Default sets the mode of the topology constraint, the action of the failure policy and its maximal number
+// of restarts, if the pod group doesn't set them.
+func (w *PodGroupWebhook) Default(_ context.Context, obj runtime.Object) error {
+	pg, ok := obj.(*schedv1alpha1.PodGroup)
+	if !ok {
+		return fmt.Errorf("expected a PodGroup but got a %T", obj)
+	}
+	if tc := pg.Spec.TopologyConstraint; tc != nil && len(tc.Mode) == 0 {
+		tc.Mode = schedv1alpha1.TopologyConstraintRequired
+	}
+	if fp := pg.Spec.FailurePolicy; fp != nil {
+		if len(fp.Action) == 0 {
+			fp.Action = schedv1alpha1.FailurePolicyNone
+		}
+		if fp.Action == schedv1alpha1.FailurePolicyRestartGroup && fp.MaxRestarts == nil {
+			fp.MaxRestarts = pointer.Int32(schedv1alpha1.DefaultMaxRestarts)
+		}
+	}
+	return nil
+}
+
+// ValidateCreate validates the pod group, see validatePodGroupSpec.
+func (w *PodGroupWebhook) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, validatePodGroup(obj)
+}
+
+// ValidateUpdate validates the pod group, see validatePodGroupSpec.
+func (w *PodGroupWebhook) ValidateUpdate(_ context.Context, _, newObj runtime.Object) (admission.Warnings, error) {
+	return nil, validatePodGroup(newObj)
+}
+
+// ValidateDelete accepts the deletion of any pod group.
+func (w *PodGroupWebhook) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func validatePodGroup(obj runtime.Object) error {
+	pg, ok := obj.(*schedv1alpha1.PodGroup)
+	if !ok {
+		return fmt.Errorf("expected a PodGroup but got a %T", obj)
+	}
+	if allErrs := validatePodGroupSpec(&pg.Spec, field.NewPath("spec")); len(allErrs) != 0 {
+		return apierrors.NewInvalid(schedv1alpha1.SchemeGroupVersion.WithKind("PodGroup").GroupKind(), pg.Name, allErrs)
+	}
+	return nil
+}
+
+// validatePodGroupSpec rejects the negative numbers and quantities, a maxMember below the members the pod
+// group needs to be scheduled, the roles without name or with the same name, and invalid topology keys.
+func validatePodGroupSpec(spec *schedv1alpha1.PodGroupSpec, fldPath *field.Path) field.ErrorList {
+	var allErrs field.ErrorList
+	if spec.MinMember < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("minMember"), spec.MinMember, "must be greater than or equal to 0"))
+	}
+	allErrs = append(allErrs, validateNonNegativeResourceList(spec.MinResources, fldPath.Child("minResources"))...)
+	if spec.ScheduleTimeoutSeconds != nil && *spec.ScheduleTimeoutSeconds < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("scheduleTimeoutSeconds"), *spec.ScheduleTimeoutSeconds, "must be greater than or equal to 0"))
+	}
+	if spec.TTLSecondsAfterFinished != nil && *spec.TTLSecondsAfterFinished < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("ttlSecondsAfterFinished"), *spec.TTLSecondsAfterFinished, "must be greater than or equal to 0"))
+	}
+
+	var roleMembers int32
+	names := sets.NewString()
+	for i, role := range spec.Roles {
+		rolePath := fldPath.Child("roles").Index(i)
+		if len(role.Name) == 0 {
+			allErrs = append(allErrs, field.Required(rolePath.Child("name"), ""))
+		} else if names.Has(role.Name) {
+			allErrs = append(allErrs, field.Duplicate(rolePath.Child("name"), role.Name))
+		}
+		names.Insert(role.Name)
+		if role.MinMember < 0 {
+			allErrs = append(allErrs, field.Invalid(rolePath.Child("minMember"), role.MinMember, "must be greater than or equal to 0"))
+		} else {
+			roleMembers += role.MinMember
+		}
+		allErrs = append(allErrs, validateNonNegativeResourceList(role.MinResources, rolePath.Child("minResources"))...)
+	}
+
+	if spec.MaxMember != nil {
+		maxMember := *spec.MaxMember
+		if maxMember < spec.MinMember {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("maxMember"), maxMember, "must be greater than or equal to minMember"))
+		} else if maxMember < roleMembers {
+			allErrs = append(allErrs, field.Invalid(fldPath.Child("maxMember"), maxMember,
+				fmt.Sprintf("must be greater than or equal to the sum of the minMember of the roles, %d", roleMembers)))
+		}
+	}
+
+	if tc := spec.TopologyConstraint; tc != nil {
+		allErrs = append(allErrs, metav1validation.ValidateLabelName(tc.TopologyKey, fldPath.Child("topologyConstraint", "topologyKey"))...)
+	}
+	if fp := spec.FailurePolicy; fp != nil && fp.MaxRestarts != nil && *fp.MaxRestarts < 0 {
+		allErrs = append(allErrs, field.Invalid(fldPath.Child("failurePolicy", "maxRestarts"), *fp.MaxRestarts, "must be greater than or equal to 0"))
+	}
+	return allErrs
+}
+
+// SetupWebhookWithManager registers the webhooks in the webhook server of the Manager.
+func (w *PodGroupWebhook) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&schedv1alpha1.PodGroup{}).
+		WithDefaulter(w).
+		WithValidator(w).
+		Complete()
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/pointer"
+
+	"sigs.k8s.io/scheduler-plugins/apis/scheduling/v1alpha1"
+	testutil "sigs.k8s.io/scheduler-plugins/test/integration"
+)
+
+func TestPodGroupWebhook_Default(t *testing.T) {
+	pg := &v1alpha1.PodGroup{
+		Spec: v1alpha1.PodGroupSpec{
+			TopologyConstraint: &v1alpha1.TopologyConstraint{TopologyKey: "topology.kubernetes.io/zone"},
+			FailurePolicy:      &v1alpha1.FailurePolicy{Action: v1alpha1.FailurePolicyRestartGroup},
+		},
+	}
+	if err := (&PodGroupWebhook{}).Default(context.TODO(), pg); err != nil {
+		t.Fatal(err)
+	}
+	if pg.Spec.TopologyConstraint.Mode != v1alpha1.TopologyConstraintRequired {
+		t.Errorf("want mode %v, got %v", v1alpha1.TopologyConstraintRequired, pg.Spec.TopologyConstraint.Mode)
+	}
+	if maxRestarts := pg.Spec.FailurePolicy.MaxRestarts; maxRestarts == nil || *maxRestarts != v1alpha1.DefaultMaxRestarts {
+		t.Errorf("want maxRestarts %v, got %v", v1alpha1.DefaultMaxRestarts, maxRestarts)
+	}
+}
+
+func TestValidatePodGroupSpec(t *testing.T) {
+	cases := []struct {
+		name       string
+		spec       v1alpha1.PodGroupSpec
+		wantFields []string
+	}{
+		{
+			name: "valid pod group",
+			spec: v1alpha1.PodGroupSpec{
+				MinMember:          3,
+				MaxMember:          pointer.Int32(5),
+				MinResources:       testutil.MakeResourceList().CPU(3).Obj(),
+				Roles:              []v1alpha1.PodGroupRole{{Name: "launcher", MinMember: 1}, {Name: "worker", MinMember: 2}},
+				TopologyConstraint: &v1alpha1.TopologyConstraint{TopologyKey: "topology.kubernetes.io/zone"},
+			},
+		},
+		{
+			name: "negative numbers and quantities",
+			spec: v1alpha1.PodGroupSpec{
+				MinMember:              -1,
+				MinResources:           testutil.MakeResourceList().CPU(-1).Obj(),
+				ScheduleTimeoutSeconds: pointer.Int32(-1),
+				FailurePolicy:          &v1alpha1.FailurePolicy{Action: v1alpha1.FailurePolicyRestartGroup, MaxRestarts: pointer.Int32(-1)},
+			},
+			wantFields: []string{"spec.minMember", "spec.minResources[cpu]", "spec.scheduleTimeoutSeconds", "spec.failurePolicy.maxRestarts"},
+		},
+		{
+			name:       "maxMember below minMember",
+			spec:       v1alpha1.PodGroupSpec{MinMember: 3, MaxMember: pointer.Int32(2)},
+			wantFields: []string{"spec.maxMember"},
+		},
+		{
+			name: "maxMember below the members of the roles",
+			spec: v1alpha1.PodGroupSpec{
+				MinMember: 1,
+				MaxMember: pointer.Int32(2),
+				Roles:     []v1alpha1.PodGroupRole{{Name: "launcher", MinMember: 1}, {Name: "worker", MinMember: 2}},
+			},
+			wantFields: []string{"spec.maxMember"},
+		},
+		{
+			name: "invalid roles",
+			spec: v1alpha1.PodGroupSpec{
+				Roles: []v1alpha1.PodGroupRole{
+					{MinMember: 1},
+					{Name: "worker", MinMember: -1},
+					{Name: "worker", MinMember: 1, MinResources: testutil.MakeResourceList().Mem(-1).Obj()},
+				},
+			},
+			wantFields: []string{"spec.roles[0].name", "spec.roles[1].minMember", "spec.roles[2].name", "spec.roles[2].minResources[memory]"},
+		},
+		{
+			name:       "invalid topology key",
+			spec:       v1alpha1.PodGroupSpec{TopologyConstraint: &v1alpha1.TopologyConstraint{TopologyKey: "not a key"}},
+			wantFields: []string{"spec.topologyConstraint.topologyKey"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var fields []string
+			for _, err := range validatePodGroupSpec(&c.spec, field.NewPath("spec")) {
+				fields = append(fields, err.Field)
+			}
+			if !reflect.DeepEqual(fields, c.wantFields) {
+				t.Errorf("want errors on %v, got %v", c.wantFields, fields)
+			}
+		})
+	}
+
+	// The webhook rejects the invalid pod groups with an Invalid error.
+	pg := &v1alpha1.PodGroup{Spec: v1alpha1.PodGroupSpec{MinMember: 2, MaxMember: pointer.Int32(1)}}
+	if _, err := (&PodGroupWebhook{}).ValidateCreate(context.TODO(), pg); err == nil {
+		t.Errorf("want an error for an invalid pod group")
+	}
+}
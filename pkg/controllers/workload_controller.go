@@ -0,0 +1,223 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	quota "k8s.io/apiserver/pkg/quota/v1"
+	"k8s.io/client-go/tools/record"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	schedv1alpha1 "sigs.k8s.io/scheduler-plugins/apis/scheduling/v1alpha1"
+	"sigs.k8s.io/scheduler-plugins/pkg/util"
+)
+
+// JobGVK is the kind of the workloads the WorkloadReconciler creates pod groups for by default.
+var JobGVK = schema.GroupVersionKind{Group: "batch", Version: "v1", Kind: "Job"}
+
+// WorkloadReconciler creates a PodGroup for each workload of a given kind, e.g. batch/v1 Jobs,
+// which has the PodGroupCreateAnnotation annotation. The PodGroup has the name of the workload
+// and is owned by it, so that it gets garbage collected along with the workload.
+type WorkloadReconciler struct {
+	recorder record.EventRecorder
+
+	client.Client
+	Scheme  *runtime.Scheme
+	Workers int
+	// GVK is the kind of the workloads.
+	GVK schema.GroupVersionKind
+}
+
+// +kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch
+
+// Reconcile creates the PodGroup of the workload, or updates its minMember and minResources.
+func (r *WorkloadReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	log.Info("reconciling")
+	workload := &unstructured.Unstructured{}
+	workload.SetGroupVersionKind(r.GVK)
+	if err := r.Get(ctx, req.NamespacedName, workload); err != nil {
+		if apierrs.IsNotFound(err) {
+			log.V(5).Info("Workload has been deleted")
+			return ctrl.Result{}, nil
+		}
+		log.V(3).Error(err, "Unable to retrieve workload")
+		return ctrl.Result{}, err
+	}
+	if !podGroupCreationEnabled(workload) || workload.GetDeletionTimestamp() != nil {
+		return ctrl.Result{}, nil
+	}
+
+	minMember, minResources, err := getWorkloadPodGroupSpec(workload)
+	if err != nil {
+		r.recorder.Eventf(workload, v1.EventTypeWarning, "InvalidPodGroup", "Cannot create the PodGroup: %v", err)
+		return ctrl.Result{}, nil
+	}
+
+	pg := &schedv1alpha1.PodGroup{}
+	if err := r.Get(ctx, req.NamespacedName, pg); err != nil {
+		if !apierrs.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		pg = &schedv1alpha1.PodGroup{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      workload.GetName(),
+				Namespace: workload.GetNamespace(),
+			},
+			Spec: schedv1alpha1.PodGroupSpec{
+				MinMember:    minMember,
+				MinResources: minResources,
+			},
+		}
+		if err := controllerutil.SetControllerReference(workload, pg, r.Scheme); err != nil {
+			return ctrl.Result{}, err
+		}
+		if err := r.Create(ctx, pg); err != nil {
+			return ctrl.Result{}, err
+		}
+		r.recorder.Eventf(workload, v1.EventTypeNormal, "PodGroupCreated", "Created PodGroup %v", pg.Name)
+		return ctrl.Result{}, nil
+	}
+
+	if !metav1.IsControlledBy(pg, workload) {
+		r.recorder.Eventf(workload, v1.EventTypeWarning, "PodGroupExists",
+			"PodGroup %v already exists and isn't owned by the workload", pg.Name)
+		return ctrl.Result{}, nil
+	}
+	if pg.Spec.MinMember == minMember && apiequality.Semantic.DeepEqual(pg.Spec.MinResources, minResources) {
+		return ctrl.Result{}, nil
+	}
+	pgCopy := pg.DeepCopy()
+	pgCopy.Spec.MinMember = minMember
+	pgCopy.Spec.MinResources = minResources
+	return ctrl.Result{}, r.Patch(ctx, pgCopy, client.MergeFrom(pg))
+}
+
+// podGroupCreationEnabled checks whether the workload opted in the automatic creation of its pod group.
+func podGroupCreationEnabled(obj client.Object) bool {
+	return obj.GetAnnotations()[schedv1alpha1.PodGroupCreateAnnotation] == "true"
+}
+
+// getWorkloadPodGroupSpec returns the minMember and minResources of the pod group of the workload.
+// The minMember is taken from the PodGroupMinMemberAnnotation annotation, or else from the replicas
+// or the parallelism (capped by the completions) of the workload, and defaults to 1. It is never less
+// than 1, even for a workload scaled down to zero. The minResources are the requests of the pod
+// template, overhead included, times minMember.
+func getWorkloadPodGroupSpec(workload *unstructured.Unstructured) (int32, v1.ResourceList, error) {
+	minMember, err := getWorkloadMinMember(workload)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	templateObj, found, err := unstructured.NestedMap(workload.Object, "spec", "template")
+	if err != nil {
+		return 0, nil, err
+	}
+	if !found {
+		return 0, nil, fmt.Errorf("spec.template not found")
+	}
+	template := &v1.PodTemplateSpec{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(templateObj, template); err != nil {
+		return 0, nil, err
+	}
+	request := util.GetPodEffectiveRequest(&v1.Pod{Spec: template.Spec})
+	if template.Spec.Overhead != nil {
+		request = quota.Add(request, template.Spec.Overhead)
+	}
+	if len(request) == 0 {
+		return minMember, nil, nil
+	}
+	minResources := make(v1.ResourceList, len(request))
+	for name, quant := range request {
+		if name == v1.ResourceCPU {
+			minResources[name] = *resource.NewMilliQuantity(quant.MilliValue()*int64(minMember), quant.Format)
+		} else {
+			minResources[name] = *resource.NewQuantity(quant.Value()*int64(minMember), quant.Format)
+		}
+	}
+	return minMember, minResources, nil
+}
+
+func getWorkloadMinMember(workload *unstructured.Unstructured) (int32, error) {
+	if value, ok := workload.GetAnnotations()[schedv1alpha1.PodGroupMinMemberAnnotation]; ok {
+		minMember, err := strconv.ParseInt(value, 10, 32)
+		if err != nil || minMember < 1 {
+			return 0, fmt.Errorf("invalid %v annotation %q", schedv1alpha1.PodGroupMinMemberAnnotation, value)
+		}
+		return int32(minMember), nil
+	}
+
+	minMember := int64(1)
+	if replicas, found, err := unstructured.NestedInt64(workload.Object, "spec", "replicas"); err != nil {
+		return 0, err
+	} else if found {
+		minMember = replicas
+	} else {
+		parallelism, found, err := unstructured.NestedInt64(workload.Object, "spec", "parallelism")
+		if err != nil {
+			return 0, err
+		}
+		if found {
+			minMember = parallelism
+		}
+		completions, found, err := unstructured.NestedInt64(workload.Object, "spec", "completions")
+		if err != nil {
+			return 0, err
+		}
+		if found && completions < minMember {
+			minMember = completions
+		}
+	}
+	// A workload scaled down to zero keeps a pod group of one member, rather than a pod group that any pod
+	// satisfies, until it scales up again.
+	if minMember < 1 {
+		minMember = 1
+	}
+	return int32(minMember), nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *WorkloadReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.recorder = mgr.GetEventRecorderFor("PodGroupController")
+
+	workload := &unstructured.Unstructured{}
+	workload.SetGroupVersionKind(r.GVK)
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(strings.ToLower(r.GVK.GroupKind().String())+"-podgroup").
+		For(workload, builder.WithPredicates(predicate.NewPredicateFuncs(podGroupCreationEnabled))).
+		Owns(&schedv1alpha1.PodGroup{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.Workers}).
+		Complete(r)
+}
@@ -0,0 +1,264 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/utils/pointer"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"sigs.k8s.io/scheduler-plugins/apis/scheduling/v1alpha1"
+)
+
+func makePodTemplate(cpu string) v1.PodTemplateSpec {
+	return v1.PodTemplateSpec{
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{
+				Name: "worker",
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse(cpu)},
+				},
+			}},
+		},
+	}
+}
+
+func makeJob(name string, annotations map[string]string, parallelism, completions *int32) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Namespace:   "default",
+			UID:         types.UID(name),
+			Annotations: annotations,
+		},
+		Spec: batchv1.JobSpec{
+			Parallelism: parallelism,
+			Completions: completions,
+			Template:    makePodTemplate("500m"),
+		},
+	}
+}
+
+func TestWorkloadReconciler(t *testing.T) {
+	ctx := context.TODO()
+	optIn := map[string]string{v1alpha1.PodGroupCreateAnnotation: "true"}
+	statefulSetGVK := schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "StatefulSet"}
+	jobOwner := []metav1.OwnerReference{{
+		APIVersion: "batch/v1", Kind: "Job", Name: "job", UID: "job",
+		Controller: pointer.Bool(true), BlockOwnerDeletion: pointer.Bool(true),
+	}}
+	cases := []struct {
+		name           string
+		gvk            schema.GroupVersionKind
+		workload       runtime.Object
+		podGroup       *v1alpha1.PodGroup
+		desiredPG      *v1alpha1.PodGroupSpec
+		desiredOwners  []metav1.OwnerReference
+		desiredMessage string
+	}{
+		{
+			name:     "job without the annotation",
+			gvk:      JobGVK,
+			workload: makeJob("job", nil, pointer.Int32(4), nil),
+		},
+		{
+			name:     "job with parallelism",
+			gvk:      JobGVK,
+			workload: makeJob("job", optIn, pointer.Int32(4), nil),
+			desiredPG: &v1alpha1.PodGroupSpec{
+				MinMember:    4,
+				MinResources: v1.ResourceList{v1.ResourceCPU: resource.MustParse("2")},
+			},
+			desiredOwners: jobOwner,
+		},
+		{
+			name:     "job with less completions than parallelism",
+			gvk:      JobGVK,
+			workload: makeJob("job", optIn, pointer.Int32(4), pointer.Int32(2)),
+			desiredPG: &v1alpha1.PodGroupSpec{
+				MinMember:    2,
+				MinResources: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")},
+			},
+			desiredOwners: jobOwner,
+		},
+		{
+			name:     "suspended job with zero parallelism",
+			gvk:      JobGVK,
+			workload: makeJob("job", optIn, pointer.Int32(0), nil),
+			desiredPG: &v1alpha1.PodGroupSpec{
+				MinMember:    1,
+				MinResources: v1.ResourceList{v1.ResourceCPU: resource.MustParse("500m")},
+			},
+			desiredOwners: jobOwner,
+		},
+		{
+			name: "job with the min member annotation",
+			gvk:  JobGVK,
+			workload: makeJob("job", map[string]string{
+				v1alpha1.PodGroupCreateAnnotation:    "true",
+				v1alpha1.PodGroupMinMemberAnnotation: "3",
+			}, pointer.Int32(4), nil),
+			desiredPG: &v1alpha1.PodGroupSpec{
+				MinMember:    3,
+				MinResources: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1500m")},
+			},
+			desiredOwners: jobOwner,
+		},
+		{
+			name: "job with an invalid min member annotation",
+			gvk:  JobGVK,
+			workload: makeJob("job", map[string]string{
+				v1alpha1.PodGroupCreateAnnotation:    "true",
+				v1alpha1.PodGroupMinMemberAnnotation: "many",
+			}, pointer.Int32(4), nil),
+			desiredMessage: `Warning InvalidPodGroup Cannot create the PodGroup: invalid scheduling.x-k8s.io/min-member annotation "many"`,
+		},
+		{
+			name:     "pod group of the job gets updated",
+			gvk:      JobGVK,
+			workload: makeJob("job", optIn, pointer.Int32(4), nil),
+			podGroup: &v1alpha1.PodGroup{
+				ObjectMeta: metav1.ObjectMeta{Name: "job", Namespace: "default", OwnerReferences: jobOwner},
+				Spec: v1alpha1.PodGroupSpec{
+					MinMember:     2,
+					FailurePolicy: &v1alpha1.FailurePolicy{Action: v1alpha1.FailurePolicyRestartGroup},
+				},
+			},
+			desiredPG: &v1alpha1.PodGroupSpec{
+				MinMember:     4,
+				MinResources:  v1.ResourceList{v1.ResourceCPU: resource.MustParse("2")},
+				FailurePolicy: &v1alpha1.FailurePolicy{Action: v1alpha1.FailurePolicyRestartGroup},
+			},
+			desiredOwners: jobOwner,
+		},
+		{
+			name:     "pod group not owned by the job is left untouched",
+			gvk:      JobGVK,
+			workload: makeJob("job", optIn, pointer.Int32(4), nil),
+			podGroup: &v1alpha1.PodGroup{
+				ObjectMeta: metav1.ObjectMeta{Name: "job", Namespace: "default"},
+				Spec:       v1alpha1.PodGroupSpec{MinMember: 2},
+			},
+			desiredPG:      &v1alpha1.PodGroupSpec{MinMember: 2},
+			desiredMessage: "Warning PodGroupExists PodGroup job already exists and isn't owned by the workload",
+		},
+		{
+			name: "statefulset with replicas",
+			gvk:  statefulSetGVK,
+			workload: &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "sts", Namespace: "default", UID: "sts", Annotations: optIn},
+				Spec: appsv1.StatefulSetSpec{
+					Replicas: pointer.Int32(3),
+					Template: makePodTemplate("1"),
+				},
+			},
+			desiredPG: &v1alpha1.PodGroupSpec{
+				MinMember:    3,
+				MinResources: v1.ResourceList{v1.ResourceCPU: resource.MustParse("3")},
+			},
+			desiredOwners: []metav1.OwnerReference{{
+				APIVersion: "apps/v1", Kind: "StatefulSet", Name: "sts", UID: "sts",
+				Controller: pointer.Bool(true), BlockOwnerDeletion: pointer.Bool(true),
+			}},
+		},
+		{
+			name: "statefulset scaled down to zero replicas",
+			gvk:  statefulSetGVK,
+			workload: &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "sts", Namespace: "default", UID: "sts", Annotations: optIn},
+				Spec: appsv1.StatefulSetSpec{
+					Replicas: pointer.Int32(0),
+					Template: makePodTemplate("1"),
+				},
+			},
+			desiredPG: &v1alpha1.PodGroupSpec{
+				MinMember:    1,
+				MinResources: v1.ResourceList{v1.ResourceCPU: resource.MustParse("1")},
+			},
+			desiredOwners: []metav1.OwnerReference{{
+				APIVersion: "apps/v1", Kind: "StatefulSet", Name: "sts", UID: "sts",
+				Controller: pointer.Bool(true), BlockOwnerDeletion: pointer.Bool(true),
+			}},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := scheme.Scheme
+			s.AddKnownTypes(v1alpha1.SchemeGroupVersion, &v1alpha1.PodGroup{}, &v1alpha1.PodGroupList{})
+			objs := []runtime.Object{c.workload}
+			if c.podGroup != nil {
+				objs = append(objs, c.podGroup)
+			}
+			kClient := fake.NewClientBuilder().WithScheme(s).WithRuntimeObjects(objs...).Build()
+			recorder := record.NewFakeRecorder(3)
+			r := &WorkloadReconciler{
+				Client:   kClient,
+				Scheme:   s,
+				recorder: recorder,
+				GVK:      c.gvk,
+			}
+			obj := c.workload.(metav1.Object)
+			key := types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}
+			if _, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: key}); err != nil {
+				t.Fatal(err)
+			}
+
+			pg := &v1alpha1.PodGroup{}
+			err := kClient.Get(ctx, key, pg)
+			if c.desiredPG == nil {
+				if !apierrs.IsNotFound(err) {
+					t.Errorf("want no pod group, got %v", pg)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else {
+				if !apiequality.Semantic.DeepEqual(pg.Spec, *c.desiredPG) {
+					t.Errorf("want pod group spec %v, got %v", *c.desiredPG, pg.Spec)
+				}
+				if !apiequality.Semantic.DeepEqual(pg.OwnerReferences, c.desiredOwners) {
+					t.Errorf("want owner references %v, got %v", c.desiredOwners, pg.OwnerReferences)
+				}
+			}
+			if len(c.desiredMessage) != 0 {
+				select {
+				case msg := <-recorder.Events:
+					if msg != c.desiredMessage {
+						t.Errorf("want event %q, got %q", c.desiredMessage, msg)
+					}
+				default:
+					t.Errorf("want event %q, got none", c.desiredMessage)
+				}
+			}
+		})
+	}
+}
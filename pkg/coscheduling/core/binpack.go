@@ -0,0 +1,250 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	corev1helpers "k8s.io/component-helpers/scheduling/corev1"
+	"k8s.io/component-helpers/scheduling/corev1/nodeaffinity"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+
+	"sigs.k8s.io/scheduler-plugins/pkg/util"
+)
+
+// SelectMembers returns the pods to place for the PodGroup to reach its quorum: <pod> first, then the
+// pending siblings needed by the roles of the PodGroup, then any pending sibling up to <missing> pods.
+// It returns nil if there are not enough pending pods.
+func SelectMembers(pod *corev1.Pod, siblings []*corev1.Pod, missing int, missingRoles map[string]int) []*corev1.Pod {
+	needed := make(map[string]int, len(missingRoles))
+	for role, n := range missingRoles {
+		needed[role] = n
+	}
+	members := []*corev1.Pod{pod}
+	needed[util.GetPodGroupRole(pod)]--
+	var others []*corev1.Pod
+	for _, sibling := range siblings {
+		if role := util.GetPodGroupRole(sibling); needed[role] > 0 {
+			members = append(members, sibling)
+			needed[role]--
+		} else {
+			others = append(others, sibling)
+		}
+	}
+	for _, n := range needed {
+		if n > 0 {
+			return nil
+		}
+	}
+	for _, sibling := range others {
+		if len(members) >= missing {
+			break
+		}
+		members = append(members, sibling)
+	}
+	if len(members) < missing {
+		return nil
+	}
+	return members
+}
+
+// FitMembers checks whether the given pods can be placed on the nodes altogether. It simulates a
+// first-fit-decreasing bin-pack: the pods, ordered by their dominant share of the cluster allocatable,
+// are placed one by one on the first node (by name) which matches their node selector, node affinity
+// and tolerations and has enough free resources left for their request.
+// It returns an error detailing the resource gap of the first pod which cannot be placed.
+func FitMembers(nodeList []*framework.NodeInfo, pods []*corev1.Pod) error {
+	var nodes []*binpackNode
+	total := &framework.Resource{}
+	for _, info := range nodeList {
+		if info == nil || info.Node() == nil {
+			continue
+		}
+		nodes = append(nodes, &binpackNode{node: info.Node(), free: freeResource(info)})
+		addResource(total, info.Allocatable)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].node.Name < nodes[j].node.Name })
+
+	requests := make(map[*corev1.Pod]*framework.Resource, len(pods))
+	shares := make(map[*corev1.Pod]float64, len(pods))
+	for _, pod := range pods {
+		requests[pod] = podRequest(pod)
+		shares[pod] = dominantShare(requests[pod], total)
+	}
+	ordered := append([]*corev1.Pod(nil), pods...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		if shares[ordered[i]] != shares[ordered[j]] {
+			return shares[ordered[i]] > shares[ordered[j]]
+		}
+		return ordered[i].Name < ordered[j].Name
+	})
+
+	for i, pod := range ordered {
+		request := requests[pod]
+		var eligible []*binpackNode
+		placed := false
+		for _, n := range nodes {
+			if !nodeMatches(pod, n.node) {
+				continue
+			}
+			eligible = append(eligible, n)
+			if fitsResource(request, n.free) {
+				subtractResource(n.free, request)
+				placed = true
+				break
+			}
+		}
+		if placed {
+			continue
+		}
+		if len(eligible) == 0 {
+			return fmt.Errorf("%d of %d members cannot be placed: no node matches the node selector, "+
+				"node affinity and tolerations of pod %v", len(ordered)-i, len(ordered), pod.Name)
+		}
+		return fmt.Errorf("%d of %d members cannot be placed, pod %v: %v", len(ordered)-i, len(ordered), pod.Name,
+			resourceGap(request, eligible))
+	}
+	return nil
+}
+
+// binpackNode is a node along with its resources left during a bin-pack simulation.
+type binpackNode struct {
+	node *corev1.Node
+	free *framework.Resource
+}
+
+// nodeMatches checks whether the pod can be placed on the node regarding its node selector,
+// its required node affinity and the NoSchedule and NoExecute taints of the node.
+func nodeMatches(pod *corev1.Pod, node *corev1.Node) bool {
+	if match, err := nodeaffinity.GetRequiredNodeAffinity(pod).Match(node); err != nil || !match {
+		return false
+	}
+	_, untolerated := corev1helpers.FindMatchingUntoleratedTaint(node.Spec.Taints, pod.Spec.Tolerations, func(t *corev1.Taint) bool {
+		return t.Effect == corev1.TaintEffectNoSchedule || t.Effect == corev1.TaintEffectNoExecute
+	})
+	return !untolerated
+}
+
+// resourceGap describes, for each resource requested by the pod, how much it lacks on the eligible
+// node with the most of that resource left.
+func resourceGap(request *framework.Resource, nodes []*binpackNode) string {
+	free := make(corev1.ResourceList)
+	for _, n := range nodes {
+		for name, quant := range util.ResourceList(n.free) {
+			if current, ok := free[name]; !ok || quant.Cmp(current) > 0 {
+				free[name] = quant
+			}
+		}
+	}
+
+	var gaps []string
+	requested := util.ResourceList(request)
+	for _, name := range sets.List(sets.KeySet(requested)) {
+		quant := requested[name]
+		if quant.IsZero() {
+			continue
+		}
+		quant.Sub(free[name])
+		if quant.Sign() > 0 {
+			gaps = append(gaps, fmt.Sprintf("%v: %v", name, quant.String()))
+		}
+	}
+	if len(gaps) == 0 {
+		return "no node has enough of all the requested resources at once"
+	}
+	return fmt.Sprintf("resource gap on the best node: %v", strings.Join(gaps, ", "))
+}
+
+// podRequest returns the resources requested by the pod, including its overhead and the pod slot.
+func podRequest(pod *corev1.Pod) *framework.Resource {
+	request := framework.NewResource(util.GetPodEffectiveRequest(pod))
+	if pod.Spec.Overhead != nil {
+		request.Add(pod.Spec.Overhead)
+	}
+	request.AllowedPodNumber = 1
+	return request
+}
+
+// freeResource returns the resources left on the node.
+func freeResource(info *framework.NodeInfo) *framework.Resource {
+	free := info.Allocatable.Clone()
+	free.AllowedPodNumber -= len(info.Pods)
+	free.MilliCPU -= info.Requested.MilliCPU
+	free.Memory -= info.Requested.Memory
+	free.EphemeralStorage -= info.Requested.EphemeralStorage
+	for name, quant := range info.Requested.ScalarResources {
+		if free.ScalarResources == nil {
+			free.ScalarResources = make(map[corev1.ResourceName]int64)
+		}
+		free.ScalarResources[name] -= quant
+	}
+	return free
+}
+
+func fitsResource(request, free *framework.Resource) bool {
+	if request.AllowedPodNumber > free.AllowedPodNumber || request.MilliCPU > free.MilliCPU ||
+		request.Memory > free.Memory || request.EphemeralStorage > free.EphemeralStorage {
+		return false
+	}
+	for name, quant := range request.ScalarResources {
+		if quant > free.ScalarResources[name] {
+			return false
+		}
+	}
+	return true
+}
+
+func addResource(r, other *framework.Resource) {
+	r.AllowedPodNumber += other.AllowedPodNumber
+	r.MilliCPU += other.MilliCPU
+	r.Memory += other.Memory
+	r.EphemeralStorage += other.EphemeralStorage
+	for name, quant := range other.ScalarResources {
+		r.AddScalar(name, quant)
+	}
+}
+
+func subtractResource(r, other *framework.Resource) {
+	r.AllowedPodNumber -= other.AllowedPodNumber
+	r.MilliCPU -= other.MilliCPU
+	r.Memory -= other.Memory
+	r.EphemeralStorage -= other.EphemeralStorage
+	for name, quant := range other.ScalarResources {
+		r.AddScalar(name, -quant)
+	}
+}
+
+// dominantShare returns the greatest share of the total amount of a resource that the request asks for.
+func dominantShare(request, total *framework.Resource) float64 {
+	var share float64
+	update := func(req, tot int64) {
+		if tot > 0 && float64(req)/float64(tot) > share {
+			share = float64(req) / float64(tot)
+		}
+	}
+	update(request.MilliCPU, total.MilliCPU)
+	update(request.Memory, total.Memory)
+	update(request.EphemeralStorage, total.EphemeralStorage)
+	for name, quant := range request.ScalarResources {
+		update(quant, total.ScalarResources[name])
+	}
+	return share
+}
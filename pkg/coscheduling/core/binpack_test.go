@@ -0,0 +1,170 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package core
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	st "k8s.io/kubernetes/pkg/scheduler/testing"
+
+	"sigs.k8s.io/scheduler-plugins/apis/scheduling/v1alpha1"
+	tu "sigs.k8s.io/scheduler-plugins/test/util"
+)
+
+func TestFitMembers(t *testing.T) {
+	const gpu corev1.ResourceName = "nvidia.com/gpu"
+	node := func(name, gpus string) *st.NodeWrapper {
+		return st.MakeNode().Name(name).Capacity(map[corev1.ResourceName]string{
+			corev1.ResourceCPU: "8", corev1.ResourcePods: "10", gpu: gpus,
+		})
+	}
+	member := func(name, gpus string) *st.PodWrapper {
+		return st.MakePod().Name(name).Namespace("ns").UID(name).Label(v1alpha1.PodGroupLabel, "pg1").
+			Req(map[corev1.ResourceName]string{corev1.ResourceCPU: "1", gpu: gpus})
+	}
+
+	tests := []struct {
+		name         string
+		nodes        []*corev1.Node
+		existingPods []*corev1.Pod
+		members      []*corev1.Pod
+		wantErr      string
+	}{
+		{
+			name:    "free resources fragmented across the nodes",
+			nodes:   []*corev1.Node{node("node-a", "1").Obj(), node("node-b", "1").Obj(), node("node-c", "1").Obj(), node("node-d", "1").Obj()},
+			members: []*corev1.Pod{member("p1", "2").Obj(), member("p2", "2").Obj()},
+			wantErr: "2 of 2 members cannot be placed, pod p1: resource gap on the best node: nvidia.com/gpu: 1",
+		},
+		{
+			name:    "largest members are placed first",
+			nodes:   []*corev1.Node{node("node-a", "5").Obj(), node("node-b", "5").Obj()},
+			members: []*corev1.Pod{member("p1", "2").Obj(), member("p2", "2").Obj(), member("p3", "3").Obj(), member("p4", "3").Obj()},
+		},
+		{
+			name:  "pods on the nodes are taken into account",
+			nodes: []*corev1.Node{node("node-a", "4").Obj(), node("node-b", "4").Obj()},
+			existingPods: []*corev1.Pod{
+				st.MakePod().Name("other").Namespace("ns").UID("other").Node("node-b").
+					Req(map[corev1.ResourceName]string{gpu: "2"}).Obj(),
+			},
+			members: []*corev1.Pod{member("p1", "4").Obj(), member("p2", "4").Obj()},
+			wantErr: "1 of 2 members cannot be placed, pod p2: resource gap on the best node: nvidia.com/gpu: 2",
+		},
+		{
+			name:    "no node matches the node selector",
+			nodes:   []*corev1.Node{node("node-a", "4").Obj(), node("node-b", "4").Label("zone", "zone1").Obj()},
+			members: []*corev1.Pod{member("p1", "4").Obj(), member("p2", "4").NodeSelector(map[string]string{"zone": "zone2"}).Obj()},
+			wantErr: "1 of 2 members cannot be placed: no node matches the node selector, node affinity and tolerations of pod p2",
+		},
+		{
+			name:    "members are not placed on nodes with untolerated taints",
+			nodes:   []*corev1.Node{node("node-a", "4").Obj(), node("node-b", "4").Taints([]corev1.Taint{{Key: "gpu", Effect: corev1.TaintEffectNoSchedule}}).Obj()},
+			members: []*corev1.Pod{member("p1", "4").Obj(), member("p2", "4").Obj()},
+			wantErr: "1 of 2 members cannot be placed, pod p2: resource gap on the best node: nvidia.com/gpu: 4",
+		},
+		{
+			name:  "members are placed on nodes with tolerated taints",
+			nodes: []*corev1.Node{node("node-a", "4").Obj(), node("node-b", "4").Taints([]corev1.Taint{{Key: "gpu", Effect: corev1.TaintEffectNoSchedule}}).Obj()},
+			members: []*corev1.Pod{
+				member("p1", "4").Toleration("gpu").Obj(),
+				member("p2", "4").Toleration("gpu").Obj(),
+			},
+		},
+		{
+			name: "resources are enough but not on a single node",
+			nodes: []*corev1.Node{
+				node("node-a", "1").Obj(),
+				st.MakeNode().Name("node-b").Capacity(map[corev1.ResourceName]string{corev1.ResourceCPU: "2", corev1.ResourcePods: "10", gpu: "8"}).Obj(),
+			},
+			members: []*corev1.Pod{
+				st.MakePod().Name("p1").Namespace("ns").UID("p1").Label(v1alpha1.PodGroupLabel, "pg1").
+					Req(map[corev1.ResourceName]string{corev1.ResourceCPU: "4", gpu: "4"}).Obj(),
+			},
+			wantErr: "1 of 1 members cannot be placed, pod p1: no node has enough of all the requested resources at once",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nodeInfos, _ := tu.NewFakeSharedLister(tt.existingPods, tt.nodes).NodeInfos().List()
+			var gotErr string
+			if err := FitMembers(nodeInfos, tt.members); err != nil {
+				gotErr = err.Error()
+			}
+			if gotErr != tt.wantErr {
+				t.Errorf("Want error %q, but got %q", tt.wantErr, gotErr)
+			}
+		})
+	}
+}
+
+func TestSelectMembers(t *testing.T) {
+	rolePod := func(name, role string) *corev1.Pod {
+		return st.MakePod().Name(name).Namespace("ns").UID(name).Label(v1alpha1.PodGroupLabel, "pg1").Label(v1alpha1.PodGroupRoleLabel, role).Obj()
+	}
+	pod := rolePod("p", "worker")
+	siblings := []*corev1.Pod{rolePod("w1", "worker"), rolePod("w2", "worker"), rolePod("l1", "launcher")}
+
+	tests := []struct {
+		name         string
+		missing      int
+		missingRoles map[string]int
+		want         []string
+	}{
+		{
+			name:    "pods are taken in order without roles",
+			missing: 2,
+			want:    []string{"p", "w1"},
+		},
+		{
+			name:         "pods needed by the roles come first",
+			missing:      2,
+			missingRoles: map[string]int{"launcher": 1},
+			want:         []string{"p", "l1"},
+		},
+		{
+			name:         "remaining pods fill up the quorum",
+			missing:      3,
+			missingRoles: map[string]int{"launcher": 1, "worker": 1},
+			want:         []string{"p", "l1", "w1"},
+		},
+		{
+			name:         "not enough pods of a role",
+			missing:      3,
+			missingRoles: map[string]int{"launcher": 2},
+		},
+		{
+			name:    "not enough pods",
+			missing: 5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, member := range SelectMembers(pod, siblings, tt.missing, tt.missingRoles) {
+				got = append(got, member.Name)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("Unexpected members (-want, +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -19,6 +19,7 @@ package core
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -26,15 +27,15 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/labels"
-	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
 	informerv1 "k8s.io/client-go/informers/core/v1"
-	listerv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
 	"k8s.io/kubernetes/pkg/scheduler/framework"
-	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"sigs.k8s.io/scheduler-plugins/apis/scheduling/v1alpha1"
+	schedinformer "sigs.k8s.io/scheduler-plugins/pkg/generated/informers/externalversions/scheduling/v1alpha1"
+	listerv1alpha1 "sigs.k8s.io/scheduler-plugins/pkg/generated/listers/scheduling/v1alpha1"
 	"sigs.k8s.io/scheduler-plugins/pkg/util"
 )
 
@@ -50,49 +51,111 @@ const (
 	Wait             Status = "Wait"
 )
 
+// ConditionError is an error preventing a podgroup from being scheduled, along with the reason
+// of the Schedulable condition of the podgroup it's reported with.
+type ConditionError struct {
+	Reason string
+	Err    error
+}
+
+func (e *ConditionError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConditionError) Unwrap() error {
+	return e.Err
+}
+
+func newConditionError(reason string, err error) error {
+	return &ConditionError{Reason: reason, Err: err}
+}
+
+// podGroupIndex is the name of the pod informer index from the namespaced name of a PodGroup to its pods.
+const podGroupIndex = "podGroup"
+
 // Manager defines the interfaces for PodGroup management.
 type Manager interface {
 	PreFilter(context.Context, *corev1.Pod) error
 	Permit(context.Context, *corev1.Pod) Status
 	GetPodGroup(context.Context, *corev1.Pod) (string, *v1alpha1.PodGroup)
 	GetCreationTimestamp(*corev1.Pod, time.Time) time.Time
-	DeletePermittedPodGroup(string)
-	CalculateAssignedPods(string, string) int
+	CalculateAssignedPods(string, string) (int, map[string]int)
 	ActivateSiblings(pod *corev1.Pod, state *framework.CycleState)
 	BackoffPodGroup(string, time.Duration)
+	GetPendingSiblings(*corev1.Pod) ([]*corev1.Pod, error)
+	GetTopologyDomain(string) (string, string)
+	SkipTopologyDomain(string, string)
 }
 
 // PodGroupManager defines the scheduling operation called
 type PodGroupManager struct {
-	// client is a generic controller-runtime client to manipulate both core resources and PodGroups.
-	client client.Client
+	// pgLister is podgroup lister
+	pgLister listerv1alpha1.PodGroupLister
 	// snapshotSharedLister is pod shared list
 	snapshotSharedLister framework.SharedLister
 	// scheduleTimeout is the default timeout for podgroup scheduling.
 	// If podgroup's scheduleTimeoutSeconds is set, it will be used.
 	scheduleTimeout *time.Duration
-	// permittedPG stores the podgroup name which has passed the pre resource check.
-	permittedPG *gochache.Cache
 	// backedOffPG stores the podgorup name which failed scheudling recently.
 	backedOffPG *gochache.Cache
-	// podLister is pod lister
-	podLister listerv1.PodLister
+	// podIndexer is the pod informer indexer, indexing the pods by their podgroup.
+	podIndexer cache.Indexer
+	// topologyDomains stores the topology domain selection of the podgroups with a topologyConstraint.
+	topologyDomains map[string]*topologyDomains
 	sync.RWMutex
 }
 
+// topologyDomains records the topology domain selected for a podgroup and the domains
+// the podgroup failed to be scheduled in.
+type topologyDomains struct {
+	topologyKey string
+	selected    string
+	tried       sets.Set[string]
+}
+
 // NewPodGroupManager creates a new operation object.
-func NewPodGroupManager(client client.Client, snapshotSharedLister framework.SharedLister, scheduleTimeout *time.Duration, podInformer informerv1.PodInformer) *PodGroupManager {
+// The podgroup index is added to the pod informer, which must not be started yet.
+func NewPodGroupManager(snapshotSharedLister framework.SharedLister, scheduleTimeout *time.Duration,
+	podInformer informerv1.PodInformer, pgInformer schedinformer.PodGroupInformer) *PodGroupManager {
+	podIndexer := podInformer.Informer().GetIndexer()
+	if _, ok := podIndexer.GetIndexers()[podGroupIndex]; !ok {
+		if err := podInformer.Informer().AddIndexers(cache.Indexers{podGroupIndex: podGroupIndexFunc}); err != nil {
+			klog.ErrorS(err, "Failed to add the podgroup index to the pod informer")
+		}
+	}
 	pgMgr := &PodGroupManager{
-		client:               client,
 		snapshotSharedLister: snapshotSharedLister,
 		scheduleTimeout:      scheduleTimeout,
-		podLister:            podInformer.Lister(),
-		permittedPG:          gochache.New(3*time.Second, 3*time.Second),
+		pgLister:             pgInformer.Lister(),
+		podIndexer:           podIndexer,
 		backedOffPG:          gochache.New(10*time.Second, 10*time.Second),
 	}
+	// The topology domains of a podgroup deleted before reaching its quorum are forgotten along with it.
+	pgInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		DeleteFunc: pgMgr.deletePodGroup,
+	})
 	return pgMgr
 }
 
+// deletePodGroup forgets the topology domain selection of the deleted podgroup.
+func (pgMgr *PodGroupManager) deletePodGroup(obj interface{}) {
+	var pg *v1alpha1.PodGroup
+	switch t := obj.(type) {
+	case *v1alpha1.PodGroup:
+		pg = t
+	case cache.DeletedFinalStateUnknown:
+		var ok bool
+		if pg, ok = t.Obj.(*v1alpha1.PodGroup); !ok {
+			return
+		}
+	default:
+		return
+	}
+	pgMgr.Lock()
+	defer pgMgr.Unlock()
+	delete(pgMgr.topologyDomains, GetNamespacedName(pg))
+}
+
 func (pgMgr *PodGroupManager) BackoffPodGroup(pgName string, backoff time.Duration) {
 	if backoff == time.Duration(0) {
 		return
@@ -108,9 +171,7 @@ func (pgMgr *PodGroupManager) ActivateSiblings(pod *corev1.Pod, state *framework
 		return
 	}
 
-	pods, err := pgMgr.podLister.Pods(pod.Namespace).List(
-		labels.SelectorFromSet(labels.Set{v1alpha1.PodGroupLabel: pgName}),
-	)
+	pods, err := pgMgr.listPodGroupPods(pod.Namespace, pgName)
 	if err != nil {
 		klog.ErrorS(err, "Failed to obtain pods belong to a PodGroup", "podGroup", pgName)
 		return
@@ -137,10 +198,36 @@ func (pgMgr *PodGroupManager) ActivateSiblings(pod *corev1.Pod, state *framework
 	}
 }
 
+// GetPendingSiblings returns the pods belonging to the same PodGroup of the given pod
+// which are not assigned to a node yet, sorted by name. The given pod is not included.
+func (pgMgr *PodGroupManager) GetPendingSiblings(pod *corev1.Pod) ([]*corev1.Pod, error) {
+	pgName := util.GetPodGroupLabel(pod)
+	if pgName == "" {
+		return nil, nil
+	}
+
+	pods, err := pgMgr.listPodGroupPods(pod.Namespace, pgName)
+	if err != nil {
+		return nil, err
+	}
+
+	var siblings []*corev1.Pod
+	for _, p := range pods {
+		if p.UID == pod.UID || p.Spec.NodeName != "" || p.DeletionTimestamp != nil {
+			continue
+		}
+		siblings = append(siblings, p)
+	}
+	sort.Slice(siblings, func(i, j int) bool { return siblings[i].Name < siblings[j].Name })
+	return siblings, nil
+}
+
 // PreFilter filters out a pod if
 // 1. it belongs to a podgroup that was recently denied or
-// 2. the total number of pods in the podgroup is less than the minimum number of pods
+// 2. the podgroup already has maxMember pods scheduled or
+// 3. the total number of pods in the podgroup, or in one of its roles, is less than the minimum number of pods
 // that is required to be scheduled.
+// Once the quorum of the podgroup is reached, the pods beyond it are scheduled individually.
 func (pgMgr *PodGroupManager) PreFilter(ctx context.Context, pod *corev1.Pod) error {
 	klog.V(5).InfoS("Pre-filter", "pod", klog.KObj(pod))
 	pgFullName, pg := pgMgr.GetPodGroup(ctx, pod)
@@ -149,46 +236,80 @@ func (pgMgr *PodGroupManager) PreFilter(ctx context.Context, pod *corev1.Pod) er
 	}
 
 	if _, exist := pgMgr.backedOffPG.Get(pgFullName); exist {
-		return fmt.Errorf("podGroup %v failed recently", pgFullName)
+		return newConditionError(v1alpha1.PodGroupReasonBackedOff, fmt.Errorf("podGroup %v failed recently", pgFullName))
 	}
 
-	pods, err := pgMgr.podLister.Pods(pod.Namespace).List(
-		labels.SelectorFromSet(labels.Set{v1alpha1.PodGroupLabel: util.GetPodGroupLabel(pod)}),
-	)
+	assigned, assignedRoles := pgMgr.CalculateAssignedPods(pg.Name, pg.Namespace)
+	if pg.Spec.MaxMember != nil && assigned >= int(*pg.Spec.MaxMember) {
+		return fmt.Errorf("podGroup %v already has maxMember %v pods scheduled", pgFullName, *pg.Spec.MaxMember)
+	}
+	missing, missingRoles := MissingMembers(pg, assigned, assignedRoles)
+	if missing == 0 {
+		return pgMgr.selectTopologyDomain(pod, pg, pgFullName)
+	}
+
+	pods, err := pgMgr.listPodGroupPods(pod.Namespace, pg.Name)
 	if err != nil {
-		return fmt.Errorf("podLister list pods failed: %w", err)
+		return fmt.Errorf("podIndexer list pods failed: %w", err)
 	}
 
 	if len(pods) < int(pg.Spec.MinMember) {
-		return fmt.Errorf("pre-filter pod %v cannot find enough sibling pods, "+
-			"current pods number: %v, minMember of group: %v", pod.Name, len(pods), pg.Spec.MinMember)
+		return newConditionError(v1alpha1.PodGroupReasonNotEnoughMembers, fmt.Errorf("pre-filter pod %v cannot find enough sibling pods, "+
+			"current pods number: %v, minMember of group: %v", pod.Name, len(pods), pg.Spec.MinMember))
 	}
 
-	if pg.Spec.MinResources == nil {
-		return nil
+	if len(pg.Spec.Roles) != 0 {
+		podsPerRole := make(map[string]int)
+		for _, p := range pods {
+			podsPerRole[util.GetPodGroupRole(p)]++
+		}
+		for _, role := range pg.Spec.Roles {
+			if podsPerRole[role.Name] < int(role.MinMember) {
+				return newConditionError(v1alpha1.PodGroupReasonNotEnoughMembers, fmt.Errorf("pre-filter pod %v cannot find enough sibling pods of role %v, "+
+					"current pods number: %v, minMember of role: %v", pod.Name, role.Name, podsPerRole[role.Name], role.MinMember))
+			}
+		}
 	}
 
-	// TODO(cwdsuzhou): This resource check may not always pre-catch unschedulable pod group.
-	// It only tries to PreFilter resource constraints so even if a PodGroup passed here,
-	// it may not necessarily pass Filter due to other constraints such as affinity/taints.
-	if _, ok := pgMgr.permittedPG.Get(pgFullName); ok {
-		return nil
+	if err := pgMgr.checkGroupResources(pod, pg, pgFullName, missing, missingRoles); err != nil {
+		return err
 	}
+	return pgMgr.selectTopologyDomain(pod, pg, pgFullName)
+}
 
+// checkGroupResources checks whether the cluster has enough resources to run the podgroup: its minResources
+// in total if any, and the missing members altogether given the request of each of them.
+func (pgMgr *PodGroupManager) checkGroupResources(pod *corev1.Pod, pg *v1alpha1.PodGroup, pgFullName string,
+	missing int, missingRoles map[string]int) error {
+	// TODO(cwdsuzhou): This resource check may not always pre-catch unschedulable pod group.
+	// It only tries to PreFilter resource constraints so even if a PodGroup passed here,
+	// it may not necessarily pass Filter due to other constraints such as inter-pod affinity.
+	// The check isn't cached across the members: every member assumed on a node changes the snapshot.
 	nodes, err := pgMgr.snapshotSharedLister.NodeInfos().List()
 	if err != nil {
 		return err
 	}
 
-	minResources := pg.Spec.MinResources.DeepCopy()
-	podQuantity := resource.NewQuantity(int64(pg.Spec.MinMember), resource.DecimalSI)
-	minResources[corev1.ResourcePods] = *podQuantity
-	err = CheckClusterResource(nodes, minResources, pgFullName)
+	if minResources := util.GetMinResources(pg); minResources != nil {
+		if err := CheckClusterResource(nodes, minResources, pgFullName); err != nil {
+			klog.ErrorS(err, "Failed to PreFilter", "podGroup", klog.KObj(pg))
+			return newConditionError(v1alpha1.PodGroupReasonInsufficientResources, err)
+		}
+	}
+
+	siblings, err := pgMgr.GetPendingSiblings(pod)
 	if err != nil {
-		klog.ErrorS(err, "Failed to PreFilter", "podGroup", klog.KObj(pg))
 		return err
 	}
-	pgMgr.permittedPG.Add(pgFullName, pgFullName, *pgMgr.scheduleTimeout)
+	members := SelectMembers(pod, siblings, missing, missingRoles)
+	if members == nil {
+		return newConditionError(v1alpha1.PodGroupReasonNotEnoughMembers,
+			fmt.Errorf("pre-filter pod %v cannot find enough pending sibling pods, missing members: %v", pod.Name, missing))
+	}
+	if err := FitMembers(nodes, members); err != nil {
+		klog.ErrorS(err, "Failed to PreFilter", "podGroup", klog.KObj(pg))
+		return newConditionError(v1alpha1.PodGroupReasonInsufficientResources, fmt.Errorf("podGroup %v cannot be placed: %w", pgFullName, err))
+	}
 	return nil
 }
 
@@ -203,10 +324,15 @@ func (pgMgr *PodGroupManager) Permit(ctx context.Context, pod *corev1.Pod) Statu
 		return PodGroupNotFound
 	}
 
-	assigned := pgMgr.CalculateAssignedPods(pg.Name, pg.Namespace)
+	assigned, assignedRoles := pgMgr.CalculateAssignedPods(pg.Name, pg.Namespace)
 	// The number of pods that have been assigned nodes is calculated from the snapshot.
 	// The current pod in not included in the snapshot during the current scheduling cycle.
-	if int32(assigned)+1 >= pg.Spec.MinMember {
+	assignedRoles[util.GetPodGroupRole(pod)]++
+	if missing, _ := MissingMembers(pg, assigned+1, assignedRoles); missing == 0 {
+		// The domain is decided by the assigned pods from now on.
+		pgMgr.Lock()
+		delete(pgMgr.topologyDomains, pgFullName)
+		pgMgr.Unlock()
 		return Success
 	}
 	return Wait
@@ -218,37 +344,172 @@ func (pgMgr *PodGroupManager) GetCreationTimestamp(pod *corev1.Pod, ts time.Time
 	if len(pgName) == 0 {
 		return ts
 	}
-	var pg v1alpha1.PodGroup
-	if err := pgMgr.client.Get(context.TODO(), types.NamespacedName{Namespace: pod.Namespace, Name: pgName}, &pg); err != nil {
+	pg, err := pgMgr.pgLister.PodGroups(pod.Namespace).Get(pgName)
+	if err != nil {
 		return ts
 	}
 	return pg.CreationTimestamp.Time
 }
 
-// DeletePermittedPodGroup deletes a podGroup that passes Pre-Filter but reaches PostFilter.
-func (pgMgr *PodGroupManager) DeletePermittedPodGroup(pgFullName string) {
-	pgMgr.permittedPG.Delete(pgFullName)
+// GetTopologyDomain returns the topology key and the topology domain selected in PreFilter for the podgroup.
+// The domain is empty if the podgroup is not pinned to any domain.
+func (pgMgr *PodGroupManager) GetTopologyDomain(pgFullName string) (string, string) {
+	pgMgr.RLock()
+	defer pgMgr.RUnlock()
+	domains, ok := pgMgr.topologyDomains[pgFullName]
+	if !ok {
+		return "", ""
+	}
+	return domains.topologyKey, domains.selected
+}
+
+// SkipTopologyDomain marks the topology domain as tried for the podgroup, so that the next
+// scheduling attempts of the podgroup move on to the next domain.
+func (pgMgr *PodGroupManager) SkipTopologyDomain(pgFullName, domain string) {
+	pgMgr.Lock()
+	defer pgMgr.Unlock()
+	domains, ok := pgMgr.topologyDomains[pgFullName]
+	if !ok {
+		return
+	}
+	domains.tried.Insert(domain)
+	if domains.selected == domain {
+		domains.selected = ""
+	}
+}
+
+// selectTopologyDomain selects the topology domain the members of the podgroup are pinned to.
+// The domain holding most of the members already assigned is kept. Otherwise, the first domain
+// (by name) which the podgroup didn't fail in yet and has enough resources for the whole group
+// is selected; when all such domains were tried, it starts over.
+// It returns an error if the topologyConstraint is required and no domain can accommodate the podgroup.
+func (pgMgr *PodGroupManager) selectTopologyDomain(pod *corev1.Pod, pg *v1alpha1.PodGroup, pgFullName string) error {
+	pgMgr.Lock()
+	defer pgMgr.Unlock()
+	constraint := pg.Spec.TopologyConstraint
+	if constraint == nil {
+		delete(pgMgr.topologyDomains, pgFullName)
+		return nil
+	}
+
+	nodes, err := pgMgr.snapshotSharedLister.NodeInfos().List()
+	if err != nil {
+		return err
+	}
+	domainNodes := make(map[string][]*framework.NodeInfo)
+	assigned := make(map[string]int)
+	for _, nodeInfo := range nodes {
+		if nodeInfo.Node() == nil {
+			continue
+		}
+		domain, ok := nodeInfo.Node().Labels[constraint.TopologyKey]
+		if !ok {
+			continue
+		}
+		domainNodes[domain] = append(domainNodes[domain], nodeInfo)
+		for _, podInfo := range nodeInfo.Pods {
+			if util.GetPodGroupFullName(podInfo.Pod) == pgFullName {
+				assigned[domain]++
+			}
+		}
+	}
+
+	if pgMgr.topologyDomains == nil {
+		pgMgr.topologyDomains = make(map[string]*topologyDomains)
+	}
+	domains, ok := pgMgr.topologyDomains[pgFullName]
+	if !ok || domains.topologyKey != constraint.TopologyKey {
+		domains = &topologyDomains{topologyKey: constraint.TopologyKey, tried: sets.New[string]()}
+		pgMgr.topologyDomains[pgFullName] = domains
+	}
+	domains.selected = ""
+
+	required := constraint.Mode != v1alpha1.TopologyConstraintPreferred
+	request := groupResourceRequest(pod, pg)
+	fits := func(domain string) bool {
+		return CheckClusterResource(domainNodes[domain], request.DeepCopy(), pgFullName) == nil
+	}
+
+	if domain := mostAssignedDomain(assigned); domain != "" {
+		if required || fits(domain) {
+			domains.selected = domain
+		}
+		return nil
+	}
+
+	names := sets.List(sets.KeySet(domainNodes))
+	for _, domain := range names {
+		if !domains.tried.Has(domain) && fits(domain) {
+			domains.selected = domain
+			return nil
+		}
+	}
+	for _, domain := range names {
+		if domains.tried.Has(domain) && fits(domain) {
+			// All the domains which can accommodate the podgroup were tried, start over.
+			domains.tried = sets.New[string]()
+			domains.selected = domain
+			return nil
+		}
+	}
+
+	if !required {
+		return nil
+	}
+	return newConditionError(v1alpha1.PodGroupReasonInsufficientResources,
+		fmt.Errorf("no topology domain of %q can accommodate podGroup %v", constraint.TopologyKey, pgFullName))
 }
 
 // GetPodGroup returns the PodGroup that a Pod belongs to in cache.
+// The returned PodGroup is shared with the informer cache and must not be modified.
 func (pgMgr *PodGroupManager) GetPodGroup(ctx context.Context, pod *corev1.Pod) (string, *v1alpha1.PodGroup) {
 	pgName := util.GetPodGroupLabel(pod)
 	if len(pgName) == 0 {
 		return "", nil
 	}
-	var pg v1alpha1.PodGroup
-	if err := pgMgr.client.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: pgName}, &pg); err != nil {
+	pg, err := pgMgr.pgLister.PodGroups(pod.Namespace).Get(pgName)
+	if err != nil {
 		return fmt.Sprintf("%v/%v", pod.Namespace, pgName), nil
 	}
-	return fmt.Sprintf("%v/%v", pod.Namespace, pgName), &pg
+	return fmt.Sprintf("%v/%v", pod.Namespace, pgName), pg
+}
+
+// listPodGroupPods returns the pods belonging to the given podgroup from the pod informer index.
+func (pgMgr *PodGroupManager) listPodGroupPods(namespace, pgName string) ([]*corev1.Pod, error) {
+	objs, err := pgMgr.podIndexer.ByIndex(podGroupIndex, fmt.Sprintf("%v/%v", namespace, pgName))
+	if err != nil {
+		return nil, err
+	}
+	pods := make([]*corev1.Pod, 0, len(objs))
+	for _, obj := range objs {
+		if pod, ok := obj.(*corev1.Pod); ok {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
+
+// podGroupIndexFunc indexes the pods by the namespaced name of their podgroup.
+func podGroupIndexFunc(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return nil, nil
+	}
+	pgFullName := util.GetPodGroupFullName(pod)
+	if pgFullName == "" {
+		return nil, nil
+	}
+	return []string{pgFullName}, nil
 }
 
-// CalculateAssignedPods returns the number of pods that has been assigned nodes: assumed or bound.
-func (pgMgr *PodGroupManager) CalculateAssignedPods(podGroupName, namespace string) int {
+// CalculateAssignedPods returns the number of pods that has been assigned nodes: assumed or bound,
+// along with the number of them per role.
+func (pgMgr *PodGroupManager) CalculateAssignedPods(podGroupName, namespace string) (int, map[string]int) {
+	roles := make(map[string]int)
 	nodeInfos, err := pgMgr.snapshotSharedLister.NodeInfos().List()
 	if err != nil {
 		klog.ErrorS(err, "Cannot get nodeInfos from frameworkHandle")
-		return 0
+		return 0, roles
 	}
 	var count int
 	for _, nodeInfo := range nodeInfos {
@@ -256,11 +517,33 @@ func (pgMgr *PodGroupManager) CalculateAssignedPods(podGroupName, namespace stri
 			pod := podInfo.Pod
 			if util.GetPodGroupLabel(pod) == podGroupName && pod.Namespace == namespace && pod.Spec.NodeName != "" {
 				count++
+				roles[util.GetPodGroupRole(pod)]++
 			}
 		}
 	}
 
-	return count
+	return count, roles
+}
+
+// MissingMembers returns the number of pods missing for the podgroup to reach its quorum, given the
+// number of pods assigned in total and per role, along with the number of pods missing per role.
+func MissingMembers(pg *v1alpha1.PodGroup, assigned int, assignedRoles map[string]int) (int, map[string]int) {
+	missingRoles := make(map[string]int)
+	var missingInRoles int
+	for _, role := range pg.Spec.Roles {
+		if missing := int(role.MinMember) - assignedRoles[role.Name]; missing > 0 {
+			missingRoles[role.Name] = missing
+			missingInRoles += missing
+		}
+	}
+	missing := int(pg.Spec.MinMember) - assigned
+	if missing < missingInRoles {
+		missing = missingInRoles
+	}
+	if missing < 0 {
+		missing = 0
+	}
+	return missing, missingRoles
 }
 
 // CheckClusterResource checks if resource capacity of the cluster can satisfy <resourceRequest>.
@@ -292,6 +575,32 @@ func GetNamespacedName(obj metav1.Object) string {
 	return fmt.Sprintf("%v/%v", obj.GetNamespace(), obj.GetName())
 }
 
+// mostAssignedDomain returns the domain with the most assigned pods, the first one by name on a tie.
+func mostAssignedDomain(assigned map[string]int) string {
+	var result string
+	for _, domain := range sets.List(sets.KeySet(assigned)) {
+		if result == "" || assigned[domain] > assigned[result] {
+			result = domain
+		}
+	}
+	return result
+}
+
+// groupResourceRequest returns the resources required to run the minMember pods of the podgroup:
+// its minResources if specified, otherwise the request of the given pod times minMember.
+func groupResourceRequest(pod *corev1.Pod, pg *v1alpha1.PodGroup) corev1.ResourceList {
+	if minResources := util.GetMinResources(pg); minResources != nil {
+		return minResources
+	}
+	minMember := int64(util.GetMinMember(pg))
+	request := make(corev1.ResourceList)
+	for name, quant := range util.GetPodEffectiveRequest(pod) {
+		request[name] = *resource.NewMilliQuantity(quant.MilliValue()*minMember, quant.Format)
+	}
+	request[corev1.ResourcePods] = *resource.NewQuantity(minMember, resource.DecimalSI)
+	return request
+}
+
 func getNodeResource(info *framework.NodeInfo, desiredPodGroupName string) *framework.Resource {
 	nodeClone := info.Clone()
 	for _, podInfo := range info.Pods {
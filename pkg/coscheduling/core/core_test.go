@@ -18,13 +18,14 @@ package core
 
 import (
 	"context"
+	"reflect"
 	"testing"
 	"time"
 
 	gochache "github.com/patrickmn/go-cache"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
-	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/informers"
 	clientsetfake "k8s.io/client-go/kubernetes/fake"
 	clicache "k8s.io/client-go/tools/cache"
@@ -48,6 +49,7 @@ func TestPreFilter(t *testing.T) {
 		pod             *corev1.Pod
 		pendingPods     []*corev1.Pod
 		pgs             []*v1alpha1.PodGroup
+		fragmentingPods []*corev1.Pod
 		expectedSuccess bool
 	}{
 		{
@@ -123,6 +125,69 @@ func TestPreFilter(t *testing.T) {
 			},
 			expectedSuccess: true,
 		},
+		{
+			// 4 cpus are left in total, 2 on each node, so that the members requesting 3 cpus cannot be placed.
+			name: "cluster's resource satisfies minResource but is fragmented",
+			pod: st.MakePod().Name("p1a").Namespace("ns").UID("p1a").Label(v1alpha1.PodGroupLabel, "pg1").
+				Req(map[corev1.ResourceName]string{corev1.ResourceCPU: "3"}).Obj(),
+			pendingPods: []*corev1.Pod{
+				st.MakePod().Name("p1a").Namespace("ns").UID("p1a").Label(v1alpha1.PodGroupLabel, "pg1").
+					Req(map[corev1.ResourceName]string{corev1.ResourceCPU: "3"}).Obj(),
+				st.MakePod().Name("p1b").Namespace("ns").UID("p1b").Label(v1alpha1.PodGroupLabel, "pg1").
+					Req(map[corev1.ResourceName]string{corev1.ResourceCPU: "3"}).Obj(),
+				st.MakePod().Name("x1").Namespace("ns").UID("x1").Node("node-a").
+					Req(map[corev1.ResourceName]string{corev1.ResourceCPU: "2"}).Obj(),
+				st.MakePod().Name("x2").Namespace("ns").UID("x2").Node("node-b").
+					Req(map[corev1.ResourceName]string{corev1.ResourceCPU: "2"}).Obj(),
+			},
+			pgs: []*v1alpha1.PodGroup{
+				tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(2).
+					MinResources(map[corev1.ResourceName]string{corev1.ResourceCPU: "4"}).Obj(),
+			},
+			expectedSuccess: false,
+		},
+		{
+			// The members are bin-packed even if the pod group doesn't define minResources.
+			name: "cluster is fragmented for a pod group without minResources",
+			pod: st.MakePod().Name("p1a").Namespace("ns").UID("p1a").Label(v1alpha1.PodGroupLabel, "pg1").
+				Req(map[corev1.ResourceName]string{corev1.ResourceCPU: "3"}).Obj(),
+			pendingPods: []*corev1.Pod{
+				st.MakePod().Name("p1a").Namespace("ns").UID("p1a").Label(v1alpha1.PodGroupLabel, "pg1").
+					Req(map[corev1.ResourceName]string{corev1.ResourceCPU: "3"}).Obj(),
+				st.MakePod().Name("p1b").Namespace("ns").UID("p1b").Label(v1alpha1.PodGroupLabel, "pg1").
+					Req(map[corev1.ResourceName]string{corev1.ResourceCPU: "3"}).Obj(),
+				st.MakePod().Name("x1").Namespace("ns").UID("x1").Node("node-a").
+					Req(map[corev1.ResourceName]string{corev1.ResourceCPU: "2"}).Obj(),
+				st.MakePod().Name("x2").Namespace("ns").UID("x2").Node("node-b").
+					Req(map[corev1.ResourceName]string{corev1.ResourceCPU: "2"}).Obj(),
+			},
+			pgs: []*v1alpha1.PodGroup{
+				tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(2).Obj(),
+			},
+			expectedSuccess: false,
+		},
+		{
+			// The members fit at first, the pods assigned afterwards leave 2 cpus on each node.
+			name: "pod group is bin-packed again once the cluster gets fragmented",
+			pod: st.MakePod().Name("p1a").Namespace("ns").UID("p1a").Label(v1alpha1.PodGroupLabel, "pg1").
+				Req(map[corev1.ResourceName]string{corev1.ResourceCPU: "3"}).Obj(),
+			pendingPods: []*corev1.Pod{
+				st.MakePod().Name("p1a").Namespace("ns").UID("p1a").Label(v1alpha1.PodGroupLabel, "pg1").
+					Req(map[corev1.ResourceName]string{corev1.ResourceCPU: "3"}).Obj(),
+				st.MakePod().Name("p1b").Namespace("ns").UID("p1b").Label(v1alpha1.PodGroupLabel, "pg1").
+					Req(map[corev1.ResourceName]string{corev1.ResourceCPU: "3"}).Obj(),
+			},
+			pgs: []*v1alpha1.PodGroup{
+				tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(2).Obj(),
+			},
+			fragmentingPods: []*corev1.Pod{
+				st.MakePod().Name("x1").Namespace("ns").UID("x1").Node("node-a").
+					Req(map[corev1.ResourceName]string{corev1.ResourceCPU: "2"}).Obj(),
+				st.MakePod().Name("x2").Namespace("ns").UID("x2").Node("node-b").
+					Req(map[corev1.ResourceName]string{corev1.ResourceCPU: "2"}).Obj(),
+			},
+			expectedSuccess: true,
+		},
 		{
 			// Previously we defined 2 nodes, each with 4 cpus. Now the PodGroup's minResources req is 10 cpus.
 			name: "cluster's resource cannot satisfy minResource",
@@ -137,6 +202,70 @@ func TestPreFilter(t *testing.T) {
 			},
 			expectedSuccess: false,
 		},
+		{
+			name: "pod count of a role less than its minMember",
+			pod:  st.MakePod().Name("p1a").Namespace("ns").UID("p1a").Label(v1alpha1.PodGroupLabel, "pg1").Label(v1alpha1.PodGroupRoleLabel, "worker").Obj(),
+			pendingPods: []*corev1.Pod{
+				st.MakePod().Name("p1b").Namespace("ns").UID("p1b").Label(v1alpha1.PodGroupLabel, "pg1").Label(v1alpha1.PodGroupRoleLabel, "worker").Obj(),
+				st.MakePod().Name("p1c").Namespace("ns").UID("p1c").Label(v1alpha1.PodGroupLabel, "pg1").Label(v1alpha1.PodGroupRoleLabel, "worker").Obj(),
+			},
+			pgs: []*v1alpha1.PodGroup{
+				tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(2).Role("launcher", 1, nil).Role("worker", 1, nil).Obj(),
+			},
+			expectedSuccess: false,
+		},
+		{
+			name: "pod count of every role equal its minMember",
+			pod:  st.MakePod().Name("p1a").Namespace("ns").UID("p1a").Label(v1alpha1.PodGroupLabel, "pg1").Label(v1alpha1.PodGroupRoleLabel, "worker").Obj(),
+			pendingPods: []*corev1.Pod{
+				st.MakePod().Name("p1b").Namespace("ns").UID("p1b").Label(v1alpha1.PodGroupLabel, "pg1").Label(v1alpha1.PodGroupRoleLabel, "launcher").Obj(),
+				st.MakePod().Name("p1c").Namespace("ns").UID("p1c").Label(v1alpha1.PodGroupLabel, "pg1").Label(v1alpha1.PodGroupRoleLabel, "worker").Obj(),
+			},
+			pgs: []*v1alpha1.PodGroup{
+				tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(2).Role("launcher", 1, nil).Role("worker", 1, nil).Obj(),
+			},
+			expectedSuccess: true,
+		},
+		{
+			// Previously we defined 2 nodes, each with 4 cpus. Now the roles' minResources req is 9 cpus in total.
+			name: "cluster's resource cannot satisfy minResources of the roles",
+			pod:  st.MakePod().Name("p1a").Namespace("ns").UID("p1a").Label(v1alpha1.PodGroupLabel, "pg1").Label(v1alpha1.PodGroupRoleLabel, "worker").Obj(),
+			pendingPods: []*corev1.Pod{
+				st.MakePod().Name("p1b").Namespace("ns").UID("p1b").Label(v1alpha1.PodGroupLabel, "pg1").Label(v1alpha1.PodGroupRoleLabel, "launcher").Obj(),
+			},
+			pgs: []*v1alpha1.PodGroup{
+				tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(2).
+					Role("launcher", 1, map[corev1.ResourceName]string{corev1.ResourceCPU: "1"}).
+					Role("worker", 1, map[corev1.ResourceName]string{corev1.ResourceCPU: "8"}).Obj(),
+			},
+			expectedSuccess: false,
+		},
+		{
+			name: "pod group already has maxMember pods scheduled",
+			pod:  st.MakePod().Name("p1a").Namespace("ns").UID("p1a").Label(v1alpha1.PodGroupLabel, "pg1").Obj(),
+			pendingPods: []*corev1.Pod{
+				st.MakePod().Name("p1b").Namespace("ns").UID("p1b").Label(v1alpha1.PodGroupLabel, "pg1").Node("node-a").Obj(),
+				st.MakePod().Name("p1c").Namespace("ns").UID("p1c").Label(v1alpha1.PodGroupLabel, "pg1").Node("node-a").Obj(),
+			},
+			pgs: []*v1alpha1.PodGroup{
+				tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(1).MaxMember(2).Obj(),
+			},
+			expectedSuccess: false,
+		},
+		{
+			// The minResources of the pod group cannot be satisfied anymore, but its quorum is already reached.
+			name: "pod beyond the quorum is scheduled individually",
+			pod:  st.MakePod().Name("p1a").Namespace("ns").UID("p1a").Label(v1alpha1.PodGroupLabel, "pg1").Obj(),
+			pendingPods: []*corev1.Pod{
+				st.MakePod().Name("p1b").Namespace("ns").UID("p1b").Label(v1alpha1.PodGroupLabel, "pg1").Node("node-a").Obj(),
+				st.MakePod().Name("p1c").Namespace("ns").UID("p1c").Label(v1alpha1.PodGroupLabel, "pg1").Node("node-a").Obj(),
+			},
+			pgs: []*v1alpha1.PodGroup{
+				tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(2).MaxMember(3).
+					MinResources(map[corev1.ResourceName]string{corev1.ResourceCPU: "10"}).Obj(),
+			},
+			expectedSuccess: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -144,32 +273,12 @@ func TestPreFilter(t *testing.T) {
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
 
-			// Compile all objects into `objs`.
-			var objs []runtime.Object
-			for _, pod := range append(tt.pendingPods, tt.pod) {
-				objs = append(objs, pod)
-			}
-			for _, pg := range tt.pgs {
-				objs = append(objs, pg)
-			}
-
-			client, err := tu.NewFakeClient(objs...)
-			if err != nil {
-				t.Fatal(err)
-			}
-
 			cs := clientsetfake.NewSimpleClientset()
 			informerFactory := informers.NewSharedInformerFactory(cs, 0)
 			podInformer := informerFactory.Core().V1().Pods()
 
-			pgMgr := &PodGroupManager{
-				client:               client,
-				snapshotSharedLister: tu.NewFakeSharedLister(tt.pendingPods, nodes),
-				podLister:            podInformer.Lister(),
-				scheduleTimeout:      &scheduleTimeout,
-				permittedPG:          newCache(),
-				backedOffPG:          newCache(),
-			}
+			snapshot := tu.NewFakeSharedLister(tt.pendingPods, nodes)
+			pgMgr := NewPodGroupManager(snapshot, &scheduleTimeout, podInformer, tu.NewPodGroupInformer(tt.pgs...))
 
 			informerFactory.Start(ctx.Done())
 			if !clicache.WaitForCacheSync(ctx.Done(), podInformer.Informer().HasSynced) {
@@ -179,10 +288,22 @@ func TestPreFilter(t *testing.T) {
 				podInformer.Informer().GetStore().Add(p)
 			}
 
-			err = pgMgr.PreFilter(ctx, tt.pod)
+			err := pgMgr.PreFilter(ctx, tt.pod)
 			if (err == nil) != tt.expectedSuccess {
 				t.Errorf("Want %v, but got %v", tt.expectedSuccess, err == nil)
 			}
+			if len(tt.fragmentingPods) != 0 {
+				for _, p := range tt.fragmentingPods {
+					nodeInfo, err := snapshot.NodeInfos().Get(p.Spec.NodeName)
+					if err != nil {
+						t.Fatal(err)
+					}
+					nodeInfo.AddPod(p)
+				}
+				if err := pgMgr.PreFilter(ctx, tt.pod); err == nil {
+					t.Errorf("Want the pod group to be rejected once the cluster gets fragmented")
+				}
+			}
 		})
 	}
 }
@@ -238,6 +359,39 @@ func TestPermit(t *testing.T) {
 			},
 			want: Success,
 		},
+		{
+			name: "pod belongs to a pg that have quorum satisfied but not the quorum of a role",
+			pod:  st.MakePod().Name("p1a").Namespace("ns").UID("p1a").Label(v1alpha1.PodGroupLabel, "pg1").Label(v1alpha1.PodGroupRoleLabel, "worker").Obj(),
+			existingPods: []*corev1.Pod{
+				st.MakePod().Name("p1b").Namespace("ns").UID("p1b").Label(v1alpha1.PodGroupLabel, "pg1").Label(v1alpha1.PodGroupRoleLabel, "worker").Node("node").Obj(),
+			},
+			pgs: []*v1alpha1.PodGroup{
+				tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(2).Role("launcher", 1, nil).Role("worker", 1, nil).Obj(),
+			},
+			want: Wait,
+		},
+		{
+			name: "pod belongs to a pg that have the quorum of every role satisfied",
+			pod:  st.MakePod().Name("p1a").Namespace("ns").UID("p1a").Label(v1alpha1.PodGroupLabel, "pg1").Label(v1alpha1.PodGroupRoleLabel, "launcher").Obj(),
+			existingPods: []*corev1.Pod{
+				st.MakePod().Name("p1b").Namespace("ns").UID("p1b").Label(v1alpha1.PodGroupLabel, "pg1").Label(v1alpha1.PodGroupRoleLabel, "worker").Node("node").Obj(),
+			},
+			pgs: []*v1alpha1.PodGroup{
+				tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(2).Role("launcher", 1, nil).Role("worker", 1, nil).Obj(),
+			},
+			want: Success,
+		},
+		{
+			name: "pod belongs to a pg whose roles require more pods than minMember",
+			pod:  st.MakePod().Name("p1a").Namespace("ns").UID("p1a").Label(v1alpha1.PodGroupLabel, "pg1").Label(v1alpha1.PodGroupRoleLabel, "worker").Obj(),
+			existingPods: []*corev1.Pod{
+				st.MakePod().Name("p1b").Namespace("ns").UID("p1b").Label(v1alpha1.PodGroupLabel, "pg1").Label(v1alpha1.PodGroupRoleLabel, "launcher").Node("node").Obj(),
+			},
+			pgs: []*v1alpha1.PodGroup{
+				tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(2).Role("launcher", 1, nil).Role("worker", 2, nil).Obj(),
+			},
+			want: Wait,
+		},
 	}
 
 	for _, tt := range tests {
@@ -245,30 +399,12 @@ func TestPermit(t *testing.T) {
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
 
-			// Compile all objects into `objs`.
-			var objs []runtime.Object
-			for _, pod := range append(tt.existingPods, tt.pod) {
-				objs = append(objs, pod)
-			}
-			for _, pg := range tt.pgs {
-				objs = append(objs, pg)
-			}
-
-			client, err := tu.NewFakeClient(objs...)
-			if err != nil {
-				t.Fatal(err)
-			}
-
 			cs := clientsetfake.NewSimpleClientset()
 			informerFactory := informers.NewSharedInformerFactory(cs, 0)
 			podInformer := informerFactory.Core().V1().Pods()
 
-			pgMgr := &PodGroupManager{
-				client:               client,
-				snapshotSharedLister: tu.NewFakeSharedLister(tt.existingPods, nodes),
-				podLister:            podInformer.Lister(),
-				scheduleTimeout:      &scheduleTimeout,
-			}
+			pgMgr := NewPodGroupManager(tu.NewFakeSharedLister(tt.existingPods, nodes), &scheduleTimeout,
+				podInformer, tu.NewPodGroupInformer(tt.pgs...))
 
 			informerFactory.Start(ctx.Done())
 			if !clicache.WaitForCacheSync(ctx.Done(), podInformer.Informer().HasSynced) {
@@ -356,6 +492,133 @@ func TestCheckClusterResource(t *testing.T) {
 	}
 }
 
+func TestSelectTopologyDomain(t *testing.T) {
+	capacity := map[corev1.ResourceName]string{
+		corev1.ResourceCPU:  "2",
+		corev1.ResourcePods: "10",
+	}
+	nodes := []*corev1.Node{
+		st.MakeNode().Name("node-a1").Label("rack", "rack-a").Capacity(capacity).Obj(),
+		st.MakeNode().Name("node-a2").Label("rack", "rack-a").Capacity(capacity).Obj(),
+		st.MakeNode().Name("node-b1").Label("rack", "rack-b").Capacity(capacity).Obj(),
+		st.MakeNode().Name("node-b2").Label("rack", "rack-b").Capacity(capacity).Obj(),
+		st.MakeNode().Name("node-c").Capacity(capacity).Obj(),
+	}
+	pod := st.MakePod().Name("p").Namespace("ns").UID("p").Label(v1alpha1.PodGroupLabel, "pg1").
+		Req(map[corev1.ResourceName]string{corev1.ResourceCPU: "1"}).Obj()
+
+	tests := []struct {
+		name         string
+		existingPods []*corev1.Pod
+		pg           *v1alpha1.PodGroup
+		tried        []string
+		wantDomain   string
+		wantTried    []string
+		wantErr      bool
+	}{
+		{
+			name:       "first domain with enough resources is selected",
+			pg:         tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(3).TopologyConstraint("rack", v1alpha1.TopologyConstraintRequired).Obj(),
+			wantDomain: "rack-a",
+			wantTried:  []string{},
+		},
+		{
+			name: "domains without enough resources are skipped",
+			existingPods: []*corev1.Pod{
+				st.MakePod().Name("p1").Namespace("ns").UID("p1").Node("node-a1").Req(map[corev1.ResourceName]string{corev1.ResourceCPU: "2"}).Obj(),
+			},
+			pg:         tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(3).TopologyConstraint("rack", v1alpha1.TopologyConstraintRequired).Obj(),
+			wantDomain: "rack-b",
+			wantTried:  []string{},
+		},
+		{
+			name: "minResources are used as the request of the group",
+			pg: tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(1).TopologyConstraint("rack", v1alpha1.TopologyConstraintRequired).
+				MinResources(map[corev1.ResourceName]string{corev1.ResourceCPU: "5"}).Obj(),
+			wantErr:   true,
+			wantTried: []string{},
+		},
+		{
+			name:       "domains tried already are skipped",
+			pg:         tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(3).TopologyConstraint("rack", v1alpha1.TopologyConstraintRequired).Obj(),
+			tried:      []string{"rack-a"},
+			wantDomain: "rack-b",
+			wantTried:  []string{"rack-a"},
+		},
+		{
+			name:       "start over when all domains were tried",
+			pg:         tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(3).TopologyConstraint("rack", v1alpha1.TopologyConstraintRequired).Obj(),
+			tried:      []string{"rack-a", "rack-b"},
+			wantDomain: "rack-a",
+			wantTried:  []string{},
+		},
+		{
+			name: "domain of the assigned pods is kept",
+			existingPods: []*corev1.Pod{
+				st.MakePod().Name("p1").Namespace("ns").UID("p1").Node("node-b1").Label(v1alpha1.PodGroupLabel, "pg1").Obj(),
+			},
+			pg:         tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(3).TopologyConstraint("rack", v1alpha1.TopologyConstraintRequired).Obj(),
+			tried:      []string{"rack-b"},
+			wantDomain: "rack-b",
+			wantTried:  []string{"rack-b"},
+		},
+		{
+			name:      "required constraint cannot be satisfied",
+			pg:        tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(5).TopologyConstraint("rack", v1alpha1.TopologyConstraintRequired).Obj(),
+			wantErr:   true,
+			wantTried: []string{},
+		},
+		{
+			name:      "preferred constraint cannot be satisfied",
+			pg:        tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(5).TopologyConstraint("rack", v1alpha1.TopologyConstraintPreferred).Obj(),
+			wantTried: []string{},
+		},
+		{
+			name: "preferred constraint is not enforced if the domain of the assigned pods is full",
+			existingPods: []*corev1.Pod{
+				st.MakePod().Name("p1").Namespace("ns").UID("p1").Node("node-b1").Label(v1alpha1.PodGroupLabel, "pg1").Obj(),
+				st.MakePod().Name("p2").Namespace("ns").UID("p2").Node("node-b2").Req(map[corev1.ResourceName]string{corev1.ResourceCPU: "2"}).Obj(),
+			},
+			pg:        tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(3).TopologyConstraint("rack", v1alpha1.TopologyConstraintPreferred).Obj(),
+			wantTried: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pgMgr := &PodGroupManager{
+				snapshotSharedLister: tu.NewFakeSharedLister(tt.existingPods, nodes),
+				topologyDomains: map[string]*topologyDomains{
+					"ns/pg1": {topologyKey: "rack", tried: sets.New[string](tt.tried...)},
+				},
+			}
+			err := pgMgr.selectTopologyDomain(pod, tt.pg, "ns/pg1")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Want error %v, but got %v", tt.wantErr, err)
+			}
+			if _, domain := pgMgr.GetTopologyDomain("ns/pg1"); domain != tt.wantDomain {
+				t.Errorf("Want domain %q, but got %q", tt.wantDomain, domain)
+			}
+			if got := sets.List(pgMgr.topologyDomains["ns/pg1"].tried); !reflect.DeepEqual(got, tt.wantTried) {
+				t.Errorf("Want tried domains %v, but got %v", tt.wantTried, got)
+			}
+
+			if tt.wantDomain != "" {
+				pgMgr.SkipTopologyDomain("ns/pg1", tt.wantDomain)
+				if _, domain := pgMgr.GetTopologyDomain("ns/pg1"); domain != "" {
+					t.Errorf("Want no domain selected after skipping it, but got %q", domain)
+				}
+			}
+
+			// The domains are forgotten once the pod group is deleted.
+			pgMgr.deletePodGroup(tt.pg)
+			if _, ok := pgMgr.topologyDomains["ns/pg1"]; ok {
+				t.Errorf("Want the topology domains of the deleted pod group to be forgotten")
+			}
+		})
+	}
+}
+
 func newCache() *gochache.Cache {
 	return gochache.New(10*time.Second, 10*time.Second)
 }
@@ -18,23 +18,27 @@ package coscheduling
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
-	clientscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/kubernetes"
+	policylisters "k8s.io/client-go/listers/policy/v1"
 	"k8s.io/client-go/tools/cache"
 	corev1helpers "k8s.io/component-helpers/scheduling/corev1"
 	"k8s.io/klog/v2"
 	"k8s.io/kubernetes/pkg/scheduler/framework"
-	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"sigs.k8s.io/scheduler-plugins/apis/config"
 	"sigs.k8s.io/scheduler-plugins/apis/scheduling"
 	"sigs.k8s.io/scheduler-plugins/apis/scheduling/v1alpha1"
 	"sigs.k8s.io/scheduler-plugins/pkg/coscheduling/core"
+	"sigs.k8s.io/scheduler-plugins/pkg/generated/clientset/versioned"
+	schedinformer "sigs.k8s.io/scheduler-plugins/pkg/generated/informers/externalversions"
 	"sigs.k8s.io/scheduler-plugins/pkg/util"
 )
 
@@ -44,10 +48,14 @@ type Coscheduling struct {
 	pgMgr            core.Manager
 	scheduleTimeout  *time.Duration
 	pgBackoff        *time.Duration
+	pdbLister        policylisters.PodDisruptionBudgetLister
+	// conditionRecorder writes the Schedulable condition of the PodGroups.
+	conditionRecorder *conditionRecorder
 }
 
 var _ framework.QueueSortPlugin = &Coscheduling{}
 var _ framework.PreFilterPlugin = &Coscheduling{}
+var _ framework.FilterPlugin = &Coscheduling{}
 var _ framework.PostFilterPlugin = &Coscheduling{}
 var _ framework.PermitPlugin = &Coscheduling{}
 var _ framework.ReservePlugin = &Coscheduling{}
@@ -57,8 +65,54 @@ var _ framework.EnqueueExtensions = &Coscheduling{}
 const (
 	// Name is the name of the plugin used in Registry and configurations.
 	Name = "Coscheduling"
+
+	// topologyDomainStateKey is the key in CycleState to the topology domain the pod is pinned to.
+	topologyDomainStateKey = Name + "/topologyDomain"
+	// permittedStateKey is the key in CycleState marking the pod as allowed in Permit.
+	permittedStateKey = Name + "/permitted"
+	// waitingStateKey is the key in CycleState to the deadline of the pod waiting in Permit.
+	waitingStateKey = Name + "/waiting"
+	// rejectedStateKey is the key in CycleState marking the pod as rejected in PreFilter.
+	rejectedStateKey = Name + "/rejected"
 )
 
+// topologyDomainState is computed at PreFilter and used at Filter.
+type topologyDomainState struct {
+	topologyKey string
+	domain      string
+}
+
+// Clone the topology domain state.
+func (s *topologyDomainState) Clone() framework.StateData {
+	return s
+}
+
+// permittedState is written at Permit when the quorum of the PodGroup is reached.
+type permittedState struct{}
+
+// Clone the permitted state.
+func (s *permittedState) Clone() framework.StateData {
+	return s
+}
+
+// waitingState is written at Permit when the pod waits for its siblings.
+type waitingState struct {
+	deadline time.Time
+}
+
+// Clone the waiting state.
+func (s *waitingState) Clone() framework.StateData {
+	return s
+}
+
+// rejectedState is written at PreFilter when the pod is rejected.
+type rejectedState struct{}
+
+// Clone the rejected state.
+func (s *rejectedState) Clone() framework.StateData {
+	return s
+}
+
 // New initializes and returns a new Coscheduling plugin.
 func New(obj runtime.Object, handle framework.Handle) (framework.Plugin, error) {
 	args, ok := obj.(*config.CoschedulingArgs)
@@ -66,30 +120,34 @@ func New(obj runtime.Object, handle framework.Handle) (framework.Plugin, error)
 		return nil, fmt.Errorf("want args to be of type CoschedulingArgs, got %T", obj)
 	}
 
-	scheme := runtime.NewScheme()
-	_ = clientscheme.AddToScheme(scheme)
-	_ = v1.AddToScheme(scheme)
-	_ = v1alpha1.AddToScheme(scheme)
-	client, err := client.New(handle.KubeConfig(), client.Options{Scheme: scheme})
+	pgClient, err := versioned.NewForConfig(handle.KubeConfig())
 	if err != nil {
 		return nil, err
 	}
+	pgInformer := schedinformer.NewSharedInformerFactory(pgClient, 0).Scheduling().V1alpha1().PodGroups()
+	// Register the PodGroup informer to the framework's informer factory, so that it gets started
+	// and synced along with the other informers before scheduling starts.
+	handle.SharedInformerFactory().InformerFor(&v1alpha1.PodGroup{}, func(kubernetes.Interface, time.Duration) cache.SharedIndexInformer {
+		return pgInformer.Informer()
+	})
 
 	// Performance improvement when retrieving list of objects by namespace or we'll log 'index not exist' warning.
 	handle.SharedInformerFactory().Core().V1().Pods().Informer().AddIndexers(cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
 
 	scheduleTimeDuration := time.Duration(args.PermitWaitingTimeSeconds) * time.Second
 	pgMgr := core.NewPodGroupManager(
-		client,
 		handle.SnapshotSharedLister(),
 		&scheduleTimeDuration,
 		// Keep the podInformer (from frameworkHandle) as the single source of Pods.
 		handle.SharedInformerFactory().Core().V1().Pods(),
+		pgInformer,
 	)
 	plugin := &Coscheduling{
-		frameworkHandler: handle,
-		pgMgr:            pgMgr,
-		scheduleTimeout:  &scheduleTimeDuration,
+		frameworkHandler:  handle,
+		pgMgr:             pgMgr,
+		scheduleTimeout:   &scheduleTimeDuration,
+		pdbLister:         handle.SharedInformerFactory().Policy().V1().PodDisruptionBudgets().Lister(),
+		conditionRecorder: newConditionRecorder(pgClient, pgInformer.Lister()),
 	}
 	if args.PodGroupBackoffSeconds < 0 {
 		err := fmt.Errorf("parse arguments failed")
@@ -99,6 +157,7 @@ func New(obj runtime.Object, handle framework.Handle) (framework.Plugin, error)
 		pgBackoff := time.Duration(args.PodGroupBackoffSeconds) * time.Second
 		plugin.pgBackoff = &pgBackoff
 	}
+	go plugin.conditionRecorder.run(util.InformerContext(handle.SharedInformerFactory().Core().V1().Pods().Informer()).Done())
 	return plugin, nil
 }
 
@@ -107,8 +166,9 @@ func (cs *Coscheduling) EventsToRegister() []framework.ClusterEventWithHint {
 	// https://git.k8s.io/kubernetes/pkg/scheduler/eventhandlers.go#L403-L410
 	pgGVK := fmt.Sprintf("podgroups.v1alpha1.%v", scheduling.GroupName)
 	return []framework.ClusterEventWithHint{
-		{Event: framework.ClusterEvent{Resource: framework.Pod, ActionType: framework.Add}},
+		{Event: framework.ClusterEvent{Resource: framework.Pod, ActionType: framework.Add | framework.Delete}},
 		{Event: framework.ClusterEvent{Resource: framework.GVK(pgGVK), ActionType: framework.Add | framework.Update}},
+		{Event: framework.ClusterEvent{Resource: framework.Node, ActionType: framework.Add | framework.UpdateNodeLabel}},
 	}
 }
 
@@ -138,17 +198,62 @@ func (cs *Coscheduling) Less(podInfo1, podInfo2 *framework.QueuedPodInfo) bool {
 // PreFilter performs the following validations.
 // 1. Whether the PodGroup that the Pod belongs to is on the deny list.
 // 2. Whether the total number of pods in a PodGroup is less than its `minMember`.
+// 3. Whether a topology domain can accommodate the PodGroup, if it has a `topologyConstraint`.
+// In a dry run, e.g. for the other members of the PodGroup during gang preemption, the validations are skipped
+// so that the state of the PodGroup is left untouched, and the pod is only pinned to the topology domain.
 func (cs *Coscheduling) PreFilter(ctx context.Context, state *framework.CycleState, pod *v1.Pod) (*framework.PreFilterResult, *framework.Status) {
+	if util.IsDryRun(state) {
+		cs.writeTopologyDomainState(state, pod)
+		return nil, framework.NewStatus(framework.Success, "")
+	}
 	// If PreFilter fails, return framework.UnschedulableAndUnresolvable to avoid
 	// any preemption attempts.
 	if err := cs.pgMgr.PreFilter(ctx, pod); err != nil {
 		klog.ErrorS(err, "PreFilter failed", "pod", klog.KObj(pod))
+		var condErr *core.ConditionError
+		if errors.As(err, &condErr) {
+			cs.conditionRecorder.record(util.GetPodGroupFullName(pod), metav1.ConditionFalse, condErr.Reason, err.Error())
+		}
+		state.Write(rejectedStateKey, &rejectedState{})
 		return nil, framework.NewStatus(framework.UnschedulableAndUnresolvable, err.Error())
 	}
+	cs.writeTopologyDomainState(state, pod)
 	return nil, framework.NewStatus(framework.Success, "")
 }
 
+// writeTopologyDomainState pins the pod to the topology domain selected for its PodGroup, if any.
+func (cs *Coscheduling) writeTopologyDomainState(state *framework.CycleState, pod *v1.Pod) {
+	if pgFullName := util.GetPodGroupFullName(pod); pgFullName != "" {
+		if topologyKey, domain := cs.pgMgr.GetTopologyDomain(pgFullName); domain != "" {
+			state.Write(topologyDomainStateKey, &topologyDomainState{topologyKey: topologyKey, domain: domain})
+		}
+	}
+}
+
+// Filter rejects the nodes outside of the topology domain the PodGroup is pinned to in PreFilter.
+func (cs *Coscheduling) Filter(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodeInfo *framework.NodeInfo) *framework.Status {
+	s, ok := getTopologyDomainState(state)
+	if !ok {
+		return framework.NewStatus(framework.Success, "")
+	}
+	if nodeInfo.Node().Labels[s.topologyKey] != s.domain {
+		return framework.NewStatus(framework.UnschedulableAndUnresolvable,
+			fmt.Sprintf("node(s) didn't match the topology domain %v=%v of the pod group", s.topologyKey, s.domain))
+	}
+	return framework.NewStatus(framework.Success, "")
+}
+
+func getTopologyDomainState(state *framework.CycleState) (*topologyDomainState, bool) {
+	c, err := state.Read(topologyDomainStateKey)
+	if err != nil {
+		return nil, false
+	}
+	s, ok := c.(*topologyDomainState)
+	return s, ok
+}
+
 // PostFilter is used to reject a group of pods if a pod does not pass PreFilter or Filter.
+// Before rejecting, it tries to preempt lower-priority pods on behalf of the whole PodGroup.
 func (cs *Coscheduling) PostFilter(ctx context.Context, state *framework.CycleState, pod *v1.Pod,
 	filteredNodeStatusMap framework.NodeToStatusMap) (*framework.PostFilterResult, *framework.Status) {
 	pgName, pg := cs.pgMgr.GetPodGroup(ctx, pod)
@@ -159,15 +264,22 @@ func (cs *Coscheduling) PostFilter(ctx context.Context, state *framework.CycleSt
 
 	// This indicates there are already enough Pods satisfying the PodGroup,
 	// so don't bother to reject the whole PodGroup.
-	assigned := cs.pgMgr.CalculateAssignedPods(pg.Name, pod.Namespace)
-	if assigned >= int(pg.Spec.MinMember) {
+	assigned, assignedRoles := cs.pgMgr.CalculateAssignedPods(pg.Name, pod.Namespace)
+	missing, missingRoles := core.MissingMembers(pg, assigned, assignedRoles)
+	if missing == 0 {
 		klog.V(4).InfoS("Assigned pods", "podGroup", klog.KObj(pg), "assigned", assigned)
 		return &framework.PostFilterResult{}, framework.NewStatus(framework.Unschedulable)
 	}
 
+	// Try to make room for the whole PodGroup by preempting lower-priority pods.
+	// Nothing is evicted unless all the missing members can be placed.
+	if result, status := cs.preemptGang(ctx, state, pod, pg, missing, missingRoles); status != nil {
+		return result, status
+	}
+
 	// If the gap is less than/equal 10%, we may want to try subsequent Pods
 	// to see they can satisfy the PodGroup
-	notAssignedPercentage := float32(int(pg.Spec.MinMember)-assigned) / float32(pg.Spec.MinMember)
+	notAssignedPercentage := float32(missing) / float32(util.GetMinMember(pg))
 	if notAssignedPercentage <= 0.1 {
 		klog.V(4).InfoS("A small gap of pods to reach the quorum", "podGroup", klog.KObj(pg), "percentage", notAssignedPercentage)
 		return &framework.PostFilterResult{}, framework.NewStatus(framework.Unschedulable)
@@ -182,16 +294,24 @@ func (cs *Coscheduling) PostFilter(ctx context.Context, state *framework.CycleSt
 		}
 	})
 
+	fitErr := &framework.FitError{Pod: pod, NumAllNodes: len(filteredNodeStatusMap),
+		Diagnosis: framework.Diagnosis{NodeToStatusMap: filteredNodeStatusMap}}
+	reason, message := v1alpha1.PodGroupReasonUnschedulable, fmt.Sprintf("Pod %v is unschedulable: %v", pod.Name, fitErr.Error())
 	if cs.pgBackoff != nil {
 		pods, err := cs.frameworkHandler.SharedInformerFactory().Core().V1().Pods().Lister().Pods(pod.Namespace).List(
 			labels.SelectorFromSet(labels.Set{v1alpha1.PodGroupLabel: util.GetPodGroupLabel(pod)}),
 		)
 		if err == nil && len(pods) >= int(pg.Spec.MinMember) {
 			cs.pgMgr.BackoffPodGroup(pgName, *cs.pgBackoff)
+			reason, message = v1alpha1.PodGroupReasonBackedOff, fmt.Sprintf("Backed off for %v: %v", *cs.pgBackoff, message)
 		}
 	}
+	util.RejectPodGroup(state)
+	// The pods rejected in PreFilter already got a more specific condition recorded.
+	if _, err := state.Read(rejectedStateKey); err != nil {
+		cs.conditionRecorder.record(pgName, metav1.ConditionFalse, reason, message)
+	}
 
-	cs.pgMgr.DeletePermittedPodGroup(pgName)
 	return &framework.PostFilterResult{}, framework.NewStatus(framework.Unschedulable,
 		fmt.Sprintf("PodGroup %v gets rejected due to Pod %v is unschedulable even after PostFilter", pgName, pod.Name))
 }
@@ -218,6 +338,7 @@ func (cs *Coscheduling) Permit(ctx context.Context, state *framework.CycleState,
 			waitTime = wait
 		}
 		retStatus = framework.NewStatus(framework.Wait)
+		state.Write(waitingStateKey, &waitingState{deadline: time.Now().Add(waitTime)})
 		// We will also request to move the sibling pods back to activeQ.
 		cs.pgMgr.ActivateSiblings(pod, state)
 	case core.Success:
@@ -229,6 +350,9 @@ func (cs *Coscheduling) Permit(ctx context.Context, state *framework.CycleState,
 			}
 		})
 		klog.V(3).InfoS("Permit allows", "pod", klog.KObj(pod))
+		state.Write(permittedStateKey, &permittedState{})
+		cs.conditionRecorder.record(pgFullName, metav1.ConditionTrue, v1alpha1.PodGroupReasonScheduled,
+			"The quorum of the PodGroup is scheduled")
 		retStatus = framework.NewStatus(framework.Success)
 		waitTime = 0
 	}
@@ -242,16 +366,36 @@ func (cs *Coscheduling) Reserve(ctx context.Context, state *framework.CycleState
 }
 
 // Unreserve rejects all other Pods in the PodGroup when one of the pods in the group times out.
+// If the PodGroup is pinned to a topology domain and the pod timed out or got rejected while waiting
+// in Permit, the next attempts of the PodGroup move on to the next domain. A pod failing before it
+// waits in Permit, e.g. in the Reserve of another plugin, keeps the PodGroup in its domain.
+// A pod allowed in Permit, i.e. once the quorum is reached, failing afterwards doesn't affect the PodGroup.
 func (cs *Coscheduling) Unreserve(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodeName string) {
 	pgName, pg := cs.pgMgr.GetPodGroup(ctx, pod)
 	if pg == nil {
 		return
 	}
+	if _, err := state.Read(permittedStateKey); err == nil {
+		klog.V(3).InfoS("Unreserve a pod allowed beyond the quorum", "pod", klog.KObj(pod), "podGroup", klog.KObj(pg))
+		return
+	}
+	if c, err := state.Read(waitingStateKey); err == nil {
+		if s, ok := c.(*waitingState); ok && !time.Now().Before(s.deadline) {
+			assigned, _ := cs.pgMgr.CalculateAssignedPods(pg.Name, pg.Namespace)
+			cs.conditionRecorder.record(pgName, metav1.ConditionFalse, v1alpha1.PodGroupReasonPermitTimeout,
+				fmt.Sprintf("Pod %v timed out waiting in Permit, %v of %v members were assigned", pod.Name, assigned, util.GetMinMember(pg)))
+		}
+		// The pod waited in Permit without being allowed by the quorum: it timed out or got rejected.
+		// Once the quorum is reached the domain is no longer tracked, so skipping it is a no-op.
+		if s, ok := getTopologyDomainState(state); ok {
+			klog.V(3).InfoS("PodGroup moves on to the next topology domain", "podGroup", klog.KObj(pg), "domain", s.domain)
+			cs.pgMgr.SkipTopologyDomain(pgName, s.domain)
+		}
+	}
 	cs.frameworkHandler.IterateOverWaitingPods(func(waitingPod framework.WaitingPod) {
 		if waitingPod.GetPod().Namespace == pod.Namespace && util.GetPodGroupLabel(waitingPod.GetPod()) == pg.Name {
 			klog.V(3).InfoS("Unreserve rejects", "pod", klog.KObj(waitingPod.GetPod()), "podGroup", klog.KObj(pg))
 			waitingPod.Reject(cs.Name(), "rejection in Unreserve")
 		}
 	})
-	cs.pgMgr.DeletePermittedPodGroup(pgName)
 }
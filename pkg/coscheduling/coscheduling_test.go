@@ -19,6 +19,7 @@ package coscheduling
 import (
 	"context"
 	"fmt"
+	"math/rand"
 	"reflect"
 	"sort"
 	"testing"
@@ -26,7 +27,6 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	v1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/informers"
 	clientsetfake "k8s.io/client-go/kubernetes/fake"
 	clicache "k8s.io/client-go/tools/cache"
@@ -40,6 +40,7 @@ import (
 	_ "sigs.k8s.io/scheduler-plugins/apis/config/scheme"
 	"sigs.k8s.io/scheduler-plugins/apis/scheduling/v1alpha1"
 	"sigs.k8s.io/scheduler-plugins/pkg/coscheduling/core"
+	"sigs.k8s.io/scheduler-plugins/pkg/util"
 	tu "sigs.k8s.io/scheduler-plugins/test/util"
 )
 
@@ -79,20 +80,6 @@ func TestPodGroupBackoffTime(t *testing.T) {
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
 
-			// Compile all objects into `objs`.
-			var objs []runtime.Object
-			for _, pod := range tt.pods {
-				objs = append(objs, pod)
-			}
-			for _, pg := range tt.pgs {
-				objs = append(objs, pg)
-			}
-
-			client, err := tu.NewFakeClient(objs...)
-			if err != nil {
-				t.Fatal(err)
-			}
-
 			// Compose a fake framework handle.
 			cs := clientsetfake.NewSimpleClientset()
 			informerFactory := informers.NewSharedInformerFactory(cs, 0)
@@ -101,17 +88,21 @@ func TestPodGroupBackoffTime(t *testing.T) {
 				st.RegisterQueueSortPlugin(queuesort.Name, queuesort.New),
 				st.RegisterBindPlugin(defaultbinder.Name, defaultbinder.New),
 			}
-			f, err := st.NewFramework(ctx, registeredPlugins, "default-scheduler", fwkruntime.WithInformerFactory(informerFactory))
+			f, err := st.NewFramework(ctx, registeredPlugins, "default-scheduler",
+				fwkruntime.WithInformerFactory(informerFactory),
+				fwkruntime.WithPodNominator(tu.NewPodNominator(podInformer.Lister())),
+				fwkruntime.WithSnapshotSharedLister(tu.NewFakeSharedLister(tt.pods, nodes)),
+			)
 			if err != nil {
 				t.Fatal(err)
 			}
 
 			pgMgr := core.NewPodGroupManager(
-				client,
 				tu.NewFakeSharedLister(tt.pods, nodes),
 				// In this UT, 5 seconds should suffice to test the PreFilter's return code.
 				pointer.Duration(5*time.Second),
 				podInformer,
+				tu.NewPodGroupInformer(tt.pgs...),
 			)
 			pl := &Coscheduling{
 				frameworkHandler: f,
@@ -400,21 +391,11 @@ func TestLess(t *testing.T) {
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
 
-			// Compile all objects into `objs`.
-			var objs []runtime.Object
-			for _, pg := range tt.pgs {
-				objs = append(objs, pg)
-			}
-
-			client, err := tu.NewFakeClient(objs...)
-			if err != nil {
-				t.Fatal(err)
-			}
 			cs := clientsetfake.NewSimpleClientset()
 			informerFactory := informers.NewSharedInformerFactory(cs, 0)
 			podInformer := informerFactory.Core().V1().Pods()
 
-			pl := &Coscheduling{pgMgr: core.NewPodGroupManager(client, nil, nil, podInformer)}
+			pl := &Coscheduling{pgMgr: core.NewPodGroupManager(nil, nil, podInformer, tu.NewPodGroupInformer(tt.pgs...))}
 
 			informerFactory.Start(ctx.Done())
 			if !clicache.WaitForCacheSync(ctx.Done(), podInformer.Informer().HasSynced) {
@@ -428,6 +409,42 @@ func TestLess(t *testing.T) {
 	}
 }
 
+func BenchmarkLess(b *testing.B) {
+	const (
+		numPods      = 10000
+		podsPerGroup = 10
+	)
+	now := time.Now()
+	var pgs []*v1alpha1.PodGroup
+	queue := make([]*framework.QueuedPodInfo, 0, numPods)
+	for i := 0; i < numPods; i++ {
+		pgName := fmt.Sprintf("pg%d", i/podsPerGroup)
+		if i%podsPerGroup == 0 {
+			pgs = append(pgs, tu.MakePodGroup().Name(pgName).Namespace("ns").Time(now.Add(time.Duration(i)*time.Millisecond)).Obj())
+		}
+		pod := st.MakePod().Name(fmt.Sprintf("p%d", i)).Namespace("ns").UID(fmt.Sprintf("p%d", i)).
+			Label(v1alpha1.PodGroupLabel, pgName).Priority(int32(i % 3)).Obj()
+		ts := now.Add(time.Duration(numPods-i) * time.Millisecond)
+		queue = append(queue, &framework.QueuedPodInfo{
+			PodInfo:                 tu.MustNewPodInfo(b, pod),
+			Timestamp:               ts,
+			InitialAttemptTimestamp: &ts,
+		})
+	}
+	rand.New(rand.NewSource(1)).Shuffle(len(queue), func(i, j int) { queue[i], queue[j] = queue[j], queue[i] })
+
+	cs := clientsetfake.NewSimpleClientset()
+	informerFactory := informers.NewSharedInformerFactory(cs, 0)
+	pl := &Coscheduling{pgMgr: core.NewPodGroupManager(nil, nil, informerFactory.Core().V1().Pods(), tu.NewPodGroupInformer(pgs...))}
+
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		sorted := append([]*framework.QueuedPodInfo(nil), queue...)
+		sort.Slice(sorted, func(i, j int) bool { return pl.Less(sorted[i], sorted[j]) })
+	}
+	b.ReportMetric(float64(b.N*numPods)/b.Elapsed().Seconds(), "pods/s")
+}
+
 func TestPermit(t *testing.T) {
 	scheduleTimeout := 10 * time.Second
 	capacity := map[v1.ResourceName]string{
@@ -477,18 +494,6 @@ func TestPermit(t *testing.T) {
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
 
-			// Compile all objects into `objs`.
-			var objs []runtime.Object
-			objs = append(objs, tt.pod)
-			for _, pg := range tt.pgs {
-				objs = append(objs, pg)
-			}
-
-			client, err := tu.NewFakeClient(objs...)
-			if err != nil {
-				t.Fatal(err)
-			}
-
 			// Compose a fake framework handle.
 			registeredPlugins := []st.RegisterPluginFunc{
 				st.RegisterQueueSortPlugin(queuesort.Name, queuesort.New),
@@ -504,7 +509,7 @@ func TestPermit(t *testing.T) {
 
 			pl := &Coscheduling{
 				frameworkHandler: f,
-				pgMgr:            core.NewPodGroupManager(client, tu.NewFakeSharedLister(nil, nodes), nil, podInformer),
+				pgMgr:            core.NewPodGroupManager(tu.NewFakeSharedLister(nil, nodes), nil, podInformer, tu.NewPodGroupInformer(tt.pgs...)),
 				scheduleTimeout:  &scheduleTimeout,
 			}
 
@@ -537,6 +542,7 @@ func TestPostFilter(t *testing.T) {
 		existingPods []*v1.Pod
 		pgs          []*v1alpha1.PodGroup
 		want         *framework.Status
+		wantRejected bool
 	}{
 		{
 			name: "pod does not belong to any pod group",
@@ -570,6 +576,7 @@ func TestPostFilter(t *testing.T) {
 				framework.Unschedulable,
 				"PodGroup ns/pg1 gets rejected due to Pod p is unschedulable even after PostFilter",
 			),
+			wantRejected: true,
 		},
 	}
 
@@ -578,41 +585,30 @@ func TestPostFilter(t *testing.T) {
 			ctx, cancel := context.WithCancel(context.Background())
 			defer cancel()
 
-			// Compile all objects into `objs`.
-			var objs []runtime.Object
-			for _, pod := range append(tt.existingPods, tt.pod) {
-				objs = append(objs, pod)
-			}
-			for _, pg := range tt.pgs {
-				objs = append(objs, pg)
-			}
-
-			client, err := tu.NewFakeClient(objs...)
-			if err != nil {
-				t.Fatal(err)
-			}
-
 			// Compose a fake framework handle.
 			registeredPlugins := []st.RegisterPluginFunc{
 				st.RegisterQueueSortPlugin(queuesort.Name, queuesort.New),
 				st.RegisterBindPlugin(defaultbinder.Name, defaultbinder.New),
 			}
-			f, err := st.NewFramework(ctx, registeredPlugins, "default-scheduler")
-			if err != nil {
-				t.Fatal(err)
-			}
-
 			cs := clientsetfake.NewSimpleClientset()
 			informerFactory := informers.NewSharedInformerFactory(cs, 0)
 			podInformer := informerFactory.Core().V1().Pods()
 
+			f, err := st.NewFramework(ctx, registeredPlugins, "default-scheduler",
+				fwkruntime.WithPodNominator(tu.NewPodNominator(podInformer.Lister())),
+				fwkruntime.WithSnapshotSharedLister(tu.NewFakeSharedLister(tt.existingPods, nodes)),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
 			pl := &Coscheduling{
 				frameworkHandler: f,
 				pgMgr: core.NewPodGroupManager(
-					client,
 					tu.NewFakeSharedLister(tt.existingPods, nodes),
 					&scheduleTimeout,
 					podInformer,
+					tu.NewPodGroupInformer(tt.pgs...),
 				),
 				scheduleTimeout: &scheduleTimeout,
 			}
@@ -625,10 +621,135 @@ func TestPostFilter(t *testing.T) {
 				podInformer.Informer().GetStore().Add(p)
 			}
 
-			_, got := pl.PostFilter(ctx, framework.NewCycleState(), tt.pod, nodeStatusMap)
+			state := framework.NewCycleState()
+			rejected := false
+			util.OnPodGroupRejected(state, func() { rejected = true })
+			_, got := pl.PostFilter(ctx, state, tt.pod, nodeStatusMap)
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Want %v, but got %v", tt.want, got)
 			}
+			if rejected != tt.wantRejected {
+				t.Errorf("Want the PodGroup rejected: %v, but got %v", tt.wantRejected, rejected)
+			}
+		})
+	}
+}
+
+func TestUnreserveTopologyDomain(t *testing.T) {
+	scheduleTimeout := 10 * time.Second
+	capacity := map[v1.ResourceName]string{v1.ResourceCPU: "4", v1.ResourcePods: "10"}
+	nodes := []*v1.Node{
+		st.MakeNode().Name("node-a").Label("rack", "rack-a").Capacity(capacity).Obj(),
+		st.MakeNode().Name("node-b").Label("rack", "rack-b").Capacity(capacity).Obj(),
+	}
+	pg := tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(1).TopologyConstraint("rack", v1alpha1.TopologyConstraintRequired).Obj()
+	pod := st.MakePod().Name("p").Namespace("ns").UID("p").Label(v1alpha1.PodGroupLabel, "pg1").
+		Req(map[v1.ResourceName]string{v1.ResourceCPU: "1"}).Obj()
+
+	tests := []struct {
+		name       string
+		waited     bool
+		wantDomain string
+	}{
+		{
+			name:       "pod failing before Permit keeps the pod group in its domain",
+			wantDomain: "rack-a",
+		},
+		{
+			name:   "pod rejected while waiting in Permit moves the pod group on",
+			waited: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			registeredPlugins := []st.RegisterPluginFunc{
+				st.RegisterQueueSortPlugin(queuesort.Name, queuesort.New),
+				st.RegisterBindPlugin(defaultbinder.Name, defaultbinder.New),
+			}
+			f, err := st.NewFramework(ctx, registeredPlugins, "default-scheduler")
+			if err != nil {
+				t.Fatal(err)
+			}
+			informerFactory := informers.NewSharedInformerFactory(clientsetfake.NewSimpleClientset(), 0)
+			podInformer := informerFactory.Core().V1().Pods()
+			pl := &Coscheduling{
+				frameworkHandler: f,
+				pgMgr:            core.NewPodGroupManager(tu.NewFakeSharedLister(nil, nodes), &scheduleTimeout, podInformer, tu.NewPodGroupInformer(pg)),
+				scheduleTimeout:  &scheduleTimeout,
+			}
+			podInformer.Informer().GetStore().Add(pod)
+
+			state := framework.NewCycleState()
+			if _, status := pl.PreFilter(ctx, state, pod); !status.IsSuccess() {
+				t.Fatalf("Unexpected PreFilter status: %v", status)
+			}
+			if tt.waited {
+				state.Write(waitingStateKey, &waitingState{deadline: time.Now().Add(scheduleTimeout)})
+			}
+			pl.Unreserve(ctx, state, pod, "node-a")
+			if _, domain := pl.pgMgr.GetTopologyDomain("ns/pg1"); domain != tt.wantDomain {
+				t.Errorf("Want domain %q, but got %q", tt.wantDomain, domain)
+			}
+		})
+	}
+}
+
+func TestFilter(t *testing.T) {
+	nodeInRackA := st.MakeNode().Name("node-a").Label("rack", "rack-a").Obj()
+	nodeInRackB := st.MakeNode().Name("node-b").Label("rack", "rack-b").Obj()
+	nodeWithoutRack := st.MakeNode().Name("node-c").Obj()
+
+	tests := []struct {
+		name  string
+		state *topologyDomainState
+		node  *v1.Node
+		want  *framework.Status
+	}{
+		{
+			name: "pod group not pinned to any topology domain",
+			node: nodeWithoutRack,
+			want: framework.NewStatus(framework.Success, ""),
+		},
+		{
+			name:  "node in the topology domain",
+			state: &topologyDomainState{topologyKey: "rack", domain: "rack-a"},
+			node:  nodeInRackA,
+			want:  framework.NewStatus(framework.Success, ""),
+		},
+		{
+			name:  "node in another topology domain",
+			state: &topologyDomainState{topologyKey: "rack", domain: "rack-a"},
+			node:  nodeInRackB,
+			want: framework.NewStatus(framework.UnschedulableAndUnresolvable,
+				"node(s) didn't match the topology domain rack=rack-a of the pod group"),
+		},
+		{
+			name:  "node without the topology key",
+			state: &topologyDomainState{topologyKey: "rack", domain: "rack-a"},
+			node:  nodeWithoutRack,
+			want: framework.NewStatus(framework.UnschedulableAndUnresolvable,
+				"node(s) didn't match the topology domain rack=rack-a of the pod group"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := framework.NewCycleState()
+			if tt.state != nil {
+				state.Write(topologyDomainStateKey, tt.state)
+			}
+			nodeInfo := framework.NewNodeInfo()
+			nodeInfo.SetNode(tt.node)
+
+			pl := &Coscheduling{}
+			pod := st.MakePod().Name("p").Namespace("ns").UID("p").Label(v1alpha1.PodGroupLabel, "pg1").Obj()
+			if got := pl.Filter(context.Background(), state, pod, nodeInfo); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Want %v, but got %v", tt.want, got)
+			}
 		})
 	}
 }
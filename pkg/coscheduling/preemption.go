@@ -0,0 +1,483 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package coscheduling
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	policylisters "k8s.io/client-go/listers/policy/v1"
+	corev1helpers "k8s.io/component-helpers/scheduling/corev1"
+	"k8s.io/klog/v2"
+	extenderv1 "k8s.io/kube-scheduler/extender/v1"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+	"k8s.io/kubernetes/pkg/scheduler/framework/preemption"
+	schedutil "k8s.io/kubernetes/pkg/scheduler/util"
+
+	"sigs.k8s.io/scheduler-plugins/apis/scheduling/v1alpha1"
+	"sigs.k8s.io/scheduler-plugins/pkg/coscheduling/core"
+	"sigs.k8s.io/scheduler-plugins/pkg/util"
+)
+
+var _ preemption.Interface = &gangPreemptor{}
+
+// gangPreemptor selects victims for a single member of a PodGroup. Pods of the same
+// PodGroup are never considered as victims.
+type gangPreemptor struct {
+	fh         framework.Handle
+	pgFullName string
+}
+
+// gangPlacement records the node a member of a PodGroup gets nominated to.
+type gangPlacement struct {
+	pod      *v1.Pod
+	nodeName string
+}
+
+// preemptGang runs a group-level dry-run preemption for the PodGroup <pg> of <pod>.
+// The <missing> members needed to reach the quorum, including the ones needed by the roles
+// of the PodGroup as per <missingRoles>, are placed one by one on a private copy
+// of the snapshot, preempting lower-priority pods when they don't fit. Victims are only
+// evicted when every missing member could be placed; in that case the members get
+// nominated to their nodes together and the result carries the node nominated for <pod>.
+// It returns a nil status when preemption cannot make the whole group schedulable,
+// in which case nothing has been evicted.
+func (cs *Coscheduling) preemptGang(ctx context.Context, state *framework.CycleState, pod *v1.Pod,
+	pg *v1alpha1.PodGroup, missing int, missingRoles map[string]int) (*framework.PostFilterResult, *framework.Status) {
+	fwk, ok := cs.frameworkHandler.(framework.Framework)
+	if !ok {
+		return nil, nil
+	}
+	pgFullName := util.GetPodGroupFullName(pod)
+	gp := &gangPreemptor{fh: cs.frameworkHandler, pgFullName: pgFullName}
+	if eligible, reason := gp.PodEligibleToPreemptOthers(pod, nil); !eligible {
+		klog.V(4).InfoS("PodGroup is not eligible for gang preemption", "podGroup", klog.KObj(pg), "pod", klog.KObj(pod), "reason", reason)
+		return nil, nil
+	}
+
+	siblings, err := cs.pgMgr.GetPendingSiblings(pod)
+	if err != nil {
+		klog.ErrorS(err, "Failed to list the pending pods of PodGroup", "podGroup", klog.KObj(pg))
+		return nil, nil
+	}
+	members := core.SelectMembers(pod, siblings, missing, missingRoles)
+	if members == nil {
+		klog.V(4).InfoS("Not enough pending pods to reach the quorum with gang preemption", "podGroup", klog.KObj(pg), "pending", len(siblings)+1, "missing", missing)
+		return nil, nil
+	}
+
+	allNodes, err := cs.frameworkHandler.SnapshotSharedLister().NodeInfos().List()
+	if err != nil {
+		return nil, framework.AsStatus(err)
+	}
+	nodes := make([]*framework.NodeInfo, 0, len(allNodes))
+	nodesByName := make(map[string]*framework.NodeInfo, len(allNodes))
+	for _, nodeInfo := range allNodes {
+		if nodeInfo.Node() == nil {
+			continue
+		}
+		clone := nodeInfo.Clone()
+		nodes = append(nodes, clone)
+		nodesByName[clone.Node().Name] = clone
+	}
+
+	if minResources := util.GetMinResources(pg); minResources != nil {
+		if err := checkClusterResourceWithoutLowerPriorityPods(nodes, pod, minResources, pgFullName); err != nil {
+			klog.V(4).InfoS("Gang preemption cannot free enough resources", "podGroup", klog.KObj(pg), "err", err)
+			return nil, nil
+		}
+	}
+
+	pdbs, err := getPodDisruptionBudgets(cs.pdbLister)
+	if err != nil {
+		return nil, framework.AsStatus(err)
+	}
+
+	// simulated keeps track of the pods removed from and added to the copied snapshot, so that
+	// the PreFilter state of the next members can be brought up to date with them.
+	var simulated []simulatedChange
+	var victims []*v1.Pod
+	var placements []gangPlacement
+	for _, member := range members {
+		memberState, status := cs.memberCycleState(ctx, fwk, state, pod, member, simulated)
+		if !status.IsSuccess() {
+			klog.V(4).InfoS("Gang preemption cannot run PreFilter for PodGroup member", "podGroup", klog.KObj(pg), "pod", klog.KObj(member), "status", status.Message())
+			return nil, nil
+		}
+
+		nodeName, nodeVictims := cs.selectNodeForMember(ctx, memberState, gp, member, nodes, pdbs)
+		if nodeName == "" {
+			klog.V(4).InfoS("Gang preemption cannot place the whole PodGroup", "podGroup", klog.KObj(pg), "pod", klog.KObj(member))
+			return nil, nil
+		}
+
+		nodeInfo := nodesByName[nodeName]
+		for _, victim := range nodeVictims {
+			if err := nodeInfo.RemovePod(victim); err != nil {
+				return nil, framework.AsStatus(err)
+			}
+			simulated = append(simulated, simulatedChange{pod: victim, nodeInfo: nodeInfo, removed: true})
+		}
+		nodeInfo.AddPod(member)
+		simulated = append(simulated, simulatedChange{pod: member, nodeInfo: nodeInfo})
+
+		pdbs = consumePodDisruptionBudgets(pdbs, nodeVictims)
+		victims = append(victims, nodeVictims...)
+		placements = append(placements, gangPlacement{pod: member, nodeName: nodeName})
+	}
+
+	// The members can be placed without evicting anything, so they are failing for reasons
+	// preemption doesn't help with.
+	if len(victims) == 0 {
+		klog.V(4).InfoS("Gang preemption found no victims", "podGroup", klog.KObj(pg))
+		return nil, nil
+	}
+
+	if status := cs.prepareGangCandidates(ctx, pod, pgFullName, victims, placements); !status.IsSuccess() {
+		return nil, status
+	}
+	klog.V(3).InfoS("PodGroup preempted pods to make room for its members", "podGroup", klog.KObj(pg), "victims", len(victims), "members", len(placements))
+	return framework.NewPostFilterResultWithNominatedNode(placements[0].nodeName), framework.NewStatus(framework.Success)
+}
+
+// memberCycleState returns the CycleState to evaluate <member> with. For the pod being scheduled
+// it's a copy of its own state, for the other members PreFilter is run from scratch in a dry run
+// CycleState, so that the plugins don't reserve anything for them. In both cases the changes
+// already simulated on the snapshot are replayed through the PreFilter extensions.
+func (cs *Coscheduling) memberCycleState(ctx context.Context, fwk framework.Framework, state *framework.CycleState,
+	pod, member *v1.Pod, simulated []simulatedChange) (*framework.CycleState, *framework.Status) {
+	var memberState *framework.CycleState
+	if member.UID == pod.UID {
+		memberState = state.Clone()
+	} else {
+		memberState = util.NewDryRunCycleState()
+		if _, status := fwk.RunPreFilterPlugins(ctx, memberState, member); !status.IsSuccess() {
+			return nil, status
+		}
+	}
+
+	for _, change := range simulated {
+		podInfo, err := framework.NewPodInfo(change.pod)
+		if err != nil {
+			return nil, framework.AsStatus(err)
+		}
+		var status *framework.Status
+		if change.removed {
+			status = fwk.RunPreFilterExtensionRemovePod(ctx, memberState, member, podInfo, change.nodeInfo)
+		} else {
+			status = fwk.RunPreFilterExtensionAddPod(ctx, memberState, member, podInfo, change.nodeInfo)
+		}
+		if !status.IsSuccess() {
+			return nil, status
+		}
+	}
+	return memberState, framework.NewStatus(framework.Success)
+}
+
+// selectNodeForMember returns the node <member> fits on, along with the pods that have to be
+// preempted on that node. Nodes where the member fits without preemption are preferred.
+// It returns an empty node name if the member cannot be placed anywhere.
+func (cs *Coscheduling) selectNodeForMember(ctx context.Context, state *framework.CycleState, gp *gangPreemptor,
+	member *v1.Pod, nodes []*framework.NodeInfo, pdbs []*policy.PodDisruptionBudget) (string, []*v1.Pod) {
+	for _, nodeInfo := range nodes {
+		if s := cs.frameworkHandler.RunFilterPluginsWithNominatedPods(ctx, state, member, nodeInfo); s.IsSuccess() {
+			return nodeInfo.Node().Name, nil
+		}
+	}
+
+	ev := preemption.Evaluator{
+		PluginName: Name,
+		Handler:    cs.frameworkHandler,
+		State:      state,
+		Interface:  gp,
+	}
+	candidates, _, err := ev.DryRunPreemption(ctx, member, nodes, pdbs, 0, int32(len(nodes)))
+	if err != nil {
+		klog.V(4).InfoS("Errors while dry running preemption", "pod", klog.KObj(member), "err", err)
+	}
+	best := ev.SelectCandidate(klog.FromContext(ctx), candidates)
+	if best == nil || len(best.Name()) == 0 {
+		return "", nil
+	}
+	return best.Name(), best.Victims().Pods
+}
+
+// prepareGangCandidates evicts the victims and nominates the members of the PodGroup, except
+// <pod> whose nomination is carried by the PostFilterResult. Like the default preemption, it
+// clears the nomination of the lower-priority pods nominated to the nodes of the members.
+func (cs *Coscheduling) prepareGangCandidates(ctx context.Context, pod *v1.Pod, pgFullName string,
+	victims []*v1.Pod, placements []gangPlacement) *framework.Status {
+	fh := cs.frameworkHandler
+	logger := klog.FromContext(ctx)
+	// The nominated pods are collected before the members get nominated, which would make them
+	// lower-priority nominated pods as well when the members are lower-priority than <pod>.
+	nominatedPods := getLowerPriorityNominatedPods(fh, pod, pgFullName, placements)
+	for _, victim := range victims {
+		if waitingPod := fh.GetWaitingPod(victim.UID); waitingPod != nil {
+			waitingPod.Reject(cs.Name(), "preempted")
+		} else if err := schedutil.DeletePod(ctx, fh.ClientSet(), victim); err != nil {
+			klog.ErrorS(err, "Failed to preempt pod", "pod", klog.KObj(victim), "preemptor", klog.KObj(pod))
+			return framework.AsStatus(err)
+		}
+		fh.EventRecorder().Eventf(victim, pod, v1.EventTypeNormal, "Preempted", "Preempting",
+			"Preempted by PodGroup %v on node %v", pgFullName, victim.Spec.NodeName)
+	}
+
+	for _, placement := range placements {
+		if placement.pod.UID == pod.UID {
+			continue
+		}
+		podInfo, err := framework.NewPodInfo(placement.pod)
+		if err != nil {
+			return framework.AsStatus(err)
+		}
+		fh.AddNominatedPod(logger, podInfo, &framework.NominatingInfo{NominatingMode: framework.ModeOverride, NominatedNodeName: placement.nodeName})
+
+		newStatus := placement.pod.Status.DeepCopy()
+		newStatus.NominatedNodeName = placement.nodeName
+		if err := schedutil.PatchPodStatus(ctx, fh.ClientSet(), placement.pod, newStatus); err != nil {
+			// Not critical: the nominator already accounts for the member.
+			klog.ErrorS(err, "Failed to nominate PodGroup member", "pod", klog.KObj(placement.pod), "node", placement.nodeName)
+		}
+	}
+
+	if err := schedutil.ClearNominatedNodeName(ctx, fh.ClientSet(), nominatedPods...); err != nil {
+		// Not critical: the pods only lose their nomination once scheduled again.
+		klog.ErrorS(err, "Cannot clear 'NominatedNodeName' field")
+	}
+	return framework.NewStatus(framework.Success)
+}
+
+// getLowerPriorityNominatedPods returns the pods outside of the PodGroup whose priority is lower than
+// the priority of <pod> and which are nominated to the nodes of the members.
+func getLowerPriorityNominatedPods(pn framework.PodNominator, pod *v1.Pod, pgFullName string, placements []gangPlacement) []*v1.Pod {
+	podPriority := corev1helpers.PodPriority(pod)
+	nodeNames := sets.New[string]()
+	var lowerPriorityPods []*v1.Pod
+	for _, placement := range placements {
+		if nodeNames.Has(placement.nodeName) {
+			continue
+		}
+		nodeNames.Insert(placement.nodeName)
+		for _, pi := range pn.NominatedPodsForNode(placement.nodeName) {
+			if util.GetPodGroupFullName(pi.Pod) != pgFullName && corev1helpers.PodPriority(pi.Pod) < podPriority {
+				lowerPriorityPods = append(lowerPriorityPods, pi.Pod)
+			}
+		}
+	}
+	return lowerPriorityPods
+}
+
+type simulatedChange struct {
+	pod      *v1.Pod
+	nodeInfo *framework.NodeInfo
+	removed  bool
+}
+
+// checkClusterResourceWithoutLowerPriorityPods checks whether the minResources of the PodGroup
+// could be satisfied once every pod with a lower priority than <pod> is preempted.
+func checkClusterResourceWithoutLowerPriorityPods(nodes []*framework.NodeInfo, pod *v1.Pod, minResources v1.ResourceList, pgFullName string) error {
+	podPriority := corev1helpers.PodPriority(pod)
+	candidates := make([]*framework.NodeInfo, 0, len(nodes))
+	for _, nodeInfo := range nodes {
+		clone := nodeInfo.Clone()
+		for _, pi := range nodeInfo.Pods {
+			if util.GetPodGroupFullName(pi.Pod) == pgFullName || corev1helpers.PodPriority(pi.Pod) >= podPriority {
+				continue
+			}
+			if err := clone.RemovePod(pi.Pod); err != nil {
+				return err
+			}
+		}
+		candidates = append(candidates, clone)
+	}
+
+	return core.CheckClusterResource(candidates, minResources, pgFullName)
+}
+
+// GetOffsetAndNumCandidates makes every node a candidate, as every member of the group
+// needs to find a node.
+func (p *gangPreemptor) GetOffsetAndNumCandidates(n int32) (int32, int32) {
+	return 0, n
+}
+
+func (p *gangPreemptor) CandidatesToVictimsMap(candidates []preemption.Candidate) map[string]*extenderv1.Victims {
+	m := make(map[string]*extenderv1.Victims)
+	for _, c := range candidates {
+		m[c.Name()] = c.Victims()
+	}
+	return m
+}
+
+// PodEligibleToPreemptOthers determines whether this pod should be considered
+// for preempting other pods or not. If this pod has already preempted other
+// pods and those are in their graceful termination period, it shouldn't be
+// considered for preemption.
+func (p *gangPreemptor) PodEligibleToPreemptOthers(pod *v1.Pod, nominatedNodeStatus *framework.Status) (bool, string) {
+	if pod.Spec.PreemptionPolicy != nil && *pod.Spec.PreemptionPolicy == v1.PreemptNever {
+		return false, "not eligible due to preemptionPolicy=Never."
+	}
+	nomNodeName := pod.Status.NominatedNodeName
+	if len(nomNodeName) > 0 {
+		// If the pod's nominated node is considered as UnschedulableAndUnresolvable by the filters,
+		// then the pod should be considered for preempting again.
+		if nominatedNodeStatus.Code() == framework.UnschedulableAndUnresolvable {
+			return true, ""
+		}
+
+		if nodeInfo, _ := p.fh.SnapshotSharedLister().NodeInfos().Get(nomNodeName); nodeInfo != nil {
+			podPriority := corev1helpers.PodPriority(pod)
+			for _, pi := range nodeInfo.Pods {
+				if pi.Pod.DeletionTimestamp != nil && corev1helpers.PodPriority(pi.Pod) < podPriority {
+					return false, "not eligible due to a terminating pod on the nominated node."
+				}
+			}
+		}
+	}
+	return true, ""
+}
+
+// SelectVictimsOnNode finds the minimum set of lower-priority pods on the given node that
+// should be preempted in order to make room for <pod>. Pods belonging to the PodGroup being
+// scheduled are never selected.
+func (p *gangPreemptor) SelectVictimsOnNode(
+	ctx context.Context,
+	state *framework.CycleState,
+	pod *v1.Pod,
+	nodeInfo *framework.NodeInfo,
+	pdbs []*policy.PodDisruptionBudget) ([]*v1.Pod, int, *framework.Status) {
+	var potentialVictims []*framework.PodInfo
+	removePod := func(rpi *framework.PodInfo) error {
+		if err := nodeInfo.RemovePod(rpi.Pod); err != nil {
+			return err
+		}
+		status := p.fh.RunPreFilterExtensionRemovePod(ctx, state, pod, rpi, nodeInfo)
+		if !status.IsSuccess() {
+			return status.AsError()
+		}
+		return nil
+	}
+	addPod := func(api *framework.PodInfo) error {
+		nodeInfo.AddPodInfo(api)
+		status := p.fh.RunPreFilterExtensionAddPod(ctx, state, pod, api, nodeInfo)
+		if !status.IsSuccess() {
+			return status.AsError()
+		}
+		return nil
+	}
+
+	podPriority := corev1helpers.PodPriority(pod)
+	for _, pi := range nodeInfo.Pods {
+		if corev1helpers.PodPriority(pi.Pod) >= podPriority || util.GetPodGroupFullName(pi.Pod) == p.pgFullName {
+			continue
+		}
+		potentialVictims = append(potentialVictims, pi)
+	}
+	for _, pi := range potentialVictims {
+		if err := removePod(pi); err != nil {
+			return nil, 0, framework.AsStatus(err)
+		}
+	}
+
+	// No potential victims are found, and so we don't need to evaluate the node again since its state didn't change.
+	if len(potentialVictims) == 0 {
+		message := fmt.Sprintf("No victims found on node %v for preemptor pod %v", nodeInfo.Node().Name, pod.Name)
+		return nil, 0, framework.NewStatus(framework.UnschedulableAndUnresolvable, message)
+	}
+
+	// If the new pod does not fit after removing all the lower priority pods,
+	// this node is not suitable for preemption.
+	if s := p.fh.RunFilterPluginsWithNominatedPods(ctx, state, pod, nodeInfo); !s.IsSuccess() {
+		return nil, 0, s
+	}
+
+	var victims []*v1.Pod
+	numViolatingVictim := 0
+	sort.Slice(potentialVictims, func(i, j int) bool {
+		return schedutil.MoreImportantPod(potentialVictims[i].Pod, potentialVictims[j].Pod)
+	})
+	// Try to reprieve as many pods as possible. We first try to reprieve the PDB
+	// violating victims and then other non-violating ones. In both cases, we start
+	// from the highest priority victims.
+	violatingVictims, nonViolatingVictims := util.FilterPodsWithPDBViolation(potentialVictims, pdbs)
+	reprievePod := func(pi *framework.PodInfo) (bool, error) {
+		if err := addPod(pi); err != nil {
+			return false, err
+		}
+		fits := p.fh.RunFilterPluginsWithNominatedPods(ctx, state, pod, nodeInfo).IsSuccess()
+		if !fits {
+			if err := removePod(pi); err != nil {
+				return false, err
+			}
+			victims = append(victims, pi.Pod)
+			klog.V(5).InfoS("Found a potential preemption victim on node", "pod", klog.KObj(pi.Pod), "node", klog.KObj(nodeInfo.Node()))
+		}
+		return fits, nil
+	}
+	for _, pi := range violatingVictims {
+		if fits, err := reprievePod(pi); err != nil {
+			return nil, 0, framework.AsStatus(err)
+		} else if !fits {
+			numViolatingVictim++
+		}
+	}
+	for _, pi := range nonViolatingVictims {
+		if _, err := reprievePod(pi); err != nil {
+			return nil, 0, framework.AsStatus(err)
+		}
+	}
+	return victims, numViolatingVictim, framework.NewStatus(framework.Success)
+}
+
+func getPodDisruptionBudgets(pdbLister policylisters.PodDisruptionBudgetLister) ([]*policy.PodDisruptionBudget, error) {
+	if pdbLister != nil {
+		return pdbLister.List(labels.Everything())
+	}
+	return nil, nil
+}
+
+// consumePodDisruptionBudgets returns a copy of <pdbs> with the disruptions caused by
+// preempting <victims> subtracted, so that the next members of the group see the budget left.
+func consumePodDisruptionBudgets(pdbs []*policy.PodDisruptionBudget, victims []*v1.Pod) []*policy.PodDisruptionBudget {
+	if len(victims) == 0 {
+		return pdbs
+	}
+	result := make([]*policy.PodDisruptionBudget, 0, len(pdbs))
+	for _, pdb := range pdbs {
+		pdb = pdb.DeepCopy()
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err == nil && !selector.Empty() {
+			for _, victim := range victims {
+				if victim.Namespace != pdb.Namespace || !selector.Matches(labels.Set(victim.Labels)) {
+					continue
+				}
+				if _, exist := pdb.Status.DisruptedPods[victim.Name]; exist {
+					continue
+				}
+				pdb.Status.DisruptionsAllowed--
+			}
+		}
+		result = append(result, pdb)
+	}
+	return result
+}
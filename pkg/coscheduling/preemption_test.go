@@ -0,0 +1,298 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package coscheduling
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	v1 "k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/informers"
+	clientsetfake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/events"
+	"k8s.io/klog/v2"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/defaultbinder"
+	plfeature "k8s.io/kubernetes/pkg/scheduler/framework/plugins/feature"
+	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/noderesources"
+	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/queuesort"
+	fwkruntime "k8s.io/kubernetes/pkg/scheduler/framework/runtime"
+	st "k8s.io/kubernetes/pkg/scheduler/testing"
+
+	"sigs.k8s.io/scheduler-plugins/apis/scheduling/v1alpha1"
+	"sigs.k8s.io/scheduler-plugins/pkg/coscheduling/core"
+	tu "sigs.k8s.io/scheduler-plugins/test/util"
+)
+
+func TestGangPreemption(t *testing.T) {
+	const (
+		lowPriority  = int32(0)
+		midPriority  = int32(10)
+		highPriority = int32(100)
+	)
+	scheduleTimeout := 10 * time.Second
+	capacity := map[v1.ResourceName]string{v1.ResourceCPU: "4", v1.ResourcePods: "10"}
+	request := map[v1.ResourceName]string{v1.ResourceCPU: "3"}
+	nodes := []*v1.Node{
+		st.MakeNode().Name("node-a").Capacity(capacity).Obj(),
+		st.MakeNode().Name("node-b").Capacity(capacity).Obj(),
+	}
+	member := func(name string) *v1.Pod {
+		return st.MakePod().Name(name).Namespace("ns").UID(name).Priority(highPriority).
+			Label(v1alpha1.PodGroupLabel, "pg1").Req(request).Obj()
+	}
+
+	tests := []struct {
+		name          string
+		pod           *v1.Pod
+		siblings      []*v1.Pod
+		existingPods  []*v1.Pod
+		nominatedPods []*v1.Pod
+		pdbs          []*policy.PodDisruptionBudget
+		pg            *v1alpha1.PodGroup
+		wantResult    *framework.PostFilterResult
+		wantStatus    *framework.Status
+		wantDeleted   []string
+		wantNominated map[string]string
+		wantCleared   []string
+	}{
+		{
+			name:     "whole group fits after preempting lower-priority pods",
+			pod:      member("p1"),
+			siblings: []*v1.Pod{member("p2")},
+			existingPods: []*v1.Pod{
+				st.MakePod().Name("low-a").Namespace("ns").UID("low-a").Node("node-a").Priority(midPriority).Req(request).Obj(),
+				st.MakePod().Name("low-b").Namespace("ns").UID("low-b").Node("node-b").Priority(lowPriority).Req(request).Obj(),
+			},
+			pg:            tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(2).Obj(),
+			wantResult:    framework.NewPostFilterResultWithNominatedNode("node-b"),
+			wantStatus:    framework.NewStatus(framework.Success),
+			wantDeleted:   []string{"low-a", "low-b"},
+			wantNominated: map[string]string{"p2": "node-a"},
+		},
+		{
+			name:     "lower-priority pods nominated to the nodes of the members lose their nomination",
+			pod:      member("p1"),
+			siblings: []*v1.Pod{member("p2")},
+			existingPods: []*v1.Pod{
+				st.MakePod().Name("low-a").Namespace("ns").UID("low-a").Node("node-a").Priority(lowPriority).Req(request).Obj(),
+				st.MakePod().Name("low-b").Namespace("ns").UID("low-b").Node("node-b").Priority(lowPriority).Req(request).Obj(),
+			},
+			nominatedPods: []*v1.Pod{
+				st.MakePod().Name("nominated-low").Namespace("ns").UID("nominated-low").Priority(lowPriority).
+					NominatedNodeName("node-a").Req(request).Obj(),
+				st.MakePod().Name("nominated-high").Namespace("ns").UID("nominated-high").Priority(highPriority).
+					NominatedNodeName("node-a").Obj(),
+			},
+			pg:            tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(2).Obj(),
+			wantResult:    framework.NewPostFilterResultWithNominatedNode("node-b"),
+			wantStatus:    framework.NewStatus(framework.Success),
+			wantDeleted:   []string{"low-a", "low-b"},
+			wantNominated: map[string]string{"p2": "node-a", "nominated-high": "node-a"},
+			wantCleared:   []string{"nominated-low"},
+		},
+		{
+			name:     "only part of the group fits after preemption, nothing is evicted",
+			pod:      member("p1"),
+			siblings: []*v1.Pod{member("p2")},
+			existingPods: []*v1.Pod{
+				st.MakePod().Name("low-a").Namespace("ns").UID("low-a").Node("node-a").Priority(lowPriority).Req(request).Obj(),
+				st.MakePod().Name("high-b").Namespace("ns").UID("high-b").Node("node-b").Priority(highPriority).Req(request).Obj(),
+			},
+			pg:         tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(2).Obj(),
+			wantResult: &framework.PostFilterResult{},
+			wantStatus: framework.NewStatus(framework.Unschedulable,
+				"PodGroup ns/pg1 gets rejected due to Pod p1 is unschedulable even after PostFilter"),
+		},
+		{
+			name:     "not enough pending members to reach the quorum, nothing is evicted",
+			pod:      member("p1"),
+			siblings: []*v1.Pod{member("p2")},
+			existingPods: []*v1.Pod{
+				st.MakePod().Name("low-a").Namespace("ns").UID("low-a").Node("node-a").Priority(lowPriority).Req(request).Obj(),
+				st.MakePod().Name("low-b").Namespace("ns").UID("low-b").Node("node-b").Priority(lowPriority).Req(request).Obj(),
+			},
+			pg:         tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(3).Obj(),
+			wantResult: &framework.PostFilterResult{},
+			wantStatus: framework.NewStatus(framework.Unschedulable,
+				"PodGroup ns/pg1 gets rejected due to Pod p1 is unschedulable even after PostFilter"),
+		},
+		{
+			name:     "minResources cannot be satisfied even after preempting all lower-priority pods",
+			pod:      member("p1"),
+			siblings: []*v1.Pod{member("p2")},
+			existingPods: []*v1.Pod{
+				st.MakePod().Name("low-a").Namespace("ns").UID("low-a").Node("node-a").Priority(lowPriority).Req(request).Obj(),
+				st.MakePod().Name("low-b").Namespace("ns").UID("low-b").Node("node-b").Priority(lowPriority).Req(request).Obj(),
+			},
+			pg: tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(2).
+				MinResources(map[v1.ResourceName]string{v1.ResourceCPU: "10"}).Obj(),
+			wantResult: &framework.PostFilterResult{},
+			wantStatus: framework.NewStatus(framework.Unschedulable,
+				"PodGroup ns/pg1 gets rejected due to Pod p1 is unschedulable even after PostFilter"),
+		},
+		{
+			name:     "nodes without PDB violations are preferred",
+			pod:      member("p1"),
+			siblings: []*v1.Pod{member("p2")},
+			existingPods: []*v1.Pod{
+				st.MakePod().Name("low-a").Namespace("ns").UID("low-a").Node("node-a").Priority(lowPriority).Req(request).Label("app", "protected").Obj(),
+				st.MakePod().Name("low-b").Namespace("ns").UID("low-b").Node("node-b").Priority(lowPriority).Req(request).Obj(),
+				st.MakePod().Name("low-c").Namespace("ns").UID("low-c").Node("node-b").Priority(lowPriority).Obj(),
+			},
+			pdbs: []*policy.PodDisruptionBudget{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "pdb", Namespace: "ns"},
+					Spec: policy.PodDisruptionBudgetSpec{
+						MinAvailable: &intstr.IntOrString{Type: intstr.Int, IntVal: 1},
+						Selector:     &metav1.LabelSelector{MatchLabels: map[string]string{"app": "protected"}},
+					},
+				},
+			},
+			pg:            tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(2).Obj(),
+			wantResult:    framework.NewPostFilterResultWithNominatedNode("node-b"),
+			wantStatus:    framework.NewStatus(framework.Success),
+			wantDeleted:   []string{"low-a", "low-b"},
+			wantNominated: map[string]string{"p2": "node-a"},
+		},
+		{
+			name: "pod with preemptionPolicy Never does not preempt",
+			pod: st.MakePod().Name("p1").Namespace("ns").UID("p1").Priority(highPriority).
+				PreemptionPolicy(v1.PreemptNever).Label(v1alpha1.PodGroupLabel, "pg1").Req(request).Obj(),
+			siblings: []*v1.Pod{member("p2")},
+			existingPods: []*v1.Pod{
+				st.MakePod().Name("low-a").Namespace("ns").UID("low-a").Node("node-a").Priority(lowPriority).Req(request).Obj(),
+				st.MakePod().Name("low-b").Namespace("ns").UID("low-b").Node("node-b").Priority(lowPriority).Req(request).Obj(),
+			},
+			pg:         tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(2).Obj(),
+			wantResult: &framework.PostFilterResult{},
+			wantStatus: framework.NewStatus(framework.Unschedulable,
+				"PodGroup ns/pg1 gets rejected due to Pod p1 is unschedulable even after PostFilter"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var objs []runtime.Object
+			for _, pod := range append(append(append(tt.existingPods, tt.nominatedPods...), tt.siblings...), tt.pod) {
+				objs = append(objs, pod)
+			}
+			for _, pdb := range tt.pdbs {
+				objs = append(objs, pdb)
+			}
+			cs := clientsetfake.NewSimpleClientset(objs...)
+			informerFactory := informers.NewSharedInformerFactory(cs, 0)
+			podInformer := informerFactory.Core().V1().Pods()
+			pdbInformer := informerFactory.Policy().V1().PodDisruptionBudgets()
+
+			registeredPlugins := []st.RegisterPluginFunc{
+				st.RegisterQueueSortPlugin(queuesort.Name, queuesort.New),
+				st.RegisterBindPlugin(defaultbinder.Name, defaultbinder.New),
+				st.RegisterPluginAsExtensions(noderesources.Name, func(plArgs runtime.Object, fh framework.Handle) (framework.Plugin, error) {
+					return noderesources.NewFit(plArgs, fh, plfeature.Features{})
+				}, "Filter", "PreFilter"),
+			}
+			f, err := st.NewFramework(ctx, registeredPlugins, "default-scheduler",
+				fwkruntime.WithClientSet(cs),
+				fwkruntime.WithEventRecorder(&events.FakeRecorder{}),
+				fwkruntime.WithInformerFactory(informerFactory),
+				fwkruntime.WithPodNominator(tu.NewPodNominator(podInformer.Lister())),
+				fwkruntime.WithSnapshotSharedLister(tu.NewFakeSharedLister(tt.existingPods, nodes)),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pl := &Coscheduling{
+				frameworkHandler: f,
+				pgMgr:            core.NewPodGroupManager(f.SnapshotSharedLister(), &scheduleTimeout, podInformer, tu.NewPodGroupInformer(tt.pg)),
+				scheduleTimeout:  &scheduleTimeout,
+				pdbLister:        pdbInformer.Lister(),
+			}
+			for _, pod := range append(append(append(tt.existingPods, tt.nominatedPods...), tt.siblings...), tt.pod) {
+				podInformer.Informer().GetStore().Add(pod)
+			}
+			for _, pod := range tt.nominatedPods {
+				f.AddNominatedPod(klog.FromContext(ctx), mustNewPodInfo(t, pod), &framework.NominatingInfo{
+					NominatingMode: framework.ModeOverride, NominatedNodeName: pod.Status.NominatedNodeName})
+			}
+			for _, pdb := range tt.pdbs {
+				pdbInformer.Informer().GetStore().Add(pdb)
+			}
+
+			state := framework.NewCycleState()
+			if _, s := f.RunPreFilterPlugins(ctx, state, tt.pod); !s.IsSuccess() {
+				t.Fatalf("Unexpected PreFilter status: %v", s)
+			}
+			gotResult, gotStatus := pl.PostFilter(ctx, state, tt.pod, framework.NodeToStatusMap{})
+			if diff := cmp.Diff(tt.wantStatus, gotStatus); diff != "" {
+				t.Errorf("Unexpected status (-want, +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantResult, gotResult); diff != "" {
+				t.Errorf("Unexpected result (-want, +got):\n%s", diff)
+			}
+
+			var gotDeleted []string
+			for _, pod := range tt.existingPods {
+				if _, err := cs.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{}); err != nil {
+					gotDeleted = append(gotDeleted, pod.Name)
+				}
+			}
+			sort.Strings(gotDeleted)
+			if diff := cmp.Diff(tt.wantDeleted, gotDeleted); diff != "" {
+				t.Errorf("Unexpected deleted pods (-want, +got):\n%s", diff)
+			}
+
+			for name, wantNode := range tt.wantNominated {
+				got, err := cs.CoreV1().Pods("ns").Get(ctx, name, metav1.GetOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.Status.NominatedNodeName != wantNode {
+					t.Errorf("Want pod %v to be nominated to %v, but got %q", name, wantNode, got.Status.NominatedNodeName)
+				}
+			}
+			for _, name := range tt.wantCleared {
+				got, err := cs.CoreV1().Pods("ns").Get(ctx, name, metav1.GetOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got.Status.NominatedNodeName != "" {
+					t.Errorf("Want the nomination of pod %v to be cleared, but got %q", name, got.Status.NominatedNodeName)
+				}
+			}
+		})
+	}
+}
+
+func mustNewPodInfo(t *testing.T, pod *v1.Pod) *framework.PodInfo {
+	podInfo, err := framework.NewPodInfo(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return podInfo
+}
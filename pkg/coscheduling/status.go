@@ -0,0 +1,167 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package coscheduling
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+
+	"sigs.k8s.io/scheduler-plugins/apis/scheduling/v1alpha1"
+	"sigs.k8s.io/scheduler-plugins/pkg/generated/clientset/versioned"
+	listerv1alpha1 "sigs.k8s.io/scheduler-plugins/pkg/generated/listers/scheduling/v1alpha1"
+)
+
+// conditionRecorder writes the Schedulable condition of the PodGroups asynchronously,
+// so that the scheduling cycle never waits for the API server. Only the latest condition
+// recorded for a PodGroup gets written, and the writes are rate-limited: 10 qps overall, with
+// a per-PodGroup exponential backoff on failures.
+type conditionRecorder struct {
+	pgClient versioned.Interface
+	pgLister listerv1alpha1.PodGroupLister
+	queue    workqueue.RateLimitingInterface
+	// conditions stores the condition to write for each PodGroup, keyed by <namespace>/<name>.
+	conditions map[string]metav1.Condition
+	sync.Mutex
+}
+
+func newConditionRecorder(pgClient versioned.Interface, pgLister listerv1alpha1.PodGroupLister) *conditionRecorder {
+	return &conditionRecorder{
+		pgClient:   pgClient,
+		pgLister:   pgLister,
+		queue:      workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "podgroup-conditions"),
+		conditions: make(map[string]metav1.Condition),
+	}
+}
+
+// run writes the recorded conditions until stopCh is closed.
+func (r *conditionRecorder) run(stopCh <-chan struct{}) {
+	defer r.queue.ShutDown()
+	wait.Until(func() {
+		for r.processNextItem() {
+		}
+	}, time.Second, stopCh)
+}
+
+// record records the Schedulable condition of the given PodGroup, to be written later on.
+// It's a no-op on a nil recorder.
+func (r *conditionRecorder) record(pgFullName string, status metav1.ConditionStatus, reason, message string) {
+	if r == nil || pgFullName == "" {
+		return
+	}
+	r.Lock()
+	_, queued := r.conditions[pgFullName]
+	r.conditions[pgFullName] = metav1.Condition{
+		Type:    v1alpha1.PodGroupSchedulable,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	}
+	r.Unlock()
+	if !queued {
+		r.queue.AddRateLimited(pgFullName)
+	}
+}
+
+func (r *conditionRecorder) processNextItem() bool {
+	item, shutdown := r.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer r.queue.Done(item)
+
+	key := item.(string)
+	r.Lock()
+	condition, ok := r.conditions[key]
+	delete(r.conditions, key)
+	r.Unlock()
+	if !ok {
+		return true
+	}
+	if err := r.writeCondition(key, condition); err != nil {
+		klog.ErrorS(err, "Failed to write the condition of the PodGroup", "podGroup", key)
+		// Retry, unless a newer condition was recorded meanwhile.
+		r.Lock()
+		if _, ok := r.conditions[key]; !ok {
+			r.conditions[key] = condition
+		}
+		r.Unlock()
+		r.queue.AddRateLimited(key)
+		return true
+	}
+	r.queue.Forget(key)
+	return true
+}
+
+// writeCondition patches the conditions of the PodGroup in its status, unless they are up-to-date.
+// The patch carries the resourceVersion the conditions were computed from, so that it never overwrites
+// conditions written meanwhile, e.g. by the controller; on a conflict, the PodGroup is read again from
+// the API server and the patch retried.
+func (r *conditionRecorder) writeCondition(key string, condition metav1.Condition) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	pg, err := r.pgLister.PodGroups(namespace).Get(name)
+	if err != nil {
+		// The PodGroup may have been deleted meanwhile.
+		return nil
+	}
+	ctx := context.TODO()
+	pgClient := r.pgClient.SchedulingV1alpha1().PodGroups(namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if pg == nil {
+			if pg, err = pgClient.Get(ctx, name, metav1.GetOptions{}); err != nil {
+				if apierrors.IsNotFound(err) {
+					return nil
+				}
+				return err
+			}
+		}
+		if current := meta.FindStatusCondition(pg.Status.Conditions, condition.Type); current != nil &&
+			current.Status == condition.Status && current.Reason == condition.Reason && current.Message == condition.Message {
+			return nil
+		}
+
+		conditions := make([]metav1.Condition, len(pg.Status.Conditions))
+		copy(conditions, pg.Status.Conditions)
+		condition.ObservedGeneration = pg.Generation
+		meta.SetStatusCondition(&conditions, condition)
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{"resourceVersion": pg.ResourceVersion},
+			"status":   map[string]interface{}{"conditions": conditions},
+		})
+		if err != nil {
+			return err
+		}
+		_, err = pgClient.Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{}, "status")
+		// Read the PodGroup again before retrying.
+		pg = nil
+		return err
+	})
+}
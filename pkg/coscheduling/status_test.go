@@ -0,0 +1,238 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package coscheduling
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	clientsetfake "k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+	st "k8s.io/kubernetes/pkg/scheduler/testing"
+
+	"sigs.k8s.io/scheduler-plugins/apis/scheduling/v1alpha1"
+	"sigs.k8s.io/scheduler-plugins/pkg/coscheduling/core"
+	pgfake "sigs.k8s.io/scheduler-plugins/pkg/generated/clientset/versioned/fake"
+	tu "sigs.k8s.io/scheduler-plugins/test/util"
+)
+
+func TestConditionRecorder(t *testing.T) {
+	otherCondition := metav1.Condition{Type: "Other", Status: metav1.ConditionTrue, Reason: "Other", Message: "other"}
+	tests := []struct {
+		name       string
+		conditions []metav1.Condition
+		// staleConditions, if set, are the conditions in the lister, which missed the latest update.
+		staleConditions []metav1.Condition
+		record          []metav1.Condition
+		wantConditions  []metav1.Condition
+		wantPatches     int
+	}{
+		{
+			name: "only the latest condition gets written",
+			record: []metav1.Condition{
+				{Status: metav1.ConditionFalse, Reason: v1alpha1.PodGroupReasonNotEnoughMembers, Message: "not enough"},
+				{Status: metav1.ConditionFalse, Reason: v1alpha1.PodGroupReasonInsufficientResources, Message: "resource gap"},
+			},
+			wantConditions: []metav1.Condition{
+				{Type: v1alpha1.PodGroupSchedulable, Status: metav1.ConditionFalse, Reason: v1alpha1.PodGroupReasonInsufficientResources, Message: "resource gap"},
+			},
+			wantPatches: 1,
+		},
+		{
+			name: "other conditions are preserved",
+			conditions: []metav1.Condition{
+				otherCondition,
+				{Type: v1alpha1.PodGroupSchedulable, Status: metav1.ConditionFalse, Reason: v1alpha1.PodGroupReasonNotEnoughMembers, Message: "not enough"},
+			},
+			record: []metav1.Condition{
+				{Status: metav1.ConditionTrue, Reason: v1alpha1.PodGroupReasonScheduled, Message: "scheduled"},
+			},
+			wantConditions: []metav1.Condition{
+				otherCondition,
+				{Type: v1alpha1.PodGroupSchedulable, Status: metav1.ConditionTrue, Reason: v1alpha1.PodGroupReasonScheduled, Message: "scheduled"},
+			},
+			wantPatches: 1,
+		},
+		{
+			name: "up-to-date condition is not written again",
+			conditions: []metav1.Condition{
+				{Type: v1alpha1.PodGroupSchedulable, Status: metav1.ConditionFalse, Reason: v1alpha1.PodGroupReasonNotEnoughMembers, Message: "not enough"},
+			},
+			record: []metav1.Condition{
+				{Status: metav1.ConditionFalse, Reason: v1alpha1.PodGroupReasonNotEnoughMembers, Message: "not enough"},
+			},
+			wantConditions: []metav1.Condition{
+				{Type: v1alpha1.PodGroupSchedulable, Status: metav1.ConditionFalse, Reason: v1alpha1.PodGroupReasonNotEnoughMembers, Message: "not enough"},
+			},
+		},
+		{
+			name:            "conditions written meanwhile are preserved",
+			conditions:      []metav1.Condition{otherCondition},
+			staleConditions: []metav1.Condition{},
+			record: []metav1.Condition{
+				{Status: metav1.ConditionFalse, Reason: v1alpha1.PodGroupReasonNotEnoughMembers, Message: "not enough"},
+			},
+			wantConditions: []metav1.Condition{
+				otherCondition,
+				{Type: v1alpha1.PodGroupSchedulable, Status: metav1.ConditionFalse, Reason: v1alpha1.PodGroupReasonNotEnoughMembers, Message: "not enough"},
+			},
+			// The patch computed from the lister conflicts, and is retried.
+			wantPatches: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pg := tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(2).Obj()
+			pg.ResourceVersion = "2"
+			pg.Status.Conditions = tt.conditions
+			listerPG := pg
+			if tt.staleConditions != nil {
+				listerPG = pg.DeepCopy()
+				listerPG.ResourceVersion = "1"
+				listerPG.Status.Conditions = tt.staleConditions
+			}
+			pgClient := pgfake.NewSimpleClientset(pg)
+			// The fake clientset doesn't check the resourceVersion of the patches.
+			pgClient.PrependReactor("patch", "podgroups", func(action clienttesting.Action) (bool, runtime.Object, error) {
+				var patch v1alpha1.PodGroup
+				if err := json.Unmarshal(action.(clienttesting.PatchAction).GetPatch(), &patch); err != nil {
+					return true, nil, err
+				}
+				if patch.ResourceVersion != pg.ResourceVersion {
+					return true, nil, apierrors.NewConflict(v1alpha1.Resource("podgroups"), pg.Name, errors.New("stale resourceVersion"))
+				}
+				return false, nil, nil
+			})
+			r := newConditionRecorder(pgClient, tu.NewPodGroupInformer(listerPG).Lister())
+
+			for _, c := range tt.record {
+				r.record("ns/pg1", c.Status, c.Reason, c.Message)
+			}
+			r.processNextItem()
+
+			got, err := pgClient.SchedulingV1alpha1().PodGroups("ns").Get(context.TODO(), "pg1", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.wantConditions, got.Status.Conditions, cmpopts.IgnoreFields(metav1.Condition{}, "LastTransitionTime")); diff != "" {
+				t.Errorf("Unexpected conditions (-want, +got):\n%s", diff)
+			}
+			var patches int
+			for _, action := range pgClient.Actions() {
+				if action.GetVerb() == "patch" {
+					patches++
+				}
+			}
+			if patches != tt.wantPatches {
+				t.Errorf("Want %v patches, but got %v", tt.wantPatches, patches)
+			}
+		})
+	}
+}
+
+func TestPreFilterRecordsCondition(t *testing.T) {
+	nodes := []*v1.Node{
+		st.MakeNode().Name("node").Capacity(map[v1.ResourceName]string{v1.ResourceCPU: "4"}).Obj(),
+	}
+	tests := []struct {
+		name       string
+		pods       []*v1.Pod
+		pg         *v1alpha1.PodGroup
+		wantReason string
+	}{
+		{
+			name: "not enough members",
+			pods: []*v1.Pod{
+				st.MakePod().Name("p1").Namespace("ns").UID("p1").Label(v1alpha1.PodGroupLabel, "pg1").Obj(),
+			},
+			pg:         tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(2).Obj(),
+			wantReason: v1alpha1.PodGroupReasonNotEnoughMembers,
+		},
+		{
+			name: "insufficient resources",
+			pods: []*v1.Pod{
+				st.MakePod().Name("p1").Namespace("ns").UID("p1").Label(v1alpha1.PodGroupLabel, "pg1").
+					Req(map[v1.ResourceName]string{v1.ResourceCPU: "3"}).Obj(),
+				st.MakePod().Name("p2").Namespace("ns").UID("p2").Label(v1alpha1.PodGroupLabel, "pg1").
+					Req(map[v1.ResourceName]string{v1.ResourceCPU: "3"}).Obj(),
+			},
+			pg: tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(2).
+				MinResources(map[v1.ResourceName]string{v1.ResourceCPU: "4"}).Obj(),
+			wantReason: v1alpha1.PodGroupReasonInsufficientResources,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			informerFactory := informers.NewSharedInformerFactory(clientsetfake.NewSimpleClientset(), 0)
+			podInformer := informerFactory.Core().V1().Pods()
+			pgInformer := tu.NewPodGroupInformer(tt.pg)
+			pgClient := pgfake.NewSimpleClientset(tt.pg)
+			pl := &Coscheduling{
+				pgMgr:             core.NewPodGroupManager(tu.NewFakeSharedLister(nil, nodes), nil, podInformer, pgInformer),
+				conditionRecorder: newConditionRecorder(pgClient, pgInformer.Lister()),
+			}
+			for _, p := range tt.pods {
+				podInformer.Informer().GetStore().Add(p)
+			}
+
+			state := framework.NewCycleState()
+			if _, s := pl.PreFilter(ctx, state, tt.pods[0]); s.IsSuccess() {
+				t.Fatal("Want PreFilter to fail, but it succeeded")
+			}
+			// The pod rejected in PreFilter doesn't overwrite the condition in PostFilter.
+			if _, err := state.Read(rejectedStateKey); err != nil {
+				t.Errorf("Want the pod to be marked as rejected: %v", err)
+			}
+
+			done := make(chan struct{})
+			go func() {
+				pl.conditionRecorder.processNextItem()
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(wait.ForeverTestTimeout):
+				t.Fatal("Timed out waiting for the condition to be written")
+			}
+			got, err := pgClient.SchedulingV1alpha1().PodGroups("ns").Get(ctx, "pg1", metav1.GetOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Status.Conditions) != 1 || got.Status.Conditions[0].Reason != tt.wantReason ||
+				got.Status.Conditions[0].Status != metav1.ConditionFalse {
+				t.Errorf("Want a Schedulable=False condition with reason %v, but got %v", tt.wantReason, got.Status.Conditions)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cache
+
+import (
+	"fmt"
+
+	k8scache "k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	topologyv1alpha2 "github.com/k8stopologyawareschedwg/noderesourcetopology-api/pkg/apis/topology/v1alpha2"
+)
+
+// SetupNodeTopologyUpdates feeds the Node Resource Topology objects received by the informer to the cache as they
+// arrive, so a node is reconciled as soon as its topology data catches up, rather than on the next Resync().
+// The pods of the node are found through the podprovider.NodeNameIndex index of the given pod indexer.
+func SetupNodeTopologyUpdates(nrtInformer k8scache.SharedInformer, podIndexer k8scache.Indexer, ov *OverReserve) {
+	ov.podIndexer = podIndexer
+	nodeTopologyUpdated := func(obj interface{}) {
+		nrt, ok := obj.(*topologyv1alpha2.NodeResourceTopology)
+		if !ok {
+			klog.V(3).InfoS("nrtcache: update: unsupported object", "type", fmt.Sprintf("%T", obj))
+			return
+		}
+		ov.NodeTopologyUpdated(nrt)
+	}
+
+	nrtInformer.AddEventHandler(k8scache.ResourceEventHandlerFuncs{
+		AddFunc: nodeTopologyUpdated,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldNRT, ok := oldObj.(*topologyv1alpha2.NodeResourceTopology)
+			newNRT, ok2 := newObj.(*topologyv1alpha2.NodeResourceTopology)
+			if ok && ok2 && oldNRT.ResourceVersion == newNRT.ResourceVersion {
+				// periodic resync of the informer, nothing changed
+				return
+			}
+			nodeTopologyUpdated(newObj)
+		},
+	})
+}
@@ -30,6 +30,7 @@ import (
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	podlisterv1 "k8s.io/client-go/listers/core/v1"
+	k8scache "k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
 
 	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
@@ -50,8 +51,10 @@ type OverReserve struct {
 	nodesMaybeOverreserved counter
 	nodesWithForeignPods   counter
 	podLister              podlisterv1.PodLister
-	resyncMethod           apiconfig.CacheResyncMethod
-	isPodRelevant          podprovider.PodFilterFunc
+	// podIndexer finds the pods of a node on the Node Resource Topology updates, see SetupNodeTopologyUpdates.
+	podIndexer    k8scache.Indexer
+	resyncMethod  apiconfig.CacheResyncMethod
+	isPodRelevant podprovider.PodFilterFunc
 }
 
 func NewOverReserve(cfg *apiconfig.NodeResourceTopologyCache, client ctrlclient.Client, podLister podlisterv1.PodLister, isPodRelevant podprovider.PodFilterFunc) (*OverReserve, error) {
@@ -230,23 +233,7 @@ func (ov *OverReserve) Resync() {
 			continue
 		}
 
-		pfpExpected, onlyExclRes := podFingerprintForNodeTopology(nrtCandidate, ov.resyncMethod)
-		if pfpExpected == "" {
-			klog.V(3).InfoS("nrtcache: missing NodeTopology podset fingerprint data", "logID", logID, "node", nodeName)
-			continue
-		}
-
-		klog.V(6).InfoS("nrtcache: trying to resync NodeTopology", "logID", logID, "node", nodeName, "fingerprint", pfpExpected, "onlyExclusiveResources", onlyExclRes)
-
-		err = checkPodFingerprintForNode(logID, objs, nodeName, pfpExpected, onlyExclRes)
-		if errors.Is(err, podfingerprint.ErrSignatureMismatch) {
-			// can happen, not critical
-			klog.V(5).InfoS("nrtcache: NodeTopology podset fingerprint mismatch", "logID", logID, "node", nodeName)
-			continue
-		}
-		if err != nil {
-			// should never happen, let's be vocal
-			klog.V(3).ErrorS(err, "nrtcache: checking NodeTopology podset fingerprint", "logID", logID, "node", nodeName)
+		if !ov.matchesPodFingerprint(logID, nrtCandidate, objs) {
 			continue
 		}
 
@@ -257,10 +244,79 @@ func (ov *OverReserve) Resync() {
 	ov.FlushNodes(logID, nrtUpdates...)
 }
 
+// NodeTopologyUpdated applies a Node Resource Topology object received from the informer.
+// The cached data of a clean node is replaced right away. For a node with assumed resources or marked dirty,
+// the object is checked against the pods running on the node: if the podset fingerprint matches, the node is
+// Flush()ed, clearing both the assumed resources and the foreign pods mark. Otherwise the object is ignored, like
+// Resync() does, because the assumed resources may already be accounted in it: the node keeps its cached data,
+// assumed resources and marks, waiting for a later update or for the Resync() safety net.
+func (ov *OverReserve) NodeTopologyUpdated(nrt *topologyv1alpha2.NodeResourceTopology) {
+	logID := logIDFromNodeTopology(nrt)
+	nodeName := nrt.Name
+
+	ov.lock.Lock()
+	defer ov.lock.Unlock()
+	if !ov.nodeNeedsReconcile(nodeName) {
+		ov.nrts.Update(nrt)
+		return
+	}
+
+	objs, err := makeNodePodData(ov.podIndexer, ov.isPodRelevant, nodeName, logID)
+	if err != nil {
+		klog.ErrorS(err, "cannot find the running pods of node", "logID", logID, "node", nodeName)
+		return
+	}
+	if !ov.matchesPodFingerprint(logID, nrt, objs) {
+		return
+	}
+	klog.V(4).InfoS("nrtcache: overriding cached info", "logID", logID, "node", nodeName)
+	ov.flushNodes(logID, nrt)
+}
+
+// nodeNeedsReconcile tells if the node has assumed resources or is marked dirty, so if a Node Resource Topology
+// update needs to be checked against the pods running on the node before resetting the node state.
+// The caller must hold the lock.
+func (ov *OverReserve) nodeNeedsReconcile(nodeName string) bool {
+	if ov.nodesMaybeOverreserved.IsSet(nodeName) || ov.nodesWithForeignPods.IsSet(nodeName) {
+		return true
+	}
+	nodeAssumedResources, ok := ov.assumedResources[nodeName]
+	return ok && len(nodeAssumedResources.data) > 0
+}
+
+// matchesPodFingerprint checks if the podset fingerprint of the Node Resource Topology object matches the given pods.
+func (ov *OverReserve) matchesPodFingerprint(logID string, nrt *topologyv1alpha2.NodeResourceTopology, objs []podData) bool {
+	pfpExpected, onlyExclRes := podFingerprintForNodeTopology(nrt, ov.resyncMethod)
+	if pfpExpected == "" {
+		klog.V(3).InfoS("nrtcache: missing NodeTopology podset fingerprint data", "logID", logID, "node", nrt.Name)
+		return false
+	}
+
+	klog.V(6).InfoS("nrtcache: trying to resync NodeTopology", "logID", logID, "node", nrt.Name, "fingerprint", pfpExpected, "onlyExclusiveResources", onlyExclRes)
+
+	err := checkPodFingerprintForNode(logID, objs, nrt.Name, pfpExpected, onlyExclRes)
+	if errors.Is(err, podfingerprint.ErrSignatureMismatch) {
+		// can happen, not critical
+		klog.V(5).InfoS("nrtcache: NodeTopology podset fingerprint mismatch", "logID", logID, "node", nrt.Name)
+		return false
+	}
+	if err != nil {
+		// should never happen, let's be vocal
+		klog.V(3).ErrorS(err, "nrtcache: checking NodeTopology podset fingerprint", "logID", logID, "node", nrt.Name)
+		return false
+	}
+	return true
+}
+
 // FlushNodes drops all the cached information about a given node, resetting its state clean.
 func (ov *OverReserve) FlushNodes(logID string, nrts ...*topologyv1alpha2.NodeResourceTopology) {
 	ov.lock.Lock()
 	defer ov.lock.Unlock()
+	ov.flushNodes(logID, nrts...)
+}
+
+// flushNodes is FlushNodes for callers holding the lock.
+func (ov *OverReserve) flushNodes(logID string, nrts ...*topologyv1alpha2.NodeResourceTopology) {
 	for _, nrt := range nrts {
 		klog.V(4).InfoS("nrtcache: flushing", "logID", logID, "node", nrt.Name)
 		ov.nrts.Update(nrt)
@@ -286,20 +342,48 @@ func makeNodeToPodDataMap(podLister podlisterv1.PodLister, isPodRelevant podprov
 			continue
 		}
 		nodeObjs := nodeToObjsMap[pod.Spec.NodeName]
-		nodeObjs = append(nodeObjs, podData{
-			Namespace:             pod.Namespace,
-			Name:                  pod.Name,
-			HasExclusiveResources: resourcerequests.AreExclusiveForPod(pod),
-		})
+		nodeObjs = append(nodeObjs, makePodData(pod))
 		nodeToObjsMap[pod.Spec.NodeName] = nodeObjs
 	}
 	return nodeToObjsMap, nil
 }
 
+// makeNodePodData returns the data of the relevant pods of the given node, found through the node name index.
+func makeNodePodData(podIndexer k8scache.Indexer, isPodRelevant podprovider.PodFilterFunc, nodeName, logID string) ([]podData, error) {
+	if podIndexer == nil {
+		return nil, fmt.Errorf("nrtcache: missing pod indexer")
+	}
+	items, err := podIndexer.ByIndex(podprovider.NodeNameIndex, nodeName)
+	if err != nil {
+		return nil, err
+	}
+	var objs []podData
+	for _, item := range items {
+		pod, ok := item.(*corev1.Pod)
+		if !ok || !isPodRelevant(pod, logID) {
+			continue
+		}
+		objs = append(objs, makePodData(pod))
+	}
+	return objs, nil
+}
+
+func makePodData(pod *corev1.Pod) podData {
+	return podData{
+		Namespace:             pod.Namespace,
+		Name:                  pod.Name,
+		HasExclusiveResources: resourcerequests.AreExclusiveForPod(pod),
+	}
+}
+
 func logIDFromTime() string {
 	return fmt.Sprintf("resync%v", time.Now().UnixMilli())
 }
 
+func logIDFromNodeTopology(nrt *topologyv1alpha2.NodeResourceTopology) string {
+	return fmt.Sprintf("update%s@%s", nrt.Name, nrt.ResourceVersion)
+}
+
 func getCacheResyncMethod(cfg *apiconfig.NodeResourceTopologyCache) apiconfig.CacheResyncMethod {
 	var resyncMethod apiconfig.CacheResyncMethod
 	if cfg != nil && cfg.ResyncMethod != nil {
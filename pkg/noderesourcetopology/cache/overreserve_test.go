@@ -31,6 +31,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	podlisterv1 "k8s.io/client-go/listers/core/v1"
+	k8scache "k8s.io/client-go/tools/cache"
 
 	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -623,6 +624,172 @@ func TestResyncMatchFingerprint(t *testing.T) {
 	}
 }
 
+func TestNodeTopologyUpdated(t *testing.T) {
+	testPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod1",
+			Namespace: "namespace1",
+		},
+		Spec: corev1.PodSpec{
+			NodeName: "node1",
+			Containers: []corev1.Container{
+				{
+					Resources: corev1.ResourceRequirements{
+						Limits: corev1.ResourceList{
+							corev1.ResourceCPU:    resource.MustParse("8"),
+							corev1.ResourceMemory: resource.MustParse("16Gi"),
+						},
+						Requests: corev1.ResourceList{
+							corev1.ResourceCPU:    resource.MustParse("8"),
+							corev1.ResourceMemory: resource.MustParse("16Gi"),
+						},
+					},
+				},
+			},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodRunning,
+		},
+	}
+
+	makeUpdatedTopology := func(pfp string) *topologyv1alpha2.NodeResourceTopology {
+		nrt := &topologyv1alpha2.NodeResourceTopology{
+			ObjectMeta:       metav1.ObjectMeta{Name: "node1"},
+			TopologyPolicies: []string{string(topologyv1alpha2.SingleNUMANodeContainerLevel)},
+			Zones: topologyv1alpha2.ZoneList{
+				{
+					Name: "node-0",
+					Type: "Node",
+					Resources: topologyv1alpha2.ResourceInfoList{
+						MakeTopologyResInfo(cpu, "32", "30"),
+						MakeTopologyResInfo(memory, "64Gi", "60Gi"),
+						MakeTopologyResInfo(nicResourceName, "16", "16"),
+					},
+				},
+				{
+					Name: "node-1",
+					Type: "Node",
+					Resources: topologyv1alpha2.ResourceInfoList{
+						MakeTopologyResInfo(cpu, "32", "22"),
+						MakeTopologyResInfo(memory, "64Gi", "44Gi"),
+						MakeTopologyResInfo(nicResourceName, "16", "16"),
+					},
+				},
+			},
+		}
+		if pfp != "" {
+			nrt.Attributes = topologyv1alpha2.AttributeList{
+				{
+					Name:  podfingerprint.Attribute,
+					Value: pfp,
+				},
+			}
+		}
+		return nrt
+	}
+
+	tcases := []struct {
+		description   string
+		reserve       bool
+		foreignPods   bool
+		nrt           *topologyv1alpha2.NodeResourceTopology
+		expectedDirty bool
+		expectedFresh bool
+	}{
+		{
+			description:   "clean node",
+			nrt:           makeUpdatedTopology(""),
+			expectedFresh: true,
+		},
+		{
+			description:   "assumed resources with matching fingerprint",
+			reserve:       true,
+			nrt:           makeUpdatedTopology("pfp0v0019e0420efb37746c6"),
+			expectedFresh: true,
+		},
+		{
+			description:   "foreign pods with matching fingerprint",
+			foreignPods:   true,
+			nrt:           makeUpdatedTopology("pfp0v0019e0420efb37746c6"),
+			expectedFresh: true,
+		},
+		{
+			description:   "foreign pods with mismatching fingerprint",
+			foreignPods:   true,
+			nrt:           makeUpdatedTopology("pfp0v001ffffffffffffffff"),
+			expectedDirty: true,
+		},
+		{
+			description:   "foreign pods without fingerprint",
+			foreignPods:   true,
+			nrt:           makeUpdatedTopology(""),
+			expectedDirty: true,
+		},
+	}
+
+	for _, tcase := range tcases {
+		t.Run(tcase.description, func(t *testing.T) {
+			fakeClient, err := tu.NewFakeClient()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fakePodLister := &fakePodLister{}
+			fakePodLister.AddPod(testPod)
+
+			nrtCache := mustOverReserve(t, fakeClient, fakePodLister)
+			// the pods of the other nodes don't count in the fingerprint of node1.
+			otherPod := testPod.DeepCopy()
+			otherPod.Name = "pod2"
+			otherPod.Spec.NodeName = "node2"
+			nrtCache.podIndexer = k8scache.NewIndexer(k8scache.MetaNamespaceKeyFunc, k8scache.Indexers{podprovider.NodeNameIndex: podprovider.NodeNameIndexFunc})
+			for _, pod := range []*corev1.Pod{testPod, otherPod} {
+				if err := nrtCache.podIndexer.Add(pod); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			nodeTopologies := makeDefaultTestTopology()
+			for _, obj := range nodeTopologies {
+				nrtCache.Store().Update(obj)
+			}
+			// on a mismatch, the cached object is kept along with the assumed resources.
+			expectedStored := nodeTopologies[0].DeepCopy()
+			if tcase.expectedFresh {
+				expectedStored = tcase.nrt
+			}
+
+			if tcase.reserve {
+				nrtCache.ReserveNodeResources("node1", testPod)
+				nrtCache.NodeMaybeOverReserved("node1", testPod)
+			}
+			if tcase.foreignPods {
+				nrtCache.NodeHasForeignPods("node1", testPod)
+			}
+
+			nrtCache.NodeTopologyUpdated(tcase.nrt)
+
+			dirtyNodes := nrtCache.NodesMaybeOverReserved("testing")
+			if dirty := len(dirtyNodes) > 0; dirty != tcase.expectedDirty {
+				t.Errorf("expected dirty %v got dirty nodes %v", tcase.expectedDirty, dirtyNodes)
+			}
+
+			nrtObj, fresh := nrtCache.GetCachedNRTCopy(context.Background(), "node1", testPod)
+			if fresh != tcase.expectedFresh {
+				t.Fatalf("expected fresh %v got %v", tcase.expectedFresh, fresh)
+			}
+			if fresh && !isNRTEqual(nrtObj, tcase.nrt) {
+				t.Errorf("unexpected nrt from cache\ngot: %v\nexpected: %v\n", dumpNRT(nrtObj), dumpNRT(tcase.nrt))
+			}
+
+			storedObj := nrtCache.Store().GetNRTCopyByNodeName("node1")
+			if !isNRTEqual(storedObj, expectedStored) {
+				t.Errorf("unexpected stored nrt\ngot: %v\nexpected: %v\n", dumpNRT(storedObj), dumpNRT(expectedStored))
+			}
+		})
+	}
+}
+
 func isNRTEqual(a, b *topologyv1alpha2.NodeResourceTopology) bool {
 	return equality.Semantic.DeepDerivative(a.Zones, b.Zones) &&
 		equality.Semantic.DeepDerivative(a.TopologyPolicies, b.TopologyPolicies) &&
@@ -17,6 +17,9 @@ limitations under the License.
 package noderesourcetopology
 
 import (
+	"strconv"
+	"strings"
+
 	"k8s.io/klog/v2"
 	kubeletconfig "k8s.io/kubernetes/pkg/kubelet/apis/config"
 
@@ -26,10 +29,27 @@ import (
 const (
 	AttributeScope  = "topologyManagerScope"
 	AttributePolicy = "topologyManagerPolicy"
+	// AttributeThreadsPerCore is the number of hardware threads of each physical core, needed to honor
+	// the full-pcpus-only option of the CPU manager.
+	AttributeThreadsPerCore = "threadsPerCore"
+
+	// AttributePrefixTopologyManagerOption prefixes the expanded topologyManagerPolicyOptions,
+	// e.g. topologyManagerOptionPreferClosestNumaNodes.
+	AttributePrefixTopologyManagerOption = "topologyManagerOption"
+	// AttributePrefixCPUManagerPolicyOption prefixes the expanded cpuManagerPolicyOptions,
+	// e.g. cpuManagerPolicyOptionFullPcpusOnly.
+	AttributePrefixCPUManagerPolicyOption = "cpuManagerPolicyOption"
+
+	// the kubelet options, as expanded in attribute names
+	optionPreferClosestNUMANodes   = "PreferClosestNumaNodes"
+	optionMaxAllowableNUMANodes    = "MaxAllowableNumaNodes"
+	optionFullPCPUsOnly            = "FullPcpusOnly"
+	optionDistributeCPUsAcrossNUMA = "DistributeCpusAcrossNuma"
+
+	// defaultMaxAllowableNUMANodes is the default of the max-allowable-numa-nodes option of kubelet.
+	defaultMaxAllowableNUMANodes = 8
 )
 
-// TODO: handle topologyManagerPolicyOptions added in k8s 1.26
-
 func IsValidScope(scope string) bool {
 	if scope == kubeletconfig.ContainerTopologyManagerScope || scope == kubeletconfig.PodTopologyManagerScope {
 		return true
@@ -48,6 +68,31 @@ func IsValidPolicy(policy string) bool {
 type TopologyManagerConfig struct {
 	Scope  string
 	Policy string
+	// PreferClosestNUMANodes makes kubelet align the resources to the closest NUMA nodes by distance, rather than
+	// to the NUMA nodes of lowest IDs, among the sets of NUMA nodes of the same size.
+	PreferClosestNUMANodes bool
+	// MaxAllowableNUMANodes is the maximal number of NUMA nodes the resources can be aligned to, 0 for the default.
+	MaxAllowableNUMANodes int
+	// CPUManager is the configuration of the CPU manager, which allocates the CPUs within the NUMA nodes.
+	CPUManager CPUManagerConfig
+}
+
+// CPUManagerConfig holds the CPU manager policy options constraining the admission of the pods.
+type CPUManagerConfig struct {
+	// FullPCPUsOnly makes kubelet reject the containers whose exclusive CPUs don't make full physical cores.
+	FullPCPUsOnly bool
+	// DistributeCPUsAcrossNUMA makes kubelet spread evenly the CPUs of the containers needing several NUMA nodes.
+	DistributeCPUsAcrossNUMA bool
+	// ThreadsPerCore is the number of hardware threads of each physical core, 0 if unknown.
+	ThreadsPerCore int
+}
+
+// maxAllowableNUMANodes returns the maximal number of NUMA nodes the resources can be aligned to.
+func (conf TopologyManagerConfig) maxAllowableNUMANodes() int {
+	if conf.MaxAllowableNUMANodes > 0 {
+		return conf.MaxAllowableNUMANodes
+	}
+	return defaultMaxAllowableNUMANodes
 }
 
 func makeTopologyManagerConfigDefaults() TopologyManagerConfig {
@@ -76,8 +121,72 @@ func updateTopologyManagerConfigFromAttributes(conf *TopologyManagerConfig, attr
 			conf.Policy = attr.Value
 			continue
 		}
-		// TODO: handle topologyManagerPolicyOptions added in k8s 1.26
+		if attr.Name == AttributeThreadsPerCore {
+			if threads, ok := parsePositiveInt(attr.Value); ok {
+				conf.CPUManager.ThreadsPerCore = threads
+			}
+			continue
+		}
+		if option, ok := strings.CutPrefix(attr.Name, AttributePrefixTopologyManagerOption); ok {
+			updateTopologyManagerConfigFromOption(conf, option, attr.Value)
+			continue
+		}
+		if option, ok := strings.CutPrefix(attr.Name, AttributePrefixCPUManagerPolicyOption); ok {
+			updateCPUManagerConfigFromOption(&conf.CPUManager, option, attr.Value)
+			continue
+		}
+	}
+}
+
+// updateTopologyManagerConfigFromOption sets a topologyManagerPolicyOptions, ignoring the unknown options and values.
+func updateTopologyManagerConfigFromOption(conf *TopologyManagerConfig, option, value string) {
+	switch option {
+	case optionPreferClosestNUMANodes:
+		if enabled, ok := parseBoolOption(value); ok {
+			conf.PreferClosestNUMANodes = enabled
+		}
+	case optionMaxAllowableNUMANodes:
+		if maxNUMANodes, ok := parsePositiveInt(value); ok {
+			conf.MaxAllowableNUMANodes = maxNUMANodes
+		}
+	default:
+		klog.V(4).InfoS("ignoring unknown topology manager option", "option", option)
+	}
+}
+
+// updateCPUManagerConfigFromOption sets a cpuManagerPolicyOptions, ignoring the unknown options and values.
+func updateCPUManagerConfigFromOption(conf *CPUManagerConfig, option, value string) {
+	switch option {
+	case optionFullPCPUsOnly:
+		if enabled, ok := parseBoolOption(value); ok {
+			conf.FullPCPUsOnly = enabled
+		}
+	case optionDistributeCPUsAcrossNUMA:
+		if enabled, ok := parseBoolOption(value); ok {
+			conf.DistributeCPUsAcrossNUMA = enabled
+		}
+	default:
+		klog.V(4).InfoS("ignoring unknown CPU manager policy option", "option", option)
+	}
+}
+
+// parseBoolOption accepts exactly either `true` or `false`.
+func parseBoolOption(value string) (bool, bool) {
+	switch value {
+	case "true":
+		return true, true
+	case "false":
+		return false, true
+	}
+	return false, false
+}
+
+func parsePositiveInt(value string) (int, bool) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, false
 	}
+	return n, true
 }
 
 func updateTopologyManagerConfigFromTopologyPolicies(conf *TopologyManagerConfig, nodeName string, topologyPolicies []string) {
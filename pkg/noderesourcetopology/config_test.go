@@ -225,6 +225,71 @@ func TestConfigFromAttributes(t *testing.T) {
 				Policy: kubeletconfig.RestrictedTopologyManagerPolicy,
 			},
 		},
+		{
+			name: "options",
+			attrs: topologyv1alpha2.AttributeList{
+				{
+					Name:  "topologyManagerPolicy",
+					Value: "restricted",
+				},
+				{
+					Name:  "topologyManagerOptionPreferClosestNumaNodes",
+					Value: "true",
+				},
+				{
+					Name:  "topologyManagerOptionMaxAllowableNumaNodes",
+					Value: "2",
+				},
+				{
+					Name:  "cpuManagerPolicyOptionFullPcpusOnly",
+					Value: "true",
+				},
+				{
+					Name:  "cpuManagerPolicyOptionDistributeCpusAcrossNuma",
+					Value: "true",
+				},
+				{
+					Name:  "threadsPerCore",
+					Value: "2",
+				},
+			},
+			expected: TopologyManagerConfig{
+				Policy:                 kubeletconfig.RestrictedTopologyManagerPolicy,
+				PreferClosestNUMANodes: true,
+				MaxAllowableNUMANodes:  2,
+				CPUManager: CPUManagerConfig{
+					FullPCPUsOnly:            true,
+					DistributeCPUsAcrossNUMA: true,
+					ThreadsPerCore:           2,
+				},
+			},
+		},
+		{
+			name: "error-options",
+			attrs: topologyv1alpha2.AttributeList{
+				{
+					Name:  "topologyManagerOptionPreferClosestNumaNodes",
+					Value: "True",
+				},
+				{
+					Name:  "topologyManagerOptionMaxAllowableNumaNodes",
+					Value: "-1",
+				},
+				{
+					Name:  "topologyManagerOptionFoo",
+					Value: "true",
+				},
+				{
+					Name:  "cpuManagerPolicyOptionFullPcpusOnly",
+					Value: "1",
+				},
+				{
+					Name:  "threadsPerCore",
+					Value: "two",
+				},
+			},
+			expected: TopologyManagerConfig{},
+		},
 	}
 
 	for _, tt := range tests {
@@ -194,7 +194,156 @@ func singleNUMAPodLevelHandler(pod *v1.Pod, zones topologyv1alpha2.ZoneList, nod
 	return nil
 }
 
-// Filter Now only single-numa-node supported
+func restrictedContainerLevelHandler(pod *v1.Pod, zones topologyv1alpha2.ZoneList, nodeInfo *framework.NodeInfo, opts numaAlignmentOptions) *framework.Status {
+	klog.V(5).InfoS("Restricted container level handler")
+
+	nodes := createNUMANodeList(zones)
+	qos := v1qos.GetPodQOS(pod)
+
+	// Node() != nil already verified in Filter(), which is the only public entry point
+	logNumaNodes("container handler NUMA resources", nodeInfo.Node().Name, nodes)
+
+	// like in singleNUMAContainerLevelHandler, the resources of the init containers aren't accumulated.
+	for _, initContainer := range pod.Spec.InitContainers {
+		logID := fmt.Sprintf("%s/%s/%s", pod.Namespace, pod.Name, initContainer.Name)
+		klog.V(6).InfoS("target resources", stringify.ResourceListToLoggable(logID, initContainer.Resources.Requests)...)
+
+		if _, match := resourcesAvailableInMinimalNUMANodes(logID, nodes, initContainer.Resources.Requests, qos, nodeInfo, opts); !match {
+			klog.V(2).InfoS("cannot align container", "name", initContainer.Name, "kind", "init")
+			return framework.NewStatus(framework.Unschedulable, "cannot align init container")
+		}
+	}
+
+	for _, container := range pod.Spec.Containers {
+		logID := fmt.Sprintf("%s/%s/%s", pod.Namespace, pod.Name, container.Name)
+		klog.V(6).InfoS("target resources", stringify.ResourceListToLoggable(logID, container.Resources.Requests)...)
+
+		numaNodes, match := resourcesAvailableInMinimalNUMANodes(logID, nodes, container.Resources.Requests, qos, nodeInfo, opts)
+		if !match {
+			klog.V(2).InfoS("cannot align container", "name", container.Name, "kind", "app")
+			return framework.NewStatus(framework.Unschedulable, "cannot align container")
+		}
+		if numaNodes != nil {
+			// subtract the resources requested by the container from the NUMA nodes it's aligned to,
+			// so we won't allocate the same resources for the upcoming containers
+			subtractFromAlignedNUMAs(container.Resources.Requests, nodes, numaNodes, opts)
+		}
+	}
+	return nil
+}
+
+func restrictedPodLevelHandler(pod *v1.Pod, zones topologyv1alpha2.ZoneList, nodeInfo *framework.NodeInfo, opts numaAlignmentOptions) *framework.Status {
+	klog.V(5).InfoS("Restricted pod level handler")
+
+	resources := util.GetPodEffectiveRequest(pod)
+
+	logID := fmt.Sprintf("%s/%s", pod.Namespace, pod.Name)
+	nodes := createNUMANodeList(zones)
+
+	// Node() != nil already verified in Filter(), which is the only public entry point
+	logNumaNodes("pod handler NUMA resources", nodeInfo.Node().Name, nodes)
+	klog.V(6).InfoS("target resources", stringify.ResourceListToLoggable(logID, resources)...)
+
+	if _, match := resourcesAvailableInMinimalNUMANodes(logID, nodes, resources, v1qos.GetPodQOS(pod), nodeInfo, opts); !match {
+		klog.V(2).InfoS("cannot align pod", "name", pod.Name)
+		return framework.NewStatus(framework.Unschedulable, "cannot align pod")
+	}
+	return nil
+}
+
+// resourcesAvailableInMinimalNUMANodes emulates the hint merging of the restricted Topology Manager policy: kubelet
+// admits the resources only if their merged hint is preferred, that is if they can be aligned to as few NUMA nodes
+// as they would need on an idle node, and no more than the maximal number of NUMA nodes of opts. It returns the NUMA
+// nodes the resources would be aligned to, nil if none of the resources has NUMA affinity.
+// https://github.com/kubernetes/kubernetes/blob/v1.28.4/pkg/kubelet/cm/topologymanager/policy_restricted.go
+func resourcesAvailableInMinimalNUMANodes(logID string, numaNodes NUMANodeList, resources v1.ResourceList, qos v1.PodQOSClass, nodeInfo *framework.NodeInfo, opts numaAlignmentOptions) (bm.BitMask, bool) {
+	// Node() != nil already verified in Filter(), which is the only public entry point
+	nodeName := nodeInfo.Node().Name
+	nodeResources := util.ResourceList(nodeInfo.Allocatable)
+
+	numaResources := v1.ResourceList{}
+	for resource, quantity := range resources {
+		if quantity.IsZero() {
+			klog.V(4).InfoS("ignoring zero-qty resource request", "logID", logID, "node", nodeName, "resource", resource)
+			continue
+		}
+		if _, ok := nodeResources[resource]; !ok {
+			// see resourcesAvailableInAnyNUMANodes
+			klog.V(5).InfoS("early verdict: cannot meet request", "logID", logID, "node", nodeName, "resource", resource, "suitable", "false")
+			return nil, false
+		}
+		if onlyNonNUMAResources(numaNodes, v1.ResourceList{resource: quantity}) {
+			// non-native resources or ephemeral-storage may not expose NUMA affinity,
+			// but since they are available at node level, this is fine
+			if !v1helper.IsNativeResource(resource) || resource == v1.ResourceEphemeralStorage {
+				klog.V(6).InfoS("resource available at node level (no NUMA affinity)", "logID", logID, "node", nodeName, "resource", resource)
+				continue
+			}
+			klog.V(5).InfoS("early verdict: no NUMA affinity", "logID", logID, "node", nodeName, "resource", resource, "suitable", "false")
+			return nil, false
+		}
+		numaResources[resource] = quantity
+	}
+	if len(numaResources) == 0 {
+		return nil, true
+	}
+
+	required, _ := numaNodesRequired(logID, qos, numaNodes, numaResources, opts)
+	if required == nil {
+		klog.V(5).InfoS("final verdict: cannot meet request", "logID", logID, "node", nodeName, "suitable", "false")
+		return nil, false
+	}
+	// kubelet prefers the hints spanning as few NUMA nodes as the capacity of the node allows.
+	preferred, _ := numaNodesRequired(logID, qos, idleNUMANodes(numaNodes), numaResources, opts)
+	ret := preferred != nil && required.Count() <= preferred.Count()
+	klog.V(5).InfoS("final verdict", "logID", logID, "node", nodeName, "NUMA nodes", required.Count(), "suitable", ret)
+	return required, ret
+}
+
+// fullPCPUsHandler rejects the pod if a container of the pod gets exclusive CPUs which don't make full physical
+// cores while the CPU manager only allocates full physical cores. The check is skipped if the number of threads
+// of each core is unknown.
+// https://github.com/kubernetes/kubernetes/blob/v1.28.4/pkg/kubelet/cm/cpumanager/policy_static.go
+func fullPCPUsHandler(pod *v1.Pod, conf CPUManagerConfig) *framework.Status {
+	if !conf.FullPCPUsOnly || conf.ThreadsPerCore < 2 || v1qos.GetPodQOS(pod) != v1.PodQOSGuaranteed {
+		return nil
+	}
+	// the containers are checked separately, so that the slices of the pod from the informer are never written
+	for _, containers := range [][]v1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for _, container := range containers {
+			if !fullPCPUsFit(container, conf.ThreadsPerCore) {
+				return framework.NewStatus(framework.Unschedulable, "cannot allocate full physical cores")
+			}
+		}
+	}
+	return nil
+}
+
+// fullPCPUsFit tells if the exclusive CPUs of the container, if any, are made of full physical cores.
+func fullPCPUsFit(container v1.Container, threadsPerCore int) bool {
+	cpus := container.Resources.Requests[v1.ResourceCPU]
+	// only the integral CPU requests get exclusive CPUs
+	if cpus.MilliValue()%1000 != 0 {
+		return true
+	}
+	if cpus.Value()%int64(threadsPerCore) != 0 {
+		klog.V(2).InfoS("cannot allocate full physical cores", "container", container.Name, "cpus", cpus.Value(), "threadsPerCore", threadsPerCore)
+		return false
+	}
+	return true
+}
+
+// idleNUMANodes returns the NUMA nodes with all their capacity available.
+func idleNUMANodes(numaNodes NUMANodeList) NUMANodeList {
+	idle := make(NUMANodeList, len(numaNodes))
+	for i, node := range numaNodes {
+		idle[i] = NUMANode{NUMAID: node.NUMAID, Resources: node.Capacity, Capacity: node.Capacity, Costs: node.Costs}
+	}
+	return idle
+}
+
+// Filter supports the single-numa-node and restricted Topology Manager policies; kubelet admits any pod with the
+// other policies. The full-pcpus-only option of the CPU manager is honored with any policy.
 func (tm *TopologyMatch) Filter(ctx context.Context, cycleState *framework.CycleState, pod *v1.Pod, nodeInfo *framework.NodeInfo) *framework.Status {
 	if nodeInfo.Node() == nil {
 		return framework.NewStatus(framework.Error, "node not found")
@@ -215,7 +364,11 @@ func (tm *TopologyMatch) Filter(ctx context.Context, cycleState *framework.Cycle
 
 	klog.V(5).InfoS("Found NodeResourceTopology", "nodeTopology", klog.KObj(nodeTopology))
 
-	handler := filterHandlerFromTopologyManagerConfig(topologyManagerConfigFromNodeResourceTopology(nodeTopology))
+	conf := topologyManagerConfigFromNodeResourceTopology(nodeTopology)
+	if status := fullPCPUsHandler(pod, conf.CPUManager); status != nil {
+		return status
+	}
+	handler := filterHandlerFromTopologyManagerConfig(conf)
 	if handler == nil {
 		return nil
 	}
@@ -249,14 +402,27 @@ func subtractFromNUMA(nodes NUMANodeList, numaID int, container v1.Container) {
 }
 
 func filterHandlerFromTopologyManagerConfig(conf TopologyManagerConfig) filterFn {
-	if conf.Policy != kubeletconfig.SingleNumaNodeTopologyManagerPolicy {
-		return nil
-	}
-	if conf.Scope == kubeletconfig.PodTopologyManagerScope {
-		return singleNUMAPodLevelHandler
-	}
-	if conf.Scope == kubeletconfig.ContainerTopologyManagerScope {
-		return singleNUMAContainerLevelHandler
+	switch conf.Policy {
+	case kubeletconfig.SingleNumaNodeTopologyManagerPolicy:
+		if conf.Scope == kubeletconfig.PodTopologyManagerScope {
+			return singleNUMAPodLevelHandler
+		}
+		if conf.Scope == kubeletconfig.ContainerTopologyManagerScope {
+			return singleNUMAContainerLevelHandler
+		}
+	case kubeletconfig.RestrictedTopologyManagerPolicy:
+		opts := alignmentOptionsFromConfig(conf)
+		if conf.Scope == kubeletconfig.PodTopologyManagerScope {
+			return func(pod *v1.Pod, zones topologyv1alpha2.ZoneList, nodeInfo *framework.NodeInfo) *framework.Status {
+				return restrictedPodLevelHandler(pod, zones, nodeInfo, opts)
+			}
+		}
+		if conf.Scope == kubeletconfig.ContainerTopologyManagerScope {
+			return func(pod *v1.Pod, zones topologyv1alpha2.ZoneList, nodeInfo *framework.NodeInfo) *framework.Status {
+				return restrictedContainerLevelHandler(pod, zones, nodeInfo, opts)
+			}
+		}
 	}
-	return nil // cannot happen
+	// best-effort and none policies: kubelet never rejects a pod for alignment
+	return nil
 }
@@ -1178,6 +1178,149 @@ func TestNodeResourceTopologyMultiContainerContainerScope(t *testing.T) {
 	}
 }
 
+func TestNodeResourceTopologyRestricted(t *testing.T) {
+	makeNRT := func(name string, policy topologyv1alpha2.TopologyManagerPolicy, attrs ...topologyv1alpha2.AttributeInfo) *topologyv1alpha2.NodeResourceTopology {
+		return &topologyv1alpha2.NodeResourceTopology{
+			ObjectMeta:       metav1.ObjectMeta{Name: name},
+			TopologyPolicies: []string{string(policy)},
+			Attributes:       attrs,
+			Zones: topologyv1alpha2.ZoneList{
+				{
+					Name: "node-0",
+					Type: "Node",
+					Resources: topologyv1alpha2.ResourceInfoList{
+						MakeTopologyResInfo(cpu, "32", "4"),
+						MakeTopologyResInfo(memory, "64Gi", "60Gi"),
+					},
+				},
+				{
+					Name: "node-1",
+					Type: "Node",
+					Resources: topologyv1alpha2.ResourceInfoList{
+						MakeTopologyResInfo(cpu, "32", "30"),
+						MakeTopologyResInfo(memory, "64Gi", "64Gi"),
+					},
+				},
+			},
+		}
+	}
+	nodeTopologies := []*topologyv1alpha2.NodeResourceTopology{
+		makeNRT("restricted-pod", topologyv1alpha2.RestrictedPodLevel),
+		makeNRT("restricted-container", topologyv1alpha2.RestrictedContainerLevel),
+		makeNRT("best-effort", topologyv1alpha2.BestEffortPodLevel),
+		makeNRT("restricted-single-numa", topologyv1alpha2.RestrictedPodLevel,
+			topologyv1alpha2.AttributeInfo{Name: "topologyManagerOptionMaxAllowableNumaNodes", Value: "1"}),
+		makeNRT("full-pcpus", topologyv1alpha2.BestEffortPodLevel,
+			topologyv1alpha2.AttributeInfo{Name: "cpuManagerPolicyOptionFullPcpusOnly", Value: "true"},
+			topologyv1alpha2.AttributeInfo{Name: "threadsPerCore", Value: "2"}),
+	}
+
+	fakeClient, err := tu.NewFakeClient()
+	if err != nil {
+		t.Fatalf("failed to create fake client: %v", err)
+	}
+	nodes := make(map[string]*v1.Node, len(nodeTopologies))
+	for _, nrt := range nodeTopologies {
+		if err := fakeClient.Create(context.Background(), nrt.DeepCopy()); err != nil {
+			t.Fatal(err)
+		}
+		nodes[nrt.Name] = makeNodeFromNodeResourceTopology(nrt)
+	}
+	tm := TopologyMatch{
+		nrtCache: nrtcache.NewPassthrough(fakeClient),
+	}
+
+	tests := []struct {
+		description string
+		node        string
+		cntReq      []map[string]string
+		statusErr   string
+	}{
+		{
+			description: "pod fitting in a single NUMA node",
+			node:        "restricted-pod",
+			cntReq:      []map[string]string{{cpu: "2", memory: "4Gi"}, {cpu: "18", memory: "4Gi"}},
+		},
+		{
+			description: "pod needing two NUMA nodes on an idle node",
+			node:        "restricted-pod",
+			cntReq:      []map[string]string{{cpu: "34", memory: "4Gi"}},
+		},
+		{
+			description: "pod fitting in two NUMA nodes but in one on an idle node",
+			node:        "restricted-pod",
+			cntReq:      []map[string]string{{cpu: "31", memory: "4Gi"}},
+			statusErr:   "cannot align pod",
+		},
+		{
+			description: "pod over the available resources",
+			node:        "restricted-pod",
+			cntReq:      []map[string]string{{cpu: "40", memory: "4Gi"}},
+			statusErr:   "cannot align pod",
+		},
+		{
+			description: "containers each fitting in a single NUMA node",
+			node:        "restricted-container",
+			cntReq:      []map[string]string{{cpu: "20", memory: "4Gi"}, {cpu: "8", memory: "4Gi"}},
+		},
+		{
+			description: "container fitting in two NUMA nodes once the previous one is aligned",
+			node:        "restricted-container",
+			cntReq:      []map[string]string{{cpu: "20", memory: "4Gi"}, {cpu: "12", memory: "4Gi"}},
+			statusErr:   "cannot align container",
+		},
+		{
+			description: "best-effort policy",
+			node:        "best-effort",
+			cntReq:      []map[string]string{{cpu: "31", memory: "4Gi"}},
+		},
+		{
+			description: "pod needing more NUMA nodes than allowed",
+			node:        "restricted-single-numa",
+			cntReq:      []map[string]string{{cpu: "34", memory: "4Gi"}},
+			statusErr:   "cannot align pod",
+		},
+		{
+			description: "full physical cores",
+			node:        "full-pcpus",
+			cntReq:      []map[string]string{{cpu: "2", memory: "4Gi"}, {cpu: "4", memory: "4Gi"}},
+		},
+		{
+			description: "partial physical cores",
+			node:        "full-pcpus",
+			cntReq:      []map[string]string{{cpu: "2", memory: "4Gi"}, {cpu: "3", memory: "4Gi"}},
+			statusErr:   "cannot allocate full physical cores",
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.description, func(t *testing.T) {
+			pod := makePod(fmt.Sprintf("testpod%d", i), withMultiContainers(parseContainerRes(tt.cntReq)))
+			nodeInfo := framework.NewNodeInfo()
+			nodeInfo.SetNode(nodes[tt.node])
+			gotStatus := tm.Filter(context.Background(), framework.NewCycleState(), pod, nodeInfo)
+
+			if wantStatus := parseState(tt.statusErr); !reflect.DeepEqual(gotStatus, wantStatus) {
+				t.Errorf("status does not match: %v, want: %v", gotStatus, wantStatus)
+			}
+		})
+	}
+}
+
+func TestFullPCPUsHandlerKeepsPod(t *testing.T) {
+	pod := makePod("testpod", withMultiContainers(parseContainerRes([]map[string]string{{cpu: "4", memory: "4Gi"}})))
+	res := v1.ResourceList{v1.ResourceCPU: resource.MustParse("2"), v1.ResourceMemory: resource.MustParse("4Gi")}
+	// the spare capacity of the init containers is where appending the containers would write.
+	pod.Spec.InitContainers = make([]v1.Container, 1, 2)
+	pod.Spec.InitContainers[0] = v1.Container{Name: "init", Resources: v1.ResourceRequirements{Requests: res, Limits: res}}
+
+	if status := fullPCPUsHandler(pod, CPUManagerConfig{FullPCPUsOnly: true, ThreadsPerCore: 2}); status != nil {
+		t.Fatalf("unexpected status: %v", status)
+	}
+	if spare := pod.Spec.InitContainers[:2][1]; spare.Name != "" {
+		t.Errorf("the init containers of the pod were written: %v", spare.Name)
+	}
+}
+
 func makeNodeFromNodeResourceTopology(nrt *topologyv1alpha2.NodeResourceTopology) *v1.Node {
 	res := makeResourceListFromZones(nrt.Zones)
 	return &v1.Node{
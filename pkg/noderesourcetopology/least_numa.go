@@ -20,6 +20,7 @@ import (
 	"fmt"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/klog/v2"
 	v1qos "k8s.io/kubernetes/pkg/apis/core/v1/helper/qos"
 	"k8s.io/kubernetes/pkg/kubelet/cm/topologymanager/bitmask"
@@ -36,7 +37,33 @@ const (
 	maxDistanceValue = 255
 )
 
-func leastNUMAContainerScopeScore(pod *v1.Pod, zones topologyv1alpha2.ZoneList) (int64, *framework.Status) {
+// numaAlignmentOptions are the kubelet options changing the NUMA nodes the resources are aligned to.
+type numaAlignmentOptions struct {
+	// preferClosest picks the closest NUMA nodes, rather than those of lowest IDs, among the sets of the same size.
+	preferClosest bool
+	// maxNUMANodes is the maximal number of NUMA nodes the resources can be aligned to, 0 if unlimited.
+	maxNUMANodes int
+	// distributeCPUs spreads the CPUs evenly across the NUMA nodes the resources are aligned to.
+	distributeCPUs bool
+}
+
+func alignmentOptionsFromConfig(conf TopologyManagerConfig) numaAlignmentOptions {
+	return numaAlignmentOptions{
+		preferClosest:  conf.PreferClosestNUMANodes,
+		maxNUMANodes:   conf.maxAllowableNUMANodes(),
+		distributeCPUs: conf.CPUManager.DistributeCPUsAcrossNUMA,
+	}
+}
+
+// scoringAlignmentOptions returns the options the LeastNUMANodes strategy aligns the resources with: it always
+// favors the nodes offering the closest NUMA nodes, which kubelet picks with the prefer-closest-numa-nodes option.
+func scoringAlignmentOptions(conf TopologyManagerConfig) numaAlignmentOptions {
+	opts := alignmentOptionsFromConfig(conf)
+	opts.preferClosest = true
+	return opts
+}
+
+func leastNUMAContainerScopeScore(pod *v1.Pod, zones topologyv1alpha2.ZoneList, opts numaAlignmentOptions) (int64, *framework.Status) {
 	nodes := createNUMANodeList(zones)
 	qos := v1qos.GetPodQOS(pod)
 
@@ -50,7 +77,7 @@ func leastNUMAContainerScopeScore(pod *v1.Pod, zones topologyv1alpha2.ZoneList)
 			continue
 		}
 		identifier := fmt.Sprintf("%s/%s/%s", pod.Namespace, pod.Name, container.Name)
-		numaNodes, isMinAvgDistance := numaNodesRequired(identifier, qos, nodes, container.Resources.Requests)
+		numaNodes, isMinAvgDistance := numaNodesRequired(identifier, qos, nodes, container.Resources.Requests, opts)
 		// container's resources can't fit onto node, return MinNodeScore for whole pod
 		if numaNodes == nil {
 			// score plugin should be running after resource filter plugin so we should always find sufficient amount of NUMA nodes
@@ -68,7 +95,7 @@ func leastNUMAContainerScopeScore(pod *v1.Pod, zones topologyv1alpha2.ZoneList)
 
 		// subtract the resources requested by the container from the given NUMA.
 		// this is necessary, so we won't allocate the same resources for the upcoming containers
-		subtractFromNUMAs(container.Resources.Requests, nodes, numaNodes.GetBits()...)
+		subtractFromAlignedNUMAs(container.Resources.Requests, nodes, numaNodes, opts)
 	}
 
 	if maxNUMANodesCount == 0 {
@@ -78,7 +105,7 @@ func leastNUMAContainerScopeScore(pod *v1.Pod, zones topologyv1alpha2.ZoneList)
 	return normalizeScore(maxNUMANodesCount, allContainersMinAvgDistance), nil
 }
 
-func leastNUMAPodScopeScore(pod *v1.Pod, zones topologyv1alpha2.ZoneList) (int64, *framework.Status) {
+func leastNUMAPodScopeScore(pod *v1.Pod, zones topologyv1alpha2.ZoneList, opts numaAlignmentOptions) (int64, *framework.Status) {
 	nodes := createNUMANodeList(zones)
 	qos := v1qos.GetPodQOS(pod)
 
@@ -90,7 +117,7 @@ func leastNUMAPodScopeScore(pod *v1.Pod, zones topologyv1alpha2.ZoneList) (int64
 		return framework.MaxNodeScore, nil
 	}
 
-	numaNodes, isMinAvgDistance := numaNodesRequired(identifier, qos, nodes, resources)
+	numaNodes, isMinAvgDistance := numaNodesRequired(identifier, qos, nodes, resources, opts)
 	// pod's resources can't fit onto node, return MinNodeScore
 	if numaNodes == nil {
 		// score plugin should be running after resource filter plugin so we should always find sufficient amount of NUMA nodes
@@ -167,12 +194,16 @@ func combineResources(numaNodes NUMANodeList, combination []int) v1.ResourceList
 }
 
 // numaNodesRequired returns bitmask with minimal NUMA nodes required to run given resources
-// or nil when resources can't be fitted onto the worker node
+// or nil when resources can't be fitted onto the worker node within the maximal number of NUMA nodes of opts
 // second value returned is a boolean indicating if bitmask is optimal from distance perspective
-func numaNodesRequired(identifier string, qos v1.PodQOSClass, numaNodes NUMANodeList, resources v1.ResourceList) (bitmask.BitMask, bool) {
-	for bitmaskLen := 1; bitmaskLen <= len(numaNodes); bitmaskLen++ {
+func numaNodesRequired(identifier string, qos v1.PodQOSClass, numaNodes NUMANodeList, resources v1.ResourceList, opts numaAlignmentOptions) (bitmask.BitMask, bool) {
+	maxBitmaskLen := len(numaNodes)
+	if opts.maxNUMANodes > 0 && opts.maxNUMANodes < maxBitmaskLen {
+		maxBitmaskLen = opts.maxNUMANodes
+	}
+	for bitmaskLen := 1; bitmaskLen <= maxBitmaskLen; bitmaskLen++ {
 		numaNodesCombination := combin.Combinations(len(numaNodes), bitmaskLen)
-		suitableCombination, isMinDistance := findSuitableCombination(identifier, qos, numaNodes, resources, numaNodesCombination)
+		suitableCombination, isMinDistance := findSuitableCombination(identifier, qos, numaNodes, resources, numaNodesCombination, opts)
 		// we have found suitable combination for given bitmaskLen
 		if suitableCombination != nil {
 			bm := bitmask.NewEmptyBitMask()
@@ -188,8 +219,9 @@ func numaNodesRequired(identifier string, qos v1.PodQOSClass, numaNodes NUMANode
 
 // findSuitableCombination returns combination from numaNodesCombination that can fit resources, otherwise return nil
 // second value returned is a boolean indicating if returned combination is optimal from distance perspective
-// this function will always return combination that provides minimal average distance between nodes in combination
-func findSuitableCombination(identifier string, qos v1.PodQOSClass, numaNodes NUMANodeList, resources v1.ResourceList, numaNodesCombination [][]int) ([]int, bool) {
+// this function will return combination that provides minimal average distance between nodes in combination
+// if opts prefer the closest NUMA nodes, the first suitable combination otherwise, like kubelet
+func findSuitableCombination(identifier string, qos v1.PodQOSClass, numaNodes NUMANodeList, resources v1.ResourceList, numaNodesCombination [][]int, opts numaAlignmentOptions) ([]int, bool) {
 	minAvgDistance := minAvgDistanceInCombinations(numaNodes, numaNodesCombination)
 	var (
 		minDistanceCombination []int
@@ -202,9 +234,16 @@ func findSuitableCombination(identifier string, qos v1.PodQOSClass, numaNodes NU
 		}
 		combinationResources := combineResources(numaNodes, combination)
 		resourcesFit := checkResourcesFit(identifier, qos, resources, combinationResources)
+		if resourcesFit && opts.distributeCPUs {
+			resourcesFit = cpusDistributable(qos, resources, numaNodes, combination)
+		}
 
 		if resourcesFit {
 			distance := nodesAvgDistance(numaNodes, combination...)
+			if !opts.preferClosest {
+				// the combinations are generated from lowest value, which kubelet picks
+				return combination, distance == minAvgDistance
+			}
 			if distance == minAvgDistance {
 				// return early if we can fit resources into combination and provide minDistance
 				return combination, true
@@ -220,6 +259,46 @@ func findSuitableCombination(identifier string, qos v1.PodQOSClass, numaNodes NU
 	return minDistanceCombination, false
 }
 
+// cpusDistributable checks that each NUMA node of the combination can take its even share of the CPUs requested
+// by a guaranteed pod or container, like the distribute-cpus-across-numa option of the CPU manager requires.
+func cpusDistributable(qos v1.PodQOSClass, resources v1.ResourceList, numaNodes NUMANodeList, combination []int) bool {
+	cpus, ok := resources[v1.ResourceCPU]
+	if !ok || qos != v1.PodQOSGuaranteed || len(combination) < 2 {
+		return true
+	}
+	share := cpus.MilliValue() / int64(len(combination))
+	for _, nodeIndex := range combination {
+		available := numaNodes[nodeIndex].Resources[v1.ResourceCPU]
+		if available.MilliValue() < share {
+			return false
+		}
+	}
+	return true
+}
+
+// subtractFromAlignedNUMAs subtracts the resources from the NUMA nodes they are aligned to, spreading the CPUs
+// evenly across them if opts distribute them.
+func subtractFromAlignedNUMAs(resources v1.ResourceList, numaNodes NUMANodeList, aligned bitmask.BitMask, opts numaAlignmentOptions) {
+	nodes := aligned.GetBits()
+	cpus, ok := resources[v1.ResourceCPU]
+	if !opts.distributeCPUs || !ok || len(nodes) < 2 {
+		subtractFromNUMAs(resources, numaNodes, nodes...)
+		return
+	}
+	share := cpus.MilliValue() / int64(len(nodes))
+	remainder := cpus.MilliValue() % int64(len(nodes))
+	for i, node := range nodes {
+		nodeShare := share
+		if int64(i) < remainder {
+			nodeShare++
+		}
+		subtractFromNUMAs(v1.ResourceList{v1.ResourceCPU: *resource.NewMilliQuantity(nodeShare, cpus.Format)}, numaNodes, node)
+	}
+	others := resources.DeepCopy()
+	delete(others, v1.ResourceCPU)
+	subtractFromNUMAs(others, numaNodes, nodes...)
+}
+
 func checkResourcesFit(identifier string, qos v1.PodQOSClass, resources v1.ResourceList, combinationResources v1.ResourceList) bool {
 	for resource, quantity := range resources {
 		if quantity.IsZero() {
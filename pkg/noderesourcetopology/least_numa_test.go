@@ -683,7 +683,7 @@ func TestNUMANodesRequired(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.description, func(t *testing.T) {
-			bm, isMinDistance := numaNodesRequired("test", v1.PodQOSGuaranteed, tc.numaNodes, tc.podResources)
+			bm, isMinDistance := numaNodesRequired("test", v1.PodQOSGuaranteed, tc.numaNodes, tc.podResources, numaAlignmentOptions{preferClosest: true})
 
 			if bm != nil && !bm.IsEqual(tc.expectedBitmask) {
 				t.Errorf("wrong bitmask expected: %d got: %d", tc.expectedBitmask, bm)
@@ -696,6 +696,84 @@ func TestNUMANodesRequired(t *testing.T) {
 	}
 }
 
+func TestNUMANodesRequiredOptions(t *testing.T) {
+	// makeNUMANodes returns NUMA nodes with the given CPUs available and distances.
+	makeNUMANodes := func(cpus []int64, costs [][]int) NUMANodeList {
+		var numaNodes NUMANodeList
+		for i := range cpus {
+			nodeCosts := make(map[int]int)
+			for j, cost := range costs[i] {
+				nodeCosts[j] = cost
+			}
+			numaNodes = append(numaNodes, NUMANode{
+				NUMAID:    i,
+				Resources: v1.ResourceList{v1.ResourceCPU: *resource.NewQuantity(cpus[i], resource.DecimalSI)},
+				Costs:     nodeCosts,
+			})
+		}
+		return numaNodes
+	}
+	// NUMA nodes 0 and 2 are the closest
+	costs := [][]int{
+		{10, 30, 12},
+		{30, 10, 30},
+		{12, 30, 10},
+	}
+	podResources := v1.ResourceList{v1.ResourceCPU: *resource.NewQuantity(6, resource.DecimalSI)}
+
+	testCases := []struct {
+		description         string
+		numaNodes           NUMANodeList
+		opts                numaAlignmentOptions
+		expectedBitmask     bitmask.BitMask
+		expectedMinDistance bool
+	}{
+		{
+			description:     "lowest NUMA nodes",
+			numaNodes:       makeNUMANodes([]int64{4, 4, 4}, costs),
+			expectedBitmask: NewTestBitmask(0, 1),
+		},
+		{
+			description:         "closest NUMA nodes",
+			numaNodes:           makeNUMANodes([]int64{4, 4, 4}, costs),
+			opts:                numaAlignmentOptions{preferClosest: true},
+			expectedBitmask:     NewTestBitmask(0, 2),
+			expectedMinDistance: true,
+		},
+		{
+			description: "more NUMA nodes than allowed",
+			numaNodes:   makeNUMANodes([]int64{4, 4, 4}, costs),
+			opts:        numaAlignmentOptions{maxNUMANodes: 1},
+		},
+		{
+			description:         "CPUs distributed evenly",
+			numaNodes:           makeNUMANodes([]int64{4, 2, 4}, costs),
+			opts:                numaAlignmentOptions{distributeCPUs: true},
+			expectedBitmask:     NewTestBitmask(0, 2),
+			expectedMinDistance: true,
+		},
+		{
+			description:     "CPUs not distributed",
+			numaNodes:       makeNUMANodes([]int64{4, 2, 4}, costs),
+			expectedBitmask: NewTestBitmask(0, 1),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.description, func(t *testing.T) {
+			bm, isMinDistance := numaNodesRequired("test", v1.PodQOSGuaranteed, tc.numaNodes, podResources, tc.opts)
+
+			if (bm == nil) != (tc.expectedBitmask == nil) || (bm != nil && !bm.IsEqual(tc.expectedBitmask)) {
+				t.Errorf("wrong bitmask expected: %v got: %v", tc.expectedBitmask, bm)
+			}
+
+			if isMinDistance != tc.expectedMinDistance {
+				t.Errorf("wrong isMinDistance expected: %t got: %t", tc.expectedMinDistance, isMinDistance)
+			}
+		})
+	}
+}
+
 func NewTestBitmask(bits ...int) bitmask.BitMask {
 	bm, _ := bitmask.NewBitMask(bits...)
 	return bm
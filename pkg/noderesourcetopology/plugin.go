@@ -50,7 +50,9 @@ func init() {
 type NUMANode struct {
 	NUMAID    int
 	Resources v1.ResourceList
-	Costs     map[int]int
+	// Capacity is the capacity of the NUMA node, regardless of what is already allocated.
+	Capacity v1.ResourceList
+	Costs    map[int]int
 }
 
 func (n *NUMANode) WithCosts(costs map[int]int) *NUMANode {
@@ -24,11 +24,14 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
 	k8scache "k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
 	"k8s.io/kubernetes/pkg/scheduler/framework"
 
 	topologyv1alpha2 "github.com/k8stopologyawareschedwg/noderesourcetopology-api/pkg/apis/topology/v1alpha2"
+	topologyclientset "github.com/k8stopologyawareschedwg/noderesourcetopology-api/pkg/generated/clientset/versioned"
+	topologyinformers "github.com/k8stopologyawareschedwg/noderesourcetopology-api/pkg/generated/informers/externalversions"
 
 	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -66,6 +69,11 @@ func initNodeTopologyInformer(tcfg *apiconfig.NodeResourceTopologyMatchArgs, han
 
 	initNodeTopologyForeignPodsDetection(tcfg.Cache, handle, podSharedInformer, nrtCache)
 
+	if err := initNodeTopologyUpdates(handle, podSharedInformer.GetIndexer(), nrtCache); err != nil {
+		return nil, err
+	}
+
+	// the cache consumes the NodeResourceTopology updates as they arrive, the periodic resync is only a safety net.
 	resyncPeriod := time.Duration(tcfg.CacheResyncPeriodSeconds) * time.Second
 	go wait.Forever(nrtCache.Resync, resyncPeriod)
 
@@ -74,6 +82,22 @@ func initNodeTopologyInformer(tcfg *apiconfig.NodeResourceTopologyMatchArgs, han
 	return nrtCache, nil
 }
 
+func initNodeTopologyUpdates(handle framework.Handle, podIndexer k8scache.Indexer, nrtCache *nrtcache.OverReserve) error {
+	topologyClient, err := topologyclientset.NewForConfig(handle.KubeConfig())
+	if err != nil {
+		klog.ErrorS(err, "Cannot create clientset for NodeTopologyResource informer", "kubeConfig", handle.KubeConfig())
+		return err
+	}
+	nrtInformer := topologyinformers.NewSharedInformerFactory(topologyClient, 0).Topology().V1alpha2().NodeResourceTopologies()
+	// Register the NodeResourceTopology informer to the framework's informer factory, so that it gets started
+	// and synced along with the other informers before scheduling starts.
+	handle.SharedInformerFactory().InformerFor(&topologyv1alpha2.NodeResourceTopology{}, func(kubernetes.Interface, time.Duration) k8scache.SharedIndexInformer {
+		return nrtInformer.Informer()
+	})
+	nrtcache.SetupNodeTopologyUpdates(nrtInformer.Informer(), podIndexer, nrtCache)
+	return nil
+}
+
 func initNodeTopologyForeignPodsDetection(cfg *apiconfig.NodeResourceTopologyCache, handle framework.Handle, podSharedInformer k8scache.SharedInformer, nrtCache *nrtcache.OverReserve) {
 	foreignPodsDetect := getForeignPodsDetectMode(cfg)
 
@@ -118,7 +142,7 @@ func createNUMANodeList(zones topologyv1alpha2.ZoneList) NUMANodeList {
 
 		resources := extractResources(zone)
 		klog.V(6).InfoS("extracted NUMA resources", stringify.ResourceListToLoggable(zone.Name, resources)...)
-		nodes = append(nodes, NUMANode{NUMAID: numaID, Resources: resources})
+		nodes = append(nodes, NUMANode{NUMAID: numaID, Resources: resources, Capacity: extractCapacity(zone)})
 	}
 
 	// iterate over nodes and fill them with Costs
@@ -170,6 +194,19 @@ func extractCosts(costs topologyv1alpha2.CostList) map[int]int {
 	return nodeCosts
 }
 
+// extractCapacity returns the capacity of the resources of the zone, which is never less than what is available.
+func extractCapacity(zone topologyv1alpha2.Zone) corev1.ResourceList {
+	res := make(corev1.ResourceList)
+	for _, resInfo := range zone.Resources {
+		capacity := resInfo.Capacity
+		if capacity.Cmp(resInfo.Available) < 0 {
+			capacity = resInfo.Available
+		}
+		res[corev1.ResourceName(resInfo.Name)] = capacity.DeepCopy()
+	}
+	return res
+}
+
 func extractResources(zone topologyv1alpha2.Zone) corev1.ResourceList {
 	res := make(corev1.ResourceList)
 	for _, resInfo := range zone.Resources {
@@ -33,14 +33,31 @@ import (
 
 type PodFilterFunc func(pod *corev1.Pod, logID string) bool
 
+// NodeNameIndex is the name of the index of the pod informers from the node name to the pods bound to the node.
+const NodeNameIndex = "nodeName"
+
+// NodeNameIndexFunc indexes the pods by the name of the node they are bound to.
+func NodeNameIndexFunc(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok || pod.Spec.NodeName == "" {
+		return nil, nil
+	}
+	return []string{pod.Spec.NodeName}, nil
+}
+
 func NewFromHandle(handle framework.Handle, cacheConf *apiconfig.NodeResourceTopologyCache) (k8scache.SharedIndexInformer, podlisterv1.PodLister, PodFilterFunc) {
 	dedicated := wantsDedicatedInformer(cacheConf)
 	if !dedicated {
 		podHandle := handle.SharedInformerFactory().Core().V1().Pods() // shortcut
+		if _, ok := podHandle.Informer().GetIndexer().GetIndexers()[NodeNameIndex]; !ok {
+			if err := podHandle.Informer().AddIndexers(cache.Indexers{NodeNameIndex: NodeNameIndexFunc}); err != nil {
+				klog.ErrorS(err, "Failed to add the node name index to the pod informer")
+			}
+		}
 		return podHandle.Informer(), podHandle.Lister(), IsPodRelevantShared
 	}
 
-	podInformer := coreinformers.NewFilteredPodInformer(handle.ClientSet(), metav1.NamespaceAll, 0, cache.Indexers{}, nil)
+	podInformer := coreinformers.NewFilteredPodInformer(handle.ClientSet(), metav1.NamespaceAll, 0, cache.Indexers{NodeNameIndex: NodeNameIndexFunc}, nil)
 	podLister := podlisterv1.NewPodLister(podInformer.GetIndexer())
 
 	klog.V(5).InfoS("Start custom pod informer")
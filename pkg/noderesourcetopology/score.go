@@ -152,15 +152,22 @@ func containerScopeScore(pod *v1.Pod, zones topologyv1alpha2.ZoneList, scorerFn
 
 func (tm *TopologyMatch) scoringHandlerFromTopologyManagerConfig(conf TopologyManagerConfig) scoringFn {
 	if tm.scoreStrategyType == apiconfig.LeastNUMANodes {
+		opts := scoringAlignmentOptions(conf)
 		if conf.Scope == kubeletconfig.PodTopologyManagerScope {
-			return leastNUMAPodScopeScore
+			return func(pod *v1.Pod, zones topologyv1alpha2.ZoneList) (int64, *framework.Status) {
+				return leastNUMAPodScopeScore(pod, zones, opts)
+			}
 		}
 		if conf.Scope == kubeletconfig.ContainerTopologyManagerScope {
-			return leastNUMAContainerScopeScore
+			return func(pod *v1.Pod, zones topologyv1alpha2.ZoneList) (int64, *framework.Status) {
+				return leastNUMAContainerScopeScore(pod, zones, opts)
+			}
 		}
 		return nil // cannot happen
 	}
-	if conf.Policy != kubeletconfig.SingleNumaNodeTopologyManagerPolicy {
+	// with the best-effort policy, kubelet aligns the resources when it can, so the nodes are scored like with
+	// the policies rejecting the pods it can't align.
+	if conf.Policy == kubeletconfig.NoneTopologyManagerPolicy {
 		return nil
 	}
 	if conf.Scope == kubeletconfig.PodTopologyManagerScope {
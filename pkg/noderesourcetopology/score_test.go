@@ -105,6 +105,8 @@ func TestNodeResourceScorePlugin(t *testing.T) {
 		wantedRes nodeToScoreMap
 		requests  []podRequests
 		strategy  scoreStrategyFn
+		// policy is the Topology Manager policy of the nodes, single-numa-node at container scope if empty.
+		policy topologyv1alpha2.TopologyManagerPolicy
 	}
 
 	tests := []testScenario{
@@ -141,10 +143,30 @@ func TestNodeResourceScorePlugin(t *testing.T) {
 			requests:  pRequests,
 			strategy:  leastAllocatedScoreStrategy,
 		},
+		{
+			// kubelet aligns the resources when it can with the best-effort policy, so the nodes
+			// are scored the same way.
+			name:      "LeastAllocated strategy, best-effort policy",
+			wantedRes: nodeToScoreMap{"Node1": 73},
+			requests:  pRequests,
+			strategy:  leastAllocatedScoreStrategy,
+			policy:    topologyv1alpha2.BestEffortPodLevel,
+		},
+		{
+			name:      "LeastAllocated strategy, restricted policy",
+			wantedRes: nodeToScoreMap{"Node1": 73},
+			requests:  pRequests,
+			strategy:  leastAllocatedScoreStrategy,
+			policy:    topologyv1alpha2.RestrictedContainerLevel,
+		},
 	}
 
 	for _, test := range tests {
-		nodesMap, lister := initTest(defaultNUMANodes(withPolicy(topologyv1alpha2.SingleNUMANodeContainerLevel)), nrtPassthrough)
+		policy := test.policy
+		if len(policy) == 0 {
+			policy = topologyv1alpha2.SingleNUMANodeContainerLevel
+		}
+		nodesMap, lister := initTest(defaultNUMANodes(withPolicy(policy)), nrtPassthrough)
 		t.Run(test.name, func(t *testing.T) {
 			tm := &TopologyMatch{
 				scoreStrategyFunc: test.strategy,
@@ -0,0 +1,236 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/util/sets"
+	quota "k8s.io/apiserver/pkg/quota/v1"
+
+	"sigs.k8s.io/scheduler-plugins/apis/scheduling/v1alpha1"
+)
+
+// GetElasticQuotaPodSelector returns the selector of the pods subject to the ElasticQuota,
+// or nil if the ElasticQuota has no pod selector.
+func GetElasticQuotaPodSelector(eq *v1alpha1.ElasticQuota) (labels.Selector, error) {
+	if eq.Spec.PodSelector == nil {
+		return nil, nil
+	}
+	return metav1.LabelSelectorAsSelector(eq.Spec.PodSelector)
+}
+
+// GetElasticQuotaNamespaceSelector returns the selector of the namespaces the ElasticQuota applies to,
+// or nil if the ElasticQuota only applies to its own namespace.
+func GetElasticQuotaNamespaceSelector(eq *v1alpha1.ElasticQuota) (labels.Selector, error) {
+	if eq.Spec.NamespaceSelector == nil {
+		return nil, nil
+	}
+	return metav1.LabelSelectorAsSelector(eq.Spec.NamespaceSelector)
+}
+
+// GetElasticQuotaFlavorSelectors returns the selectors of the nodes of the flavors of the ElasticQuota, in the
+// order of the flavors. A flavor with an invalid node selector selects no node.
+func GetElasticQuotaFlavorSelectors(eq *v1alpha1.ElasticQuota) []labels.Selector {
+	selectors := make([]labels.Selector, len(eq.Spec.Flavors))
+	for i := range eq.Spec.Flavors {
+		selector, err := metav1.LabelSelectorAsSelector(eq.Spec.Flavors[i].NodeSelector)
+		if err != nil || eq.Spec.Flavors[i].NodeSelector == nil {
+			selector = labels.Nothing()
+		}
+		selectors[i] = selector
+	}
+	return selectors
+}
+
+// GetElasticQuotaFlavorIndex returns the index of the first of the selectors of the flavors of an ElasticQuota
+// selecting the node, given its labels, or -1 if none does.
+func GetElasticQuotaFlavorIndex(selectors []labels.Selector, nodeLabels map[string]string) int {
+	for i, selector := range selectors {
+		if selector.Matches(labels.Set(nodeLabels)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// ElasticQuotaScope describes the pods an ElasticQuota applies to.
+type ElasticQuotaScope struct {
+	// Namespace is the namespace of the ElasticQuota.
+	Namespace string
+	// Namespaces are the namespaces selected by the namespace selector of the ElasticQuota,
+	// nil if the ElasticQuota has no namespace selector.
+	Namespaces sets.String
+	// PodSelector is the pod selector of the ElasticQuota, nil if the ElasticQuota has none.
+	PodSelector labels.Selector
+}
+
+// AppliesTo checks whether the ElasticQuota applies to the pods of the namespace.
+func (s ElasticQuotaScope) AppliesTo(namespace string) bool {
+	if s.Namespaces == nil {
+		return s.Namespace == namespace
+	}
+	return s.Namespaces.Has(namespace)
+}
+
+// SelectsPod checks whether the ElasticQuota selects the pod. An ElasticQuota without pod
+// selector selects all the pods of the namespaces it applies to.
+func (s ElasticQuotaScope) SelectsPod(pod *v1.Pod) bool {
+	return s.AppliesTo(pod.Namespace) && (s.PodSelector == nil || s.PodSelector.Matches(labels.Set(pod.Labels)))
+}
+
+// rank orders the ElasticQuotas selecting a pod, from the most specific one.
+func (s ElasticQuotaScope) rank() int {
+	rank := 0
+	if s.Namespaces != nil {
+		rank += 2
+	}
+	if s.PodSelector == nil {
+		rank++
+	}
+	return rank
+}
+
+// ElasticQuotaTakesPrecedence checks whether the ElasticQuota a takes precedence over the ElasticQuota b, both
+// selecting a pod. The ElasticQuotas of the namespace of the pod take precedence over the ElasticQuotas selecting
+// its namespace, then the ElasticQuotas with a pod selector take precedence over the ElasticQuotas without, and
+// the ElasticQuota with the smallest key, made of its namespace and name, takes precedence otherwise.
+func ElasticQuotaTakesPrecedence(aKey string, a ElasticQuotaScope, bKey string, b ElasticQuotaScope) bool {
+	if a.rank() != b.rank() {
+		return a.rank() < b.rank()
+	}
+	return aKey < bKey
+}
+
+// ElasticQuotasOverlap checks whether two ElasticQuotas selecting a pod overlap, that is whether the precedence
+// between them is only decided by their keys.
+func ElasticQuotasOverlap(a, b ElasticQuotaScope) bool {
+	return a.rank() == b.rank()
+}
+
+// IsPodCountedInElasticQuota checks whether the pod counts in the usage of the ElasticQuota it is subject to,
+// that is whether it is assigned to a node and neither succeeded nor failed. Pods still pulling their images
+// and terminating pods count, since they hold the resources of their node.
+func IsPodCountedInElasticQuota(pod *v1.Pod) bool {
+	return len(pod.Spec.NodeName) != 0 && pod.Status.Phase != v1.PodSucceeded && pod.Status.Phase != v1.PodFailed
+}
+
+// GetPodElasticQuotaRequest returns the resources the pod uses from the ElasticQuota it is subject to:
+// its effective request plus its overhead.
+func GetPodElasticQuotaRequest(pod *v1.Pod) v1.ResourceList {
+	request := GetPodEffectiveRequest(pod)
+	if pod.Spec.Overhead != nil {
+		request = quota.Add(request, pod.Spec.Overhead)
+	}
+	return request
+}
+
+// ElasticQuotasMayOverlap checks statically whether two ElasticQuotas may select the same pod without one taking
+// precedence over the other, that is whether they are of the same kind and their selectors may select the same
+// pods. The namespaces actually selected by their namespace selectors aren't considered.
+func ElasticQuotasMayOverlap(a, b *v1alpha1.ElasticQuota) bool {
+	if (a.Spec.NamespaceSelector == nil) != (b.Spec.NamespaceSelector == nil) ||
+		(a.Spec.PodSelector == nil) != (b.Spec.PodSelector == nil) {
+		return false
+	}
+	if a.Spec.NamespaceSelector == nil && a.Namespace != b.Namespace {
+		return false
+	}
+	return LabelSelectorsMayOverlap(a.Spec.NamespaceSelector, b.Spec.NamespaceSelector) &&
+		LabelSelectorsMayOverlap(a.Spec.PodSelector, b.Spec.PodSelector)
+}
+
+// labelConstraint is what the requirements of a label selector on a single label allow.
+type labelConstraint struct {
+	exists, notExists bool
+	// allowed are the values the label may take, nil for any value, and forbidden those it may not take.
+	allowed, forbidden sets.String
+}
+
+// LabelSelectorsMayOverlap checks whether a set of labels may match both label selectors, that is whether the
+// selectors don't require different values for a label, nor the presence and the absence of a label. A nil
+// selector matches any labels, and an invalid selector matches none.
+func LabelSelectorsMayOverlap(a, b *metav1.LabelSelector) bool {
+	if a == nil || b == nil {
+		return true
+	}
+	constraintsA, errA := getLabelConstraints(a)
+	constraintsB, errB := getLabelConstraints(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	for key, ca := range constraintsA {
+		cb, ok := constraintsB[key]
+		if !ok {
+			continue
+		}
+		if (ca.exists || cb.exists) && (ca.notExists || cb.notExists) {
+			return false
+		}
+		if ca.allowed == nil && cb.allowed == nil {
+			continue
+		}
+		var values sets.String
+		switch {
+		case ca.allowed == nil:
+			values = cb.allowed
+		case cb.allowed == nil:
+			values = ca.allowed
+		default:
+			values = ca.allowed.Intersection(cb.allowed)
+		}
+		if values.Difference(ca.forbidden).Difference(cb.forbidden).Len() == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// getLabelConstraints returns the constraints of the label selector, by label.
+func getLabelConstraints(selector *metav1.LabelSelector) (map[string]*labelConstraint, error) {
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	requirements, _ := s.Requirements()
+	constraints := make(map[string]*labelConstraint, len(requirements))
+	for _, r := range requirements {
+		c := constraints[r.Key()]
+		if c == nil {
+			c = &labelConstraint{forbidden: sets.NewString()}
+			constraints[r.Key()] = c
+		}
+		switch r.Operator() {
+		case selection.In, selection.Equals, selection.DoubleEquals:
+			c.exists = true
+			if c.allowed == nil {
+				c.allowed = sets.NewString(r.Values().List()...)
+			} else {
+				c.allowed = c.allowed.Intersection(r.Values())
+			}
+		case selection.NotIn, selection.NotEquals:
+			c.forbidden.Insert(r.Values().List()...)
+		case selection.Exists:
+			c.exists = true
+		case selection.DoesNotExist:
+			c.notExists = true
+		}
+	}
+	return constraints, nil
+}
@@ -0,0 +1,297 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	quota "k8s.io/apiserver/pkg/quota/v1"
+)
+
+func TestElasticQuotaTakesPrecedence(t *testing.T) {
+	selector := labels.SelectorFromSet(labels.Set{"app": "training"})
+	pooled := sets.NewString("ns1", "ns2")
+	tests := []struct {
+		name     string
+		aKey     string
+		a        ElasticQuotaScope
+		bKey     string
+		b        ElasticQuotaScope
+		expected bool
+		overlap  bool
+	}{
+		{
+			name:     "quota with a pod selector takes precedence",
+			aKey:     "ns1/z",
+			a:        ElasticQuotaScope{Namespace: "ns1", PodSelector: selector},
+			bKey:     "ns1/a",
+			b:        ElasticQuotaScope{Namespace: "ns1"},
+			expected: true,
+		},
+		{
+			name: "quota without pod selector doesn't take precedence",
+			aKey: "ns1/a",
+			a:    ElasticQuotaScope{Namespace: "ns1"},
+			bKey: "ns1/z",
+			b:    ElasticQuotaScope{Namespace: "ns1", PodSelector: selector},
+		},
+		{
+			name:     "quotas with a pod selector are ordered by key",
+			aKey:     "ns1/a",
+			a:        ElasticQuotaScope{Namespace: "ns1", PodSelector: selector},
+			bKey:     "ns1/z",
+			b:        ElasticQuotaScope{Namespace: "ns1", PodSelector: selector},
+			expected: true,
+			overlap:  true,
+		},
+		{
+			name:    "quotas without pod selector are ordered by key",
+			aKey:    "ns1/z",
+			a:       ElasticQuotaScope{Namespace: "ns1"},
+			bKey:    "ns1/a",
+			b:       ElasticQuotaScope{Namespace: "ns1"},
+			overlap: true,
+		},
+		{
+			name:     "quota of the namespace takes precedence over a pooled quota",
+			aKey:     "ns1/z",
+			a:        ElasticQuotaScope{Namespace: "ns1"},
+			bKey:     "admin/a",
+			b:        ElasticQuotaScope{Namespace: "admin", Namespaces: pooled, PodSelector: selector},
+			expected: true,
+		},
+		{
+			name:     "pooled quota with a pod selector takes precedence",
+			aKey:     "admin/z",
+			a:        ElasticQuotaScope{Namespace: "admin", Namespaces: pooled, PodSelector: selector},
+			bKey:     "admin/a",
+			b:        ElasticQuotaScope{Namespace: "admin", Namespaces: pooled},
+			expected: true,
+		},
+		{
+			name:     "pooled quotas are ordered by key",
+			aKey:     "admin/a",
+			a:        ElasticQuotaScope{Namespace: "admin", Namespaces: pooled},
+			bKey:     "team/a",
+			b:        ElasticQuotaScope{Namespace: "team", Namespaces: pooled},
+			expected: true,
+			overlap:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ElasticQuotaTakesPrecedence(tt.aKey, tt.a, tt.bKey, tt.b); got != tt.expected {
+				t.Errorf("expected precedence %v, got %v", tt.expected, got)
+			}
+			if got := ElasticQuotasOverlap(tt.a, tt.b); got != tt.overlap {
+				t.Errorf("expected overlap %v, got %v", tt.overlap, got)
+			}
+		})
+	}
+}
+
+func TestElasticQuotaScopeSelectsPod(t *testing.T) {
+	selector := labels.SelectorFromSet(labels.Set{"app": "training"})
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Labels: map[string]string{"app": "training"}}}
+	tests := []struct {
+		name     string
+		scope    ElasticQuotaScope
+		expected bool
+	}{
+		{
+			name:     "quota of the namespace of the pod",
+			scope:    ElasticQuotaScope{Namespace: "ns1"},
+			expected: true,
+		},
+		{
+			name:  "quota of another namespace",
+			scope: ElasticQuotaScope{Namespace: "ns2"},
+		},
+		{
+			name:     "pooled quota selecting the namespace of the pod",
+			scope:    ElasticQuotaScope{Namespace: "admin", Namespaces: sets.NewString("ns1", "ns2"), PodSelector: selector},
+			expected: true,
+		},
+		{
+			name:  "pooled quota not selecting the namespace of the pod",
+			scope: ElasticQuotaScope{Namespace: "ns1", Namespaces: sets.NewString("ns2")},
+		},
+		{
+			name:  "quota not selecting the labels of the pod",
+			scope: ElasticQuotaScope{Namespace: "ns1", PodSelector: labels.SelectorFromSet(labels.Set{"app": "serving"})},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.scope.SelectsPod(pod); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIsPodCountedInElasticQuota(t *testing.T) {
+	tests := []struct {
+		name     string
+		nodeName string
+		phase    v1.PodPhase
+		deleted  bool
+		expected bool
+	}{
+		{
+			name:  "pod waiting to be scheduled",
+			phase: v1.PodPending,
+		},
+		{
+			name:     "pod bound and pulling its images",
+			nodeName: "node-a",
+			phase:    v1.PodPending,
+			expected: true,
+		},
+		{
+			name:     "running pod",
+			nodeName: "node-a",
+			phase:    v1.PodRunning,
+			expected: true,
+		},
+		{
+			name:     "terminating pod",
+			nodeName: "node-a",
+			phase:    v1.PodRunning,
+			deleted:  true,
+			expected: true,
+		},
+		{
+			name:     "succeeded pod",
+			nodeName: "node-a",
+			phase:    v1.PodSucceeded,
+		},
+		{
+			name:     "failed pod",
+			nodeName: "node-a",
+			phase:    v1.PodFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := &v1.Pod{Spec: v1.PodSpec{NodeName: tt.nodeName}, Status: v1.PodStatus{Phase: tt.phase}}
+			if tt.deleted {
+				pod.DeletionTimestamp = &metav1.Time{}
+			}
+			if got := IsPodCountedInElasticQuota(pod); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestGetPodElasticQuotaRequest(t *testing.T) {
+	requests := func(cpu, mem string) v1.ResourceRequirements {
+		return v1.ResourceRequirements{Requests: v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse(cpu),
+			v1.ResourceMemory: resource.MustParse(mem),
+		}}
+	}
+	pod := &v1.Pod{Spec: v1.PodSpec{
+		InitContainers: []v1.Container{{Resources: requests("2", "1Gi")}, {Resources: requests("2", "3Gi")}},
+		Containers:     []v1.Container{{Resources: requests("2", "1Gi")}, {Resources: requests("1", "1Gi")}},
+		Overhead: v1.ResourceList{
+			v1.ResourceCPU:    resource.MustParse("100m"),
+			v1.ResourceMemory: resource.MustParse("64Mi"),
+		},
+	}}
+	expected := v1.ResourceList{
+		v1.ResourceCPU:    resource.MustParse("3100m"),
+		v1.ResourceMemory: resource.MustParse("3136Mi"),
+	}
+	if got := GetPodElasticQuotaRequest(pod); !quota.Equals(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestLabelSelectorsMayOverlap(t *testing.T) {
+	matchLabels := func(key, value string) *metav1.LabelSelector {
+		return &metav1.LabelSelector{MatchLabels: map[string]string{key: value}}
+	}
+	expression := func(key string, op metav1.LabelSelectorOperator, values ...string) *metav1.LabelSelector {
+		return &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: key, Operator: op, Values: values}}}
+	}
+	tests := []struct {
+		name     string
+		a, b     *metav1.LabelSelector
+		expected bool
+	}{
+		{
+			name:     "nil selector",
+			a:        matchLabels("team", "a"),
+			expected: true,
+		},
+		{
+			name:     "different labels",
+			a:        matchLabels("team", "a"),
+			b:        matchLabels("gpu", "true"),
+			expected: true,
+		},
+		{
+			name: "different values",
+			a:    matchLabels("team", "a"),
+			b:    matchLabels("team", "b"),
+		},
+		{
+			name:     "intersecting values",
+			a:        expression("team", metav1.LabelSelectorOpIn, "a", "b"),
+			b:        expression("team", metav1.LabelSelectorOpIn, "b", "c"),
+			expected: true,
+		},
+		{
+			name: "excluded values",
+			a:    expression("team", metav1.LabelSelectorOpIn, "a", "b"),
+			b:    expression("team", metav1.LabelSelectorOpNotIn, "a", "b"),
+		},
+		{
+			name:     "partially excluded values",
+			a:        expression("team", metav1.LabelSelectorOpIn, "a", "b"),
+			b:        expression("team", metav1.LabelSelectorOpNotIn, "a"),
+			expected: true,
+		},
+		{
+			name: "existing and missing label",
+			a:    matchLabels("team", "a"),
+			b:    expression("team", metav1.LabelSelectorOpDoesNotExist),
+		},
+		{
+			name: "invalid selector",
+			a:    expression("team", metav1.LabelSelectorOpIn),
+			b:    matchLabels("team", "a"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LabelSelectorsMayOverlap(tt.a, tt.b); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+			if got := LabelSelectorsMayOverlap(tt.b, tt.a); got != tt.expected {
+				t.Errorf("expected %v with the selectors swapped, got %v", tt.expected, got)
+			}
+		})
+	}
+}
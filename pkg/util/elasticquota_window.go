@@ -0,0 +1,188 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+
+	"sigs.k8s.io/scheduler-plugins/apis/scheduling/v1alpha1"
+)
+
+// elasticQuotaWindow is an ElasticQuotaWindow parsed for evaluation.
+type elasticQuotaWindow struct {
+	location *time.Location
+	// days are the days of the week the window starts on, nil for every day.
+	days map[time.Weekday]bool
+	// start and end are the minutes of the day the window starts and ends at.
+	start, end int
+}
+
+// parseElasticQuotaWindow parses the days, times and time zone of the window.
+func parseElasticQuotaWindow(w *v1alpha1.ElasticQuotaWindow) (*elasticQuotaWindow, error) {
+	location, err := time.LoadLocation(w.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q: %w", w.TimeZone, err)
+	}
+	parsed := &elasticQuotaWindow{location: location}
+	if parsed.start, err = parseTimeOfDay(w.Start); err != nil {
+		return nil, fmt.Errorf("invalid start: %w", err)
+	}
+	if parsed.end, err = parseTimeOfDay(w.End); err != nil {
+		return nil, fmt.Errorf("invalid end: %w", err)
+	}
+	if len(w.Days) != 0 {
+		parsed.days = make(map[time.Weekday]bool, len(w.Days))
+		for _, day := range w.Days {
+			weekday, ok := weekdays[day]
+			if !ok {
+				return nil, fmt.Errorf("invalid day %q", day)
+			}
+			parsed.days[weekday] = true
+		}
+	}
+	return parsed, nil
+}
+
+var weekdays = map[v1alpha1.Weekday]time.Weekday{
+	"Sunday":    time.Sunday,
+	"Monday":    time.Monday,
+	"Tuesday":   time.Tuesday,
+	"Wednesday": time.Wednesday,
+	"Thursday":  time.Thursday,
+	"Friday":    time.Friday,
+	"Saturday":  time.Saturday,
+}
+
+// parseTimeOfDay returns the minute of the day of a time formatted as HH:MM.
+func parseTimeOfDay(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// startsOn checks whether the window starts on the day of the week.
+func (w *elasticQuotaWindow) startsOn(day time.Weekday) bool {
+	return w.days == nil || w.days[day]
+}
+
+// isActive checks whether the window is active at the given time. A window ending at or before its start
+// ends on the next day, so that it may have started the day before.
+func (w *elasticQuotaWindow) isActive(now time.Time) bool {
+	now = now.In(w.location)
+	minute := now.Hour()*60 + now.Minute()
+	if w.start < w.end {
+		return w.startsOn(now.Weekday()) && w.start <= minute && minute < w.end
+	}
+	yesterday := (now.Weekday() + 6) % 7
+	return (w.startsOn(now.Weekday()) && minute >= w.start) || (w.startsOn(yesterday) && minute < w.end)
+}
+
+// nextChange returns the first time after now the window starts or ends.
+func (w *elasticQuotaWindow) nextChange(now time.Time) time.Time {
+	local := now.In(w.location)
+	var next time.Time
+	consider := func(t time.Time) {
+		if t.After(now) && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+	// A window starting the day before may end today, and a window starts at least once a week.
+	for offset := -1; offset <= 7; offset++ {
+		day := time.Date(local.Year(), local.Month(), local.Day()+offset, 0, 0, 0, 0, w.location)
+		if !w.startsOn(day.Weekday()) {
+			continue
+		}
+		consider(time.Date(day.Year(), day.Month(), day.Day(), w.start/60, w.start%60, 0, 0, w.location))
+		endDay := day.Day()
+		if w.end <= w.start {
+			endDay++
+		}
+		consider(time.Date(day.Year(), day.Month(), endDay, w.end/60, w.end%60, 0, 0, w.location))
+	}
+	return next
+}
+
+// ValidateElasticQuotaWindow checks that the days, times and time zone of the window can be evaluated.
+func ValidateElasticQuotaWindow(w *v1alpha1.ElasticQuotaWindow) error {
+	_, err := parseElasticQuotaWindow(w)
+	return err
+}
+
+// GetActiveElasticQuotaWindow returns the first window of the ElasticQuota active at the given time, or nil.
+// The invalid windows are never active.
+func GetActiveElasticQuotaWindow(eq *v1alpha1.ElasticQuota, now time.Time) *v1alpha1.ElasticQuotaWindow {
+	for i := range eq.Spec.Windows {
+		w, err := parseElasticQuotaWindow(&eq.Spec.Windows[i])
+		if err == nil && w.isActive(now) {
+			return &eq.Spec.Windows[i]
+		}
+	}
+	return nil
+}
+
+// GetElasticQuotaBounds returns the Min and Max of the ElasticQuota in effect at the given time, along with
+// the name of its active window, or an empty name if none is active. The Min and Max of the active window
+// override those of the ElasticQuota resource by resource.
+func GetElasticQuotaBounds(eq *v1alpha1.ElasticQuota, now time.Time) (min, max v1.ResourceList, window string) {
+	active := GetActiveElasticQuotaWindow(eq, now)
+	if active == nil {
+		return eq.Spec.Min, eq.Spec.Max, ""
+	}
+	min, max = GetElasticQuotaWindowBounds(eq, active)
+	return min, max, active.Name
+}
+
+// GetElasticQuotaWindowBounds returns the Min and Max of the ElasticQuota in effect while the window is active.
+func GetElasticQuotaWindowBounds(eq *v1alpha1.ElasticQuota, w *v1alpha1.ElasticQuotaWindow) (min, max v1.ResourceList) {
+	return overrideResourceList(eq.Spec.Min, w.Min), overrideResourceList(eq.Spec.Max, w.Max)
+}
+
+// overrideResourceList returns the base list with the quantities of the resources listed in overrides replaced.
+func overrideResourceList(base, overrides v1.ResourceList) v1.ResourceList {
+	if len(overrides) == 0 {
+		return base
+	}
+	result := make(v1.ResourceList, len(base)+len(overrides))
+	for name, quant := range base {
+		result[name] = quant
+	}
+	for name, quant := range overrides {
+		result[name] = quant
+	}
+	return result
+}
+
+// NextElasticQuotaWindowChange returns the first time after now one of the valid windows of the ElasticQuota
+// starts or ends, which is when the Min and Max in effect may change, or the zero time if it has none.
+func NextElasticQuotaWindowChange(eq *v1alpha1.ElasticQuota, now time.Time) time.Time {
+	var next time.Time
+	for i := range eq.Spec.Windows {
+		w, err := parseElasticQuotaWindow(&eq.Spec.Windows[i])
+		if err != nil {
+			continue
+		}
+		if t := w.nextChange(now); !t.IsZero() && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+	return next
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	quota "k8s.io/apiserver/pkg/quota/v1"
+
+	"sigs.k8s.io/scheduler-plugins/apis/scheduling/v1alpha1"
+)
+
+func makeWindowedElasticQuota() *v1alpha1.ElasticQuota {
+	gpu := func(n int64) v1.ResourceList {
+		return v1.ResourceList{"nvidia.com/gpu": *resource.NewQuantity(n, resource.DecimalSI)}
+	}
+	return &v1alpha1.ElasticQuota{
+		Spec: v1alpha1.ElasticQuotaSpec{
+			Min: v1.ResourceList{v1.ResourceCPU: resource.MustParse("10"), "nvidia.com/gpu": resource.MustParse("2")},
+			Max: v1.ResourceList{v1.ResourceCPU: resource.MustParse("20"), "nvidia.com/gpu": resource.MustParse("4")},
+			Windows: []v1alpha1.ElasticQuotaWindow{
+				{
+					Name:     "business-hours",
+					Days:     []v1alpha1.Weekday{"Monday", "Tuesday", "Wednesday", "Thursday", "Friday"},
+					Start:    "09:00",
+					End:      "18:00",
+					TimeZone: "Europe/Paris",
+					Min:      gpu(8),
+					Max:      gpu(16),
+				},
+				{
+					Name:  "overnight",
+					Start: "22:00",
+					End:   "06:00",
+					Max:   gpu(1),
+				},
+				{
+					Name:     "invalid",
+					Start:    "00:00",
+					End:      "00:00",
+					TimeZone: "Nowhere/Atlantis",
+					Max:      gpu(0),
+				},
+			},
+		},
+	}
+}
+
+func TestGetElasticQuotaBounds(t *testing.T) {
+	eq := makeWindowedElasticQuota()
+	tests := []struct {
+		name   string
+		now    string
+		window string
+		minGPU string
+		maxGPU string
+	}{
+		{
+			// 2023-10-16 is a Monday, 08:30 UTC is 10:30 in Paris.
+			name:   "in business hours",
+			now:    "2023-10-16T08:30:00Z",
+			window: "business-hours",
+			minGPU: "8",
+			maxGPU: "16",
+		},
+		{
+			name:   "business hours in another time zone",
+			now:    "2023-10-16T06:30:00Z",
+			minGPU: "2",
+			maxGPU: "4",
+		},
+		{
+			name:   "on a Saturday",
+			now:    "2023-10-21T08:30:00Z",
+			minGPU: "2",
+			maxGPU: "4",
+		},
+		{
+			name:   "window crossing midnight, before midnight",
+			now:    "2023-10-16T23:00:00Z",
+			window: "overnight",
+			minGPU: "2",
+			maxGPU: "1",
+		},
+		{
+			name:   "window crossing midnight, after midnight",
+			now:    "2023-10-17T05:59:00Z",
+			window: "overnight",
+			minGPU: "2",
+			maxGPU: "1",
+		},
+		{
+			name:   "end of a window",
+			now:    "2023-10-17T06:00:00Z",
+			minGPU: "2",
+			maxGPU: "4",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now, err := time.Parse(time.RFC3339, tt.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			min, max, window := GetElasticQuotaBounds(eq, now)
+			if window != tt.window {
+				t.Errorf("expected window %q, got %q", tt.window, window)
+			}
+			expectedMin := v1.ResourceList{v1.ResourceCPU: resource.MustParse("10"), "nvidia.com/gpu": resource.MustParse(tt.minGPU)}
+			if !quota.Equals(min, expectedMin) {
+				t.Errorf("expected min %v, got %v", expectedMin, min)
+			}
+			expectedMax := v1.ResourceList{v1.ResourceCPU: resource.MustParse("20"), "nvidia.com/gpu": resource.MustParse(tt.maxGPU)}
+			if !quota.Equals(max, expectedMax) {
+				t.Errorf("expected max %v, got %v", expectedMax, max)
+			}
+		})
+	}
+}
+
+func TestNextElasticQuotaWindowChange(t *testing.T) {
+	eq := makeWindowedElasticQuota()
+	tests := []struct {
+		name     string
+		now      string
+		expected string
+	}{
+		{
+			name:     "before business hours",
+			now:      "2023-10-16T06:30:00Z",
+			expected: "2023-10-16T07:00:00Z",
+		},
+		{
+			name:     "in business hours",
+			now:      "2023-10-16T08:30:00Z",
+			expected: "2023-10-16T16:00:00Z",
+		},
+		{
+			name:     "at the end of business hours",
+			now:      "2023-10-16T16:00:00Z",
+			expected: "2023-10-16T22:00:00Z",
+		},
+		{
+			name:     "overnight",
+			now:      "2023-10-16T23:00:00Z",
+			expected: "2023-10-17T06:00:00Z",
+		},
+		{
+			name:     "on a Saturday morning",
+			now:      "2023-10-21T06:00:00Z",
+			expected: "2023-10-21T22:00:00Z",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now, err := time.Parse(time.RFC3339, tt.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected, err := time.Parse(time.RFC3339, tt.expected)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := NextElasticQuotaWindowChange(eq, now); !got.Equal(expected) {
+				t.Errorf("expected %v, got %v", expected, got.UTC())
+			}
+		})
+	}
+
+	if got := NextElasticQuotaWindowChange(&v1alpha1.ElasticQuota{}, time.Now()); !got.IsZero() {
+		t.Errorf("expected no change without windows, got %v", got)
+	}
+}
+
+func TestValidateElasticQuotaWindow(t *testing.T) {
+	eq := makeWindowedElasticQuota()
+	for i, expectErr := range []bool{false, false, true} {
+		if err := ValidateElasticQuotaWindow(&eq.Spec.Windows[i]); (err != nil) != expectErr {
+			t.Errorf("%v: expected error %v, got %v", eq.Spec.Windows[i].Name, expectErr, err)
+		}
+	}
+	if err := ValidateElasticQuotaWindow(&v1alpha1.ElasticQuotaWindow{Start: "9:00", End: "25:00"}); err == nil {
+		t.Errorf("expected an error for invalid times")
+	}
+}
@@ -0,0 +1,37 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/cache"
+)
+
+// InformerContext returns a context done once the informer stops. The scheduler doesn't pass its context
+// to the plugins, but runs its informers until it is done.
+func InformerContext(informer cache.SharedIndexInformer) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	go wait.Until(func() {
+		if informer.IsStopped() {
+			cancel()
+		}
+	}, time.Second, ctx.Done())
+	return ctx
+}
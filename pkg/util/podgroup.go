@@ -22,14 +22,58 @@ import (
 	"time"
 
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/util/strategicpatch"
 
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+
 	"sigs.k8s.io/scheduler-plugins/apis/scheduling/v1alpha1"
 )
 
 // DefaultWaitTime is 60s if ScheduleTimeoutSeconds is not specified.
 const DefaultWaitTime = 60 * time.Second
 
+// podGroupRejectedStateKey is the key in CycleState of the callbacks run when the PodGroup of the pod gets rejected.
+const podGroupRejectedStateKey framework.StateKey = "PodGroupRejected"
+
+// podGroupRejectedState holds the callbacks run when the PodGroup of the pod gets rejected.
+type podGroupRejectedState struct {
+	callbacks []func()
+}
+
+// Clone the PodGroup rejected state.
+func (s *podGroupRejectedState) Clone() framework.StateData {
+	return s
+}
+
+// OnPodGroupRejected registers f to run when the PodGroup of the pod scheduled in the cycle gets rejected,
+// e.g. to release what the plugin holds on behalf of the PodGroup.
+func OnPodGroupRejected(state *framework.CycleState, f func()) {
+	var s *podGroupRejectedState
+	if data, err := state.Read(podGroupRejectedStateKey); err == nil {
+		s = data.(*podGroupRejectedState)
+	} else {
+		s = &podGroupRejectedState{}
+		state.Write(podGroupRejectedStateKey, s)
+	}
+	s.callbacks = append(s.callbacks, f)
+}
+
+// RejectPodGroup runs the callbacks registered with OnPodGroupRejected, once the PodGroup of the pod
+// scheduled in the cycle gets rejected.
+func RejectPodGroup(state *framework.CycleState) {
+	data, err := state.Read(podGroupRejectedStateKey)
+	if err != nil {
+		return
+	}
+	s := data.(*podGroupRejectedState)
+	callbacks := s.callbacks
+	s.callbacks = nil
+	for _, f := range callbacks {
+		f()
+	}
+}
+
 // CreateMergePatch return patch generated from original and new interfaces
 func CreateMergePatch(original, new interface{}) ([]byte, error) {
 	pvByte, err := json.Marshal(original)
@@ -74,3 +118,52 @@ func GetWaitTimeDuration(pg *v1alpha1.PodGroup, scheduleTimeout *time.Duration)
 	}
 	return DefaultWaitTime
 }
+
+// GetPodGroupRole get the role of a pod in its pod group from pod labels
+func GetPodGroupRole(pod *v1.Pod) string {
+	return pod.Labels[v1alpha1.PodGroupRoleLabel]
+}
+
+// GetMinMember returns the minimal number of pods to run the podgroup: the greater of its minMember
+// and the sum of the minMember of its roles.
+func GetMinMember(pg *v1alpha1.PodGroup) int32 {
+	var inRoles int32
+	for _, role := range pg.Spec.Roles {
+		inRoles += role.MinMember
+	}
+	if inRoles > pg.Spec.MinMember {
+		return inRoles
+	}
+	return pg.Spec.MinMember
+}
+
+// GetMinResources returns the minimal resources to run the podgroup, including the number of pods.
+// For each resource, the greater of the minResources of the podgroup and the sum of the minResources
+// of its roles is used. It returns nil if neither the podgroup nor its roles define minResources.
+func GetMinResources(pg *v1alpha1.PodGroup) v1.ResourceList {
+	var minResources v1.ResourceList
+	if pg.Spec.MinResources != nil {
+		minResources = pg.Spec.MinResources.DeepCopy()
+	}
+	inRoles := make(v1.ResourceList)
+	for _, role := range pg.Spec.Roles {
+		for name, quant := range role.MinResources {
+			sum := inRoles[name]
+			sum.Add(quant)
+			inRoles[name] = sum
+		}
+	}
+	if minResources == nil && len(inRoles) == 0 {
+		return nil
+	}
+	if minResources == nil {
+		minResources = make(v1.ResourceList)
+	}
+	for name, quant := range inRoles {
+		if current, ok := minResources[name]; !ok || quant.Cmp(current) > 0 {
+			minResources[name] = quant
+		}
+	}
+	minResources[v1.ResourcePods] = *resource.NewQuantity(int64(GetMinMember(pg)), resource.DecimalSI)
+	return minResources
+}
@@ -19,7 +19,12 @@ package util
 import (
 	"testing"
 
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/kubernetes/pkg/apis/core"
+
+	"sigs.k8s.io/scheduler-plugins/apis/scheduling/v1alpha1"
+	tu "sigs.k8s.io/scheduler-plugins/test/util"
 )
 
 func TestCreateMergePatch(t *testing.T) {
@@ -70,3 +75,51 @@ func TestCreateMergePatch(t *testing.T) {
 		}
 	}
 }
+
+func TestGetMinResources(t *testing.T) {
+	tests := []struct {
+		name string
+		pg   *v1alpha1.PodGroup
+		want v1.ResourceList
+	}{
+		{
+			name: "no minResources",
+			pg:   tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(2).Role("worker", 1, nil).Obj(),
+		},
+		{
+			name: "minResources of the pod group",
+			pg: tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(2).
+				MinResources(map[v1.ResourceName]string{v1.ResourceCPU: "2"}).Obj(),
+			want: v1.ResourceList{
+				v1.ResourceCPU:  resource.MustParse("2"),
+				v1.ResourcePods: resource.MustParse("2"),
+			},
+		},
+		{
+			name: "minResources of the roles are summed up",
+			pg: tu.MakePodGroup().Name("pg1").Namespace("ns").MinMember(2).
+				MinResources(map[v1.ResourceName]string{v1.ResourceCPU: "2", v1.ResourceMemory: "4Gi"}).
+				Role("launcher", 1, map[v1.ResourceName]string{v1.ResourceCPU: "1"}).
+				Role("worker", 2, map[v1.ResourceName]string{v1.ResourceCPU: "2", v1.ResourceMemory: "1Gi"}).Obj(),
+			want: v1.ResourceList{
+				v1.ResourceCPU:    resource.MustParse("3"),
+				v1.ResourceMemory: resource.MustParse("4Gi"),
+				v1.ResourcePods:   resource.MustParse("3"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := GetMinResources(tt.pg)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Want %v, but got %v", tt.want, got)
+			}
+			for name, quant := range tt.want {
+				if q, ok := got[name]; !ok || q.Cmp(quant) != 0 {
+					t.Errorf("Want %v, but got %v", tt.want, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2023 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	policy "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+)
+
+// dryRunStateKey is the key in CycleState marking the cycles which only simulate the scheduling of a pod.
+const dryRunStateKey framework.StateKey = "DryRun"
+
+// dryRunState is written in the CycleState of the cycles which only simulate the scheduling of a pod.
+type dryRunState struct{}
+
+// Clone the dry run state.
+func (s *dryRunState) Clone() framework.StateData {
+	return s
+}
+
+// NewDryRunCycleState returns a CycleState to simulate the scheduling of a pod on behalf of another one,
+// e.g. of the members of a PodGroup during gang preemption. The plugins must not change the state they
+// share with the other cycles, such as the reservations they hold, while running such a cycle.
+func NewDryRunCycleState() *framework.CycleState {
+	state := framework.NewCycleState()
+	state.Write(dryRunStateKey, &dryRunState{})
+	return state
+}
+
+// IsDryRun checks whether the CycleState was returned by NewDryRunCycleState.
+func IsDryRun(state *framework.CycleState) bool {
+	if state == nil {
+		return false
+	}
+	_, err := state.Read(dryRunStateKey)
+	return err == nil
+}
+
+// FilterPodsWithPDBViolation groups the given "pods" into two groups of "violatingPods"
+// and "nonViolatingPods" based on whether their PDBs will be violated if they are
+// preempted.
+// This function is stable and does not change the order of received pods. So, if it
+// receives a sorted list, grouping will preserve the order of the input list.
+func FilterPodsWithPDBViolation(podInfos []*framework.PodInfo, pdbs []*policy.PodDisruptionBudget) (violatingPods, nonViolatingPods []*framework.PodInfo) {
+	pdbsAllowed := make([]int32, len(pdbs))
+	for i, pdb := range pdbs {
+		pdbsAllowed[i] = pdb.Status.DisruptionsAllowed
+	}
+
+	for _, podInfo := range podInfos {
+		pod := podInfo.Pod
+		pdbForPodIsViolated := false
+		// A pod with no labels will not match any PDB. So, no need to check.
+		if len(pod.Labels) != 0 {
+			for i, pdb := range pdbs {
+				if pdb.Namespace != pod.Namespace {
+					continue
+				}
+				selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+				if err != nil {
+					continue
+				}
+				// A PDB with a nil or empty selector matches nothing.
+				if selector.Empty() || !selector.Matches(labels.Set(pod.Labels)) {
+					continue
+				}
+
+				// Existing in DisruptedPods means it has been processed in API server,
+				// we don't treat it as a violating case.
+				if _, exist := pdb.Status.DisruptedPods[pod.Name]; exist {
+					continue
+				}
+				// Only decrement the matched pdb when it's not in its <DisruptedPods>;
+				// otherwise we may over-decrement the budget number.
+				pdbsAllowed[i]--
+				// We have found a matching PDB.
+				if pdbsAllowed[i] < 0 {
+					pdbForPodIsViolated = true
+				}
+			}
+		}
+		if pdbForPodIsViolated {
+			violatingPods = append(violatingPods, podInfo)
+		} else {
+			nonViolatingPods = append(nonViolatingPods, podInfo)
+		}
+	}
+	return violatingPods, nonViolatingPods
+}
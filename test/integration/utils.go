@@ -122,6 +122,14 @@ func (p *podWrapper) InitContainerRequest(request v1.ResourceList) *podWrapper {
 	return p
 }
 
+func (p *podWrapper) Label(key, value string) *podWrapper {
+	if p.Pod.Labels == nil {
+		p.Pod.Labels = make(map[string]string)
+	}
+	p.Pod.Labels[key] = value
+	return p
+}
+
 func (p *podWrapper) Node(name string) *podWrapper {
 	p.Pod.Spec.NodeName = name
 	return p
@@ -158,6 +166,36 @@ func (e *eqWrapper) Used(used v1.ResourceList) *eqWrapper {
 	return e
 }
 
+func (e *eqWrapper) Parent(namespace, name string) *eqWrapper {
+	e.ElasticQuota.Spec.Parent = &v1alpha1.ElasticQuotaReference{Namespace: namespace, Name: name}
+	return e
+}
+
+func (e *eqWrapper) PodSelector(selector *metav1.LabelSelector) *eqWrapper {
+	e.ElasticQuota.Spec.PodSelector = selector
+	return e
+}
+
+func (e *eqWrapper) NamespaceSelector(selector *metav1.LabelSelector) *eqWrapper {
+	e.ElasticQuota.Spec.NamespaceSelector = selector
+	return e
+}
+
+func (e *eqWrapper) BorrowingLimit(limit v1.ResourceList) *eqWrapper {
+	e.ElasticQuota.Spec.BorrowingLimit = limit
+	return e
+}
+
+func (e *eqWrapper) LendingLimit(limit v1.ResourceList) *eqWrapper {
+	e.ElasticQuota.Spec.LendingLimit = limit
+	return e
+}
+
+func (e *eqWrapper) AggregatedUsed(used v1.ResourceList) *eqWrapper {
+	e.ElasticQuota.Status.AggregatedUsed = used
+	return e
+}
+
 func (e *eqWrapper) Obj() *v1alpha1.ElasticQuota {
 	return e.ElasticQuota
 }
@@ -30,6 +30,9 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/scheduler-plugins/apis/scheduling/v1alpha1"
+	pgfake "sigs.k8s.io/scheduler-plugins/pkg/generated/clientset/versioned/fake"
+	schedinformer "sigs.k8s.io/scheduler-plugins/pkg/generated/informers/externalversions"
+	pginformer "sigs.k8s.io/scheduler-plugins/pkg/generated/informers/externalversions/scheduling/v1alpha1"
 
 	topologyv1alpha2 "github.com/k8stopologyawareschedwg/noderesourcetopology-api/pkg/apis/topology/v1alpha2"
 )
@@ -288,6 +291,16 @@ func NewFakeClient(objs ...runtime.Object) (client.Client, error) {
 	return fake.NewClientBuilder().WithScheme(scheme).WithRuntimeObjects(objs...).Build(), nil
 }
 
+// NewPodGroupInformer returns a PodGroup informer holding the given PodGroups in its store.
+// The informer is not meant to be started. This function is used by unit tests.
+func NewPodGroupInformer(pgs ...*v1alpha1.PodGroup) pginformer.PodGroupInformer {
+	informer := schedinformer.NewSharedInformerFactory(pgfake.NewSimpleClientset(), 0).Scheduling().V1alpha1().PodGroups()
+	for _, pg := range pgs {
+		informer.Informer().GetStore().Add(pg)
+	}
+	return informer
+}
+
 // NewClientOrDie returns a generic controller-runtime client or panic upon any error.
 // This function is used by integration tests.
 func NewClientOrDie(cfg *rest.Config) client.Client {
@@ -68,3 +68,25 @@ func (p *PodGroupWrapper) Phase(phase v1alpha1.PodGroupPhase) *PodGroupWrapper {
 	p.Status.Phase = phase
 	return p
 }
+
+func (p *PodGroupWrapper) TopologyConstraint(topologyKey string, mode v1alpha1.TopologyConstraintMode) *PodGroupWrapper {
+	p.Spec.TopologyConstraint = &v1alpha1.TopologyConstraint{TopologyKey: topologyKey, Mode: mode}
+	return p
+}
+
+func (p *PodGroupWrapper) Role(name string, minMember int32, minResources map[v1.ResourceName]string) *PodGroupWrapper {
+	role := v1alpha1.PodGroupRole{Name: name, MinMember: minMember}
+	if minResources != nil {
+		role.MinResources = make(v1.ResourceList)
+		for name, value := range minResources {
+			role.MinResources[name] = resource.MustParse(value)
+		}
+	}
+	p.Spec.Roles = append(p.Spec.Roles, role)
+	return p
+}
+
+func (p *PodGroupWrapper) MaxMember(i int32) *PodGroupWrapper {
+	p.Spec.MaxMember = &i
+	return p
+}